@@ -54,8 +54,14 @@ func (db *DB) AddDatabaseTables() error {
 		&UsageData{},
 		&shared.DumpRequest{},
 		&shared.DeletionRequest{},
+		&shared.EncSettings{},
 		&shared.Feedback{},
 		&ActiveUserStats{},
+		&shared.Team{},
+		&shared.TeamMember{},
+		&shared.TeamHistoryEntry{},
+		&shared.SharingPublicKey{},
+		&shared.SharedHistoryEntry{},
 	}
 
 	for _, model := range models {
@@ -297,6 +303,23 @@ func (db *DB) DeletionRequestsForUserAndDevice(ctx context.Context, userID, devi
 	return deletionRequests, nil
 }
 
+// Returns, for each destination device, the minimum read count across all deletion requests for the
+// given user that were sent at or after the given time. A read count of zero means that the device has
+// not yet downloaded (and thus not yet applied) the deletion. Used to power `hishtory redact --verify`.
+func (db *DB) DeletionRequestStatuses(ctx context.Context, userID string, sentAfter time.Time) ([]shared.DeletionRequestStatus, error) {
+	var statuses []shared.DeletionRequestStatus
+	tx := db.WithContext(ctx).Model(&shared.DeletionRequest{}).
+		Select("destination_device_id as device_id, min(read_count) as read_count").
+		Where("user_id = ? AND send_time >= ?", userID, sentAfter).
+		Group("destination_device_id").
+		Scan(&statuses)
+	if tx.Error != nil {
+		return nil, fmt.Errorf("tx.Error: %w", tx.Error)
+	}
+
+	return statuses, nil
+}
+
 func (db *DB) DeletionRequestCreate(ctx context.Context, request *shared.DeletionRequest) error {
 	userID := request.UserId
 
@@ -333,6 +356,34 @@ func (db *DB) DeletionRequestCreate(ctx context.Context, request *shared.Deletio
 	return nil
 }
 
+// Create or update the encrypted settings document for the given user. Each user has at
+// most one settings document, so newer uploads replace older ones.
+func (db *DB) SettingsUpsert(ctx context.Context, settings *shared.EncSettings) error {
+	tx := db.WithContext(ctx).Where("user_id = ?", settings.UserId).Delete(&shared.EncSettings{})
+	if tx.Error != nil {
+		return fmt.Errorf("tx.Error: %w", tx.Error)
+	}
+	tx = db.WithContext(ctx).Create(settings)
+	if tx.Error != nil {
+		return fmt.Errorf("tx.Error: %w", tx.Error)
+	}
+
+	return nil
+}
+
+func (db *DB) SettingsForUser(ctx context.Context, userID string) (*shared.EncSettings, error) {
+	var settings []*shared.EncSettings
+	tx := db.WithContext(ctx).Where("user_id = ?", userID).Limit(1).Find(&settings)
+	if tx.Error != nil {
+		return nil, fmt.Errorf("tx.Error: %w", tx.Error)
+	}
+	if len(settings) == 0 {
+		return nil, nil
+	}
+
+	return settings[0], nil
+}
+
 func (db *DB) FeedbackCreate(ctx context.Context, feedback *shared.Feedback) error {
 	tx := db.WithContext(ctx).Create(feedback)
 	if tx.Error != nil {
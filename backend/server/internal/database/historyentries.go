@@ -3,6 +3,7 @@ package database
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/ddworken/hishtory/shared"
 
@@ -11,6 +12,15 @@ import (
 
 func (db *DB) CountApproximateHistoryEntries(ctx context.Context) (int64, error) {
 	var numDbEntries int64
+	if db.Name() == "sqlite" {
+		// sqlite doesn't have pg_class, so run an exact count, which is fast enough at the scale
+		// that sqlite deployments run at
+		err := db.WithContext(ctx).Raw("SELECT COUNT(*) FROM enc_history_entries").Row().Scan(&numDbEntries)
+		if err != nil {
+			return 0, fmt.Errorf("DB Error: %w", err)
+		}
+		return numDbEntries, nil
+	}
 	err := db.WithContext(ctx).Raw("SELECT reltuples::bigint FROM pg_class WHERE relname = 'enc_history_entries'").Row().Scan(&numDbEntries)
 	if err != nil {
 		return 0, fmt.Errorf("DB Error: %w", err)
@@ -42,6 +52,34 @@ func (db *DB) AllHistoryEntriesForUser(ctx context.Context, userID string) ([]*s
 	return dedupedEntries, nil
 }
 
+// AllHistoryEntriesForUserPaginated returns one page of the user's (deduplicated) history
+// entries, ordered by (date, encrypted_id) and starting after the given cursor. Used for
+// bootstrapping new devices with very large histories incrementally, rather than in one giant
+// response that risks OOMing and timing out. With descending=true the newest entries come first,
+// which is used for lazily fetching recent entries while the initial sync is still incomplete.
+func (db *DB) AllHistoryEntriesForUserPaginated(ctx context.Context, userID string, cursorDate time.Time, cursorEntryId string, limit int, descending bool) ([]*shared.EncHistoryEntry, error) {
+	var historyEntries []*shared.EncHistoryEntry
+	// Deduplicate the per-device copies of each entry in the query itself (they share an
+	// encrypted_id and identical ciphertext), so that pages aren't full of duplicates
+	tx := db.WithContext(ctx).Model(&shared.EncHistoryEntry{}).
+		Distinct("encrypted_id", "date", "enc_data", "nonce").
+		Where("user_id = ?", userID)
+	if descending {
+		if cursorEntryId != "" {
+			tx = tx.Where("(date, encrypted_id) < (?, ?)", cursorDate, cursorEntryId)
+		}
+		tx = tx.Order("date DESC, encrypted_id DESC")
+	} else {
+		tx = tx.Where("(date, encrypted_id) > (?, ?)", cursorDate, cursorEntryId).Order("date, encrypted_id")
+	}
+	tx = tx.Limit(limit).Find(&historyEntries)
+	if tx.Error != nil {
+		return nil, fmt.Errorf("tx.Error: %w", tx.Error)
+	}
+
+	return historyEntries, nil
+}
+
 func (db *DB) HistoryEntriesForDevice(ctx context.Context, deviceID string, limit int) ([]*shared.EncHistoryEntry, error) {
 	var historyEntries []*shared.EncHistoryEntry
 	tx := db.WithContext(ctx).Where("device_id = ? AND read_count < ? AND NOT is_from_same_device", deviceID, limit).Find(&historyEntries)
@@ -85,6 +123,33 @@ func (db *DB) AddHistoryEntriesForAllDevices(ctx context.Context, sourceDeviceId
 	})
 }
 
+// EntryIdsMissingForUser returns the subset of the given entry IDs that have no stored history
+// entry for the given user. Used by the manifest diffing endpoint so that `hishtory reupload`
+// only uploads the entries that the backend is actually missing.
+func (db *DB) EntryIdsMissingForUser(ctx context.Context, userID string, entryIds []string) ([]string, error) {
+	presentIds := make(map[string]bool)
+	// Chunk the query to stay under the DB's limit on the number of bound parameters
+	chunkSize := 1000
+	for _, entryIdsChunk := range shared.Chunks(entryIds, chunkSize) {
+		var foundIds []string
+		tx := db.WithContext(ctx).Model(&shared.EncHistoryEntry{}).Where("user_id = ? AND encrypted_id IN ?", userID, entryIdsChunk).Distinct().Pluck("encrypted_id", &foundIds)
+		if tx.Error != nil {
+			return nil, fmt.Errorf("tx.Error: %w", tx.Error)
+		}
+		for _, id := range foundIds {
+			presentIds[id] = true
+		}
+	}
+	missingIds := make([]string, 0)
+	for _, id := range entryIds {
+		if !presentIds[id] {
+			missingIds = append(missingIds, id)
+		}
+	}
+
+	return missingIds, nil
+}
+
 func (db *DB) Unsafe_DeleteAllHistoryEntries(ctx context.Context) error {
 	tx := db.WithContext(ctx).Exec("DELETE FROM enc_history_entries")
 	if tx.Error != nil {
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ddworken/hishtory/shared"
+
+	"gorm.io/gorm"
+)
+
+// Create or update the published sharing public key for the given user. Each user has at most
+// one sharing public key, so newer uploads replace older ones.
+func (db *DB) SharingPublicKeyUpsert(ctx context.Context, publicKey *shared.SharingPublicKey) error {
+	tx := db.WithContext(ctx).Where("user_id = ?", publicKey.UserId).Delete(&shared.SharingPublicKey{})
+	if tx.Error != nil {
+		return fmt.Errorf("tx.Error: %w", tx.Error)
+	}
+	tx = db.WithContext(ctx).Create(publicKey)
+	if tx.Error != nil {
+		return fmt.Errorf("tx.Error: %w", tx.Error)
+	}
+
+	return nil
+}
+
+func (db *DB) SharingPublicKeyForUser(ctx context.Context, userID string) (*shared.SharingPublicKey, error) {
+	var publicKeys []*shared.SharingPublicKey
+	tx := db.WithContext(ctx).Where("user_id = ?", userID).Limit(1).Find(&publicKeys)
+	if tx.Error != nil {
+		return nil, fmt.Errorf("tx.Error: %w", tx.Error)
+	}
+	if len(publicKeys) == 0 {
+		return nil, nil
+	}
+
+	return publicKeys[0], nil
+}
+
+func (db *DB) SharedEntriesAdd(ctx context.Context, entries []*shared.SharedHistoryEntry) error {
+	tx := db.WithContext(ctx).Create(entries)
+	if tx.Error != nil {
+		return fmt.Errorf("tx.Error: %w", tx.Error)
+	}
+
+	return nil
+}
+
+// Retrieve and delete the pending shared entries for the given recipient. Deleting on retrieval
+// means each shared entry is delivered once, after which the recipient's own devices get it via
+// the normal personal syncing flow.
+func (db *DB) SharedEntriesRetrieveForRecipient(ctx context.Context, recipientUserID string) ([]*shared.SharedHistoryEntry, error) {
+	var entries []*shared.SharedHistoryEntry
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if r := tx.Where("recipient_user_id = ?", recipientUserID).Order("date ASC").Find(&entries); r.Error != nil {
+			return fmt.Errorf("tx.Error: %w", r.Error)
+		}
+		if r := tx.Where("recipient_user_id = ?", recipientUserID).Delete(&shared.SharedHistoryEntry{}); r.Error != nil {
+			return fmt.Errorf("tx.Error: %w", r.Error)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
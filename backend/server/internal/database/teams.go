@@ -0,0 +1,91 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ddworken/hishtory/shared"
+
+	"gorm.io/gorm"
+)
+
+func (db *DB) TeamCreate(ctx context.Context, team *shared.Team) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if r := tx.Create(team); r.Error != nil {
+			return fmt.Errorf("tx.Error: %w", r.Error)
+		}
+		// The owner is always a member of their own team
+		member := shared.TeamMember{TeamId: team.TeamId, UserId: team.OwnerUserId, JoinedAt: team.CreatedAt}
+		if r := tx.Create(&member); r.Error != nil {
+			return fmt.Errorf("tx.Error: %w", r.Error)
+		}
+		return nil
+	})
+}
+
+func (db *DB) TeamExists(ctx context.Context, teamID string) (bool, error) {
+	var count int64
+	tx := db.WithContext(ctx).Model(&shared.Team{}).Where("team_id = ?", teamID).Count(&count)
+	if tx.Error != nil {
+		return false, fmt.Errorf("tx.Error: %w", tx.Error)
+	}
+
+	return count > 0, nil
+}
+
+func (db *DB) TeamMemberAdd(ctx context.Context, member *shared.TeamMember) error {
+	tx := db.WithContext(ctx).Create(member)
+	if tx.Error != nil {
+		return fmt.Errorf("tx.Error: %w", tx.Error)
+	}
+
+	return nil
+}
+
+func (db *DB) TeamMemberRemove(ctx context.Context, teamID, userID string) (int64, error) {
+	tx := db.WithContext(ctx).Where("team_id = ? AND user_id = ?", teamID, userID).Delete(&shared.TeamMember{})
+	if tx.Error != nil {
+		return 0, fmt.Errorf("tx.Error: %w", tx.Error)
+	}
+
+	return tx.RowsAffected, nil
+}
+
+func (db *DB) IsTeamMember(ctx context.Context, teamID, userID string) (bool, error) {
+	var count int64
+	tx := db.WithContext(ctx).Model(&shared.TeamMember{}).Where("team_id = ? AND user_id = ?", teamID, userID).Count(&count)
+	if tx.Error != nil {
+		return false, fmt.Errorf("tx.Error: %w", tx.Error)
+	}
+
+	return count > 0, nil
+}
+
+func (db *DB) TeamsForUser(ctx context.Context, userID string) ([]*shared.Team, error) {
+	var teams []*shared.Team
+	tx := db.WithContext(ctx).Where("team_id IN (SELECT team_id FROM team_members WHERE user_id = ?)", userID).Find(&teams)
+	if tx.Error != nil {
+		return nil, fmt.Errorf("tx.Error: %w", tx.Error)
+	}
+
+	return teams, nil
+}
+
+func (db *DB) TeamHistoryEntriesAdd(ctx context.Context, entries []*shared.TeamHistoryEntry) error {
+	tx := db.WithContext(ctx).Create(entries)
+	if tx.Error != nil {
+		return fmt.Errorf("tx.Error: %w", tx.Error)
+	}
+
+	return nil
+}
+
+func (db *DB) TeamHistoryEntriesForTeam(ctx context.Context, teamID string) ([]*shared.TeamHistoryEntry, error) {
+	var entries []*shared.TeamHistoryEntry
+	tx := db.WithContext(ctx).Where("team_id = ?", teamID).Order("date ASC").Find(&entries)
+	if tx.Error != nil {
+		return nil, fmt.Errorf("tx.Error: %w", tx.Error)
+	}
+
+	return entries, nil
+}
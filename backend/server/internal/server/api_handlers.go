@@ -7,6 +7,7 @@ import (
 	"html"
 	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/ddworken/hishtory/backend/server/internal/database"
@@ -73,6 +74,23 @@ func (s *Server) apiSubmitHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// apiManifestDiffHandler takes a compact list of the entry IDs that the client has locally and
+// responds with the subset that this user has no stored entries for, so that `hishtory reupload`
+// only has to re-encrypt and re-upload the missing ones
+func (s *Server) apiManifestDiffHandler(w http.ResponseWriter, r *http.Request) {
+	userId := getRequiredQueryParam(r, "user_id")
+	var req shared.ManifestDiffRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		panic(fmt.Errorf("failed to decode: %w", err))
+	}
+	missingIds, err := s.db.EntryIdsMissingForUser(r.Context(), userId, req.EntryIds)
+	checkGormError(err)
+	fmt.Printf("apiManifestDiffHandler: %d of %d entries are missing\n", len(missingIds), len(req.EntryIds))
+	if err := json.NewEncoder(w).Encode(shared.ManifestDiffResponse{MissingEntryIds: missingIds}); err != nil {
+		panic(err)
+	}
+}
+
 func (s *Server) apiBootstrapHandler(w http.ResponseWriter, r *http.Request) {
 	userId := getRequiredQueryParam(r, "user_id")
 	deviceId := getRequiredQueryParam(r, "device_id")
@@ -88,6 +106,47 @@ func (s *Server) apiBootstrapHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// The largest page size that a client may request from the paginated bootstrap endpoint
+const maxBootstrapPageSize = 10_000
+
+// apiBootstrapPaginatedHandler is the cursor-based variant of apiBootstrapHandler: it returns one
+// page of the user's entries ordered by (date, encrypted_id), starting after the cursor passed via
+// the cursor_date/cursor_id params. Clients page through until they receive a short page, so that
+// bootstrapping a very large history doesn't require one giant response.
+func (s *Server) apiBootstrapPaginatedHandler(w http.ResponseWriter, r *http.Request) {
+	userId := getRequiredQueryParam(r, "user_id")
+	deviceId := getRequiredQueryParam(r, "device_id")
+	limit, err := strconv.Atoi(getRequiredQueryParam(r, "limit"))
+	if err != nil || limit <= 0 {
+		panic(fmt.Sprintf("request to %s has an invalid limit query param", r.URL))
+	}
+	if limit > maxBootstrapPageSize {
+		limit = maxBootstrapPageSize
+	}
+	var cursorDate time.Time
+	if cursorDateStr := getOptionalQueryParam(r, "cursor_date", false); cursorDateStr != "" {
+		cursorDate, err = time.Parse(time.RFC3339Nano, cursorDateStr)
+		if err != nil {
+			panic(fmt.Sprintf("request to %s has an invalid cursor_date query param", r.URL))
+		}
+	}
+	cursorId := getOptionalQueryParam(r, "cursor_id", false)
+	descending := getOptionalQueryParam(r, "order", false) == "desc"
+
+	if cursorId == "" {
+		// Only count the first page toward usage data, so that one bootstrap isn't counted once per page
+		version := getHishtoryVersion(r)
+		remoteIPAddr := getRemoteAddr(r)
+		s.handleNonCriticalError(s.updateUsageData(r.Context(), version, remoteIPAddr, userId, deviceId, 0, false))
+	}
+	historyEntries, err := s.db.AllHistoryEntriesForUserPaginated(r.Context(), userId, cursorDate, cursorId, limit, descending)
+	checkGormError(err)
+	fmt.Printf("apiBootstrapPaginatedHandler: Found %d entries\n", len(historyEntries))
+	if err := json.NewEncoder(w).Encode(historyEntries); err != nil {
+		panic(err)
+	}
+}
+
 func (s *Server) apiQueryHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	userId := getRequiredQueryParam(r, "user_id")
@@ -277,6 +336,51 @@ func (s *Server) addDeletionRequestHandler(w http.ResponseWriter, r *http.Reques
 	w.WriteHeader(http.StatusOK)
 }
 
+func (s *Server) getDeletionRequestStatusHandler(w http.ResponseWriter, r *http.Request) {
+	userId := getRequiredQueryParam(r, "user_id")
+	sendTimeStr := getRequiredQueryParam(r, "send_time")
+	sendTime, err := time.Parse(time.RFC3339Nano, sendTimeStr)
+	if err != nil {
+		panic(fmt.Errorf("failed to parse send_time=%#v: %w", sendTimeStr, err))
+	}
+
+	statuses, err := s.db.DeletionRequestStatuses(r.Context(), userId, sendTime)
+	checkGormError(err)
+	if err := json.NewEncoder(w).Encode(statuses); err != nil {
+		panic(fmt.Errorf("failed to JSON marshal the deletion request statuses: %w", err))
+	}
+}
+
+func (s *Server) setSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	var settings shared.EncSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		panic(fmt.Errorf("failed to decode: %w", err))
+	}
+	if settings.UserId == "" {
+		panic(fmt.Errorf("rejecting settings upload with an empty user_id"))
+	}
+	settings.Date = time.Now()
+
+	err := s.db.SettingsUpsert(r.Context(), &settings)
+	checkGormError(err)
+
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) getSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	userId := getRequiredQueryParam(r, "user_id")
+	settings, err := s.db.SettingsForUser(r.Context(), userId)
+	checkGormError(err)
+	if settings == nil {
+		http.Error(w, "found no settings for the given user", http.StatusNotFound)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(settings); err != nil {
+		panic(fmt.Errorf("failed to JSON marshal the settings: %w", err))
+	}
+}
+
 func (s *Server) slsaStatusHandler(w http.ResponseWriter, r *http.Request) {
 	// returns "OK" unless there is a current SLSA bug
 	v := getHishtoryVersion(r)
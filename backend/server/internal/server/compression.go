@@ -0,0 +1,76 @@
+package server
+
+import (
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// gzipResponseWriter lazily compresses the response body. Compression is only set up once the
+// handler starts writing a 200 response without an explicit Content-Length or Content-Encoding,
+// so that empty responses, error responses, and endpoints that do their own compression (e.g.
+// promhttp) pass through untouched.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz          *gzip.Writer
+	wroteHeader bool
+	passthrough bool
+}
+
+func (w *gzipResponseWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if statusCode != http.StatusOK || w.Header().Get("Content-Length") != "" || w.Header().Get("Content-Encoding") != "" {
+			w.passthrough = true
+		} else {
+			w.Header().Set("Content-Encoding", "gzip")
+			w.gz = gzip.NewWriter(w.ResponseWriter)
+		}
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.passthrough {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.gz.Write(b)
+}
+
+func (w *gzipResponseWriter) Close() error {
+	if w.gz != nil {
+		return w.gz.Close()
+	}
+	return nil
+}
+
+// withGzipCompression transparently decompresses gzip'd request bodies, and compresses response
+// bodies for clients that send Accept-Encoding: gzip. It also advertises via the Accept-Encoding
+// response header (per RFC 7694) that gzip'd request bodies are accepted, which is how clients
+// discover that they can compress their uploads.
+func withGzipCompression() Middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Content-Encoding") == "gzip" {
+				gzipReader, err := gzip.NewReader(r.Body)
+				if err != nil {
+					panic(fmt.Errorf("failed to decompress the request body: %w", err))
+				}
+				defer gzipReader.Close()
+				r.Body = gzipReader
+			}
+			w.Header().Set("Accept-Encoding", "gzip")
+			if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+				h.ServeHTTP(w, r)
+				return
+			}
+			gzw := &gzipResponseWriter{ResponseWriter: w}
+			defer gzw.Close()
+			h.ServeHTTP(gzw, r)
+		})
+	}
+}
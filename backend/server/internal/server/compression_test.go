@@ -0,0 +1,114 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGzipCompressionRequestBody(t *testing.T) {
+	var receivedBody []byte
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		receivedBody, err = io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("failed to read request body: %v", err)
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte("test request body"))
+	gz.Close()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/", &buf)
+	req.Header.Set("Content-Encoding", "gzip")
+	withGzipCompression()(handler).ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected %d, got %d", http.StatusOK, w.Code)
+	}
+	if string(receivedBody) != "test request body" {
+		t.Errorf("expected the decompressed request body, got %q", string(receivedBody))
+	}
+	if !strings.Contains(w.Header().Get("Accept-Encoding"), "gzip") {
+		t.Errorf("expected the response to advertise gzip support, got %q", w.Header().Get("Accept-Encoding"))
+	}
+}
+
+func TestGzipCompressionResponseBody(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("test response body"))
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	withGzipCompression()(handler).ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected %d, got %d", http.StatusOK, w.Code)
+	}
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Errorf("expected a gzip'd response, got Content-Encoding=%q", w.Header().Get("Content-Encoding"))
+	}
+	gzipReader, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("failed to decompress response body: %v", err)
+	}
+	body, err := io.ReadAll(gzipReader)
+	if err != nil {
+		t.Fatalf("failed to decompress response body: %v", err)
+	}
+	if string(body) != "test response body" {
+		t.Errorf("expected the response body, got %q", string(body))
+	}
+}
+
+func TestGzipCompressionPassthrough(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.Handler
+	}{
+		{
+			name: "no Accept-Encoding",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("test response body"))
+			}),
+		},
+		{
+			name: "explicit Content-Length",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Length", "18")
+				w.Write([]byte("test response body"))
+			}),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.name != "no Accept-Encoding" {
+				req.Header.Set("Accept-Encoding", "gzip")
+			}
+			withGzipCompression()(test.handler).ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Errorf("expected %d, got %d", http.StatusOK, w.Code)
+			}
+			if w.Header().Get("Content-Encoding") != "" {
+				t.Errorf("expected an uncompressed response, got Content-Encoding=%q", w.Header().Get("Content-Encoding"))
+			}
+			if w.Body.String() != "test response body" {
+				t.Errorf("expected the response body, got %q", w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Prometheus metrics exposed via the /metrics endpoint, so that self-hosted instances can be
+// monitored with a standard Prometheus/Grafana stack rather than DataDog
+var (
+	promRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "hishtory_requests_total",
+		Help: "The number of handled HTTP requests, per handler and response code",
+	}, []string{"handler", "code"})
+	promRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "hishtory_request_duration_seconds",
+		Help:    "The duration of handled HTTP requests, per handler",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"handler"})
+	promHistoryEntryCount = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "hishtory_history_entries",
+		Help: "The approximate number of stored history entries",
+	})
+	promDistinctUserCount = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "hishtory_distinct_users",
+		Help: "The number of distinct registered users",
+	})
+	promDbPoolOpenConnections = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "hishtory_db_pool_open_connections",
+		Help: "The number of established DB connections, both in use and idle",
+	})
+	promDbPoolInUseConnections = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "hishtory_db_pool_in_use_connections",
+		Help: "The number of DB connections currently in use",
+	})
+	promDbPoolIdleConnections = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "hishtory_db_pool_idle_connections",
+		Help: "The number of idle DB connections",
+	})
+	promDbPoolWaitCount = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "hishtory_db_pool_wait_count",
+		Help: "The total number of times a DB connection had to be waited for",
+	})
+	promDbPoolWaitSeconds = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "hishtory_db_pool_wait_seconds",
+		Help: "The total time spent waiting for DB connections",
+	})
+	promCronRunsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "hishtory_cron_runs_total",
+		Help: "The number of background cron runs, per status",
+	}, []string{"status"})
+	promCronLastSuccess = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "hishtory_cron_last_success_timestamp_seconds",
+		Help: "The timestamp of the last successful background cron run, for alerting on stalled background jobs",
+	})
+)
+
+// ObserveCronRun records the result of a background cron run
+func ObserveCronRun(err error) {
+	if err == nil {
+		promCronRunsTotal.WithLabelValues("success").Inc()
+		promCronLastSuccess.SetToCurrentTime()
+	} else {
+		promCronRunsTotal.WithLabelValues("failure").Inc()
+	}
+}
+
+// prometheusMetricsHandler serves the Prometheus metrics endpoint, refreshing the DB-derived
+// gauges before every scrape
+func (s *Server) prometheusMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if numEntries, err := s.db.CountApproximateHistoryEntries(r.Context()); err == nil {
+		promHistoryEntryCount.Set(float64(numEntries))
+	} else {
+		fmt.Printf("failed to count history entries for /metrics: %v\n", err)
+	}
+	if numUsers, err := s.db.DistinctUsers(r.Context()); err == nil {
+		promDistinctUserCount.Set(float64(numUsers))
+	} else {
+		fmt.Printf("failed to count distinct users for /metrics: %v\n", err)
+	}
+	if stats, err := s.db.Stats(); err == nil {
+		promDbPoolOpenConnections.Set(float64(stats.OpenConnections))
+		promDbPoolInUseConnections.Set(float64(stats.InUse))
+		promDbPoolIdleConnections.Set(float64(stats.Idle))
+		promDbPoolWaitCount.Set(float64(stats.WaitCount))
+		promDbPoolWaitSeconds.Set(stats.WaitDuration.Seconds())
+	} else {
+		fmt.Printf("failed to retrieve DB pool stats for /metrics: %v\n", err)
+	}
+	promhttp.Handler().ServeHTTP(w, r)
+}
@@ -6,16 +6,19 @@ import (
 	"net/http"
 	"reflect"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/DataDog/datadog-go/statsd"
+	"github.com/ddworken/hishtory/shared"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 )
 
 type loggedResponseData struct {
-	size int
+	size       int
+	statusCode int
 }
 
 type loggingResponseWriter struct {
@@ -30,6 +33,7 @@ func (r *loggingResponseWriter) Write(b []byte) (int, error) {
 }
 
 func (r *loggingResponseWriter) WriteHeader(statusCode int) {
+	r.responseData.statusCode = statusCode
 	r.ResponseWriter.WriteHeader(statusCode)
 }
 
@@ -69,7 +73,7 @@ func mergeMiddlewares(middlewares ...Middleware) Middleware {
 func withLogging(s *statsd.Client, out io.Writer) Middleware {
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
-			var responseData loggedResponseData
+			responseData := loggedResponseData{statusCode: http.StatusOK}
 			lrw := loggingResponseWriter{
 				ResponseWriter: rw,
 				responseData:   &responseData,
@@ -102,6 +106,20 @@ func withLogging(s *statsd.Client, out io.Writer) Middleware {
 				s.Distribution("hishtory.request_duration", float64(duration.Microseconds())/1_000, []string{"handler:" + getFunctionName(h)}, 1.0)
 				s.Incr("hishtory.request", []string{"handler:" + getFunctionName(h)}, 1.0)
 			}
+			promRequestsTotal.WithLabelValues(getFunctionName(h), strconv.Itoa(responseData.statusCode)).Inc()
+			promRequestDuration.WithLabelValues(getFunctionName(h)).Observe(duration.Seconds())
+		})
+	}
+}
+
+// withProtocolVersionHeader advertises the wire protocol version that this server speaks on every
+// response, so that clients can distinguish "this device is running an outdated hishtory" from
+// genuine corruption when they fail to decode a response
+func withProtocolVersionHeader() Middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			rw.Header().Set("X-Hishtory-Protocol-Version", strconv.Itoa(shared.ProtocolVersion))
+			h.ServeHTTP(rw, r)
 		})
 	}
 }
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/DataDog/datadog-go/statsd"
+)
+
+// A token bucket rate limiter keyed by an arbitrary string (a user ID or a remote IP). Each
+// bucket refills continuously at `rate` tokens per second, up to `burst` tokens.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+}
+
+type tokenBucket struct {
+	tokens     float64
+	lastRefill time.Time
+}
+
+func newRateLimiter(rate, burst float64) *rateLimiter {
+	return &rateLimiter{
+		rate:      rate,
+		burst:     burst,
+		buckets:   make(map[string]*tokenBucket),
+		lastPrune: time.Now(),
+	}
+}
+
+// allow takes one token from the bucket for the given key and returns whether the request
+// should be allowed
+func (rl *rateLimiter) allow(key string) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	now := time.Now()
+	rl.maybePrune(now)
+	bucket, ok := rl.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: rl.burst, lastRefill: now}
+		rl.buckets[key] = bucket
+	}
+	bucket.tokens = min(rl.burst, bucket.tokens+now.Sub(bucket.lastRefill).Seconds()*rl.rate)
+	bucket.lastRefill = now
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// maybePrune occasionally drops buckets that have fully refilled, so that the map doesn't grow
+// without bound. Must be called with rl.mu held.
+func (rl *rateLimiter) maybePrune(now time.Time) {
+	if now.Sub(rl.lastPrune) < time.Minute {
+		return
+	}
+	rl.lastPrune = now
+	for key, bucket := range rl.buckets {
+		if bucket.tokens+now.Sub(bucket.lastRefill).Seconds()*rl.rate >= rl.burst {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// The rate limit applied to the submit/query/bootstrap endpoints, in requests per second per
+// user ID (and per remote IP). Defaults to 0, which disables rate limiting.
+func getRateLimitRps() float64 {
+	rpsStr := os.Getenv("HISHTORY_RATE_LIMIT_RPS")
+	if rpsStr == "" {
+		return 0
+	}
+	rps, err := strconv.ParseFloat(rpsStr, 64)
+	if err != nil {
+		return 0
+	}
+	return rps
+}
+
+// The burst size for the rate limit: the number of requests that can be made back-to-back
+// before the per-second limit kicks in. Defaults to 10x the configured rate.
+func getRateLimitBurst() float64 {
+	burstStr := os.Getenv("HISHTORY_RATE_LIMIT_BURST")
+	if burstStr == "" {
+		return getRateLimitRps() * 10
+	}
+	burst, err := strconv.ParseFloat(burstStr, 64)
+	if err != nil {
+		return getRateLimitRps() * 10
+	}
+	return burst
+}
+
+// withRateLimiting enforces per-user-id and per-IP token bucket rate limits on the wrapped
+// endpoint, responding with a 429 when either limit is exceeded
+func withRateLimiting(s *statsd.Client, perUser, perIp *rateLimiter) Middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			limitedBy := ""
+			if userId := r.URL.Query().Get("user_id"); userId != "" && !perUser.allow(userId) {
+				limitedBy = "user_id"
+			} else if !perIp.allow(getRemoteAddr(r)) {
+				limitedBy = "remote_addr"
+			}
+			if limitedBy != "" {
+				if s != nil {
+					s.Incr("hishtory.rate_limited", []string{"handler:" + getFunctionName(h), "limited_by:" + limitedBy}, 1.0)
+				}
+				rw.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			h.ServeHTTP(rw, r)
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	rl := newRateLimiter(1, 3)
+	for i := 0; i < 3; i++ {
+		if !rl.allow("user1") {
+			t.Errorf("expected request %d to be allowed within the burst", i)
+		}
+	}
+	if rl.allow("user1") {
+		t.Errorf("expected the request after the burst to be rejected")
+	}
+	// Other keys have their own buckets
+	if !rl.allow("user2") {
+		t.Errorf("expected a request for a different key to be allowed")
+	}
+}
+
+func TestRateLimitingMiddleware(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	wrappedHandler := withRateLimiting(nil, newRateLimiter(1, 2), newRateLimiter(1, 100))(handler)
+
+	makeRequest := func(userId string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/?user_id="+userId, nil)
+		req.Header.Add("X-Real-Ip", "127.0.0.1")
+		wrappedHandler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for i := 0; i < 2; i++ {
+		if code := makeRequest("user1"); code != http.StatusOK {
+			t.Errorf("expected status %d for request %d, got %d", http.StatusOK, i, code)
+		}
+	}
+	if code := makeRequest("user1"); code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d after the burst, got %d", http.StatusTooManyRequests, code)
+	}
+	if code := makeRequest("user2"); code != http.StatusOK {
+		t.Errorf("expected status %d for a different user, got %d", http.StatusOK, code)
+	}
+}
+
+func TestRateLimitingMiddlewarePerIp(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	wrappedHandler := withRateLimiting(nil, newRateLimiter(1, 100), newRateLimiter(1, 2))(handler)
+
+	makeRequest := func(ip string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Add("X-Real-Ip", ip)
+		wrappedHandler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for i := 0; i < 2; i++ {
+		if code := makeRequest("127.0.0.1"); code != http.StatusOK {
+			t.Errorf("expected status %d for request %d, got %d", http.StatusOK, i, code)
+		}
+	}
+	if code := makeRequest("127.0.0.1"); code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d after the burst, got %d", http.StatusTooManyRequests, code)
+	}
+	if code := makeRequest("10.0.0.1"); code != http.StatusOK {
+		t.Errorf("expected status %d for a different IP, got %d", http.StatusOK, code)
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ddworken/hishtory/shared"
+)
+
+// The handlers for `hishtory share`: users publish an X25519 public key, other users seal
+// entries to that key, and the backend queues the (opaque) sealed entries until the recipient
+// retrieves them. Publishing a key is what opts a user in to receiving shared entries.
+
+func (s *Server) apiSharePutPublicKeyHandler(w http.ResponseWriter, r *http.Request) {
+	userId := getRequiredQueryParam(r, "user_id")
+	publicKey, err := base64.URLEncoding.DecodeString(getRequiredQueryParam(r, "public_key"))
+	if err != nil {
+		panic(fmt.Errorf("failed to decode public_key: %w", err))
+	}
+	checkGormError(s.db.SharingPublicKeyUpsert(r.Context(), &shared.SharingPublicKey{UserId: userId, PublicKey: publicKey, Date: time.Now()}))
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) apiShareGetPublicKeyHandler(w http.ResponseWriter, r *http.Request) {
+	userId := getRequiredQueryParam(r, "user_id")
+	publicKey, err := s.db.SharingPublicKeyForUser(r.Context(), userId)
+	checkGormError(err)
+	if publicKey == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(publicKey); err != nil {
+		panic(err)
+	}
+}
+
+func (s *Server) apiShareSubmitHandler(w http.ResponseWriter, r *http.Request) {
+	var entries []*shared.SharedHistoryEntry
+	if err := json.NewDecoder(r.Body).Decode(&entries); err != nil {
+		panic(fmt.Errorf("failed to decode: %w", err))
+	}
+	if len(entries) == 0 {
+		return
+	}
+	checkGormError(s.db.SharedEntriesAdd(r.Context(), entries))
+	if s.statsd != nil {
+		s.statsd.Count("hishtory.share_submit", int64(len(entries)), []string{}, 1.0)
+	}
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) apiShareReceiveHandler(w http.ResponseWriter, r *http.Request) {
+	userId := getRequiredQueryParam(r, "user_id")
+	entries, err := s.db.SharedEntriesRetrieveForRecipient(r.Context(), userId)
+	checkGormError(err)
+	if err := json.NewEncoder(w).Encode(entries); err != nil {
+		panic(err)
+	}
+}
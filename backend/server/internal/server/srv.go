@@ -100,25 +100,56 @@ func (s *Server) Run(ctx context.Context, addr string) error {
 	middlewares := mergeMiddlewares(
 		withPanicGuard(s.statsd),
 		withLogging(s.statsd, os.Stdout),
+		withProtocolVersionHeader(),
+		withGzipCompression(),
 	)
+	// The heavyweight endpoints additionally get rate limited (if configured via
+	// HISHTORY_RATE_LIMIT_RPS), so that a single user or IP can't overwhelm the server
+	rateLimitedMiddlewares := middlewares
+	if rps := getRateLimitRps(); rps > 0 {
+		burst := getRateLimitBurst()
+		rateLimitedMiddlewares = mergeMiddlewares(
+			withPanicGuard(s.statsd),
+			withLogging(s.statsd, os.Stdout),
+			withRateLimiting(s.statsd, newRateLimiter(rps, burst), newRateLimiter(rps, burst)),
+			withProtocolVersionHeader(),
+			withGzipCompression(),
+		)
+	}
 
-	mux.Handle("/api/v1/submit", middlewares(http.HandlerFunc(s.apiSubmitHandler)))
+	mux.Handle("/api/v1/submit", rateLimitedMiddlewares(http.HandlerFunc(s.apiSubmitHandler)))
 	mux.Handle("/api/v1/get-dump-requests", middlewares(http.HandlerFunc(s.apiGetPendingDumpRequestsHandler)))
 	mux.Handle("/api/v1/submit-dump", middlewares(http.HandlerFunc(s.apiSubmitDumpHandler)))
-	mux.Handle("/api/v1/query", middlewares(http.HandlerFunc(s.apiQueryHandler)))
-	mux.Handle("/api/v1/bootstrap", middlewares(http.HandlerFunc(s.apiBootstrapHandler)))
+	mux.Handle("/api/v1/query", rateLimitedMiddlewares(http.HandlerFunc(s.apiQueryHandler)))
+	mux.Handle("/api/v1/bootstrap", rateLimitedMiddlewares(http.HandlerFunc(s.apiBootstrapHandler)))
+	mux.Handle("/api/v1/bootstrap-paginated", rateLimitedMiddlewares(http.HandlerFunc(s.apiBootstrapPaginatedHandler)))
+	mux.Handle("/api/v1/manifest-diff", rateLimitedMiddlewares(http.HandlerFunc(s.apiManifestDiffHandler)))
 	mux.Handle("/api/v1/register", middlewares(http.HandlerFunc(s.apiRegisterHandler)))
 	mux.Handle("/api/v1/banner", middlewares(http.HandlerFunc(s.apiBannerHandler)))
 	mux.Handle("/api/v1/download", middlewares(http.HandlerFunc(s.apiDownloadHandler)))
 	mux.Handle("/api/v1/trigger-cron", middlewares(http.HandlerFunc(s.triggerCronHandler)))
 	mux.Handle("/api/v1/get-deletion-requests", middlewares(http.HandlerFunc(s.getDeletionRequestsHandler)))
 	mux.Handle("/api/v1/add-deletion-request", middlewares(http.HandlerFunc(s.addDeletionRequestHandler)))
+	mux.Handle("/api/v1/get-deletion-request-status", middlewares(http.HandlerFunc(s.getDeletionRequestStatusHandler)))
+	mux.Handle("/api/v1/set-settings", middlewares(http.HandlerFunc(s.setSettingsHandler)))
+	mux.Handle("/api/v1/get-settings", middlewares(http.HandlerFunc(s.getSettingsHandler)))
 	mux.Handle("/api/v1/slsa-status", middlewares(http.HandlerFunc(s.slsaStatusHandler)))
 	mux.Handle("/api/v1/feedback", middlewares(http.HandlerFunc(s.feedbackHandler)))
 	mux.Handle("/api/v1/uninstall", middlewares(http.HandlerFunc(s.apiUninstallHandler)))
 	mux.Handle("/api/v1/ai-suggest", middlewares(http.HandlerFunc(s.aiSuggestionHandler)))
 	mux.Handle("/api/v1/ping", middlewares(http.HandlerFunc(s.pingHandler)))
+	mux.Handle("/api/v1/team/create", middlewares(http.HandlerFunc(s.apiTeamCreateHandler)))
+	mux.Handle("/api/v1/team/join", middlewares(http.HandlerFunc(s.apiTeamJoinHandler)))
+	mux.Handle("/api/v1/team/leave", middlewares(http.HandlerFunc(s.apiTeamLeaveHandler)))
+	mux.Handle("/api/v1/team/list", middlewares(http.HandlerFunc(s.apiTeamListHandler)))
+	mux.Handle("/api/v1/team/submit", middlewares(http.HandlerFunc(s.apiTeamSubmitHandler)))
+	mux.Handle("/api/v1/team/query", middlewares(http.HandlerFunc(s.apiTeamQueryHandler)))
+	mux.Handle("/api/v1/share/put-public-key", middlewares(http.HandlerFunc(s.apiSharePutPublicKeyHandler)))
+	mux.Handle("/api/v1/share/get-public-key", middlewares(http.HandlerFunc(s.apiShareGetPublicKeyHandler)))
+	mux.Handle("/api/v1/share/submit", middlewares(http.HandlerFunc(s.apiShareSubmitHandler)))
+	mux.Handle("/api/v1/share/receive", middlewares(http.HandlerFunc(s.apiShareReceiveHandler)))
 	mux.Handle("/healthcheck", middlewares(http.HandlerFunc(s.healthCheckHandler)))
+	mux.Handle("/metrics", middlewares(http.HandlerFunc(s.prometheusMetricsHandler)))
 	mux.Handle("/internal/api/v1/usage-stats", middlewares(http.HandlerFunc(s.usageStatsHandler)))
 	mux.Handle("/internal/api/v1/stats", middlewares(http.HandlerFunc(s.statsHandler)))
 	if s.isTestEnvironment {
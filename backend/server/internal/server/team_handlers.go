@@ -0,0 +1,118 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ddworken/hishtory/shared"
+
+	"github.com/google/uuid"
+)
+
+// Note on the security model of teams: as with the rest of the hishtory API, knowledge of a
+// user_id (which is derived from the user's secret key) acts as the credential for that user,
+// and knowledge of a team_id acts as the credential to join a team. The entries in a team's
+// pool are encrypted client-side with a team key, so the backend never sees their contents.
+
+func (s *Server) apiTeamCreateHandler(w http.ResponseWriter, r *http.Request) {
+	userId := getRequiredQueryParam(r, "user_id")
+	team := shared.Team{TeamId: uuid.Must(uuid.NewRandom()).String(), OwnerUserId: userId, CreatedAt: time.Now()}
+	checkGormError(s.db.TeamCreate(r.Context(), &team))
+	if s.statsd != nil {
+		s.statsd.Incr("hishtory.team_create", []string{}, 1.0)
+	}
+	if err := json.NewEncoder(w).Encode(team); err != nil {
+		panic(err)
+	}
+}
+
+func (s *Server) apiTeamJoinHandler(w http.ResponseWriter, r *http.Request) {
+	teamId := getRequiredQueryParam(r, "team_id")
+	userId := getRequiredQueryParam(r, "user_id")
+	teamExists, err := s.db.TeamExists(r.Context(), teamId)
+	checkGormError(err)
+	if !teamExists {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	isMember, err := s.db.IsTeamMember(r.Context(), teamId, userId)
+	checkGormError(err)
+	if !isMember {
+		checkGormError(s.db.TeamMemberAdd(r.Context(), &shared.TeamMember{TeamId: teamId, UserId: userId, JoinedAt: time.Now()}))
+	}
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) apiTeamLeaveHandler(w http.ResponseWriter, r *http.Request) {
+	teamId := getRequiredQueryParam(r, "team_id")
+	userId := getRequiredQueryParam(r, "user_id")
+	numDeleted, err := s.db.TeamMemberRemove(r.Context(), teamId, userId)
+	checkGormError(err)
+	if numDeleted == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) apiTeamListHandler(w http.ResponseWriter, r *http.Request) {
+	userId := getRequiredQueryParam(r, "user_id")
+	teams, err := s.db.TeamsForUser(r.Context(), userId)
+	checkGormError(err)
+	if err := json.NewEncoder(w).Encode(teams); err != nil {
+		panic(err)
+	}
+}
+
+func (s *Server) apiTeamSubmitHandler(w http.ResponseWriter, r *http.Request) {
+	teamId := getRequiredQueryParam(r, "team_id")
+	userId := getRequiredQueryParam(r, "user_id")
+	isMember, err := s.db.IsTeamMember(r.Context(), teamId, userId)
+	checkGormError(err)
+	if !isMember {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	var entries []*shared.TeamHistoryEntry
+	if err := json.NewDecoder(r.Body).Decode(&entries); err != nil {
+		panic(fmt.Errorf("failed to decode: %w", err))
+	}
+	if len(entries) == 0 {
+		return
+	}
+	// The team and sharing user are taken from the (validated) query params rather than trusting
+	// whatever the client put in the request body
+	for _, entry := range entries {
+		entry.TeamId = teamId
+		entry.SharedByUserId = userId
+	}
+	checkGormError(s.db.TeamHistoryEntriesAdd(r.Context(), entries))
+	if s.statsd != nil {
+		s.statsd.Count("hishtory.team_submit", int64(len(entries)), []string{}, 1.0)
+	}
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) apiTeamQueryHandler(w http.ResponseWriter, r *http.Request) {
+	teamId := getRequiredQueryParam(r, "team_id")
+	userId := getRequiredQueryParam(r, "user_id")
+	isMember, err := s.db.IsTeamMember(r.Context(), teamId, userId)
+	checkGormError(err)
+	if !isMember {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	entries, err := s.db.TeamHistoryEntriesForTeam(r.Context(), teamId)
+	checkGormError(err)
+	if s.statsd != nil {
+		s.statsd.Incr("hishtory.team_query", []string{}, 1.0)
+	}
+	if err := json.NewEncoder(w).Encode(entries); err != nil {
+		panic(err)
+	}
+}
@@ -173,6 +173,7 @@ func runBackgroundJobs(ctx context.Context, srv *server.Server, db *database.DB,
 		if err != nil {
 			fmt.Printf("Cron failure: %v", err)
 		}
+		server.ObserveCronRun(err)
 		srv.UpdateReleaseVersion(release.Version, release.BuildUpdateInfo(release.Version))
 		time.Sleep(10 * time.Minute)
 	}
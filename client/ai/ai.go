@@ -26,15 +26,79 @@ func DebouncedGetAiSuggestions(ctx context.Context, shellName, query string, num
 	return nil, nil
 }
 
+// The maximum length of a single history command that we'll include as context in an AI
+// suggestion prompt, to avoid wasting tokens on giant one-off commands
+const maxContextCommandLength = 200
+
+// Build an opt-in context blurb containing the user's current working directory and most recent
+// shell commands, so that AI suggestions can be tailored to their environment. Controlled by the
+// ai-completion-context config option, which specifies how many recent commands are shared.
+// Returns an empty string if this feature is disabled or if we fail to retrieve the context.
+func buildQueryContext(ctx context.Context, numCommands int) string {
+	if numCommands <= 0 {
+		return ""
+	}
+	entries, err := lib.Search(ctx, hctx.GetDb(ctx), "", numCommands)
+	if err != nil {
+		hctx.GetLogger().Warnf("failed to retrieve recent commands for AI context, skipping context: %v", err)
+		return ""
+	}
+	queryContext := ""
+	if cwd, err := os.Getwd(); err == nil {
+		queryContext += "\n\nFor context, my current working directory is " + cwd + "."
+	}
+	if len(entries) > 0 {
+		queryContext += "\nMy most recent shell commands (most recent first) are:\n"
+		for _, entry := range entries {
+			cmd := entry.Command
+			if len(cmd) > maxContextCommandLength {
+				cmd = cmd[:maxContextCommandLength]
+			}
+			queryContext += cmd + "\n"
+		}
+	}
+	return queryContext
+}
+
 func GetAiSuggestions(ctx context.Context, shellName, query string, numberCompletions int) ([]string, error) {
-	if os.Getenv("OPENAI_API_KEY") == "" && hctx.GetConf(ctx).AiCompletionEndpoint == ai.DefaultOpenAiEndpoint {
+	config := hctx.GetConf(ctx)
+	query += buildQueryContext(ctx, config.AiCompletionContextCommands)
+	if config.AiCompletionBackend == "ollama" {
+		endpoint := config.AiCompletionEndpoint
+		if endpoint == ai.DefaultOpenAiEndpoint {
+			// The endpoint was never customized, so use the default Ollama one rather than OpenAI's
+			endpoint = ai.DefaultOllamaEndpoint
+		}
+		return ai.GetAiSuggestionsViaOllamaApi(endpoint, query, shellName, getOsName(), os.Getenv("OPENAI_API_MODEL"), numberCompletions)
+	}
+	if os.Getenv("OPENAI_API_KEY") == "" && config.AiCompletionEndpoint == ai.DefaultOpenAiEndpoint {
 		return GetAiSuggestionsViaHishtoryApi(ctx, shellName, query, numberCompletions)
 	} else {
-		suggestions, _, err := ai.GetAiSuggestionsViaOpenAiApi(hctx.GetConf(ctx).AiCompletionEndpoint, query, shellName, getOsName(), os.Getenv("OPENAI_API_MODEL"), numberCompletions)
+		suggestions, _, err := ai.GetAiSuggestionsViaOpenAiApi(config.AiCompletionEndpoint, query, shellName, getOsName(), os.Getenv("OPENAI_API_MODEL"), numberCompletions)
 		return suggestions, err
 	}
 }
 
+// Ask the configured AI backend to explain what the given shell command does. Used by the
+// TUI's explain-command overlay. Note that unlike suggestions, this has no fallback to the
+// hishtory backend, so it requires either an OPENAI_API_KEY or a custom endpoint.
+func GetAiExplanation(ctx context.Context, shellName, command string) (string, error) {
+	config := hctx.GetConf(ctx)
+	if config.AiCompletionBackend == "ollama" {
+		endpoint := config.AiCompletionEndpoint
+		if endpoint == ai.DefaultOpenAiEndpoint {
+			// The endpoint was never customized, so use the default Ollama one rather than OpenAI's
+			endpoint = ai.DefaultOllamaEndpoint
+		}
+		return ai.GetAiExplanationViaOllamaApi(endpoint, command, shellName, getOsName(), os.Getenv("OPENAI_API_MODEL"))
+	}
+	if os.Getenv("OPENAI_API_KEY") == "" && config.AiCompletionEndpoint == ai.DefaultOpenAiEndpoint {
+		return "", fmt.Errorf("explaining commands requires either the OPENAI_API_KEY environment variable or a custom ai-completion-endpoint")
+	}
+	explanation, _, err := ai.GetAiExplanationViaOpenAiApi(config.AiCompletionEndpoint, command, shellName, getOsName(), os.Getenv("OPENAI_API_MODEL"))
+	return explanation, err
+}
+
 func getOsName() string {
 	switch runtime.GOOS {
 	case "linux":
@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ddworken/hishtory/client/data"
+	"github.com/ddworken/hishtory/client/hctx"
+	"github.com/ddworken/hishtory/client/lib"
+
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+// The current version of the backup archive format, stored in each archive so that future versions
+// of hishtory can evolve the format while still restoring old backups
+const backupFormatVersion = 1
+
+// The additional authenticated data used when encrypting backup archives
+const backupAdditionalData = "hishtory-backup"
+
+// The on-disk format of a backup archive. Everything sensitive lives inside Data, which is a
+// backupContents encrypted with the user's secret key.
+type backupArchive struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Nonce     []byte    `json:"nonce"`
+	Data      []byte    `json:"data"`
+}
+
+// The encrypted payload of a backup archive
+type backupContents struct {
+	Entries []*data.HistoryEntry `json:"entries"`
+	// The client config with the secrets stripped. Only present if the backup was created with
+	// --include-config.
+	Config *hctx.ClientConfig `json:"config,omitempty"`
+}
+
+var backupOutputPath *string
+var backupIncludeConfig *bool
+
+var backupCmd = &cobra.Command{
+	Use:     "backup",
+	Short:   "Back up the local history DB to a single encrypted archive",
+	Long:    "The archive is encrypted with your secret key and can be restored via `hishtory restore`, for disaster recovery or for migrating to a new machine without relying on syncing.",
+	GroupID: GROUP_ID_MANAGEMENT,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		lib.CheckFatalError(createBackup(ctx, *backupOutputPath, *backupIncludeConfig))
+	},
+}
+
+var restoreCmd = &cobra.Command{
+	Use:     "restore FILE",
+	Short:   "Restore history entries from an encrypted archive created by `hishtory backup`",
+	Long:    "Requires that this device uses the same secret key that created the backup (see `hishtory init`). Entries that already exist locally are skipped, so restoring is safe to re-run.",
+	GroupID: GROUP_ID_MANAGEMENT,
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		lib.CheckFatalError(restoreBackup(ctx, args[0]))
+	},
+}
+
+func createBackup(ctx context.Context, outputPath string, includeConfig bool) error {
+	db := hctx.GetDb(ctx)
+	config := hctx.GetConf(ctx)
+	var entries []*data.HistoryEntry
+	res := db.Model(&data.HistoryEntry{}).Find(&entries)
+	if res.Error != nil {
+		return fmt.Errorf("failed to read history entries for the backup: %w", res.Error)
+	}
+	contents := backupContents{Entries: entries}
+	if includeConfig {
+		// Strip the secret key and the device identity, since those shouldn't follow the backup
+		// onto a new machine
+		strippedConfig := *config
+		strippedConfig.UserSecret = ""
+		strippedConfig.DeviceId = ""
+		contents.Config = &strippedConfig
+	}
+	plaintext, err := json.Marshal(contents)
+	if err != nil {
+		return fmt.Errorf("failed to serialize the backup contents: %w", err)
+	}
+	ciphertext, nonce, err := data.Encrypt(config.UserSecret, plaintext, []byte(backupAdditionalData))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt the backup: %w", err)
+	}
+	archive := backupArchive{Version: backupFormatVersion, CreatedAt: time.Now().UTC(), Nonce: nonce, Data: ciphertext}
+	serialized, err := json.Marshal(archive)
+	if err != nil {
+		return fmt.Errorf("failed to serialize the backup archive: %w", err)
+	}
+	err = os.WriteFile(outputPath, serialized, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to write the backup to %s: %w", outputPath, err)
+	}
+	fmt.Printf("Backed up %d history entries to %s\n", len(entries), outputPath)
+	return nil
+}
+
+func restoreBackup(ctx context.Context, inputPath string) error {
+	serialized, err := os.ReadFile(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to read the backup file %s: %w", inputPath, err)
+	}
+	var archive backupArchive
+	err = json.Unmarshal(serialized, &archive)
+	if err != nil {
+		return fmt.Errorf("failed to parse the backup file %s (is it a hishtory backup?): %w", inputPath, err)
+	}
+	if archive.Version > backupFormatVersion {
+		return fmt.Errorf("backup file %s uses format version %d, but this version of hishtory only supports up to version %d (try updating hishtory)", inputPath, archive.Version, backupFormatVersion)
+	}
+	config := hctx.GetConf(ctx)
+	plaintext, err := data.Decrypt(config.UserSecret, archive.Data, []byte(backupAdditionalData), archive.Nonce)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt the backup (was it created with a different secret key?): %w", err)
+	}
+	var contents backupContents
+	err = json.Unmarshal(plaintext, &contents)
+	if err != nil {
+		return fmt.Errorf("failed to parse the backup contents: %w", err)
+	}
+	db := hctx.GetDb(ctx)
+	numRestored := 0
+	for start := 0; start < len(contents.Entries); start += lib.ImportBatchSize {
+		end := min(start+lib.ImportBatchSize, len(contents.Entries))
+		batch, err := filterExistingEntries(db, contents.Entries[start:end])
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			continue
+		}
+		err = lib.RetryingDbFunction(func() error {
+			if err := db.Create(batch).Error; err != nil {
+				return fmt.Errorf("failed to restore batch of history entries: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		numRestored += len(batch)
+	}
+	fmt.Printf("Restored %d history entries from %s (skipped %d entries that already exist locally)\n", numRestored, inputPath, len(contents.Entries)-numRestored)
+	if contents.Config != nil {
+		// Apply the backed up config, but keep this device's secret key and identity
+		restoredConfig := *contents.Config
+		restoredConfig.UserSecret = config.UserSecret
+		restoredConfig.DeviceId = config.DeviceId
+		err = hctx.SetConfig(&restoredConfig)
+		if err != nil {
+			return fmt.Errorf("failed to restore the config from the backup: %w", err)
+		}
+		fmt.Println("Restored the hishtory config from the backup")
+	}
+	return nil
+}
+
+// filterExistingEntries returns the entries from the given batch whose entry IDs aren't already
+// present in the local DB, so that restoring a backup twice doesn't create duplicate entries
+func filterExistingEntries(db *gorm.DB, batch []*data.HistoryEntry) ([]*data.HistoryEntry, error) {
+	entryIds := make([]string, 0, len(batch))
+	for _, entry := range batch {
+		entryIds = append(entryIds, entry.EntryId)
+	}
+	var existingIds []string
+	err := lib.RetryingDbFunction(func() error {
+		return db.Model(&data.HistoryEntry{}).Where("entry_id IN ?", entryIds).Pluck("entry_id", &existingIds).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for already-present entries: %w", err)
+	}
+	if len(existingIds) == 0 {
+		return batch, nil
+	}
+	existing := make(map[string]bool, len(existingIds))
+	for _, entryId := range existingIds {
+		existing[entryId] = true
+	}
+	filtered := make([]*data.HistoryEntry, 0, len(batch))
+	for _, entry := range batch {
+		if !existing[entry.EntryId] {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered, nil
+}
+
+func init() {
+	rootCmd.AddCommand(backupCmd)
+	rootCmd.AddCommand(restoreCmd)
+	backupOutputPath = backupCmd.Flags().String("output", "hishtory-backup.enc", "Where to write the encrypted backup archive")
+	backupIncludeConfig = backupCmd.Flags().Bool("include-config", false, "Also back up the hishtory config (minus your secret key)")
+}
@@ -0,0 +1,226 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ddworken/hishtory/client/data"
+	"github.com/ddworken/hishtory/client/hctx"
+	"github.com/ddworken/hishtory/client/lib"
+	"github.com/ddworken/hishtory/shared"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+)
+
+var channelJoinCmd = &cobra.Command{
+	Use:     "channel-join NAME SECRET",
+	Short:   "Join a shared channel: a team keyspace encrypted with a shared secret",
+	Long:    "A shared channel is a pool of commands that a team curates alongside their personal histories. Entries are only ever added to a channel explicitly via `hishtory channel-publish`, and are encrypted with the channel secret so the backend can't read them. Everyone who joins with the same secret shares the same channel.",
+	GroupID: GROUP_ID_MANAGEMENT,
+	Args:    cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		lib.CheckFatalError(joinChannel(ctx, args[0], args[1]))
+	},
+}
+
+var channelLeaveCmd = &cobra.Command{
+	Use:     "channel-leave NAME",
+	Short:   "Leave a shared channel",
+	Long:    "Stops publishing to and pulling from the given channel. Entries that were already pulled from the channel are kept in the local DB.",
+	GroupID: GROUP_ID_MANAGEMENT,
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		for i, channel := range config.SharedChannels {
+			if channel.Name == args[0] {
+				config.SharedChannels = append(config.SharedChannels[:i], config.SharedChannels[i+1:]...)
+				lib.CheckFatalError(hctx.SetConfig(config))
+				fmt.Printf("Left channel %s\n", args[0])
+				return
+			}
+		}
+		lib.CheckFatalError(fmt.Errorf("not a member of any channel named %#v", args[0]))
+	},
+}
+
+var channelListCmd = &cobra.Command{
+	Use:     "channel-list",
+	Short:   "List the shared channels that this device has joined",
+	GroupID: GROUP_ID_MANAGEMENT,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		if len(config.SharedChannels) == 0 {
+			fmt.Println("No shared channels joined, see `hishtory channel-join`")
+			return
+		}
+		for _, channel := range config.SharedChannels {
+			fmt.Println(channel.Name)
+		}
+	},
+}
+
+var channelPublishCmd = &cobra.Command{
+	Use:                "channel-publish CHANNEL [query]",
+	Short:              "Publish the most recent history entry matching the given query to a shared channel",
+	Long:               "Publishing is always explicit: nothing is ever uploaded to a channel automatically. The query uses the same format as 'hishtory query', and the most recent matching entry is published.",
+	GroupID:            GROUP_ID_MANAGEMENT,
+	DisableFlagParsing: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			lib.CheckFatalError(fmt.Errorf("channel-publish requires the name of the channel to publish to"))
+		}
+		ctx := hctx.MakeContext()
+		lib.CheckFatalError(publishToChannel(ctx, args[0], strings.Join(args[1:], " ")))
+	},
+}
+
+var channelPullCmd = &cobra.Command{
+	Use:     "channel-pull [CHANNEL]",
+	Short:   "Pull the entries published to a shared channel (or to all joined channels) into the local DB",
+	Long:    "Pulled entries become searchable alongside personal history, but stay local-only: they are never re-uploaded to your personal keyspace.",
+	GroupID: GROUP_ID_MANAGEMENT,
+	Args:    cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		channels := config.SharedChannels
+		if len(args) > 0 {
+			channel, err := findChannel(config, args[0])
+			lib.CheckFatalError(err)
+			channels = []hctx.SharedChannelConfig{*channel}
+		}
+		if len(channels) == 0 {
+			lib.CheckFatalError(fmt.Errorf("no shared channels joined, see `hishtory channel-join`"))
+		}
+		for _, channel := range channels {
+			numPulled, err := pullFromChannel(ctx, channel)
+			lib.CheckFatalError(err)
+			fmt.Printf("Pulled %d new entries from channel %s\n", numPulled, channel.Name)
+		}
+	},
+}
+
+func findChannel(config *hctx.ClientConfig, name string) (*hctx.SharedChannelConfig, error) {
+	for i, channel := range config.SharedChannels {
+		if channel.Name == name {
+			return &config.SharedChannels[i], nil
+		}
+	}
+	return nil, fmt.Errorf("not a member of any channel named %#v, see `hishtory channel-list`", name)
+}
+
+func joinChannel(ctx context.Context, name, secret string) error {
+	config := hctx.GetConf(ctx)
+	if config.IsOffline {
+		return fmt.Errorf("shared channels aren't supported for offline installs of hishtory")
+	}
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("the channel name must not be empty")
+	}
+	if _, err := findChannel(config, name); err == nil {
+		return fmt.Errorf("already a member of a channel named %#v", name)
+	}
+	channel := hctx.SharedChannelConfig{Name: name, Secret: secret, DeviceId: uuid.Must(uuid.NewRandom()).String()}
+	// Register this client as a device in the channel's keyspace, so that the backend will fan
+	// out entries published by other members to it
+	registerPath := "/api/v1/register?user_id=" + data.UserId(channel.Secret) + "&device_id=" + channel.DeviceId
+	if isIntegrationTestDevice() {
+		registerPath += "&is_integration_test_device=true"
+	}
+	_, err := lib.ApiGet(ctx, registerPath)
+	if err != nil {
+		return fmt.Errorf("failed to register with the channel's keyspace: %w", err)
+	}
+	config.SharedChannels = append(config.SharedChannels, channel)
+	err = hctx.SetConfig(config)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Joined channel %s, see `hishtory channel-pull` and `hishtory channel-publish`\n", name)
+	return nil
+}
+
+func publishToChannel(ctx context.Context, channelName, query string) error {
+	config := hctx.GetConf(ctx)
+	if config.IsOffline {
+		return fmt.Errorf("shared channels aren't supported for offline installs of hishtory")
+	}
+	channel, err := findChannel(config, channelName)
+	if err != nil {
+		return err
+	}
+	db := hctx.GetDb(ctx)
+	entries, err := lib.Search(ctx, db, query, 1)
+	if err != nil {
+		return fmt.Errorf("failed to search for the entry to publish: %w", err)
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("found no history entries matching query=%#v", query)
+	}
+	// Publish a copy of the entry that belongs to this client's device in the channel's keyspace,
+	// tagged with the channel name so members can search for it
+	entry := *entries[0]
+	entry.DeviceId = channel.DeviceId
+	entry.LocalOnly = false
+	entry.CustomColumns = append(entry.CustomColumns, data.CustomColumn{Name: "channel", Val: channel.Name})
+	encEntry, err := data.EncryptHistoryEntry(channel.Secret, entry)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt the entry for the channel: %w", err)
+	}
+	jsonValue, err := json.Marshal([]shared.EncHistoryEntry{encEntry})
+	if err != nil {
+		return fmt.Errorf("failed to serialize the entry for the channel: %w", err)
+	}
+	_, err = lib.ApiPost(ctx, "/api/v1/submit?source_device_id="+channel.DeviceId, "application/json", jsonValue)
+	if err != nil {
+		return fmt.Errorf("failed to publish the entry to the channel: %w", err)
+	}
+	fmt.Printf("Published to channel %s: %s\n", channel.Name, entry.Command)
+	return nil
+}
+
+func pullFromChannel(ctx context.Context, channel hctx.SharedChannelConfig) (int, error) {
+	config := hctx.GetConf(ctx)
+	if config.IsOffline {
+		return 0, fmt.Errorf("shared channels aren't supported for offline installs of hishtory")
+	}
+	// Use the bootstrap endpoint rather than the query endpoint so that pulling is idempotent and
+	// always retrieves the channel's full history
+	respBody, err := lib.ApiGet(ctx, "/api/v1/bootstrap?user_id="+data.UserId(channel.Secret)+"&device_id="+channel.DeviceId)
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve entries from the channel: %w", err)
+	}
+	var retrievedEntries []*shared.EncHistoryEntry
+	err = lib.UnmarshalServerResponse(respBody, &retrievedEntries)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load JSON response: %w", err)
+	}
+	db := hctx.GetDb(ctx)
+	numPulled := 0
+	for _, encEntry := range retrievedEntries {
+		decEntry, err := data.DecryptHistoryEntry(channel.Secret, *encEntry)
+		if err != nil {
+			return numPulled, fmt.Errorf("failed to decrypt history entry from the channel: %w", err)
+		}
+		// Mark pulled entries as local-only so that they're never re-uploaded to the personal keyspace
+		decEntry.LocalOnly = true
+		if lib.AddToDbIfNew(db, decEntry) {
+			numPulled++
+		}
+	}
+	return numPulled, nil
+}
+
+func init() {
+	rootCmd.AddCommand(channelJoinCmd)
+	rootCmd.AddCommand(channelLeaveCmd)
+	rootCmd.AddCommand(channelListCmd)
+	rootCmd.AddCommand(channelPublishCmd)
+	rootCmd.AddCommand(channelPullCmd)
+}
@@ -3,6 +3,9 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/ddworken/hishtory/client/hctx"
@@ -57,6 +60,66 @@ var addDisplayedColumnsCmd = &cobra.Command{
 	},
 }
 
+var addColumnPresetCmd = &cobra.Command{
+	Use:     "column-preset",
+	Aliases: []string{"column-presets"},
+	Short:   "Add a named preset of displayed columns",
+	Long:    "Add a named preset of displayed columns that can be used for a single invocation via `hishtory query --columns <name>` (or cycled through in the TUI) without changing the globally configured displayed-columns. E.g. `hishtory config-add column-preset debug CWD Runtime \"Exit Code\" Command`",
+	Args:    cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		presetName := args[0]
+		columns := args[1:]
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		if config.ColumnPresets == nil {
+			config.ColumnPresets = make(map[string][]string)
+		}
+		config.ColumnPresets[presetName] = columns
+		lib.CheckFatalError(hctx.SetConfig(config))
+	},
+}
+
+var addHostnameAliasCmd = &cobra.Command{
+	Use:     "hostname-alias",
+	Aliases: []string{"hostname-aliases"},
+	Short:   "Add a hostname alias that maps a hostname regex to a display alias",
+	Long:    "Add a hostname alias that maps a hostname regex to a display alias (e.g. `hishtory config-add hostname-alias 'ip-10-.*' aws-dev`). Aliases are applied when displaying and searching entries, without rewriting any stored data.",
+	Args:    cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		hostnameRegex := args[0]
+		alias := args[1]
+		if _, err := regexp.Compile(hostnameRegex); err != nil {
+			lib.CheckFatalError(fmt.Errorf("cannot create a hostname alias with invalid regex %#v: %w", hostnameRegex, err))
+		}
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		if config.HostnameAliases == nil {
+			config.HostnameAliases = make(map[string]string)
+		}
+		config.HostnameAliases[hostnameRegex] = alias
+		lib.CheckFatalError(hctx.SetConfig(config))
+	},
+}
+
+var addDeviceNameCmd = &cobra.Command{
+	Use:     "device-name",
+	Aliases: []string{"device-names"},
+	Short:   "Add a pretty name for a device ID",
+	Long:    "Add a pretty name for a device ID (e.g. `hishtory config-add device-name b2f33b82-... prod-bastion`). The name is shown in the `Device` column and can be searched via the `device:` search atom, which is useful for telling machines apart when hostnames are reused. Run `hishtory status -v` to see the current device's ID.",
+	Args:    cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		deviceId := args[0]
+		name := args[1]
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		if config.DeviceNames == nil {
+			config.DeviceNames = make(map[string]string)
+		}
+		config.DeviceNames[deviceId] = name
+		lib.CheckFatalError(hctx.SetConfig(config))
+	},
+}
+
 var addDefaultSearchColumnsCmd = &cobra.Command{
 	Use:     "default-search-columns",
 	Aliases: []string{"default-search-column"},
@@ -72,9 +135,103 @@ var addDefaultSearchColumnsCmd = &cobra.Command{
 	},
 }
 
+var addIgnoredDirectoriesCmd = &cobra.Command{
+	Use:     "ignored-directories",
+	Aliases: []string{"ignored-directory"},
+	Short:   "Add a directory glob where commands are never recorded",
+	Long:    "Add a directory glob (e.g. `hishtory config-add ignored-directories '~/work/secret-*'`) such that commands run inside matching directories (or any directory under them) are never recorded. A directory can also opt out of recording by containing a `.hishtory-ignore` marker file.",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		glob := args[0]
+		if _, err := filepath.Match(glob, "x"); err != nil {
+			lib.CheckFatalError(fmt.Errorf("cannot add invalid directory glob %#v: %w", glob, err))
+		}
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		config.IgnoredDirectories = append(config.IgnoredDirectories, glob)
+		lib.CheckFatalError(hctx.SetConfig(config))
+	},
+}
+
+var addControlRYieldShellsCmd = &cobra.Command{
+	Use:       "control-r-yield-shells",
+	Aliases:   []string{"control-r-yield-shell"},
+	Short:     "Add a shell for which hishtory yields the control-r binding to other plugins",
+	Long:      "Add a shell (one of: bash, zsh, fish) for which hishtory skips binding control-r, yielding it to other plugins like atuin, mcfly, or fzf (e.g. `hishtory config-add control-r-yield-shells zsh`). Run `hishtory doctor` to see which plugins are competing for control-r.",
+	Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	ValidArgs: []string{"bash", "zsh", "fish"},
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		if !slices.Contains(config.ControlRYieldShells, args[0]) {
+			config.ControlRYieldShells = append(config.ControlRYieldShells, args[0])
+		}
+		lib.CheckFatalError(hctx.SetConfig(config))
+	},
+}
+
+var addPresavingDisabledShellsCmd = &cobra.Command{
+	Use:       "presaving-disabled-shells",
+	Aliases:   []string{"presaving-disabled-shell"},
+	Short:     "Add a shell in which presaving of long-running commands is disabled",
+	Long:      "Add a shell (one of: bash, zsh, fish) in which hishtory skips presaving long-running commands even when presaving is enabled (e.g. `hishtory config-add presaving-disabled-shells bash`). Useful for debugging the shell integration one piece at a time.",
+	Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	ValidArgs: []string{"bash", "zsh", "fish"},
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		if !slices.Contains(config.PresavingDisabledShells, args[0]) {
+			config.PresavingDisabledShells = append(config.PresavingDisabledShells, args[0])
+		}
+		lib.CheckFatalError(hctx.SetConfig(config))
+	},
+}
+
+var addRecordingDisabledShellsCmd = &cobra.Command{
+	Use:       "recording-disabled-shells",
+	Aliases:   []string{"recording-disabled-shell"},
+	Short:     "Add a shell in which recording of history entries is disabled",
+	Long:      "Add a shell (one of: bash, zsh, fish) in which hishtory skips recording history entries entirely, while leaving the rest of the integration (e.g. the control-r binding) active (e.g. `hishtory config-add recording-disabled-shells zsh`). To also disable the control-r binding in a shell, see `hishtory config-add control-r-yield-shells`.",
+	Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	ValidArgs: []string{"bash", "zsh", "fish"},
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		if !slices.Contains(config.RecordingDisabledShells, args[0]) {
+			config.RecordingDisabledShells = append(config.RecordingDisabledShells, args[0])
+		}
+		lib.CheckFatalError(hctx.SetConfig(config))
+	},
+}
+
+var addPauseWhenEnvCmd = &cobra.Command{
+	Use:     "pause-when-env",
+	Short:   "Add an environment variable name that pauses recording while it is set",
+	Long:    "Add an environment variable name such that commands run while it is set (to any value, including an empty string) are not recorded (e.g. `hishtory config-add pause-when-env HISTCONTROL_SECRET`). Useful for direnv-managed directories where a sensitive context is signalled via the environment.",
+	Args:    cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		for _, envVar := range args {
+			if !slices.Contains(config.PauseWhenEnvVars, envVar) {
+				config.PauseWhenEnvVars = append(config.PauseWhenEnvVars, envVar)
+			}
+		}
+		lib.CheckFatalError(hctx.SetConfig(config))
+	},
+}
+
 func init() {
 	rootCmd.AddCommand(configAddCmd)
 	configAddCmd.AddCommand(addCustomColumnsCmd)
 	configAddCmd.AddCommand(addDisplayedColumnsCmd)
+	configAddCmd.AddCommand(addColumnPresetCmd)
+	configAddCmd.AddCommand(addHostnameAliasCmd)
+	configAddCmd.AddCommand(addDeviceNameCmd)
 	configAddCmd.AddCommand(addDefaultSearchColumnsCmd)
+	configAddCmd.AddCommand(addIgnoredDirectoriesCmd)
+	configAddCmd.AddCommand(addControlRYieldShellsCmd)
+	configAddCmd.AddCommand(addPresavingDisabledShellsCmd)
+	configAddCmd.AddCommand(addRecordingDisabledShellsCmd)
+	configAddCmd.AddCommand(addPauseWhenEnvCmd)
 }
@@ -81,6 +81,57 @@ var deleteDisplayedColumnCommand = &cobra.Command{
 	},
 }
 
+var deleteColumnPresetCmd = &cobra.Command{
+	Use:     "column-preset",
+	Aliases: []string{"column-presets"},
+	Short:   "Delete a named preset of displayed columns",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		presetName := args[0]
+		if _, ok := config.ColumnPresets[presetName]; !ok {
+			log.Fatalf("Did not find a column preset with name %#v to delete (current presets = %#v)", presetName, config.ColumnPresets)
+		}
+		delete(config.ColumnPresets, presetName)
+		lib.CheckFatalError(hctx.SetConfig(config))
+	},
+}
+
+var deleteHostnameAliasCmd = &cobra.Command{
+	Use:     "hostname-alias",
+	Aliases: []string{"hostname-aliases"},
+	Short:   "Delete a hostname alias by its hostname regex",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		hostnameRegex := args[0]
+		if _, ok := config.HostnameAliases[hostnameRegex]; !ok {
+			log.Fatalf("Did not find a hostname alias with regex %#v to delete (current aliases = %#v)", hostnameRegex, config.HostnameAliases)
+		}
+		delete(config.HostnameAliases, hostnameRegex)
+		lib.CheckFatalError(hctx.SetConfig(config))
+	},
+}
+
+var deleteDeviceNameCmd = &cobra.Command{
+	Use:     "device-name",
+	Aliases: []string{"device-names"},
+	Short:   "Delete the pretty name for a device ID",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		deviceId := args[0]
+		if _, ok := config.DeviceNames[deviceId]; !ok {
+			log.Fatalf("Did not find a device name for device ID %#v to delete (current device names = %#v)", deviceId, config.DeviceNames)
+		}
+		delete(config.DeviceNames, deviceId)
+		lib.CheckFatalError(hctx.SetConfig(config))
+	},
+}
+
 var deleteDefaultSearchColumnCmd = &cobra.Command{
 	Use:     "default-search-columns",
 	Aliases: []string{"default-search-column"},
@@ -104,9 +155,112 @@ var deleteDefaultSearchColumnCmd = &cobra.Command{
 	},
 }
 
+var deleteIgnoredDirectoriesCmd = &cobra.Command{
+	Use:     "ignored-directories",
+	Aliases: []string{"ignored-directory"},
+	Short:   "Delete a directory glob where commands are never recorded",
+	Args:    cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		deletedGlobs := args
+		newGlobs := make([]string, 0)
+		for _, glob := range config.IgnoredDirectories {
+			if !slices.Contains(deletedGlobs, glob) {
+				newGlobs = append(newGlobs, glob)
+			}
+		}
+		config.IgnoredDirectories = newGlobs
+		lib.CheckFatalError(hctx.SetConfig(config))
+	},
+}
+
+var deleteControlRYieldShellsCmd = &cobra.Command{
+	Use:     "control-r-yield-shells",
+	Aliases: []string{"control-r-yield-shell"},
+	Short:   "Delete a shell for which hishtory yields the control-r binding to other plugins",
+	Args:    cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		newShells := make([]string, 0)
+		for _, shell := range config.ControlRYieldShells {
+			if !slices.Contains(args, shell) {
+				newShells = append(newShells, shell)
+			}
+		}
+		config.ControlRYieldShells = newShells
+		lib.CheckFatalError(hctx.SetConfig(config))
+	},
+}
+
+var deletePresavingDisabledShellsCmd = &cobra.Command{
+	Use:     "presaving-disabled-shells",
+	Aliases: []string{"presaving-disabled-shell"},
+	Short:   "Delete a shell in which presaving of long-running commands is disabled",
+	Args:    cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		newShells := make([]string, 0)
+		for _, shell := range config.PresavingDisabledShells {
+			if !slices.Contains(args, shell) {
+				newShells = append(newShells, shell)
+			}
+		}
+		config.PresavingDisabledShells = newShells
+		lib.CheckFatalError(hctx.SetConfig(config))
+	},
+}
+
+var deleteRecordingDisabledShellsCmd = &cobra.Command{
+	Use:     "recording-disabled-shells",
+	Aliases: []string{"recording-disabled-shell"},
+	Short:   "Delete a shell in which recording of history entries is disabled",
+	Args:    cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		newShells := make([]string, 0)
+		for _, shell := range config.RecordingDisabledShells {
+			if !slices.Contains(args, shell) {
+				newShells = append(newShells, shell)
+			}
+		}
+		config.RecordingDisabledShells = newShells
+		lib.CheckFatalError(hctx.SetConfig(config))
+	},
+}
+
+var deletePauseWhenEnvCmd = &cobra.Command{
+	Use:   "pause-when-env",
+	Short: "Delete an environment variable name that pauses recording while it is set",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		newEnvVars := make([]string, 0)
+		for _, envVar := range config.PauseWhenEnvVars {
+			if !slices.Contains(args, envVar) {
+				newEnvVars = append(newEnvVars, envVar)
+			}
+		}
+		config.PauseWhenEnvVars = newEnvVars
+		lib.CheckFatalError(hctx.SetConfig(config))
+	},
+}
+
 func init() {
 	rootCmd.AddCommand(configDeleteCmd)
 	configDeleteCmd.AddCommand(deleteCustomColumnsCmd)
 	configDeleteCmd.AddCommand(deleteDisplayedColumnCommand)
+	configDeleteCmd.AddCommand(deleteColumnPresetCmd)
+	configDeleteCmd.AddCommand(deleteHostnameAliasCmd)
+	configDeleteCmd.AddCommand(deleteDeviceNameCmd)
 	configDeleteCmd.AddCommand(deleteDefaultSearchColumnCmd)
+	configDeleteCmd.AddCommand(deleteIgnoredDirectoriesCmd)
+	configDeleteCmd.AddCommand(deleteControlRYieldShellsCmd)
+	configDeleteCmd.AddCommand(deletePresavingDisabledShellsCmd)
+	configDeleteCmd.AddCommand(deleteRecordingDisabledShellsCmd)
+	configDeleteCmd.AddCommand(deletePauseWhenEnvCmd)
 }
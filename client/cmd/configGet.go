@@ -3,6 +3,7 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"slices"
 	"strings"
 
 	"github.com/ddworken/hishtory/client/hctx"
@@ -85,6 +86,186 @@ var getPresavingCmd = &cobra.Command{
 	},
 }
 
+var getEnableOutputCaptureCmd = &cobra.Command{
+	Use:   "enable-output-capture",
+	Short: "Whether the shell hooks capture whether each command wrote to stderr (and approximately how many bytes)",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		fmt.Println(config.EnableOutputCapture)
+	},
+}
+
+var getRetentionCmd = &cobra.Command{
+	Use:   "retention",
+	Short: "The retention policy used by `hishtory prune`",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		if config.RetentionPolicy == "" {
+			fmt.Println("none")
+		} else {
+			fmt.Println(config.RetentionPolicy)
+		}
+	},
+}
+
+var getPresaveOrphanRetentionCmd = &cobra.Command{
+	Use:   "presave-orphan-retention",
+	Short: "The age after which orphaned presaved entries are cleaned up automatically",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		if config.PresaveOrphanRetention == "" {
+			fmt.Println("7d")
+		} else {
+			fmt.Println(config.PresaveOrphanRetention)
+		}
+	},
+}
+
+var getContentAddressedEntryIdsCmd = &cobra.Command{
+	Use:   "content-addressed-entry-ids",
+	Short: "Whether entry IDs are derived from a hash of the entry's contents so that duplicate commands are deduplicated server-side",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		fmt.Println(config.ContentAddressedEntryIds)
+	},
+}
+
+var getEnableTerminalMetadataCmd = &cobra.Command{
+	Use:   "enable-terminal-metadata",
+	Short: "Whether hishtory records the terminal emulator (TERM_PROGRAM) and TTY that each command ran in",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		fmt.Println(config.EnableTerminalMetadata)
+	},
+}
+
+var getEnableTuiStateRestoreCmd = &cobra.Command{
+	Use:   "enable-tui-state-restore",
+	Short: "Whether hishtory remembers the last TUI search state per terminal session so it can be restored via a keybinding",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		fmt.Println(config.EnableTuiStateRestore)
+	},
+}
+
+var getSecretScanModeCmd = &cobra.Command{
+	Use:   "secret-scan-mode",
+	Short: "Get what happens when the secret scanner matches a command (e.g. one containing an AWS key)",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		if config.SecretScanMode == "" {
+			fmt.Println("off")
+		} else {
+			fmt.Println(config.SecretScanMode)
+		}
+	},
+}
+
+var getIgnoredDirectoriesCmd = &cobra.Command{
+	Use:     "ignored-directories",
+	Aliases: []string{"ignored-directory"},
+	Short:   "The list of directory globs where commands are never recorded",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		for _, glob := range config.IgnoredDirectories {
+			fmt.Println(glob)
+		}
+	},
+}
+
+var getControlRYieldShellsCmd = &cobra.Command{
+	Use:     "control-r-yield-shells",
+	Aliases: []string{"control-r-yield-shell"},
+	Short:   "The list of shells for which hishtory yields the control-r binding to other plugins",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		for _, shell := range config.ControlRYieldShells {
+			fmt.Println(shell)
+		}
+	},
+}
+
+var getPresavingDisabledShellsCmd = &cobra.Command{
+	Use:     "presaving-disabled-shells",
+	Aliases: []string{"presaving-disabled-shell"},
+	Short:   "The list of shells in which presaving of long-running commands is disabled",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		for _, shell := range config.PresavingDisabledShells {
+			fmt.Println(shell)
+		}
+	},
+}
+
+var getRecordingDisabledShellsCmd = &cobra.Command{
+	Use:     "recording-disabled-shells",
+	Aliases: []string{"recording-disabled-shell"},
+	Short:   "The list of shells in which recording of history entries is disabled",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		for _, shell := range config.RecordingDisabledShells {
+			fmt.Println(shell)
+		}
+	},
+}
+
+var getPauseWhenEnvCmd = &cobra.Command{
+	Use:   "pause-when-env",
+	Short: "The list of environment variable names that pause recording while they are set",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		for _, envVar := range config.PauseWhenEnvVars {
+			fmt.Println(envVar)
+		}
+	},
+}
+
+var getNotificationCommandCmd = &cobra.Command{
+	Use:   "notification-command",
+	Short: "Get the shell command that runs when a long-running command on another device finishes",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		fmt.Println(config.NotificationCommand)
+	},
+}
+
+var getWebhookUrlCmd = &cobra.Command{
+	Use:   "webhook-url",
+	Short: "Get the webhook URL that `hishtory share-webhook` posts entries to",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		fmt.Println(config.WebhookUrl)
+	},
+}
+
+var getNotificationMinRuntimeCmd = &cobra.Command{
+	Use:   "notification-min-runtime",
+	Short: "Get the minimum runtime for a finished remote command to trigger the notification-command",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		if config.NotificationMinRuntime == "" {
+			fmt.Println("1m")
+		} else {
+			fmt.Println(config.NotificationMinRuntime)
+		}
+	},
+}
+
 var getBetaModeCmd = &cobra.Command{
 	Use:   "beta-mode",
 	Short: "Enable beta-mode to opt-in to unreleased features",
@@ -113,6 +294,30 @@ var getDisplayedColumnsCmd = &cobra.Command{
 	},
 }
 
+var getSyncIntervalCmd = &cobra.Command{
+	Use:   "sync-interval",
+	Short: "Get how often saved entries get pushed to the sync server",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		if config.SyncInterval == "" {
+			fmt.Println("on-command")
+		} else {
+			fmt.Println(config.SyncInterval)
+		}
+	},
+}
+
+var getLazySearchFetchCmd = &cobra.Command{
+	Use:   "lazy-search-fetch",
+	Short: "Whether queries lazily fetch the most recent remote entries while the initial device sync is still incomplete",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		fmt.Println(config.LazySearchFetch)
+	},
+}
+
 var getTimestampFormatCmd = &cobra.Command{
 	Use:   "timestamp-format",
 	Short: "The go format string to use for formatting the timestamp",
@@ -136,6 +341,68 @@ var getCustomColumnsCmd = &cobra.Command{
 	},
 }
 
+var getColumnPresetsCmd = &cobra.Command{
+	Use:     "column-presets",
+	Aliases: []string{"column-preset"},
+	Short:   "The named presets of displayed columns",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		presetNames := make([]string, 0, len(config.ColumnPresets))
+		for presetName := range config.ColumnPresets {
+			presetNames = append(presetNames, presetName)
+		}
+		slices.Sort(presetNames)
+		for _, presetName := range presetNames {
+			fmt.Print(presetName + ":   ")
+			for _, col := range config.ColumnPresets[presetName] {
+				if strings.Contains(col, " ") {
+					fmt.Printf("%q ", col)
+				} else {
+					fmt.Print(col + " ")
+				}
+			}
+			fmt.Print("\n")
+		}
+	},
+}
+
+var getHostnameAliasesCmd = &cobra.Command{
+	Use:     "hostname-aliases",
+	Aliases: []string{"hostname-alias"},
+	Short:   "The map from hostname regex to display alias",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		hostnameRegexes := make([]string, 0, len(config.HostnameAliases))
+		for hostnameRegex := range config.HostnameAliases {
+			hostnameRegexes = append(hostnameRegexes, hostnameRegex)
+		}
+		slices.Sort(hostnameRegexes)
+		for _, hostnameRegex := range hostnameRegexes {
+			fmt.Println(hostnameRegex + ":   " + config.HostnameAliases[hostnameRegex])
+		}
+	},
+}
+
+var getDeviceNamesCmd = &cobra.Command{
+	Use:     "device-names",
+	Aliases: []string{"device-name"},
+	Short:   "The map from device ID to pretty display name",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		deviceIds := make([]string, 0, len(config.DeviceNames))
+		for deviceId := range config.DeviceNames {
+			deviceIds = append(deviceIds, deviceId)
+		}
+		slices.Sort(deviceIds)
+		for _, deviceId := range deviceIds {
+			fmt.Println(deviceId + ":   " + config.DeviceNames[deviceId])
+		}
+	},
+}
+
 var getColorScheme = &cobra.Command{
 	Use:   "color-scheme",
 	Short: "Get the currently configured color scheme for selected text in the TUI",
@@ -168,6 +435,80 @@ var getAiCompletionEndpoint = &cobra.Command{
 	},
 }
 
+var getDbSizeWarningThreshold = &cobra.Command{
+	Use:   "db-size-warning-threshold",
+	Short: "Get the DB size (in megabytes) above which hishtory will periodically warn you to prune your history",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		fmt.Println(config.DbSizeWarningThresholdMb)
+	},
+}
+
+var getDbCountWarningThreshold = &cobra.Command{
+	Use:   "db-count-warning-threshold",
+	Short: "Get the number of history entries above which hishtory will periodically warn you to prune your history",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		fmt.Println(config.DbCountWarningThreshold)
+	},
+}
+
+var getMaxDbSize = &cobra.Command{
+	Use:   "max-db-size",
+	Short: "Get the maximum size of the local DB (in megabytes), above which the oldest entries are evicted locally",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		fmt.Println(config.MaxDbSizeMb)
+	},
+}
+
+var getNonPrintableCommandPolicy = &cobra.Command{
+	Use:   "non-printable-command-policy",
+	Short: "Get what happens to commands that are mostly non-printable characters (e.g. a pasted binary blob)",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		if config.NonPrintableCommandPolicy == "" {
+			fmt.Println("sanitize")
+		} else {
+			fmt.Println(config.NonPrintableCommandPolicy)
+		}
+	},
+}
+
+var getMaxCommandLength = &cobra.Command{
+	Use:   "max-command-length",
+	Short: "Get the maximum length (in bytes) of a stored command, above which commands are truncated with an explicit marker",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		fmt.Println(config.MaxCommandLength)
+	},
+}
+
+var getAiCompletionBackend = &cobra.Command{
+	Use:   "ai-completion-backend",
+	Short: "The backend to use for AI completions",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		fmt.Println(config.AiCompletionBackend)
+	},
+}
+
+var getAiCompletionContext = &cobra.Command{
+	Use:   "ai-completion-context",
+	Short: "The number of recent commands to include as context in AI completion prompts",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		fmt.Println(config.AiCompletionContextCommands)
+	},
+}
+
 var getDefaultSearchColumns = &cobra.Command{
 	Use:   "default-search-columns",
 	Short: "Get the list of columns that are used for \"default\" search queries that don't use any search atoms",
@@ -188,17 +529,44 @@ func init() {
 	configGetCmd.AddCommand(getDisplayedColumnsCmd)
 	configGetCmd.AddCommand(getTimestampFormatCmd)
 	configGetCmd.AddCommand(getCustomColumnsCmd)
+	configGetCmd.AddCommand(getColumnPresetsCmd)
+	configGetCmd.AddCommand(getHostnameAliasesCmd)
+	configGetCmd.AddCommand(getDeviceNamesCmd)
 	configGetCmd.AddCommand(getBetaModeCmd)
 	configGetCmd.AddCommand(getHighlightMatchesCmd)
 	configGetCmd.AddCommand(getEnableAiCompletion)
 	configGetCmd.AddCommand(getPresavingCmd)
+	configGetCmd.AddCommand(getEnableOutputCaptureCmd)
+	configGetCmd.AddCommand(getEnableTerminalMetadataCmd)
+	configGetCmd.AddCommand(getContentAddressedEntryIdsCmd)
+	configGetCmd.AddCommand(getRetentionCmd)
+	configGetCmd.AddCommand(getPresaveOrphanRetentionCmd)
 	configGetCmd.AddCommand(getColorScheme)
 	configGetCmd.AddCommand(getDefaultFilterCmd)
 	configGetCmd.AddCommand(getAiCompletionEndpoint)
+	configGetCmd.AddCommand(getAiCompletionBackend)
+	configGetCmd.AddCommand(getAiCompletionContext)
 	configGetCmd.AddCommand(getCompactMode)
 	configGetCmd.AddCommand(getLogLevelCmd)
 	configGetCmd.AddCommand(getFullScreenCmd)
 	configGetCmd.AddCommand(getDefaultSearchColumns)
+	configGetCmd.AddCommand(getDbSizeWarningThreshold)
+	configGetCmd.AddCommand(getDbCountWarningThreshold)
+	configGetCmd.AddCommand(getMaxDbSize)
+	configGetCmd.AddCommand(getMaxCommandLength)
+	configGetCmd.AddCommand(getNonPrintableCommandPolicy)
+	configGetCmd.AddCommand(getEnableTuiStateRestoreCmd)
+	configGetCmd.AddCommand(getIgnoredDirectoriesCmd)
+	configGetCmd.AddCommand(getControlRYieldShellsCmd)
+	configGetCmd.AddCommand(getPresavingDisabledShellsCmd)
+	configGetCmd.AddCommand(getRecordingDisabledShellsCmd)
+	configGetCmd.AddCommand(getPauseWhenEnvCmd)
+	configGetCmd.AddCommand(getSecretScanModeCmd)
+	configGetCmd.AddCommand(getSyncIntervalCmd)
+	configGetCmd.AddCommand(getNotificationCommandCmd)
+	configGetCmd.AddCommand(getNotificationMinRuntimeCmd)
+	configGetCmd.AddCommand(getWebhookUrlCmd)
+	configGetCmd.AddCommand(getLazySearchFetchCmd)
 }
 
 var getLogLevelCmd = &cobra.Command{
@@ -6,7 +6,9 @@ import (
 	"log"
 	"os"
 	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ddworken/hishtory/client/hctx"
 	"github.com/ddworken/hishtory/client/lib"
@@ -125,6 +127,99 @@ var setPresavingCmd = &cobra.Command{
 	},
 }
 
+var setEnableOutputCaptureCmd = &cobra.Command{
+	Use:       "enable-output-capture",
+	Short:     "Whether the shell hooks capture whether each command wrote to stderr (and approximately how many bytes)",
+	Long:      "If enabled, entries can be searched via `had_stderr:true` and `output_size:>100`. Requires restarting your shell to take effect, and is currently only supported for bash and zsh.",
+	Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	ValidArgs: []string{"true", "false"},
+	Run: func(cmd *cobra.Command, args []string) {
+		val := args[0]
+		if val != "true" && val != "false" {
+			log.Fatalf("Unexpected config value %s, must be one of: true, false", val)
+		}
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		config.EnableOutputCapture = (val == "true")
+		lib.CheckFatalError(hctx.SetConfig(config))
+		fmt.Println("Updated output capturing, please restart your shell for this to take effect...")
+	},
+}
+
+var setRetentionCmd = &cobra.Command{
+	Use:   "retention",
+	Short: "Set the retention policy used by `hishtory prune` (e.g. 90d, 26w, 6m, or 1y; set to none to disable)",
+	Long:  "Note that entries older than the retention policy are only deleted when `hishtory prune` is run, not automatically.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		if args[0] == "none" {
+			config.RetentionPolicy = ""
+		} else {
+			_, err := lib.ParseRetentionDuration(args[0])
+			lib.CheckFatalError(err)
+			config.RetentionPolicy = args[0]
+		}
+		lib.CheckFatalError(hctx.SetConfig(config))
+	},
+}
+
+var setPresaveOrphanRetentionCmd = &cobra.Command{
+	Use:   "presave-orphan-retention",
+	Short: "Set the age after which orphaned presaved entries are cleaned up automatically (e.g. 7d or 2w; set to none to disable)",
+	Long:  "Presaved entries from shells that crashed before their command finished are deleted automatically once they're older than this threshold (default 7d). Set to none to disable the automatic cleanup and only delete them manually via `hishtory prune --presaved`.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		if args[0] == "none" {
+			config.PresaveOrphanRetention = "none"
+		} else {
+			_, err := lib.ParseRetentionDuration(args[0])
+			lib.CheckFatalError(err)
+			config.PresaveOrphanRetention = args[0]
+		}
+		lib.CheckFatalError(hctx.SetConfig(config))
+	},
+}
+
+var setContentAddressedEntryIdsCmd = &cobra.Command{
+	Use:       "content-addressed-entry-ids",
+	Short:     "Whether entry IDs are derived from a hash of the entry's contents so that duplicate commands are deduplicated server-side",
+	Long:      "If enabled, entry IDs are derived from a hash of (command, start time, hostname, cwd) rather than a random UUID, so recording or importing the same command twice doesn't create near-duplicate entries. Use `hishtory dedup` to collapse duplicates that already exist.",
+	Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	ValidArgs: []string{"true", "false"},
+	Run: func(cmd *cobra.Command, args []string) {
+		val := args[0]
+		if val != "true" && val != "false" {
+			log.Fatalf("Unexpected config value %s, must be one of: true, false", val)
+		}
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		config.ContentAddressedEntryIds = (val == "true")
+		lib.CheckFatalError(hctx.SetConfig(config))
+	},
+}
+
+var setEnableTerminalMetadataCmd = &cobra.Command{
+	Use:       "enable-terminal-metadata",
+	Short:     "Whether hishtory records the terminal emulator (TERM_PROGRAM) and TTY that each command ran in",
+	Long:      "If enabled, entries can be searched via `tty:` and `terminal:` and displayed via the Terminal and TTY columns. Off by default.",
+	Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	ValidArgs: []string{"true", "false"},
+	Run: func(cmd *cobra.Command, args []string) {
+		val := args[0]
+		if val != "true" && val != "false" {
+			log.Fatalf("Unexpected config value %s, must be one of: true, false", val)
+		}
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		config.EnableTerminalMetadata = (val == "true")
+		lib.CheckFatalError(hctx.SetConfig(config))
+	},
+}
+
 var setHighlightMatchesCmd = &cobra.Command{
 	Use:       "highlight-matches",
 	Short:     "Enable highlight-matches to enable highlighting of matches in the search results",
@@ -247,6 +342,37 @@ var setAiCompletionEndpoint = &cobra.Command{
 	},
 }
 
+var setAiCompletionBackend = &cobra.Command{
+	Use:       "ai-completion-backend",
+	Short:     "The backend to use for AI completions",
+	Long:      "Set to `openai` (the default) for the OpenAI chat completions schema, or `ollama` for Ollama/llama.cpp style local endpoints that require no API key. When using `ollama`, also set `ai-completion-endpoint` (defaults to http://localhost:11434/api/chat) and the OLLAMA_MODEL environment variable.",
+	Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	ValidArgs: []string{"openai", "ollama"},
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		config.AiCompletionBackend = args[0]
+		lib.CheckFatalError(hctx.SetConfig(config))
+	},
+}
+
+var setAiCompletionContext = &cobra.Command{
+	Use:   "ai-completion-context",
+	Short: "The number of recent commands to include as context in AI completion prompts (set to 0 to share no context)",
+	Long:  "If set to a non-zero value, AI completion prompts will include your N most recent commands along with your current working directory and OS, so that suggestions are tailored to your environment. Note that this context is sent to whichever AI backend you have configured, so only enable this if you are comfortable sharing recent commands with that backend.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		numCommands, err := strconv.Atoi(args[0])
+		if err != nil || numCommands < 0 {
+			lib.CheckFatalError(fmt.Errorf("invalid value %q, must be a non-negative integer", args[0]))
+		}
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		config.AiCompletionContextCommands = numCommands
+		lib.CheckFatalError(hctx.SetConfig(config))
+	},
+}
+
 var setLogLevelCmd = &cobra.Command{
 	Use:       "log-level",
 	Short:     "Set the log level for hishtory logs",
@@ -290,6 +416,208 @@ func validateDefaultSearchColumns(ctx context.Context, columns []string) error {
 	return nil
 }
 
+var setDbSizeWarningThreshold = &cobra.Command{
+	Use:   "db-size-warning-threshold",
+	Short: "Set the DB size (in megabytes) above which hishtory will periodically warn you to prune your history (set to -1 to disable)",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		threshold, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			lib.CheckFatalError(fmt.Errorf("invalid threshold %q, must be an integer number of megabytes: %v", args[0], err))
+		}
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		config.DbSizeWarningThresholdMb = threshold
+		lib.CheckFatalError(hctx.SetConfig(config))
+	},
+}
+
+var setDbCountWarningThreshold = &cobra.Command{
+	Use:   "db-count-warning-threshold",
+	Short: "Set the number of history entries above which hishtory will periodically warn you to prune your history (set to -1 to disable)",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		threshold, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			lib.CheckFatalError(fmt.Errorf("invalid threshold %q, must be an integer: %v", args[0], err))
+		}
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		config.DbCountWarningThreshold = threshold
+		lib.CheckFatalError(hctx.SetConfig(config))
+	},
+}
+
+var setMaxDbSize = &cobra.Command{
+	Use:   "max-db-size",
+	Short: "Set the maximum size of the local DB (in megabytes), above which the oldest entries are evicted locally (set to 0 to disable)",
+	Long:  "This is meant for constrained devices: when the local DB exceeds this size, the oldest entries are periodically evicted from the local DB. Remote copies on other devices are left intact, so evicted entries are still available on your other machines.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		maxSize, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil || maxSize < 0 {
+			lib.CheckFatalError(fmt.Errorf("invalid max DB size %q, must be a non-negative integer: %v", args[0], err))
+		}
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		config.MaxDbSizeMb = maxSize
+		lib.CheckFatalError(hctx.SetConfig(config))
+	},
+}
+
+var setSecretScanModeCmd = &cobra.Command{
+	Use:       "secret-scan-mode",
+	Short:     "Set what happens when the secret scanner matches a command (e.g. one containing an AWS key or a --password= flag)",
+	Long:      "One of: `off` (the default) to record matched commands unchanged, `mask` to replace the matched substring before recording, `skip` to not record them at all, or `local-only` to record them without ever uploading them to the sync server.",
+	Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	ValidArgs: []string{"off", "mask", "skip", "local-only"},
+	Run: func(cmd *cobra.Command, args []string) {
+		val := args[0]
+		if val != "off" && val != "mask" && val != "skip" && val != "local-only" {
+			log.Fatalf("Unexpected config value %s, must be one of: off, mask, skip, local-only", val)
+		}
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		config.SecretScanMode = val
+		lib.CheckFatalError(hctx.SetConfig(config))
+	},
+}
+
+var setSyncIntervalCmd = &cobra.Command{
+	Use:   "sync-interval",
+	Short: "Set how often saved entries get pushed to the sync server, trading immediacy for fewer backend requests",
+	Long:  "Either `on-command` (the default) to push every saved command immediately, or a duration like `30s` or `5m` to batch saves locally and push them together once the interval has elapsed.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		val := args[0]
+		if val != "on-command" {
+			if _, err := parseDigestDuration(val); err != nil {
+				log.Fatalf("Unexpected config value %s, must be on-command or a duration like 30s or 5m", val)
+			}
+		}
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		config.SyncInterval = val
+		lib.CheckFatalError(hctx.SetConfig(config))
+	},
+}
+
+var setNotificationCommandCmd = &cobra.Command{
+	Use:   "notification-command",
+	Short: "Set the shell command to run when a long-running command on another device finishes",
+	Long:  "Set the shell command that is run when a long-running command recorded on one of your other devices finishes and its entry syncs in, e.g. `hishtory config-set notification-command 'notify-send hiSHtory \"$HISHTORY_COMMAND finished on $HISHTORY_HOSTNAME\"'`. The entry's details are exposed via the HISHTORY_COMMAND, HISHTORY_HOSTNAME, HISHTORY_RUNTIME, and HISHTORY_EXIT_CODE environment variables. Set it to an empty string to disable notifications, and see `hishtory config-set notification-min-runtime` for tuning which commands trigger it.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		config.NotificationCommand = args[0]
+		lib.CheckFatalError(hctx.SetConfig(config))
+	},
+}
+
+var setWebhookUrlCmd = &cobra.Command{
+	Use:   "webhook-url",
+	Short: "Set the webhook URL that `hishtory share-webhook` posts entries to",
+	Long:  "Set the webhook URL that `hishtory share-webhook` (and the matching TUI keybinding) posts the selected entry to. The payload is a JSON object with a single \"text\" field, so any Slack-compatible incoming webhook works. Set it to an empty string to disable sharing to a webhook.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if args[0] != "" && !strings.HasPrefix(args[0], "http://") && !strings.HasPrefix(args[0], "https://") {
+			log.Fatalf("Unexpected config value %s, must be an http:// or https:// URL (or an empty string to disable)", args[0])
+		}
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		config.WebhookUrl = args[0]
+		lib.CheckFatalError(hctx.SetConfig(config))
+	},
+}
+
+var setNotificationMinRuntimeCmd = &cobra.Command{
+	Use:   "notification-min-runtime",
+	Short: "Set the minimum runtime for a finished remote command to trigger the notification-command",
+	Long:  "Set how long a command recorded on another device must have run for its completion to trigger the notification-command, as a duration like `30s` or `5m` (default: 1m).",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if _, err := time.ParseDuration(args[0]); err != nil {
+			log.Fatalf("Unexpected config value %s, must be a duration like 30s or 5m", args[0])
+		}
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		config.NotificationMinRuntime = args[0]
+		lib.CheckFatalError(hctx.SetConfig(config))
+	},
+}
+
+var setLazySearchFetchCmd = &cobra.Command{
+	Use:       "lazy-search-fetch",
+	Short:     "Whether queries lazily fetch the most recent remote entries while the initial device sync is still incomplete",
+	Long:      "If enabled, searching on a brand new device fetches and decrypts the most recent entries from the sync server on demand, so searches cover recent history even before the full download finishes. Entries stay end-to-end encrypted, they're just downloaded lazily. Has no effect once the initial sync completes.",
+	Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	ValidArgs: []string{"true", "false"},
+	Run: func(cmd *cobra.Command, args []string) {
+		val := args[0]
+		if val != "true" && val != "false" {
+			log.Fatalf("Unexpected config value %s, must be one of: true, false", val)
+		}
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		config.LazySearchFetch = (val == "true")
+		lib.CheckFatalError(hctx.SetConfig(config))
+	},
+}
+
+var setEnableTuiStateRestoreCmd = &cobra.Command{
+	Use:       "enable-tui-state-restore",
+	Short:     "Whether hishtory remembers the last TUI search state per terminal session so it can be restored via a keybinding",
+	Long:      "If enabled, the last search query, cursor position, and displayed columns are remembered per terminal session and can be restored by pressing ctrl+g in the TUI, so accidentally hitting escape doesn't lose a carefully built filter.",
+	Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	ValidArgs: []string{"true", "false"},
+	Run: func(cmd *cobra.Command, args []string) {
+		val := args[0]
+		if val != "true" && val != "false" {
+			log.Fatalf("Unexpected config value %s, must be one of: true, false", val)
+		}
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		config.EnableTuiStateRestore = (val == "true")
+		lib.CheckFatalError(hctx.SetConfig(config))
+	},
+}
+
+var setNonPrintableCommandPolicy = &cobra.Command{
+	Use:       "non-printable-command-policy",
+	Short:     "Set what happens to commands that are mostly non-printable characters (e.g. a pasted binary blob)",
+	Long:      "One of: `sanitize` (the default) to replace the non-printable characters and record the rest, `skip` to not record the command at all, or `keep` to record it unchanged.",
+	Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	ValidArgs: []string{"sanitize", "skip", "keep"},
+	Run: func(cmd *cobra.Command, args []string) {
+		val := args[0]
+		if val != "sanitize" && val != "skip" && val != "keep" {
+			log.Fatalf("Unexpected config value %s, must be one of: sanitize, skip, keep", val)
+		}
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		config.NonPrintableCommandPolicy = val
+		lib.CheckFatalError(hctx.SetConfig(config))
+	},
+}
+
+var setMaxCommandLength = &cobra.Command{
+	Use:   "max-command-length",
+	Short: "Set the maximum length (in bytes) of a stored command, above which commands are truncated with an explicit marker (set to -1 to disable)",
+	Long:  "Truncated entries are marked with `" + lib.CommandTruncationMarker + "` and can be listed via `hishtory doctor`.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		maxLength, err := strconv.Atoi(args[0])
+		if err != nil || maxLength == 0 {
+			lib.CheckFatalError(fmt.Errorf("invalid max command length %q, must be a positive integer (or -1 to disable): %v", args[0], err))
+		}
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		config.MaxCommandLength = maxLength
+		lib.CheckFatalError(hctx.SetConfig(config))
+	},
+}
+
 var setDefaultSearchColumns = &cobra.Command{
 	Use:   "default-search-columns",
 	Short: "Set the list of columns that are used for \"default\" search queries that don't use any search atoms",
@@ -317,13 +645,32 @@ func init() {
 	configSetCmd.AddCommand(setHighlightMatchesCmd)
 	configSetCmd.AddCommand(setEnableAiCompletionCmd)
 	configSetCmd.AddCommand(setPresavingCmd)
+	configSetCmd.AddCommand(setEnableOutputCaptureCmd)
+	configSetCmd.AddCommand(setEnableTerminalMetadataCmd)
+	configSetCmd.AddCommand(setContentAddressedEntryIdsCmd)
+	configSetCmd.AddCommand(setRetentionCmd)
+	configSetCmd.AddCommand(setPresaveOrphanRetentionCmd)
 	configSetCmd.AddCommand(setColorSchemeCmd)
 	configSetCmd.AddCommand(setDefaultFilterCommand)
 	configSetCmd.AddCommand(setAiCompletionEndpoint)
+	configSetCmd.AddCommand(setAiCompletionBackend)
+	configSetCmd.AddCommand(setAiCompletionContext)
 	configSetCmd.AddCommand(compactMode)
 	configSetCmd.AddCommand(setLogLevelCmd)
 	configSetCmd.AddCommand(setFullScreenCmd)
 	configSetCmd.AddCommand(setDefaultSearchColumns)
+	configSetCmd.AddCommand(setDbSizeWarningThreshold)
+	configSetCmd.AddCommand(setDbCountWarningThreshold)
+	configSetCmd.AddCommand(setMaxDbSize)
+	configSetCmd.AddCommand(setMaxCommandLength)
+	configSetCmd.AddCommand(setNonPrintableCommandPolicy)
+	configSetCmd.AddCommand(setEnableTuiStateRestoreCmd)
+	configSetCmd.AddCommand(setSecretScanModeCmd)
+	configSetCmd.AddCommand(setSyncIntervalCmd)
+	configSetCmd.AddCommand(setNotificationCommandCmd)
+	configSetCmd.AddCommand(setNotificationMinRuntimeCmd)
+	configSetCmd.AddCommand(setWebhookUrlCmd)
+	configSetCmd.AddCommand(setLazySearchFetchCmd)
 	setColorSchemeCmd.AddCommand(setColorSchemeSelectedText)
 	setColorSchemeCmd.AddCommand(setColorSchemeSelectedBackground)
 	setColorSchemeCmd.AddCommand(setColorSchemeBorderColor)
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ddworken/hishtory/client/hctx"
+	"github.com/ddworken/hishtory/client/lib"
+
+	"github.com/spf13/cobra"
+)
+
+var configSyncCmd = &cobra.Command{
+	Use:       "config-sync",
+	Short:     "Sync selected config options (displayed columns, custom columns, color scheme, and the default filter) across devices",
+	GroupID:   GROUP_ID_CONFIG,
+	Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	ValidArgs: []string{"enable", "disable", "push", "pull"},
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		switch args[0] {
+		case "enable":
+			config.EnableConfigSync = true
+			lib.CheckFatalError(hctx.SetConfig(config))
+			lib.CheckFatalError(lib.UploadSyncedConfig(ctx))
+			fmt.Println("Enabled config syncing and uploaded this device's config. Other devices will pick it up automatically once they also enable config syncing.")
+		case "disable":
+			config.EnableConfigSync = false
+			lib.CheckFatalError(hctx.SetConfig(config))
+			fmt.Println("Disabled config syncing for this device")
+		case "push":
+			lib.CheckFatalError(lib.UploadSyncedConfig(ctx))
+			fmt.Println("Uploaded this device's config to the backend")
+		case "pull":
+			applied, err := lib.DownloadSyncedConfig(ctx)
+			lib.CheckFatalError(err)
+			if applied {
+				fmt.Println("Downloaded and applied the synced config from the backend")
+			} else {
+				fmt.Println("No synced config found, run `hishtory config-sync push` on another device first")
+			}
+		default:
+			lib.CheckFatalError(cmd.Help())
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configSyncCmd)
+}
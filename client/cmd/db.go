@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+
+	"github.com/ddworken/hishtory/client/data"
+	"github.com/ddworken/hishtory/client/hctx"
+	"github.com/ddworken/hishtory/client/lib"
+
+	"github.com/fatih/color"
+	"github.com/glebarez/sqlite"
+	"github.com/rodaine/table"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+var dbCmd = &cobra.Command{
+	Use:     "db",
+	Short:   "Inspect the local hishtory DB directly, as an escape hatch for reports that the query language can't express",
+	GroupID: GROUP_ID_MANAGEMENT,
+}
+
+var dbShellWrite *bool
+
+var dbShellCmd = &cobra.Command{
+	Use:   "shell",
+	Short: "Open an interactive sqlite3 shell against the local hishtory DB (read-only by default)",
+	Long:  "Open an interactive sqlite3 shell against the local hishtory DB. The DB uses WAL journaling, so this is safe to run while hishtory is in use. The shell is opened read-only by default so that stray statements can't corrupt your history; pass --write to open it read-write.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		lib.CheckFatalError(dbShell(ctx, *dbShellWrite))
+	},
+}
+
+var dbQueryJson *bool
+
+var dbQueryCmd = &cobra.Command{
+	Use:   "query '<SQL>'",
+	Short: "Run a read-only SQL query against the local hishtory DB and display the results",
+	Long:  "Run a SQL query against the local hishtory DB and display the results as a table (or as JSON via --json). The query runs over a dedicated read-only connection, so statements that would modify the DB fail.\n\nExample queries:\n'hishtory db query 'SELECT hostname, COUNT(*) FROM history_entries GROUP BY hostname''\n'hishtory db query 'SELECT command, exit_code FROM history_entries ORDER BY start_time DESC LIMIT 5' --json'",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		lib.CheckFatalError(dbQuery(ctx, args[0], *dbQueryJson))
+	},
+}
+
+func dbShell(ctx context.Context, write bool) error {
+	sqlite3Path, err := exec.LookPath("sqlite3")
+	if err != nil {
+		return fmt.Errorf("failed to find the sqlite3 binary (install it via your package manager to use `hishtory db shell`): %w", err)
+	}
+	dbPath := path.Join(hctx.GetHome(ctx), data.GetHishtoryPath(), data.DB_PATH)
+	cmdArgs := []string{}
+	if !write {
+		cmdArgs = append(cmdArgs, "-readonly")
+	}
+	cmdArgs = append(cmdArgs, dbPath)
+	shellCmd := exec.Command(sqlite3Path, cmdArgs...)
+	shellCmd.Stdin = os.Stdin
+	shellCmd.Stdout = os.Stdout
+	shellCmd.Stderr = os.Stderr
+	return shellCmd.Run()
+}
+
+func dbQuery(ctx context.Context, query string, asJson bool) error {
+	// Open a dedicated read-only connection so that the given SQL can't modify the DB. Note that
+	// a PRAGMA on the shared gorm handle wouldn't be enough, since gorm pools connections and the
+	// query could run on a different connection than the one the PRAGMA ran on.
+	dbPath := path.Join(hctx.GetHome(ctx), data.GetHishtoryPath(), data.DB_PATH)
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=ro", dbPath)), &gorm.Config{SkipDefaultTransaction: true})
+	if err != nil {
+		return fmt.Errorf("failed to open a read-only connection to the DB at %s: %w", dbPath, err)
+	}
+	rows, err := db.Raw(query).Rows()
+	if err != nil {
+		return fmt.Errorf("failed to run the query: %w", err)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("failed to get the query's columns: %w", err)
+	}
+	resultRows := make([][]any, 0)
+	for rows.Next() {
+		values := make([]any, len(columns))
+		scanTargets := make([]any, len(columns))
+		for i := range values {
+			scanTargets[i] = &values[i]
+		}
+		if err := rows.Scan(scanTargets...); err != nil {
+			return fmt.Errorf("failed to scan a result row: %w", err)
+		}
+		for i, value := range values {
+			// sqlite returns TEXT columns as []byte, which would otherwise display as raw bytes
+			// (and base64-encode in JSON)
+			if b, ok := value.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		resultRows = append(resultRows, values)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate over the query results: %w", err)
+	}
+	if asJson {
+		jsonRows := make([]map[string]any, 0, len(resultRows))
+		for _, row := range resultRows {
+			jsonRow := make(map[string]any, len(columns))
+			for i, column := range columns {
+				jsonRow[column] = row[i]
+			}
+			jsonRows = append(jsonRows, jsonRow)
+		}
+		serialized, err := json.MarshalIndent(jsonRows, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to serialize the query results to JSON: %w", err)
+		}
+		fmt.Println(string(serialized))
+		return nil
+	}
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	headers := make([]any, 0, len(columns))
+	for _, column := range columns {
+		headers = append(headers, column)
+	}
+	tbl := table.New(headers...)
+	tbl.WithHeaderFormatter(headerFmt)
+	for _, row := range resultRows {
+		tbl.AddRow(row...)
+	}
+	tbl.Print()
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(dbCmd)
+	dbCmd.AddCommand(dbShellCmd)
+	dbCmd.AddCommand(dbQueryCmd)
+	dbShellWrite = dbShellCmd.Flags().Bool("write", false, "Open the DB read-write rather than read-only")
+	dbQueryJson = dbQueryCmd.Flags().Bool("json", false, "Display the results as JSON rather than as a table")
+}
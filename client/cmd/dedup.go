@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ddworken/hishtory/client/data"
+	"github.com/ddworken/hishtory/client/hctx"
+	"github.com/ddworken/hishtory/client/lib"
+
+	"github.com/spf13/cobra"
+)
+
+var dedupCmd = &cobra.Command{
+	Use:     "dedup",
+	Short:   "Collapse duplicate history entries and delete the extras",
+	Long:    "Entries are considered duplicates if they have the same command, start time, hostname, and working directory (e.g. from re-importing the same history file, or from re-installing hishtory). The first entry in each group of duplicates is kept, and the extras are deleted on the current machine and on all remote machines.",
+	GroupID: GROUP_ID_MANAGEMENT,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		lib.CheckFatalError(lib.RetrieveAdditionalEntriesFromRemote(ctx, "dedup"))
+		lib.CheckFatalError(lib.ProcessDeletionRequests(ctx))
+		lib.CheckFatalError(dedup(ctx, os.Getenv("HISHTORY_REDACT_FORCE") != ""))
+	},
+}
+
+func dedup(ctx context.Context, skipUserConfirmation bool) error {
+	db := hctx.GetDb(ctx)
+	var historyEntries []*data.HistoryEntry
+	res := db.Model(&data.HistoryEntry{}).Order("start_time ASC").Find(&historyEntries)
+	if res.Error != nil {
+		return res.Error
+	}
+	seenEntries := make(map[string]bool)
+	var duplicates []*data.HistoryEntry
+	for _, entry := range historyEntries {
+		// Group entries by their content-addressed ID, which hashes exactly the fields that
+		// define a duplicate
+		key := data.ContentAddressedEntryId(entry)
+		if seenEntries[key] {
+			duplicates = append(duplicates, entry)
+		} else {
+			seenEntries[key] = true
+		}
+	}
+	if len(duplicates) == 0 {
+		fmt.Println("No duplicate history entries found")
+		return nil
+	}
+	if skipUserConfirmation {
+		fmt.Printf("Permanently deleting %d duplicate entries\n", len(duplicates))
+	} else {
+		fmt.Printf("This will permanently delete %d duplicate entries, are you sure? [y/N] ", len(duplicates))
+		reader := bufio.NewReader(os.Stdin)
+		resp, err := reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read response: %w", err)
+		}
+		if strings.TrimSpace(resp) != "y" {
+			fmt.Printf("Aborting dedup per user response of %#v\n", strings.TrimSpace(resp))
+			return nil
+		}
+	}
+	for _, entry := range duplicates {
+		// Delete by (entry_id, device_id) rather than just entry_id, since with content-addressed
+		// entry IDs the kept entry may share an entry ID with the duplicate being deleted
+		res := db.Where("entry_id = ? AND device_id = ?", entry.EntryId, entry.DeviceId).Delete(&data.HistoryEntry{})
+		if res.Error != nil {
+			return res.Error
+		}
+	}
+	_, err := deleteOnRemoteInstances(ctx, duplicates)
+	return err
+}
+
+func init() {
+	rootCmd.AddCommand(dedupCmd)
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/ddworken/hishtory/client/data"
+	"github.com/ddworken/hishtory/client/hctx"
+	"github.com/ddworken/hishtory/shared/testutils"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDedup(t *testing.T) {
+	ctx, restore := makeOfflineTestContext(t)
+	defer restore()
+	db := hctx.GetDb(ctx)
+
+	// Insert an entry plus an exact duplicate (same command, start time, hostname, and working
+	// directory, e.g. from re-importing the same history file) from a different device
+	entry := testutils.MakeFakeHistoryEntry("echo duplicated")
+	require.NoError(t, db.Create(&entry).Error)
+	duplicate := entry
+	duplicate.EntryId = uuid.Must(uuid.NewRandom()).String()
+	duplicate.DeviceId = "other_device_id"
+	require.NoError(t, db.Create(&duplicate).Error)
+	otherEntry := testutils.MakeFakeHistoryEntry("echo unique")
+	require.NoError(t, db.Create(&otherEntry).Error)
+
+	// Deduping keeps one copy of the duplicated entry and leaves the unique entry alone
+	require.NoError(t, dedup(ctx, true))
+	var entries []*data.HistoryEntry
+	require.NoError(t, db.Order("start_time").Find(&entries).Error)
+	require.Len(t, entries, 2)
+	require.Equal(t, "echo duplicated", entries[0].Command)
+	require.Equal(t, "echo unique", entries[1].Command)
+
+	// Re-running is a no-op
+	require.NoError(t, dedup(ctx, true))
+	var count int64
+	require.NoError(t, db.Model(&data.HistoryEntry{}).Count(&count).Error)
+	require.Equal(t, int64(2), count)
+}
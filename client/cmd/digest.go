@@ -0,0 +1,320 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ddworken/hishtory/client/data"
+	"github.com/ddworken/hishtory/client/hctx"
+	"github.com/ddworken/hishtory/client/lib"
+
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+var (
+	digestSince  *string
+	digestFormat *string
+)
+
+var digestCmd = &cobra.Command{
+	Use:     "digest",
+	Short:   "Generate a digest of notable shell history activity, suitable for a weekly cron+mail job",
+	Long:    "Summarizes the history entries recorded in the given time window: new hosts used, top commands, failure spikes, and long-running jobs. Outputs plain text by default, or email-friendly HTML with --format html.",
+	GroupID: GROUP_ID_MANAGEMENT,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		since, err := parseDigestDuration(*digestSince)
+		lib.CheckFatalError(err)
+		lib.CheckFatalError(generateDigest(ctx, os.Stdout, since, *digestFormat))
+	},
+}
+
+// parseDigestDuration parses durations like "7d" (which time.ParseDuration doesn't support) in
+// addition to standard durations like "24h"
+func parseDigestDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse duration %#v: %w", s, err)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse duration %#v: %w", s, err)
+	}
+	return duration, nil
+}
+
+// The data that gets rendered into a digest, computed from the entries in the requested window
+type digestData struct {
+	Since time.Time
+	Until time.Time
+	// The total number of commands recorded in the window
+	NumCommands int
+	// Hostnames that were used in the window but never seen before it
+	NewHosts []string
+	// The most frequently run commands (by their first token) in the window
+	TopCommands []digestCount
+	// Commands whose failure count in the window is notably higher than in the preceding
+	// window of the same length
+	FailureSpikes []digestFailureSpike
+	// The longest-running commands in the window
+	LongRunningJobs []digestJob
+}
+
+type digestCount struct {
+	Command string
+	Count   int
+}
+
+type digestFailureSpike struct {
+	Command          string
+	NumFailures      int
+	PriorNumFailures int
+}
+
+type digestJob struct {
+	Command  string
+	Hostname string
+	Duration time.Duration
+	ExitCode int
+}
+
+// How many entries to include in the top-commands, failure-spikes, and long-running-jobs sections
+const digestSectionSize = 10
+
+// Long-running jobs shorter than this aren't worth calling out in the digest
+const digestMinJobDuration = time.Minute
+
+// A failure count needs to be at least this high (and at least double the prior window's count)
+// to be reported as a spike
+const digestMinFailuresForSpike = 5
+
+func generateDigest(ctx context.Context, w io.Writer, since time.Duration, format string) error {
+	db := hctx.GetDb(ctx)
+	now := time.Now()
+	cutoff := now.Add(-since)
+
+	entries, err := lib.RetryingDbFunctionWithResult(func() ([]*data.HistoryEntry, error) {
+		var entries []*data.HistoryEntry
+		if res := db.Where("end_time > ?", cutoff).Order("end_time DESC").Find(&entries); res.Error != nil {
+			return nil, fmt.Errorf("failed to retrieve history entries for the digest: %w", res.Error)
+		}
+		return entries, nil
+	})
+	if err != nil {
+		return err
+	}
+	// The preceding window of the same length, used as the baseline for detecting failure spikes
+	priorEntries, err := lib.RetryingDbFunctionWithResult(func() ([]*data.HistoryEntry, error) {
+		var priorEntries []*data.HistoryEntry
+		if res := db.Where("end_time > ? AND end_time <= ?", cutoff.Add(-since), cutoff).Find(&priorEntries); res.Error != nil {
+			return nil, fmt.Errorf("failed to retrieve history entries for the digest baseline: %w", res.Error)
+		}
+		return priorEntries, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	newHosts, err := findNewHosts(db, cutoff, entries)
+	if err != nil {
+		return err
+	}
+	digest := digestData{
+		Since:           cutoff,
+		Until:           now,
+		NumCommands:     len(entries),
+		NewHosts:        newHosts,
+		TopCommands:     findTopCommands(entries),
+		FailureSpikes:   findFailureSpikes(entries, priorEntries),
+		LongRunningJobs: findLongRunningJobs(entries),
+	}
+	if format == "html" {
+		return renderDigestHtml(w, digest)
+	}
+	if format != "text" {
+		return fmt.Errorf("unsupported digest format %#v, expected \"text\" or \"html\"", format)
+	}
+	renderDigestText(w, digest)
+	return nil
+}
+
+// findNewHosts returns the hostnames that appear in the given entries but have no recorded
+// history from before the cutoff
+func findNewHosts(db *gorm.DB, cutoff time.Time, entries []*data.HistoryEntry) ([]string, error) {
+	var previouslySeenHosts []string
+	if res := db.Model(&data.HistoryEntry{}).Where("end_time <= ?", cutoff).Distinct().Pluck("hostname", &previouslySeenHosts); res.Error != nil {
+		return nil, fmt.Errorf("failed to retrieve previously seen hostnames: %w", res.Error)
+	}
+	seenBefore := make(map[string]bool)
+	for _, host := range previouslySeenHosts {
+		seenBefore[host] = true
+	}
+	newHosts := make([]string, 0)
+	for _, entry := range entries {
+		if !seenBefore[entry.Hostname] {
+			seenBefore[entry.Hostname] = true
+			newHosts = append(newHosts, entry.Hostname)
+		}
+	}
+	sort.Strings(newHosts)
+	return newHosts, nil
+}
+
+// firstToken returns the first whitespace-separated token of a command, which is what the digest
+// aggregates commands by
+func firstToken(command string) string {
+	return strings.SplitN(strings.TrimSpace(command), " ", 2)[0]
+}
+
+func findTopCommands(entries []*data.HistoryEntry) []digestCount {
+	counts := make(map[string]int)
+	for _, entry := range entries {
+		if token := firstToken(entry.Command); token != "" {
+			counts[token]++
+		}
+	}
+	ret := make([]digestCount, 0, len(counts))
+	for command, count := range counts {
+		ret = append(ret, digestCount{Command: command, Count: count})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Count != ret[j].Count {
+			return ret[i].Count > ret[j].Count
+		}
+		return ret[i].Command < ret[j].Command
+	})
+	if len(ret) > digestSectionSize {
+		ret = ret[:digestSectionSize]
+	}
+	return ret
+}
+
+func countFailures(entries []*data.HistoryEntry) map[string]int {
+	failures := make(map[string]int)
+	for _, entry := range entries {
+		// Exit code 130 is Ctrl-C, which isn't a real failure
+		if entry.ExitCode != 0 && entry.ExitCode != 130 {
+			if token := firstToken(entry.Command); token != "" {
+				failures[token]++
+			}
+		}
+	}
+	return failures
+}
+
+func findFailureSpikes(entries, priorEntries []*data.HistoryEntry) []digestFailureSpike {
+	failures := countFailures(entries)
+	priorFailures := countFailures(priorEntries)
+	ret := make([]digestFailureSpike, 0)
+	for command, numFailures := range failures {
+		if numFailures >= digestMinFailuresForSpike && numFailures >= 2*priorFailures[command] {
+			ret = append(ret, digestFailureSpike{Command: command, NumFailures: numFailures, PriorNumFailures: priorFailures[command]})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].NumFailures != ret[j].NumFailures {
+			return ret[i].NumFailures > ret[j].NumFailures
+		}
+		return ret[i].Command < ret[j].Command
+	})
+	if len(ret) > digestSectionSize {
+		ret = ret[:digestSectionSize]
+	}
+	return ret
+}
+
+func findLongRunningJobs(entries []*data.HistoryEntry) []digestJob {
+	jobs := make([]digestJob, 0)
+	for _, entry := range entries {
+		duration := entry.EndTime.Sub(entry.StartTime)
+		if duration >= digestMinJobDuration {
+			jobs = append(jobs, digestJob{Command: entry.Command, Hostname: entry.Hostname, Duration: duration.Round(time.Second), ExitCode: entry.ExitCode})
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Duration > jobs[j].Duration })
+	if len(jobs) > digestSectionSize {
+		jobs = jobs[:digestSectionSize]
+	}
+	return jobs
+}
+
+func renderDigestText(w io.Writer, digest digestData) {
+	fmt.Fprintf(w, "hiSHtory digest for %s to %s\n", digest.Since.Local().Format("2006-01-02"), digest.Until.Local().Format("2006-01-02"))
+	fmt.Fprintf(w, "%d commands recorded\n", digest.NumCommands)
+	if len(digest.NewHosts) > 0 {
+		fmt.Fprintf(w, "\nNew hosts:\n")
+		for _, host := range digest.NewHosts {
+			fmt.Fprintf(w, "  %s\n", host)
+		}
+	}
+	if len(digest.TopCommands) > 0 {
+		fmt.Fprintf(w, "\nTop commands:\n")
+		for _, c := range digest.TopCommands {
+			fmt.Fprintf(w, "  %5d  %s\n", c.Count, c.Command)
+		}
+	}
+	if len(digest.FailureSpikes) > 0 {
+		fmt.Fprintf(w, "\nFailure spikes:\n")
+		for _, spike := range digest.FailureSpikes {
+			fmt.Fprintf(w, "  %s: %d failures (up from %d in the prior period)\n", spike.Command, spike.NumFailures, spike.PriorNumFailures)
+		}
+	}
+	if len(digest.LongRunningJobs) > 0 {
+		fmt.Fprintf(w, "\nLong-running jobs:\n")
+		for _, job := range digest.LongRunningJobs {
+			fmt.Fprintf(w, "  %10s  [%s, exit %d]  %s\n", job.Duration, job.Hostname, job.ExitCode, job.Command)
+		}
+	}
+}
+
+// A deliberately simple inline-styled HTML template, since email clients don't reliably support
+// stylesheets
+const digestHtmlTemplate = `<html>
+<body style="font-family: sans-serif">
+<h2>hiSHtory digest for {{ .Since.Local.Format "2006-01-02" }} to {{ .Until.Local.Format "2006-01-02" }}</h2>
+<p>{{ .NumCommands }} commands recorded</p>
+{{ if .NewHosts }}<h3>New hosts</h3>
+<ul>{{ range .NewHosts }}<li><code>{{ . }}</code></li>{{ end }}</ul>
+{{ end }}{{ if .TopCommands }}<h3>Top commands</h3>
+<table border="1" cellpadding="4" style="border-collapse: collapse">
+<tr><th>Count</th><th>Command</th></tr>
+{{ range .TopCommands }}<tr><td>{{ .Count }}</td><td><code>{{ .Command }}</code></td></tr>
+{{ end }}</table>
+{{ end }}{{ if .FailureSpikes }}<h3>Failure spikes</h3>
+<table border="1" cellpadding="4" style="border-collapse: collapse">
+<tr><th>Command</th><th>Failures</th><th>Prior period</th></tr>
+{{ range .FailureSpikes }}<tr><td><code>{{ .Command }}</code></td><td>{{ .NumFailures }}</td><td>{{ .PriorNumFailures }}</td></tr>
+{{ end }}</table>
+{{ end }}{{ if .LongRunningJobs }}<h3>Long-running jobs</h3>
+<table border="1" cellpadding="4" style="border-collapse: collapse">
+<tr><th>Duration</th><th>Host</th><th>Exit</th><th>Command</th></tr>
+{{ range .LongRunningJobs }}<tr><td>{{ .Duration }}</td><td>{{ .Hostname }}</td><td>{{ .ExitCode }}</td><td><code>{{ .Command }}</code></td></tr>
+{{ end }}</table>
+{{ end }}</body>
+</html>
+`
+
+func renderDigestHtml(w io.Writer, digest digestData) error {
+	tmpl, err := template.New("digest").Parse(digestHtmlTemplate)
+	if err != nil {
+		return fmt.Errorf("failed to parse the digest template: %w", err)
+	}
+	return tmpl.Execute(w, digest)
+}
+
+func init() {
+	rootCmd.AddCommand(digestCmd)
+	digestSince = digestCmd.Flags().String("since", "7d", "The time window to summarize, e.g. 7d or 24h")
+	digestFormat = digestCmd.Flags().String("format", "text", "The output format: text or html")
+}
@@ -0,0 +1,286 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ddworken/hishtory/client/data"
+	"github.com/ddworken/hishtory/client/hctx"
+	"github.com/ddworken/hishtory/client/lib"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/spf13/cobra"
+)
+
+// How many truncated entries `hishtory doctor` displays before eliding the rest
+const doctorMaxDisplayedTruncatedEntries = 10
+
+// The maximum clock skew between the local device and the backend server before `hishtory doctor` warns
+// about it, since large skews lead to confusing timestamps on synced entries
+const doctorMaxAllowedClockSkew = time.Minute
+
+var doctorCmd = &cobra.Command{
+	Use:     "doctor",
+	Short:   "Run basic checks on your local hishtory install and report any issues",
+	GroupID: GROUP_ID_MANAGEMENT,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		fmt.Printf("hiSHtory: v0.%s\n", lib.Version)
+		printDbSize(ctx, config)
+		lib.CheckFatalError(reportShellHooks(ctx))
+		reportDuplicateHooks(ctx)
+		reportConflictingPlugins(ctx)
+		lib.CheckFatalError(reportConfigValidity())
+		lib.CheckFatalError(reportDbIntegrity(ctx))
+		reportBackendStatus(ctx, config)
+		lib.CheckFatalError(reportTruncatedEntries(ctx))
+	},
+}
+
+// reportShellHooks checks whether the hishtory shell hooks are installed for each supported
+// shell that is present on this machine
+func reportShellHooks(ctx context.Context) error {
+	homedir := hctx.GetHome(ctx)
+	fmt.Println("Shell Hooks:")
+	for _, check := range shellHookChecks {
+		if _, err := exec.LookPath(check.shell); err != nil {
+			fmt.Printf("\t%s: not installed on this machine, skipping\n", check.shell)
+			continue
+		}
+		isConfigured, err := check.isConfigured(homedir)
+		if err != nil {
+			return fmt.Errorf("failed to check whether %s is configured: %w", check.shell, err)
+		}
+		if isConfigured {
+			fmt.Printf("\t%s: configured\n", check.shell)
+		} else {
+			fmt.Printf("\t%s: NOT configured, new commands run in %s will not be recorded (fix: run `hishtory repair-install`)\n", check.shell, check.shell)
+		}
+	}
+	return nil
+}
+
+// reportDuplicateHooks checks each shell rc file for duplicated hishtory source lines, which
+// historically caused the hooks to be registered twice and every command to be recorded twice.
+// The hook scripts now have include guards that make the second source a no-op, but the
+// duplicate lines are still worth cleaning up.
+func reportDuplicateHooks(ctx context.Context) {
+	homedir := hctx.GetHome(ctx)
+	fmt.Println("Duplicate Hooks:")
+	foundAny := false
+	for _, rcFile := range []struct {
+		path       string
+		sourceLine string
+	}{
+		{path.Join(homedir, ".bashrc"), "source " + getBashConfigPath(homedir)},
+		{path.Join(homedir, ".bash_profile"), "source " + getBashConfigPath(homedir)},
+		{getZshRcPath(homedir), "source " + getZshConfigPath(homedir)},
+		{path.Join(homedir, ".config/fish/config.fish"), "source " + getFishConfigPath(homedir)},
+	} {
+		contents, err := os.ReadFile(rcFile.path)
+		if err != nil {
+			// The rc file doesn't exist (e.g. the shell isn't in use), so there is nothing to check
+			continue
+		}
+		count := strings.Count(string(contents), rcFile.sourceLine)
+		if count > 1 {
+			foundAny = true
+			fmt.Printf("\t%s: sources the hishtory config %d times (fix: remove the duplicate `%s` lines)\n", rcFile.path, count, rcFile.sourceLine)
+		}
+	}
+	if !foundAny {
+		fmt.Println("\tnone detected")
+	}
+}
+
+// conflictingPluginChecks lists known plugins that also bind control-r and thus compete with
+// hishtory's search TUI. Each plugin is detected by scanning the shell config files for the
+// snippets that activate it.
+var conflictingPluginChecks = []struct {
+	name string
+	// Substrings that indicate the plugin is enabled when found in a shell config file
+	markers []string
+	// A short explanation of how the plugin conflicts, included in the doctor output
+	explanation string
+}{
+	{"atuin", []string{"atuin init"}, "atuin binds control-r to its own history search"},
+	{"mcfly", []string{"mcfly init"}, "mcfly binds control-r to its own history search"},
+	{"fzf", []string{".fzf.bash", ".fzf.zsh", "fzf --bash", "fzf --zsh", "fzf/key-bindings", "fzf_key_bindings"}, "the fzf key bindings bind control-r to fuzzy history search"},
+	{"zsh-vi-mode", []string{"zsh-vi-mode"}, "zsh-vi-mode re-binds keys (including control-r) when the first prompt renders, even if it was sourced before hishtory"},
+}
+
+// reportConflictingPlugins checks the shell config files for known plugins that also bind
+// control-r, and explains which binding wins and how to change that via the
+// control-r-yield-shells config
+func reportConflictingPlugins(ctx context.Context) {
+	homedir := hctx.GetHome(ctx)
+	config := hctx.GetConf(ctx)
+	fmt.Println("Conflicting Plugins:")
+	if !config.ControlRSearchEnabled {
+		fmt.Println("\tskipped, control-r search is disabled via `hishtory config-set enable-control-r false`")
+		return
+	}
+	for _, shellFiles := range []struct {
+		shell string
+		files []string
+	}{
+		{"bash", []string{path.Join(homedir, ".bashrc"), path.Join(homedir, ".bash_profile")}},
+		{"zsh", []string{path.Join(homedir, ".zshrc")}},
+		{"fish", []string{path.Join(homedir, ".config/fish/config.fish")}},
+	} {
+		var contents string
+		for _, file := range shellFiles.files {
+			if fileContents, err := os.ReadFile(file); err == nil {
+				contents += string(fileContents)
+			}
+		}
+		detectedAny := false
+		for _, check := range conflictingPluginChecks {
+			detected := false
+			for _, marker := range check.markers {
+				if strings.Contains(contents, marker) {
+					detected = true
+					break
+				}
+			}
+			if !detected {
+				continue
+			}
+			detectedAny = true
+			if slices.Contains(config.ControlRYieldShells, shellFiles.shell) {
+				fmt.Printf("\t%s: %s detected (%s); hishtory is configured to yield control-r in %s, so %s's binding wins (to take back control-r, run `hishtory config-delete control-r-yield-shells %s`)\n", shellFiles.shell, check.name, check.explanation, shellFiles.shell, check.name, shellFiles.shell)
+			} else {
+				fmt.Printf("\t%s: %s detected (%s); whichever binds last during shell startup wins control-r (to let %s keep it, run `hishtory config-add control-r-yield-shells %s`)\n", shellFiles.shell, check.name, check.explanation, check.name, shellFiles.shell)
+			}
+		}
+		if !detectedAny {
+			fmt.Printf("\t%s: no conflicting plugins detected\n", shellFiles.shell)
+		}
+	}
+}
+
+// reportConfigValidity checks that the hishtory config file on disk parses, since a corrupted
+// config file leads to hishtory silently falling back to default settings
+func reportConfigValidity() error {
+	homedir, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to get user's home directory: %w", err)
+	}
+	var config hctx.ClientConfig
+	if contents, err := os.ReadFile(path.Join(homedir, data.GetHishtoryPath(), data.CONFIG_TOML_PATH)); err == nil {
+		if err := toml.Unmarshal(contents, &config); err != nil {
+			fmt.Printf("Config File: INVALID, failed to parse ~/%s/%s: %v (fix: run `hishtory init` to reset it)\n", data.GetHishtoryPath(), data.CONFIG_TOML_PATH, err)
+			return nil
+		}
+		fmt.Println("Config File: valid")
+		return nil
+	}
+	// There is no TOML config yet, so this is an install that still has a legacy JSON config
+	contents, err := hctx.GetConfigContents()
+	if err != nil {
+		return fmt.Errorf("failed to read the hishtory config file: %w", err)
+	}
+	if err := json.Unmarshal(contents, &config); err != nil {
+		fmt.Printf("Config File: INVALID, failed to parse ~/%s/%s: %v (fix: run `hishtory init` to reset it)\n", data.GetHishtoryPath(), data.CONFIG_PATH, err)
+		return nil
+	}
+	fmt.Println("Config File: valid")
+	return nil
+}
+
+// reportDbIntegrity runs sqlite's built-in integrity check on the local DB to detect corruption
+func reportDbIntegrity(ctx context.Context) error {
+	db := hctx.GetDb(ctx)
+	var result string
+	if err := db.Raw("PRAGMA integrity_check").Scan(&result).Error; err != nil {
+		return fmt.Errorf("failed to run PRAGMA integrity_check: %w", err)
+	}
+	if result == "ok" {
+		fmt.Println("Database Integrity: ok")
+	} else {
+		fmt.Printf("Database Integrity: CORRUPTED: %s (fix: back up and delete ~/%s/%s, then run `hishtory init $(hishtory status -v | grep 'Secret Key' | cut -d' ' -f3)` to re-download your history)\n", result, data.GetHishtoryPath(), data.DB_PATH)
+	}
+	return nil
+}
+
+// reportBackendStatus checks that the backend server is reachable, that the local clock is not
+// significantly skewed from the server's clock, and that the installed version is up to date
+func reportBackendStatus(ctx context.Context, config *hctx.ClientConfig) {
+	if config.IsOffline {
+		fmt.Println("Sync Server: skipped, device is in offline mode")
+		return
+	}
+	req, err := http.NewRequest("GET", lib.GetServerHostname()+"/api/v1/ping", nil)
+	if err != nil {
+		fmt.Printf("Sync Server: failed to build request: %v\n", err)
+		return
+	}
+	req.Header.Set("X-Hishtory-Version", "v0."+lib.Version)
+	resp, err := lib.GetHttpClient().Do(req)
+	if err != nil || resp.StatusCode != 200 {
+		fmt.Printf("Sync Server: UNREACHABLE at %s: %v (fix: check your network connection, or run `hishtory syncing disable` if you intend to use hishtory offline)\n", lib.GetServerHostname(), err)
+		return
+	}
+	defer resp.Body.Close()
+	fmt.Printf("Sync Server: reachable at %s\n", lib.GetServerHostname())
+	if serverTime, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+		skew := time.Since(serverTime)
+		if skew.Abs() > doctorMaxAllowedClockSkew {
+			fmt.Printf("Clock Skew: local clock is off from the server by %s, which will lead to incorrect timestamps on synced entries (fix: enable NTP time synchronization on this machine)\n", skew.Round(time.Second))
+		} else {
+			fmt.Println("Clock Skew: ok")
+		}
+	}
+	downloadData, err := GetDownloadData(ctx)
+	if err != nil {
+		fmt.Printf("Version: failed to check for updates: %v\n", err)
+		return
+	}
+	if downloadData.Version == "v0."+lib.Version {
+		fmt.Printf("Version: v0.%s is the latest version\n", lib.Version)
+	} else {
+		fmt.Printf("Version: v0.%s is outdated, the latest version is %s (fix: run `hishtory update`)\n", lib.Version, downloadData.Version)
+	}
+}
+
+// reportTruncatedEntries reports any entries whose commands were truncated because they exceeded
+// the configured max-command-length
+func reportTruncatedEntries(ctx context.Context) error {
+	db := hctx.GetDb(ctx)
+	var truncatedEntries []*data.HistoryEntry
+	res := db.Where("command LIKE ?", "%"+lib.CommandTruncationMarker).Order("end_time DESC").Find(&truncatedEntries)
+	if res.Error != nil {
+		return fmt.Errorf("failed to query for truncated entries: %w", res.Error)
+	}
+	if len(truncatedEntries) == 0 {
+		fmt.Println("Truncated Entries: none")
+		return nil
+	}
+	config := hctx.GetConf(ctx)
+	fmt.Printf("Truncated Entries: %d entries were truncated to max-command-length=%d bytes:\n", len(truncatedEntries), config.MaxCommandLength)
+	for i, entry := range truncatedEntries {
+		if i >= doctorMaxDisplayedTruncatedEntries {
+			fmt.Printf("\t... and %d more\n", len(truncatedEntries)-doctorMaxDisplayedTruncatedEntries)
+			break
+		}
+		command := entry.Command
+		if len(command) > 80 {
+			command = command[:80] + "..."
+		}
+		fmt.Printf("\t%s: %s\n", entry.EndTime.Local().Format("2006-01-02"), command)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
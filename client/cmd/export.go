@@ -6,12 +6,16 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
 	"github.com/ddworken/hishtory/client/data"
 	"github.com/ddworken/hishtory/client/hctx"
 	"github.com/ddworken/hishtory/client/lib"
 
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
 	"github.com/spf13/cobra"
+	"gorm.io/gorm"
 )
 
 var exportJsonCmd = &cobra.Command{
@@ -25,6 +29,99 @@ var exportJsonCmd = &cobra.Command{
 	},
 }
 
+// exportToMarkdown renders the entries matching the given query as a markdown runbook with
+// timestamps, working directories, and fenced command blocks, so that e.g. incident timelines can
+// be pasted directly into postmortem docs
+func exportToMarkdown(ctx context.Context, w io.Writer, query string) error {
+	db := hctx.GetDb(ctx)
+	config := hctx.GetConf(ctx)
+	entries, err := lib.Search(ctx, db, query, 0)
+	if err != nil {
+		return fmt.Errorf("failed to search for history entries to export: %w", err)
+	}
+	fmt.Fprintf(w, "# Shell history export\n\n")
+	if strings.TrimSpace(query) != "" {
+		fmt.Fprintf(w, "Query: `%s`\n\n", query)
+	}
+	fmt.Fprintf(w, "%d commands, oldest first.\n", len(entries))
+	// Search results are ordered newest first, so iterate backwards to render a chronological timeline
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		fmt.Fprintf(w, "\n### %s — `%s` (exit %d)\n\n", entry.StartTime.Local().Format(config.TimestampFormat), entry.CurrentWorkingDirectory, entry.ExitCode)
+		fence := "```"
+		if strings.Contains(entry.Command, fence) {
+			// Use a longer fence so that commands containing backtick fences render correctly
+			fence = "````"
+		}
+		fmt.Fprintf(w, "%s\n%s\n%s\n", fence+"bash", entry.Command, fence)
+	}
+	return nil
+}
+
+// exportToAtuinSqlite writes the entries matching the given query to a new sqlite database in
+// atuin's history.db format, so that users trying out atuin (or moving away from hishtory) can
+// take their history with them
+func exportToAtuinSqlite(ctx context.Context, query, outputPath string) error {
+	if _, err := os.Stat(outputPath); err == nil {
+		return fmt.Errorf("refusing to overwrite %s, delete it or specify a different path via --output", outputPath)
+	}
+	entries, err := lib.Search(ctx, hctx.GetDb(ctx), query, 0)
+	if err != nil {
+		return fmt.Errorf("failed to search for history entries to export: %w", err)
+	}
+	atuinDb, err := gorm.Open(sqlite.Open(outputPath), &gorm.Config{SkipDefaultTransaction: true})
+	if err != nil {
+		return fmt.Errorf("failed to create the atuin database at %s: %w", outputPath, err)
+	}
+	// This matches the schema that atuin's sqlite migrations create for ~/.local/share/atuin/history.db
+	schemaStatements := []string{
+		"CREATE TABLE history (id text primary key, timestamp integer not null, duration integer not null, exit integer not null, command text not null, cwd text not null, session text not null, hostname text not null, deleted_at integer)",
+		"CREATE INDEX idx_history_timestamp ON history(timestamp)",
+		"CREATE INDEX idx_history_command ON history(command)",
+	}
+	for _, statement := range schemaStatements {
+		if err := atuinDb.Exec(statement).Error; err != nil {
+			return fmt.Errorf("failed to create the atuin history table: %w", err)
+		}
+	}
+	// Atuin groups entries by session, so attribute the whole export to one synthetic session
+	sessionId := uuid.Must(uuid.NewRandom()).String()
+	err = atuinDb.Transaction(func(tx *gorm.DB) error {
+		// Search results are ordered newest first, so iterate backwards to insert chronologically
+		for i := len(entries) - 1; i >= 0; i-- {
+			entry := entries[i]
+			if entry.Command == "" {
+				continue
+			}
+			cwd := entry.CurrentWorkingDirectory
+			if strings.HasPrefix(cwd, "~/") {
+				cwd = entry.HomeDirectory + strings.TrimPrefix(cwd, "~")
+			}
+			// Atuin stores timestamps and durations in nanoseconds, and hostnames as "hostname:username"
+			err := tx.Exec("INSERT INTO history (id, timestamp, duration, exit, command, cwd, session, hostname, deleted_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, NULL)",
+				uuid.Must(uuid.NewRandom()).String(),
+				entry.StartTime.UnixNano(),
+				entry.EndTime.Sub(entry.StartTime).Nanoseconds(),
+				entry.ExitCode,
+				entry.Command,
+				cwd,
+				sessionId,
+				entry.Hostname+":"+entry.LocalUsername,
+			).Error
+			if err != nil {
+				return fmt.Errorf("failed to insert entry into the atuin database: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Exported %d history entries to %s\n", len(entries), outputPath)
+	fmt.Println("To use it with atuin, copy it to atuin's database location (by default ~/.local/share/atuin/history.db) and run `atuin doctor` to confirm atuin can read it")
+	return nil
+}
+
 func structToMap(entry data.HistoryEntry) (map[string]interface{}, error) {
 	inrec, err := json.Marshal(entry)
 	if err != nil {
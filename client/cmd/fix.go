@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ddworken/hishtory/client/ai"
+	"github.com/ddworken/hishtory/client/data"
+	"github.com/ddworken/hishtory/client/hctx"
+	"github.com/ddworken/hishtory/client/lib"
+
+	"github.com/spf13/cobra"
+)
+
+// How many recent history entries we'll look through to find the most recent failed command
+const fixSearchWindow = 100
+
+var fixCmd = &cobra.Command{
+	Use:     "fix",
+	Short:   "Ask the configured AI backend to suggest a corrected version of your most recent failed command",
+	GroupID: GROUP_ID_QUERYING,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		shellName := "bash"
+		if os.Getenv("HISHTORY_SHELL_NAME") != "" {
+			shellName = os.Getenv("HISHTORY_SHELL_NAME")
+		}
+		entry, err := getMostRecentFailedCommand(ctx)
+		lib.CheckFatalError(err)
+		fmt.Printf("Suggesting fixes for %#v (exit code %d):\n", entry.Command, entry.ExitCode)
+		suggestions, err := ai.GetAiSuggestions(ctx, shellName, buildFixQuery(entry), 3)
+		lib.CheckFatalError(err)
+		for _, suggestion := range suggestions {
+			fmt.Println("\t" + suggestion)
+		}
+	},
+}
+
+// Find the most recent history entry that failed with a non-zero exit code, skipping hishtory's
+// own commands (so that e.g. `hishtory fix` failing doesn't suggest fixes for itself)
+func getMostRecentFailedCommand(ctx context.Context) (*data.HistoryEntry, error) {
+	db := hctx.GetDb(ctx)
+	entries, err := lib.Search(ctx, db, "", fixSearchWindow)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search for recent commands: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.ExitCode != 0 && !strings.HasPrefix(strings.TrimSpace(entry.Command), "hishtory") {
+			return entry, nil
+		}
+	}
+	return nil, fmt.Errorf("failed to find a recent command with a non-zero exit code in your last %d commands", fixSearchWindow)
+}
+
+// Build the AI query for fixing the given failed command. Note that hishtory doesn't capture
+// stderr, so the AI backend only gets the command, its exit code, and where it ran.
+func buildFixQuery(entry *data.HistoryEntry) string {
+	return fmt.Sprintf("I ran the command `%s` in the directory `%s` and it failed with exit code %d. Reply with a corrected version of this command.",
+		entry.Command, entry.CurrentWorkingDirectory, entry.ExitCode)
+}
+
+func init() {
+	rootCmd.AddCommand(fixCmd)
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/ddworken/hishtory/client/hctx"
+	"github.com/ddworken/hishtory/client/lib"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	fleetHostsFile      *string
+	fleetSecretKey      *string
+	fleetConfigTemplate *string
+)
+
+var fleetCmd = &cobra.Command{
+	Use:     "fleet",
+	Short:   "Install and manage hishtory across a fleet of servers over ssh",
+	GroupID: GROUP_ID_INSTALL,
+}
+
+var fleetApplyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Install or update hishtory on every host in the given hosts file over ssh, and apply a shared config template",
+	Long: "Reads hosts (one `user@host` per line, with blank lines and #-comments skipped) from the file given via --hosts. For each host: installs hishtory if it isn't installed (initializing it with this machine's secret key, or the one given via --secret-key, so the fleet syncs to one account), updates it if it is, and then applies the config template given via --config-template (one `hishtory config-set` invocation per line, e.g. `sync-interval 5m`). Hosts must be reachable via non-interactive ssh (e.g. with ssh keys loaded), and a per-host success/failure summary is printed at the end.\n\nExample template:\n  sync-interval 5m\n  displayed-columns Hostname Command",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		lib.CheckFatalError(fleetApply(ctx, *fleetHostsFile, *fleetSecretKey, *fleetConfigTemplate))
+	},
+}
+
+func fleetApply(ctx context.Context, hostsFile, secretKey, configTemplatePath string) error {
+	if hostsFile == "" {
+		return fmt.Errorf("--hosts is required, pass a file with one `user@host` per line")
+	}
+	hosts, err := parseFleetHostsFile(hostsFile)
+	if err != nil {
+		return err
+	}
+	if len(hosts) == 0 {
+		return fmt.Errorf("the hosts file %s contains no hosts", hostsFile)
+	}
+	if secretKey == "" {
+		secretKey = hctx.GetConf(ctx).UserSecret
+	}
+	configTemplate := make([]string, 0)
+	if configTemplatePath != "" {
+		configTemplate, err = parseFleetFileLines(configTemplatePath)
+		if err != nil {
+			return err
+		}
+	}
+	numSucceeded := 0
+	for _, host := range hosts {
+		if err := fleetApplyToHost(host, secretKey, configTemplate); err != nil {
+			fmt.Printf("%s: failed: %v\n", host, err)
+		} else {
+			fmt.Printf("%s: success\n", host)
+			numSucceeded++
+		}
+	}
+	fmt.Printf("Applied to %d/%d hosts\n", numSucceeded, len(hosts))
+	if numSucceeded != len(hosts) {
+		return fmt.Errorf("failed to apply to %d of %d hosts, see above for details", len(hosts)-numSucceeded, len(hosts))
+	}
+	return nil
+}
+
+// fleetApplyToHost brings a single host to the desired state: hishtory installed (joined to the
+// fleet's account), up to date, and configured per the shared template
+func fleetApplyToHost(host, secretKey string, configTemplate []string) error {
+	if _, err := runSshCommand(host, "~/.hishtory/hishtory version"); err != nil {
+		// hishtory isn't installed on this host (or isn't working), so install it and join it to
+		// the fleet's account
+		if _, err := runSshCommand(host, "curl https://hishtory.dev/install.py | python3 -"); err != nil {
+			return fmt.Errorf("failed to install hishtory: %w", err)
+		}
+		// The secret key is passed over stdin and exported as HISHTORY_SECRET_KEY rather than put
+		// on the remote command line, where it would be visible to every user on the host via ps
+		if _, err := runSshCommandWithStdin(host, "IFS= read -r HISHTORY_SECRET_KEY && export HISHTORY_SECRET_KEY && HISHTORY_SKIP_INIT_IMPORT=1 ~/.hishtory/hishtory init --force", secretKey+"\n"); err != nil {
+			return fmt.Errorf("failed to initialize hishtory with the fleet's secret key: %w", err)
+		}
+	} else {
+		if _, err := runSshCommand(host, "~/.hishtory/hishtory update"); err != nil {
+			return fmt.Errorf("failed to update hishtory: %w", err)
+		}
+	}
+	for _, line := range configTemplate {
+		if _, err := runSshCommand(host, "~/.hishtory/hishtory config-set "+line); err != nil {
+			return fmt.Errorf("failed to apply config template line %#v: %w", line, err)
+		}
+	}
+	return nil
+}
+
+// runSshCommand runs the given command on the given host over ssh. BatchMode ensures that ssh
+// fails immediately rather than prompting for a password, since fleet apply is non-interactive.
+func runSshCommand(host, remoteCommand string) (string, error) {
+	return runSshCommandWithStdin(host, remoteCommand, "")
+}
+
+// runSshCommandWithStdin is runSshCommand with the given input piped to the remote command's
+// stdin, e.g. for passing it a secret without putting it on the remote command line
+func runSshCommandWithStdin(host, remoteCommand, stdin string) (string, error) {
+	cmd := exec.Command("ssh", "-o", "BatchMode=yes", host, remoteCommand)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("ssh %s %#v failed (stdout=%#v, stderr=%#v): %w", host, remoteCommand, stdout.String(), stderr.String(), err)
+	}
+	return stdout.String(), nil
+}
+
+// parseFleetHostsFile reads the hosts file given to --hosts, one `user@host` per line
+func parseFleetHostsFile(path string) ([]string, error) {
+	return parseFleetFileLines(path)
+}
+
+// parseFleetFileLines reads the non-empty, non-comment lines from the given file
+func parseFleetFileLines(path string) ([]string, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	lines := make([]string, 0)
+	for _, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+func init() {
+	rootCmd.AddCommand(fleetCmd)
+	fleetCmd.AddCommand(fleetApplyCmd)
+	fleetHostsFile = fleetApplyCmd.Flags().String("hosts", "", "A file containing one `user@host` per line to apply to")
+	fleetSecretKey = fleetApplyCmd.Flags().String("secret-key", "", "The secret key to initialize new installs with (defaults to this machine's secret key)")
+	fleetConfigTemplate = fleetApplyCmd.Flags().String("config-template", "", "A file containing one `hishtory config-set` invocation per line to apply to every host")
+}
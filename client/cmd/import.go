@@ -16,14 +16,32 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var (
+	importFiles    *[]string
+	importAsUser   *string
+	importHostname *string
+)
+
 var importCmd = &cobra.Command{
 	Use:     "import",
 	GroupID: GROUP_ID_MANAGEMENT,
 	Hidden:  true,
 	Short:   "Re-import history entries from your existing shell history",
-	Long:    "Note that you may also pipe commands to be imported in via stdin. For example `history | hishtory import`.",
+	Long: "Note that you may also pipe commands to be imported in via stdin. For example `history | hishtory import`.\n\n" +
+		"When migrating a shared machine, specific history files can be imported with explicit attribution via " +
+		"`hishtory import --file /home/alice/.bash_history --as-user alice --hostname old-server`. Make sure you " +
+		"have the consent of the users whose history you're importing.",
 	Run: func(cmd *cobra.Command, args []string) {
 		ctx := hctx.MakeContext()
+		if len(*importFiles) > 0 {
+			numImported, err := lib.ImportHistoryFromFiles(ctx, *importFiles, *importAsUser, *importHostname)
+			lib.CheckFatalError(err)
+			fmt.Printf("Imported %v history entries\n", numImported)
+			return
+		}
+		if *importAsUser != "" || *importHostname != "" {
+			lib.CheckFatalError(fmt.Errorf("--as-user and --hostname can only be used with --file"))
+		}
 		numImported, err := lib.ImportHistory(ctx, true, true)
 		lib.CheckFatalError(err)
 		if numImported > 0 {
@@ -48,6 +66,59 @@ var importJsonCmd = &cobra.Command{
 	},
 }
 
+var importWarpCmd = &cobra.Command{
+	Use:     "import-warp [path-to-warp.sqlite]",
+	GroupID: GROUP_ID_MANAGEMENT,
+	Short:   "Import history entries from Warp's command history database",
+	Long: "Imports the command history captured by the Warp terminal, preserving the working directory, " +
+		"exit code, and timestamps that Warp recorded for each command. If no path is given, the database " +
+		"is read from Warp's default location. Safe to re-run: already-imported entries are skipped.",
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		dbPath := ""
+		if len(args) > 0 {
+			dbPath = args[0]
+		} else {
+			dbPath = lib.DefaultWarpDbPath(ctx)
+			if dbPath == "" {
+				lib.CheckFatalError(fmt.Errorf("failed to find Warp's command history database, specify its path explicitly via `hishtory import-warp /path/to/warp.sqlite`"))
+			}
+		}
+		numImported, err := lib.ImportWarpHistory(ctx, dbPath)
+		lib.CheckFatalError(err)
+		fmt.Printf("Imported %v history entries from Warp\n", numImported)
+	},
+}
+
+var importIterm2Cmd = &cobra.Command{
+	Use:     "import-iterm2 [path-to-CommandHistory.plist]",
+	GroupID: GROUP_ID_MANAGEMENT,
+	Short:   "Import history entries from iTerm2's shell-integration command history",
+	Long: "Imports the command history captured by iTerm2's shell integration, preserving the working " +
+		"directory, exit code, timestamp, and host attribution for each command. iTerm2 stores its command " +
+		"history as a binary plist, so convert it to XML first via " +
+		"`plutil -convert xml1 -o /tmp/CommandHistory.xml ~/Library/Application\\ Support/iTerm2/CommandHistory.plist` " +
+		"and then run `hishtory import-iterm2 /tmp/CommandHistory.xml`. Safe to re-run: already-imported " +
+		"entries are skipped.",
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		plistPath := ""
+		if len(args) > 0 {
+			plistPath = args[0]
+		} else {
+			plistPath = lib.DefaultIterm2HistoryPath(ctx)
+			if plistPath == "" {
+				lib.CheckFatalError(fmt.Errorf("failed to find iTerm2's command history, specify its path explicitly via `hishtory import-iterm2 /path/to/CommandHistory.plist`"))
+			}
+		}
+		numImported, err := lib.ImportIterm2History(ctx, plistPath)
+		lib.CheckFatalError(err)
+		fmt.Printf("Imported %v history entries from iTerm2\n", numImported)
+	},
+}
+
 func importFromJson(ctx context.Context) (int, error) {
 	// Get the data needed for filling in any missing columns
 	currentUser, err := user.Current()
@@ -121,4 +192,9 @@ func importFromJson(ctx context.Context) (int, error) {
 func init() {
 	rootCmd.AddCommand(importCmd)
 	rootCmd.AddCommand(importJsonCmd)
+	rootCmd.AddCommand(importWarpCmd)
+	rootCmd.AddCommand(importIterm2Cmd)
+	importFiles = importCmd.Flags().StringArray("file", nil, "Import history from the given file rather than the default history files (can be specified multiple times)")
+	importAsUser = importCmd.Flags().String("as-user", "", "Attribute the imported entries to the given username rather than the current user (requires --file)")
+	importHostname = importCmd.Flags().String("hostname", "", "Attribute the imported entries to the given hostname rather than the current hostname (requires --file)")
 }
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"os/exec"
 	"path"
@@ -21,16 +22,20 @@ import (
 	"github.com/ddworken/hishtory/shared"
 
 	"github.com/google/uuid"
+	"github.com/schollz/progressbar/v3"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 	"gorm.io/gorm"
 )
 
 var (
 	offlineInit                  *bool
 	forceInit                    *bool
+	passphraseInit               *bool
 	offlineInstall               *bool
 	skipConfigModification       *bool
 	skipUpdateConfigModification *bool
+	remoteInstall                *string
 
 	//lint:ignore U1000 Flag that is allowed to be specified, but not used
 	currentlyInstalledVersion *string
@@ -48,9 +53,18 @@ var installCmd = &cobra.Command{
 		if len(args) > 0 {
 			secretKey = args[0]
 		}
+		if secretKey == "" {
+			// Allow passing the secret key via the environment, so that automation doesn't have
+			// to put it on the command line where other users on the machine can see it via ps
+			secretKey = os.Getenv("HISHTORY_SECRET_KEY")
+		}
 		if strings.HasPrefix(secretKey, "-") {
 			lib.CheckFatalError(fmt.Errorf("secret key %#v looks like a CLI flag, please use a secret key that does not start with a -", secretKey))
 		}
+		if *remoteInstall != "" {
+			lib.CheckFatalError(installOnRemoteHost(*remoteInstall, secretKey))
+			return
+		}
 		lib.CheckFatalError(install(secretKey, *offlineInstall || lib.IsOfflineBinary(), *skipConfigModification || *skipUpdateConfigModification))
 		if os.Getenv("HISHTORY_SKIP_INIT_IMPORT") == "" {
 			db, err := hctx.OpenLocalSqliteDb()
@@ -95,6 +109,19 @@ var initCmd = &cobra.Command{
 		if len(args) > 0 {
 			secretKey = args[0]
 		}
+		if secretKey == "" {
+			// Allow passing the secret key via the environment, so that automation doesn't have
+			// to put it on the command line where other users on the machine can see it via ps
+			secretKey = os.Getenv("HISHTORY_SECRET_KEY")
+		}
+		if *passphraseInit {
+			if secretKey != "" {
+				lib.CheckFatalError(fmt.Errorf("cannot specify both a secret key and --passphrase"))
+			}
+			derivedKey, err := readPassphraseAndDeriveKey()
+			lib.CheckFatalError(err)
+			secretKey = derivedKey
+		}
 		lib.CheckFatalError(setup(secretKey, *offlineInit))
 		if os.Getenv("HISHTORY_SKIP_INIT_IMPORT") == "" {
 			fmt.Println("Importing existing shell history...")
@@ -108,6 +135,30 @@ var initCmd = &cobra.Command{
 	},
 }
 
+// readPassphraseAndDeriveKey prompts for a passphrase (with confirmation, and without echoing it
+// to the terminal) and derives a secret key from it
+func readPassphraseAndDeriveKey() (string, error) {
+	fmt.Printf("Passphrase: ")
+	passphrase, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		return "", fmt.Errorf("failed to read the passphrase: %w", err)
+	}
+	if strings.TrimSpace(string(passphrase)) == "" {
+		return "", fmt.Errorf("the passphrase must not be empty")
+	}
+	fmt.Printf("Confirm passphrase: ")
+	confirmation, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		return "", fmt.Errorf("failed to read the passphrase confirmation: %w", err)
+	}
+	if string(passphrase) != string(confirmation) {
+		return "", fmt.Errorf("the passphrases did not match")
+	}
+	return data.DeriveKeyFromPassphrase(string(passphrase)), nil
+}
+
 var uninstallCmd = &cobra.Command{
 	Use:     "uninstall",
 	Short:   "Completely uninstall hiSHtory and remove your shell history",
@@ -143,6 +194,87 @@ var uninstallCmd = &cobra.Command{
 	},
 }
 
+var repairInstallCmd = &cobra.Command{
+	Use:     "repair-install",
+	Short:   "Re-add the hishtory shell hooks to your shell config files if they are missing (e.g. after a dotfile sync overwrote them)",
+	GroupID: GROUP_ID_INSTALL,
+	Run: func(cmd *cobra.Command, args []string) {
+		lib.CheckFatalError(repairInstall())
+	},
+}
+
+// shellHookChecks lists each supported shell along with the function that checks whether that
+// shell's config file sources the hishtory shell hooks
+var shellHookChecks = []struct {
+	shell        string
+	isConfigured func(homedir string) (bool, error)
+}{
+	{"bash", func(homedir string) (bool, error) {
+		bashRcIsConfigured, err := isBashRcConfigured(homedir)
+		if err != nil {
+			return false, err
+		}
+		if bashRcIsConfigured {
+			return true, nil
+		}
+		return isBashProfileConfigured(homedir)
+	}},
+	{"zsh", isZshConfigured},
+	{"fish", isFishConfigured},
+}
+
+// getShellsWithMissingHooks returns the list of shells that are installed on this machine, but
+// whose config files are missing the hishtory shell hooks (so commands run in them won't be recorded)
+func getShellsWithMissingHooks(homedir string) ([]string, error) {
+	missing := make([]string, 0)
+	for _, check := range shellHookChecks {
+		if _, err := exec.LookPath(check.shell); err != nil {
+			// This shell isn't installed on this machine, so don't check it
+			continue
+		}
+		isConfigured, err := check.isConfigured(homedir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check whether %s is configured: %w", check.shell, err)
+		}
+		if !isConfigured {
+			missing = append(missing, check.shell)
+		}
+	}
+	return missing, nil
+}
+
+// repairInstall idempotently re-adds the hishtory shell hooks to the shell config files for all
+// supported shells, without touching the hishtory config or local DB
+func repairInstall() error {
+	homedir, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to get user's home directory: %w", err)
+	}
+	missingShells, err := getShellsWithMissingHooks(homedir)
+	if err != nil {
+		return err
+	}
+	if len(missingShells) == 0 {
+		fmt.Println("All shell config files already contain the hishtory shell hooks, nothing to repair")
+		return nil
+	}
+	binaryPath := path.Join(homedir, data.GetHishtoryPath(), "hishtory")
+	err = configureBashrc(homedir, binaryPath, false)
+	if err != nil {
+		return err
+	}
+	err = configureZshrc(homedir, binaryPath, false)
+	if err != nil {
+		return err
+	}
+	err = configureFish(homedir, binaryPath, false)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Re-added the hishtory shell hooks for: %s (restart your terminal for this to take effect)\n", strings.Join(missingShells, ", "))
+	return nil
+}
+
 func warnIfUnsupportedBashVersion() error {
 	_, err := exec.LookPath("bash")
 	if err != nil {
@@ -160,6 +292,82 @@ func warnIfUnsupportedBashVersion() error {
 	return nil
 }
 
+// installOnRemoteHost bootstraps hiSHtory onto the given remote host (e.g. user@host) by copying
+// this binary over SSH and running `hishtory install` on it with this machine's secret key, so
+// that history syncs between the two machines. Since the local binary is what gets copied, the
+// remote host must be running the same OS and architecture as this machine.
+func installOnRemoteHost(remoteHost, secretKey string) error {
+	for _, requiredBinary := range []string{"ssh", "scp"} {
+		if _, err := exec.LookPath(requiredBinary); err != nil {
+			return fmt.Errorf("failed to find %s on the PATH, which is required for --remote: %w", requiredBinary, err)
+		}
+	}
+	if secretKey == "" {
+		config, err := hctx.GetConfig()
+		if err != nil {
+			return fmt.Errorf("failed to read the local hishtory config (install hishtory locally first, or specify a secret key explicitly): %w", err)
+		}
+		if config.IsOffline {
+			return fmt.Errorf("this machine is running in offline mode, so installing on a remote host wouldn't sync any history; specify a secret key explicitly to install anyways")
+		}
+		secretKey = config.UserSecret
+	}
+
+	// Check that the remote platform matches this machine's, since this binary is what gets copied
+	unameOutput, err := exec.Command("ssh", remoteHost, "uname -sm").Output()
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s over ssh: %w", remoteHost, err)
+	}
+	remotePlatform := strings.TrimSpace(string(unameOutput))
+	goosToUname := map[string]string{"linux": "Linux", "darwin": "Darwin"}
+	goarchToUname := map[string][]string{"amd64": {"x86_64"}, "arm64": {"arm64", "aarch64"}}
+	platformMatches := false
+	for _, remoteArch := range goarchToUname[runtime.GOARCH] {
+		if remotePlatform == goosToUname[runtime.GOOS]+" "+remoteArch {
+			platformMatches = true
+		}
+	}
+	if !platformMatches {
+		return fmt.Errorf("the remote host is %#v which doesn't match this machine (%s/%s), so this binary can't be copied to it; install hishtory on it directly and then run `hishtory init` there with this machine's secret key to link them", remotePlatform, runtime.GOOS, runtime.GOARCH)
+	}
+
+	// Copy the binary over and run the install on the remote host
+	localBinary, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the path of the hishtory binary: %w", err)
+	}
+	// Copy to a unique temp path rather than a fixed, predictable one that another user on the
+	// remote host could pre-create or symlink
+	mktempOutput, err := exec.Command("ssh", remoteHost, "mktemp /tmp/hishtory-install.XXXXXX").Output()
+	if err != nil {
+		return fmt.Errorf("failed to create a temporary file on %s: %w", remoteHost, err)
+	}
+	remoteBinaryPath := strings.TrimSpace(string(mktempOutput))
+	if !strings.HasPrefix(remoteBinaryPath, "/tmp/hishtory-install.") {
+		return fmt.Errorf("mktemp on %s returned an unexpected path %#v", remoteHost, remoteBinaryPath)
+	}
+	scpCmd := exec.Command("scp", localBinary, remoteHost+":"+remoteBinaryPath)
+	scpCmd.Stdin = os.Stdin
+	scpCmd.Stdout = os.Stdout
+	scpCmd.Stderr = os.Stderr
+	if err := scpCmd.Run(); err != nil {
+		return fmt.Errorf("failed to copy the hishtory binary to %s: %w", remoteHost, err)
+	}
+	// The secret key is passed over stdin and exported as HISHTORY_SECRET_KEY rather than put on
+	// the remote command line, where it would be visible to every user on the remote host via ps
+	// while the install runs. Prompts from ssh itself (e.g. for a password or host key) still work
+	// as normal, since ssh reads those from the terminal rather than from stdin.
+	sshCmd := exec.Command("ssh", remoteHost, fmt.Sprintf("IFS= read -r HISHTORY_SECRET_KEY && export HISHTORY_SECRET_KEY && chmod +x %s && %s install && rm %s", remoteBinaryPath, remoteBinaryPath, remoteBinaryPath))
+	sshCmd.Stdin = strings.NewReader(secretKey + "\n")
+	sshCmd.Stdout = os.Stdout
+	sshCmd.Stderr = os.Stderr
+	if err := sshCmd.Run(); err != nil {
+		return fmt.Errorf("failed to install hishtory on %s: %w", remoteHost, err)
+	}
+	fmt.Printf("Successfully installed hishtory on %s\n", remoteHost)
+	return nil
+}
+
 func install(secretKey string, offline, skipConfigModification bool) error {
 	homedir, err := os.UserHomeDir()
 	if err != nil {
@@ -240,6 +448,10 @@ func handleUpgradedFeatures() error {
 		// AI completion is not yet configured, disable it for upgrades since this is a new feature
 		config.AiCompletion = false
 	}
+	if !strings.Contains(string(configContents), "lazy_search_fetch") {
+		// Lazy search fetching is not yet configured, so enable it
+		config.LazySearchFetch = true
+	}
 	return hctx.SetConfig(&config)
 }
 
@@ -621,6 +833,7 @@ func setup(userSecret string, isOffline bool) error {
 		config.AiCompletion = false
 	}
 	config.EnablePresaving = true
+	config.LazySearchFetch = true
 	err := hctx.SetConfig(&config)
 	if err != nil {
 		return fmt.Errorf("failed to persist config to disk: %w", err)
@@ -653,12 +866,22 @@ func registerAndBootstrapDevice(ctx context.Context, config *hctx.ClientConfig,
 		return fmt.Errorf("failed to register device with backend: %w", err)
 	}
 
+	err = bootstrapDevicePaginated(ctx, config, db, userSecret, true)
+	if err == nil {
+		return nil
+	}
+	if !strings.Contains(err.Error(), "status_code=404") {
+		return err
+	}
+
+	// The backend is too old to support paginated bootstrapping, so fall back to downloading
+	// everything in one response
 	respBody, err := lib.ApiGet(ctx, "/api/v1/bootstrap?user_id="+data.UserId(userSecret)+"&device_id="+config.DeviceId)
 	if err != nil {
 		return fmt.Errorf("failed to bootstrap device from the backend: %w", err)
 	}
 	var retrievedEntries []*shared.EncHistoryEntry
-	err = json.Unmarshal(respBody, &retrievedEntries)
+	err = lib.UnmarshalServerResponse(respBody, &retrievedEntries)
 	if err != nil {
 		return fmt.Errorf("failed to load JSON response: %w", err)
 	}
@@ -674,6 +897,87 @@ func registerAndBootstrapDevice(ctx context.Context, config *hctx.ClientConfig,
 	return nil
 }
 
+// How many entries to download per page when bootstrapping a new device
+const bootstrapPageSize = 5000
+
+// bootstrapDevicePaginated downloads the user's history one page at a time and inserts each page
+// into the local DB as it arrives, so that bootstrapping a very large history neither loads
+// everything into memory at once nor requires one giant (and timeout-prone) response. The cursor
+// identifying the last received page is persisted in the config after each page, so that a sync
+// interrupted partway through (e.g. by going offline) resumes from where it left off in a later
+// session rather than restarting from scratch.
+func bootstrapDevicePaginated(ctx context.Context, config *hctx.ClientConfig, db *gorm.DB, userSecret string, showProgress bool) error {
+	var cursorDate time.Time
+	cursorId := config.InitialSyncCursorId
+	if cursorId != "" {
+		// Resume a previously interrupted initial sync from its persisted cursor
+		var err error
+		cursorDate, err = time.Parse(time.RFC3339Nano, config.InitialSyncCursorDate)
+		if err != nil {
+			hctx.GetLogger().Warnf("failed to parse the persisted initial sync cursor %#v, restarting the sync from scratch: %v", config.InitialSyncCursorDate, err)
+			cursorId = ""
+		}
+	}
+	numEntries := 0
+	var bar *progressbar.ProgressBar
+	for {
+		path := fmt.Sprintf("/api/v1/bootstrap-paginated?user_id=%s&device_id=%s&limit=%d", data.UserId(userSecret), config.DeviceId, bootstrapPageSize)
+		if cursorId != "" {
+			path += "&cursor_date=" + url.QueryEscape(cursorDate.UTC().Format(time.RFC3339Nano)) + "&cursor_id=" + url.QueryEscape(cursorId)
+		}
+		respBody, err := lib.ApiGet(ctx, path)
+		if err != nil {
+			return fmt.Errorf("failed to bootstrap device from the backend: %w", err)
+		}
+		var retrievedEntries []*shared.EncHistoryEntry
+		err = lib.UnmarshalServerResponse(respBody, &retrievedEntries)
+		if err != nil {
+			return fmt.Errorf("failed to load JSON response: %w", err)
+		}
+		for _, entry := range retrievedEntries {
+			decEntry, err := data.DecryptHistoryEntry(userSecret, *entry)
+			if err != nil {
+				return fmt.Errorf("failed to decrypt history entry from server: %w", err)
+			}
+			lib.AddToDbIfNew(db, decEntry)
+			if bar != nil {
+				_ = bar.Add(1)
+			}
+		}
+		numEntries += len(retrievedEntries)
+		if len(retrievedEntries) < bootstrapPageSize {
+			if bar != nil {
+				_ = bar.Finish()
+			}
+			hctx.GetLogger().Infof("Bootstrapping new device: Found %d entries", numEntries)
+			if config.InitialSyncInProgress {
+				config.InitialSyncInProgress = false
+				config.InitialSyncCursorDate = ""
+				config.InitialSyncCursorId = ""
+				return hctx.SetConfig(config)
+			}
+			return nil
+		}
+		if bar == nil && showProgress {
+			// The history is large enough to span multiple pages, so show progress (we don't know
+			// the total up front, so this renders as a spinner with a running count)
+			fmt.Println("Downloading history entries")
+			bar = progressbar.Default(-1)
+		}
+		cursorDate = retrievedEntries[len(retrievedEntries)-1].Date
+		cursorId = retrievedEntries[len(retrievedEntries)-1].EncryptedId
+		// Persist the cursor so that an interrupted sync can resume from here. Note that this is
+		// only set after a full page has been received, so a backend without pagination support
+		// (which 404s above) never leaves a dangling in-progress sync.
+		config.InitialSyncInProgress = true
+		config.InitialSyncCursorDate = cursorDate.UTC().Format(time.RFC3339Nano)
+		config.InitialSyncCursorId = cursorId
+		if err := hctx.SetConfig(config); err != nil {
+			return fmt.Errorf("failed to persist the initial sync cursor: %w", err)
+		}
+	}
+}
+
 func isIntegrationTestDevice() bool {
 	if os.Getenv("HISHTORY_TEST") != "" {
 		return true
@@ -688,11 +992,14 @@ func init() {
 	rootCmd.AddCommand(installCmd)
 	rootCmd.AddCommand(initCmd)
 	rootCmd.AddCommand(uninstallCmd)
+	rootCmd.AddCommand(repairInstallCmd)
 
 	offlineInit = initCmd.Flags().Bool("offline", false, "Install hiSHtory in offline mode wiht all syncing capabilities disabled")
 	forceInit = initCmd.Flags().Bool("force", false, "Force re-init without any prompts")
+	passphraseInit = initCmd.Flags().Bool("passphrase", false, "Derive the secret key from an interactively entered passphrase (via Argon2id) rather than generating a random key, so that other machines can be initialized by entering the same passphrase")
 	offlineInstall = installCmd.Flags().Bool("offline", false, "Install hiSHtory in offline mode with all syncing capabilities disabled")
 	skipConfigModification = installCmd.Flags().Bool("skip-config-modification", false, "Skip modifying shell configs and instead instruct the user on how to modify their configs")
 	skipUpdateConfigModification = installCmd.Flags().Bool("skip-update-config-modification", false, "Skip modifying shell configs for updates")
+	remoteInstall = installCmd.Flags().String("remote", "", "Install hiSHtory on the given remote host (e.g. user@host) over SSH, initialized with this machine's secret key so that history syncs between them")
 	currentlyInstalledVersion = installCmd.Flags().String("currently-installed-version", "", "The currently installed version (used by the update command)")
 }
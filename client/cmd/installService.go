@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"runtime"
+
+	"github.com/ddworken/hishtory/client/data"
+	"github.com/ddworken/hishtory/client/hctx"
+	"github.com/ddworken/hishtory/client/lib"
+
+	"github.com/spf13/cobra"
+)
+
+// A long-running hishtory component that can be managed as a systemd user unit (Linux)
+// or launchd agent (macOS).
+type serviceDefinition struct {
+	// A short name for the service, used in file names (e.g. "web-ui")
+	name string
+	// A human-readable description of the service, included in the generated unit file
+	description string
+	// The arguments to pass to the hishtory binary to run this service
+	args []string
+}
+
+var supportedServices = []serviceDefinition{
+	{name: "web-ui", description: "hiSHtory web UI", args: []string{"start-web-ui"}},
+	{name: "suggest-daemon", description: "hiSHtory suggestion daemon", args: []string{"start-suggest-daemon"}},
+}
+
+var installServiceCmd = &cobra.Command{
+	Use:       "install-service",
+	Short:     "Install a service (systemd on Linux, launchd on macOS) to run a long-running hishtory component that survives reboots",
+	GroupID:   GROUP_ID_INSTALL,
+	Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	ValidArgs: supportedServiceNames(),
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, service := range supportedServices {
+			if service.name == args[0] {
+				lib.CheckFatalError(installService(service))
+				return
+			}
+		}
+		lib.CheckFatalError(fmt.Errorf("unknown service %q, must be one of: %v", args[0], supportedServiceNames()))
+	},
+}
+
+func supportedServiceNames() []string {
+	names := make([]string, 0)
+	for _, service := range supportedServices {
+		names = append(names, service.name)
+	}
+	return names
+}
+
+func installService(service serviceDefinition) error {
+	homedir, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to get user's home directory: %w", err)
+	}
+	binaryPath := path.Join(homedir, data.GetHishtoryPath(), "hishtory")
+	if _, err := os.Stat(binaryPath); err != nil {
+		return fmt.Errorf("failed to find the hishtory binary at %s (is hishtory installed?): %w", binaryPath, err)
+	}
+	switch runtime.GOOS {
+	case "linux":
+		return installSystemdService(homedir, binaryPath, service)
+	case "darwin":
+		return installLaunchdService(homedir, binaryPath, service)
+	default:
+		return fmt.Errorf("hishtory install-service is not supported on %s, only linux (systemd) and darwin (launchd) are supported", runtime.GOOS)
+	}
+}
+
+func buildSystemdUnit(binaryPath string, service serviceDefinition) string {
+	execStart := binaryPath
+	for _, arg := range service.args {
+		execStart += " " + arg
+	}
+	return "[Unit]\n" +
+		"Description=" + service.description + "\n" +
+		"\n" +
+		"[Service]\n" +
+		"ExecStart=" + execStart + "\n" +
+		"Restart=on-failure\n" +
+		"\n" +
+		"[Install]\n" +
+		"WantedBy=default.target\n"
+}
+
+func installSystemdService(homedir, binaryPath string, service serviceDefinition) error {
+	unitDir := path.Join(homedir, ".config/systemd/user")
+	err := os.MkdirAll(unitDir, 0o744)
+	if err != nil {
+		return fmt.Errorf("failed to create systemd user unit directory: %w", err)
+	}
+	unitPath := path.Join(unitDir, "hishtory-"+service.name+".service")
+	err = os.WriteFile(unitPath, []byte(buildSystemdUnit(binaryPath, service)), 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write systemd unit file: %w", err)
+	}
+	hctx.GetLogger().Infof("Wrote systemd unit file to %s", unitPath)
+	if err := runServiceManagerCommand("systemctl", "--user", "daemon-reload"); err != nil {
+		return err
+	}
+	if err := runServiceManagerCommand("systemctl", "--user", "enable", "--now", "hishtory-"+service.name+".service"); err != nil {
+		return err
+	}
+	fmt.Printf("Installed and started the %s service, check its status via `systemctl --user status hishtory-%s`\n", service.description, service.name)
+	return nil
+}
+
+func buildLaunchdPlist(binaryPath string, service serviceDefinition) string {
+	programArguments := "\t\t<string>" + binaryPath + "</string>\n"
+	for _, arg := range service.args {
+		programArguments += "\t\t<string>" + arg + "</string>\n"
+	}
+	return "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n" +
+		"<!DOCTYPE plist PUBLIC \"-//Apple//DTD PLIST 1.0//EN\" \"http://www.apple.com/DTDs/PropertyList-1.0.dtd\">\n" +
+		"<plist version=\"1.0\">\n" +
+		"<dict>\n" +
+		"\t<key>Label</key>\n" +
+		"\t<string>dev.hishtory." + service.name + "</string>\n" +
+		"\t<key>ProgramArguments</key>\n" +
+		"\t<array>\n" +
+		programArguments +
+		"\t</array>\n" +
+		"\t<key>RunAtLoad</key>\n" +
+		"\t<true/>\n" +
+		"\t<key>KeepAlive</key>\n" +
+		"\t<true/>\n" +
+		"</dict>\n" +
+		"</plist>\n"
+}
+
+func installLaunchdService(homedir, binaryPath string, service serviceDefinition) error {
+	agentDir := path.Join(homedir, "Library/LaunchAgents")
+	err := os.MkdirAll(agentDir, 0o744)
+	if err != nil {
+		return fmt.Errorf("failed to create launchd agent directory: %w", err)
+	}
+	plistPath := path.Join(agentDir, "dev.hishtory."+service.name+".plist")
+	err = os.WriteFile(plistPath, []byte(buildLaunchdPlist(binaryPath, service)), 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write launchd plist file: %w", err)
+	}
+	hctx.GetLogger().Infof("Wrote launchd plist file to %s", plistPath)
+	if err := runServiceManagerCommand("launchctl", "load", "-w", plistPath); err != nil {
+		return err
+	}
+	fmt.Printf("Installed and started the %s service, check its status via `launchctl list dev.hishtory.%s`\n", service.description, service.name)
+	return nil
+}
+
+func runServiceManagerCommand(command string, args ...string) error {
+	cmd := exec.Command(command, args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to run %s %v (output=%#v): %w", command, args, string(output), err)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(installServiceCmd)
+}
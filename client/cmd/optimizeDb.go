@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/ddworken/hishtory/client/hctx"
+	"github.com/ddworken/hishtory/client/lib"
+
+	"github.com/spf13/cobra"
+)
+
+// The indices that `hishtory optimize-db` creates to speed up searches over large histories. Each
+// one matches either a search atom that filters on the column (e.g. `exit_code:1` or `host:x1`)
+// or the ORDER BY that every search uses.
+var optimizeDbIndices = []struct {
+	name   string
+	column string
+}{
+	{"end_time_index", "end_time"},
+	{"start_time_index", "start_time"},
+	{"hostname_index", "hostname"},
+	{"cwd_index", "current_working_directory"},
+	{"exit_code_index", "exit_code"},
+}
+
+var optimizeDbCmd = &cobra.Command{
+	Use:     "optimize-db",
+	Short:   "Create indices on the local DB to speed up searches over large histories",
+	Long:    "Creates indices on end_time, start_time, hostname, cwd, and exit_code (matching the atoms that searches commonly filter on), and then runs ANALYZE so that sqlite's query planner knows to use them. Use `hishtory query --explain` to inspect the query plan for a given search.",
+	GroupID: GROUP_ID_MANAGEMENT,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		db := hctx.GetDb(ctx)
+		for _, index := range optimizeDbIndices {
+			lib.CheckFatalError(db.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON history_entries(%s)", index.name, index.column)).Error)
+		}
+		// Refresh sqlite's table statistics so that the query planner actually picks the new indices
+		lib.CheckFatalError(db.Exec("ANALYZE").Error)
+		fmt.Printf("Created %d indices and refreshed the local DB's statistics\n", len(optimizeDbIndices))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(optimizeDbCmd)
+}
@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ddworken/hishtory/client/data"
+	"github.com/ddworken/hishtory/client/hctx"
+	"github.com/ddworken/hishtory/client/lib"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	pruneDryRun   *bool
+	prunePresaved *bool
+)
+
+// The default age after which a presaved entry that never finalized (e.g. because the shell
+// crashed) is considered orphaned, used when presave-orphan-retention isn't configured
+const defaultPresaveOrphanRetention = 7 * 24 * time.Hour
+
+var pruneCmd = &cobra.Command{
+	Use:     "prune",
+	Short:   "Delete history entries that are older than the configured retention policy",
+	Long:    "Deletes entries older than the retention policy configured via `hishtory config-set retention` (e.g. `hishtory config-set retention 1y`) on the current machine and on all remote machines. Use --dry-run to see how many entries would be deleted without deleting anything.\n\nUse --presaved to instead delete orphaned presaved entries: entries from shells that crashed before their command finished, which otherwise accumulate forever with an N/A runtime. These are also cleaned up automatically once they're older than `hishtory config-set presave-orphan-retention` (default 7d, set to none to disable).",
+	GroupID: GROUP_ID_MANAGEMENT,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		lib.CheckFatalError(lib.RetrieveAdditionalEntriesFromRemote(ctx, "prune"))
+		lib.CheckFatalError(lib.ProcessDeletionRequests(ctx))
+		if *prunePresaved {
+			lib.CheckFatalError(prunePresavedOrphans(ctx, *pruneDryRun))
+			return
+		}
+		lib.CheckFatalError(prune(ctx, *pruneDryRun, os.Getenv("HISHTORY_REDACT_FORCE") != ""))
+	},
+}
+
+func prune(ctx context.Context, dryRun, skipUserConfirmation bool) error {
+	config := hctx.GetConf(ctx)
+	if config.RetentionPolicy == "" {
+		return fmt.Errorf("no retention policy is configured, set one via `hishtory config-set retention` (e.g. `hishtory config-set retention 1y`)")
+	}
+	retentionDuration, err := lib.ParseRetentionDuration(config.RetentionPolicy)
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-retentionDuration)
+	db := hctx.GetDb(ctx)
+	var historyEntries []*data.HistoryEntry
+	// Presaved entries use an end_time of the unix epoch as a sentinel, so they'd all match a
+	// plain `end_time < cutoff` even while their command is still running. Orphaned presaves are
+	// cleaned up separately via `hishtory prune --presaved`.
+	res := db.Where("end_time < ? AND end_time != ?", cutoff, time.Unix(0, 0).UTC()).Find(&historyEntries)
+	if res.Error != nil {
+		return res.Error
+	}
+	if len(historyEntries) == 0 {
+		fmt.Printf("No entries are older than the configured retention policy of %s\n", config.RetentionPolicy)
+		return nil
+	}
+	if dryRun {
+		fmt.Printf("Would permanently delete %d entries older than %s (from before %s)\n", len(historyEntries), config.RetentionPolicy, cutoff.Local().Format(time.DateTime))
+		return nil
+	}
+	if skipUserConfirmation {
+		fmt.Printf("Permanently deleting %d entries older than %s\n", len(historyEntries), config.RetentionPolicy)
+	} else {
+		fmt.Printf("This will permanently delete %d entries older than %s (from before %s), are you sure? [y/N] ", len(historyEntries), config.RetentionPolicy, cutoff.Local().Format(time.DateTime))
+		reader := bufio.NewReader(os.Stdin)
+		resp, err := reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read response: %w", err)
+		}
+		if strings.TrimSpace(resp) != "y" {
+			fmt.Printf("Aborting prune per user response of %#v\n", strings.TrimSpace(resp))
+			return nil
+		}
+	}
+	res = db.Where("end_time < ? AND end_time != ?", cutoff, time.Unix(0, 0).UTC()).Delete(&data.HistoryEntry{})
+	if res.Error != nil {
+		return res.Error
+	}
+	_, err = deleteOnRemoteInstances(ctx, historyEntries)
+	return err
+}
+
+// presaveOrphanCutoff returns the time before which a presaved entry that never finalized is
+// considered orphaned, per the presave-orphan-retention config
+func presaveOrphanCutoff(ctx context.Context) (time.Time, error) {
+	config := hctx.GetConf(ctx)
+	retention := defaultPresaveOrphanRetention
+	if config.PresaveOrphanRetention != "" && config.PresaveOrphanRetention != "none" {
+		parsed, err := lib.ParseRetentionDuration(config.PresaveOrphanRetention)
+		if err != nil {
+			return time.Time{}, err
+		}
+		retention = parsed
+	}
+	return time.Now().Add(-retention), nil
+}
+
+// deleteOrphanedPresaves deletes all presaved entries that started before the given cutoff and
+// never finalized, both locally and on remote devices, and returns how many were deleted. Note
+// that this intentionally includes presaves from other devices, since a device that crashed (or
+// was decommissioned) mid-command will never clean up its own orphans.
+func deleteOrphanedPresaves(ctx context.Context, cutoff time.Time) (int, error) {
+	db := hctx.GetDb(ctx)
+	var orphanedEntries []*data.HistoryEntry
+	res := db.Where("end_time = ? AND start_time < ?", time.Unix(0, 0).UTC(), cutoff).Find(&orphanedEntries)
+	if res.Error != nil {
+		return 0, fmt.Errorf("failed to search for orphaned presaved entries: %w", res.Error)
+	}
+	if len(orphanedEntries) == 0 {
+		return 0, nil
+	}
+	res = db.Where("end_time = ? AND start_time < ?", time.Unix(0, 0).UTC(), cutoff).Delete(&data.HistoryEntry{})
+	if res.Error != nil {
+		return 0, fmt.Errorf("failed to delete orphaned presaved entries: %w", res.Error)
+	}
+	_, err := deleteOnRemoteInstances(ctx, orphanedEntries)
+	return len(orphanedEntries), err
+}
+
+// prunePresavedOrphans implements `hishtory prune --presaved`: the manual path for deleting
+// orphaned presaved entries. Unlike the automatic cleanup, it runs even when
+// presave-orphan-retention is set to none (using the default threshold in that case).
+func prunePresavedOrphans(ctx context.Context, dryRun bool) error {
+	cutoff, err := presaveOrphanCutoff(ctx)
+	if err != nil {
+		return err
+	}
+	db := hctx.GetDb(ctx)
+	if dryRun {
+		var count int64
+		res := db.Model(&data.HistoryEntry{}).Where("end_time = ? AND start_time < ?", time.Unix(0, 0).UTC(), cutoff).Count(&count)
+		if res.Error != nil {
+			return res.Error
+		}
+		fmt.Printf("Would delete %d orphaned presaved entries from before %s\n", count, cutoff.Local().Format(time.DateTime))
+		return nil
+	}
+	numDeleted, err := deleteOrphanedPresaves(ctx, cutoff)
+	if err != nil {
+		return err
+	}
+	if numDeleted == 0 {
+		fmt.Printf("No orphaned presaved entries from before %s\n", cutoff.Local().Format(time.DateTime))
+	} else {
+		fmt.Printf("Deleted %d orphaned presaved entries from before %s\n", numDeleted, cutoff.Local().Format(time.DateTime))
+	}
+	return nil
+}
+
+// maybeCleanOrphanedPresaves is the automatic counterpart of `hishtory prune --presaved`, run
+// periodically from the shell hooks. It is a no-op when presave-orphan-retention is set to none.
+func maybeCleanOrphanedPresaves(ctx context.Context) error {
+	config := hctx.GetConf(ctx)
+	if config.PresaveOrphanRetention == "none" {
+		return nil
+	}
+	cutoff, err := presaveOrphanCutoff(ctx)
+	if err != nil {
+		return err
+	}
+	numDeleted, err := deleteOrphanedPresaves(ctx, cutoff)
+	if err != nil {
+		return err
+	}
+	if numDeleted > 0 {
+		hctx.GetLogger().Infof("Cleaned up %d orphaned presaved entries from before %s", numDeleted, cutoff.Format(time.DateTime))
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(pruneCmd)
+	pruneDryRun = pruneCmd.Flags().Bool("dry-run", false, "Display how many entries would be deleted without actually deleting anything")
+	prunePresaved = pruneCmd.Flags().Bool("presaved", false, "Delete orphaned presaved entries (from shells that crashed before their command finished) instead of applying the retention policy")
+}
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ddworken/hishtory/client/data"
+	"github.com/ddworken/hishtory/client/hctx"
+	"github.com/ddworken/hishtory/shared/testutils"
+
+	"github.com/stretchr/testify/require"
+)
+
+// makeOfflineTestContext initializes a fresh offline hishtory install, so that the tested commands
+// don't try to contact a backend (e.g. via deleteOnRemoteInstances)
+func makeOfflineTestContext(t *testing.T) (context.Context, func()) {
+	restore := testutils.BackupAndRestore(t)
+	require.NoError(t, hctx.InitConfig())
+	config, err := hctx.GetConfig()
+	require.NoError(t, err)
+	config.IsOffline = true
+	require.NoError(t, hctx.SetConfig(&config))
+	return hctx.MakeContext(), restore
+}
+
+func TestPrune(t *testing.T) {
+	ctx, restore := makeOfflineTestContext(t)
+	defer restore()
+	db := hctx.GetDb(ctx)
+
+	// Pruning without a retention policy configured is an error rather than deleting anything
+	require.ErrorContains(t, prune(ctx, false, true), "no retention policy is configured")
+
+	// Insert entries that are older than the retention policy, plus one recent entry
+	for i := 0; i < 3; i++ {
+		entry := testutils.MakeFakeHistoryEntry("echo old")
+		entry.StartTime = time.Now().Add(-200 * 24 * time.Hour)
+		entry.EndTime = entry.StartTime.Add(time.Second)
+		require.NoError(t, db.Create(&entry).Error)
+	}
+	recentEntry := testutils.MakeFakeHistoryEntry("echo recent")
+	recentEntry.StartTime = time.Now().Add(-time.Hour)
+	recentEntry.EndTime = recentEntry.StartTime.Add(time.Second)
+	require.NoError(t, db.Create(&recentEntry).Error)
+	// A presaved entry for a command that is still running: its sentinel end_time of the unix
+	// epoch must not make the retention policy treat it as ancient
+	presavedEntry := testutils.MakeFakeHistoryEntry("echo still-running")
+	presavedEntry.StartTime = time.Now().Add(-time.Minute)
+	presavedEntry.EndTime = time.Unix(0, 0).UTC()
+	require.NoError(t, db.Create(&presavedEntry).Error)
+	hctx.GetConf(ctx).RetentionPolicy = "90d"
+
+	// A dry-run doesn't delete anything
+	require.NoError(t, prune(ctx, true, true))
+	var count int64
+	require.NoError(t, db.Model(&data.HistoryEntry{}).Count(&count).Error)
+	require.Equal(t, int64(5), count)
+
+	// A real prune deletes exactly the finalized entries older than the retention policy, leaving
+	// the recent entry and the presaved entry alone
+	require.NoError(t, prune(ctx, false, true))
+	var entries []*data.HistoryEntry
+	require.NoError(t, db.Order("start_time").Find(&entries).Error)
+	require.Len(t, entries, 2)
+	require.Equal(t, "echo recent", entries[0].Command)
+	require.Equal(t, "echo still-running", entries[1].Command)
+
+	// Re-running is a no-op now that nothing is older than the retention policy
+	require.NoError(t, prune(ctx, false, true))
+	require.NoError(t, db.Model(&data.HistoryEntry{}).Count(&count).Error)
+	require.Equal(t, int64(2), count)
+}
+
+func TestPrunePresavedOrphans(t *testing.T) {
+	ctx, restore := makeOfflineTestContext(t)
+	defer restore()
+	db := hctx.GetDb(ctx)
+
+	// An orphaned presave: it started well before the retention threshold and never finalized
+	oldOrphan := testutils.MakeFakeHistoryEntry("echo old-orphan")
+	oldOrphan.StartTime = time.Now().Add(-30 * 24 * time.Hour)
+	oldOrphan.EndTime = time.Unix(0, 0).UTC()
+	require.NoError(t, db.Create(&oldOrphan).Error)
+	// A recent presave, e.g. from a command that is still running
+	recentPresave := testutils.MakeFakeHistoryEntry("echo still-running")
+	recentPresave.StartTime = time.Now().Add(-time.Hour)
+	recentPresave.EndTime = time.Unix(0, 0).UTC()
+	require.NoError(t, db.Create(&recentPresave).Error)
+	// A normal finalized entry that is just as old as the orphan
+	oldEntry := testutils.MakeFakeHistoryEntry("echo old-but-finalized")
+	oldEntry.StartTime = time.Now().Add(-30 * 24 * time.Hour)
+	oldEntry.EndTime = oldEntry.StartTime.Add(time.Second)
+	require.NoError(t, db.Create(&oldEntry).Error)
+
+	// A dry-run doesn't delete anything
+	require.NoError(t, prunePresavedOrphans(ctx, true))
+	var count int64
+	require.NoError(t, db.Model(&data.HistoryEntry{}).Count(&count).Error)
+	require.Equal(t, int64(3), count)
+
+	// A real run deletes only the old orphan: recent presaves and finalized entries are left alone
+	require.NoError(t, prunePresavedOrphans(ctx, false))
+	var entries []*data.HistoryEntry
+	require.NoError(t, db.Order("start_time").Find(&entries).Error)
+	require.Len(t, entries, 2)
+	require.Equal(t, "echo old-but-finalized", entries[0].Command)
+	require.Equal(t, "echo still-running", entries[1].Command)
+}
+
+func TestMaybeCleanOrphanedPresaves(t *testing.T) {
+	ctx, restore := makeOfflineTestContext(t)
+	defer restore()
+	db := hctx.GetDb(ctx)
+
+	orphan := testutils.MakeFakeHistoryEntry("echo orphan")
+	orphan.StartTime = time.Now().Add(-30 * 24 * time.Hour)
+	orphan.EndTime = time.Unix(0, 0).UTC()
+	require.NoError(t, db.Create(&orphan).Error)
+
+	// The automatic cleanup is disabled when presave-orphan-retention is set to none
+	hctx.GetConf(ctx).PresaveOrphanRetention = "none"
+	require.NoError(t, maybeCleanOrphanedPresaves(ctx))
+	var count int64
+	require.NoError(t, db.Model(&data.HistoryEntry{}).Count(&count).Error)
+	require.Equal(t, int64(1), count)
+
+	// With the default retention, the orphan is older than the threshold and gets cleaned up
+	hctx.GetConf(ctx).PresaveOrphanRetention = ""
+	require.NoError(t, maybeCleanOrphanedPresaves(ctx))
+	require.NoError(t, db.Model(&data.HistoryEntry{}).Count(&count).Error)
+	require.Equal(t, int64(0), count)
+}
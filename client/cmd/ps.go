@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ddworken/hishtory/client/data"
+	"github.com/ddworken/hishtory/client/hctx"
+	"github.com/ddworken/hishtory/client/lib"
+
+	"github.com/fatih/color"
+	"github.com/rodaine/table"
+	"github.com/spf13/cobra"
+)
+
+var psCmd = &cobra.Command{
+	Use:     "ps",
+	Short:   "List commands that are still running, on this device and your other synced devices",
+	GroupID: GROUP_ID_QUERYING,
+	Long:    "List commands that were presaved but haven't finished running yet, across all synced devices. Since presaved entries sync like regular entries, this shows long-running jobs on your other machines too. Requires presaving to be enabled on the devices running the commands (see `hishtory config-set presaving true`).",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		lib.CheckFatalError(ps(ctx))
+	},
+}
+
+func ps(ctx context.Context) error {
+	config := hctx.GetConf(ctx)
+	// Sync first so that recently started (and recently finished) commands on other devices are
+	// reflected, since a presaved entry is deleted once the command finishes
+	err := lib.RetrieveAdditionalEntriesFromRemote(ctx, "ps")
+	if err != nil {
+		if lib.IsOfflineError(ctx, err) {
+			fmt.Println("Warning: hishtory is offline so this may be missing commands that are running on your other machines!")
+		} else {
+			return err
+		}
+	}
+	if err := lib.ProcessDeletionRequests(ctx); err != nil {
+		return err
+	}
+	db := hctx.GetDb(ctx)
+	var entries []*data.HistoryEntry
+	// Presaved entries are identified by the placeholder end time that presaveHistoryEntry sets
+	res := db.Where("end_time = ?", time.Unix(0, 0).UTC()).Order("start_time DESC").Find(&entries)
+	if res.Error != nil {
+		return fmt.Errorf("failed to query for presaved entries: %w", res.Error)
+	}
+	if !config.EnablePresaving {
+		fmt.Println("Note: presaving is disabled on this device (enable it via `hishtory config-set presaving true`), so commands running on this device won't be listed")
+	}
+	if len(entries) == 0 {
+		fmt.Println("No running commands found")
+		return nil
+	}
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	tbl := table.New("Hostname", "CWD", "Started", "Running For", "Command")
+	tbl.WithHeaderFormatter(headerFmt)
+	for _, entry := range entries {
+		runningFor := time.Since(entry.StartTime).Round(time.Second)
+		if runningFor < 0 {
+			// The other device's clock is ahead of ours, so avoid displaying a negative runtime
+			runningFor = 0
+		}
+		tbl.AddRow(entry.Hostname, entry.CurrentWorkingDirectory, entry.StartTime.Local().Format(config.TimestampFormat), runningFor, entry.Command)
+	}
+	tbl.Print()
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(psCmd)
+}
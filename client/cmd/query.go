@@ -6,6 +6,7 @@ import (
 	"math/rand"
 	"os"
 	"runtime/pprof"
+	"slices"
 	"strings"
 
 	"github.com/ddworken/hishtory/client/data"
@@ -26,6 +27,7 @@ var EXAMPLE_QUERIES string = `Example queries:
 'hishtory SUBCOMMAND curl user:david'	# Find shell commands containing 'curl' run by 'david'
 'hishtory SUBCOMMAND curl host:x1'		# Find shell commands containing 'curl' run on 'x1'
 'hishtory SUBCOMMAND exit_code:1'		# Find shell commands that exited with status code 1
+'hishtory SUBCOMMAND args:>5'		# Find shell commands with more than 5 arguments
 'hishtory SUBCOMMAND before:2022-02-01'	# Find shell commands run before 2022-02-01
 `
 
@@ -35,15 +37,107 @@ var queryCmd = &cobra.Command{
 	Use:                "query",
 	Short:              "Query your shell history and display the results in an ASCII art table",
 	GroupID:            GROUP_ID_QUERYING,
-	Long:               strings.ReplaceAll(EXAMPLE_QUERIES, "SUBCOMMAND", "query"),
+	Long:               strings.ReplaceAll(EXAMPLE_QUERIES, "SUBCOMMAND", "query") + "\n\nPass --explain to instead print the generated SQL, sqlite's query plan, and timing for the search, which is useful for diagnosing slow searches (see also 'hishtory optimize-db').\n\nPass --db /path/to/.hishtory.db to search that DB file directly rather than this machine's history, without requiring hishtory to be installed or initialized (e.g. for searching a DB that was scp-ed over to a rescue machine, or for inspecting a backup).",
 	DisableFlagParsing: true,
 	Run: func(cmd *cobra.Command, args []string) {
-		ctx := hctx.MakeContext()
-		lib.CheckFatalError(lib.ProcessDeletionRequests(ctx))
+		args, dbPath := extractDbFlag(args)
+		var ctx context.Context
+		if dbPath != "" {
+			// Standalone mode: query the given DB file directly, with no config or install required
+			standaloneCtx, err := hctx.MakeStandaloneContext(dbPath)
+			lib.CheckFatalError(err)
+			ctx = standaloneCtx
+		} else {
+			ctx = hctx.MakeContext()
+		}
+		args, presetName := extractColumnsFlag(args)
+		if presetName != "" {
+			lib.CheckFatalError(applyColumnPreset(ctx, presetName))
+		}
+		args, explain := extractExplainFlag(args)
+		if explain {
+			// Use the same limit that query() passes to lib.Search, so that the explained query
+			// matches the one that actually runs
+			lib.CheckFatalError(lib.ExplainSearch(ctx, hctx.GetDb(ctx), strings.Join(args, " "), 25*5))
+			return
+		}
+		if dbPath == "" {
+			// Skipped in standalone mode since the DB is opened read-only
+			lib.CheckFatalError(lib.ProcessDeletionRequests(ctx))
+		}
 		query(ctx, strings.Join(args, " "))
 	},
 }
 
+// Extract the value of the --db flag from the given args, which is also done manually since
+// queryCmd disables flag parsing (see extractColumnsFlag)
+func extractDbFlag(args []string) ([]string, string) {
+	remainingArgs := make([]string, 0, len(args))
+	dbPath := ""
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--db" && i+1 < len(args) {
+			dbPath = args[i+1]
+			i++
+		} else if strings.HasPrefix(args[i], "--db=") {
+			dbPath = strings.TrimPrefix(args[i], "--db=")
+		} else {
+			remainingArgs = append(remainingArgs, args[i])
+		}
+	}
+	return remainingArgs, dbPath
+}
+
+// Extract the --explain flag from the given args, which is also done manually since queryCmd
+// disables flag parsing (see extractColumnsFlag)
+func extractExplainFlag(args []string) ([]string, bool) {
+	remainingArgs := make([]string, 0, len(args))
+	explain := false
+	for _, arg := range args {
+		if arg == "--explain" {
+			explain = true
+		} else {
+			remainingArgs = append(remainingArgs, arg)
+		}
+	}
+	return remainingArgs, explain
+}
+
+// Extract the value of the --columns flag from the given args. This is done manually since
+// queryCmd disables flag parsing so that search queries containing dashes aren't interpreted
+// as flags.
+func extractColumnsFlag(args []string) ([]string, string) {
+	remainingArgs := make([]string, 0, len(args))
+	presetName := ""
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--columns" && i+1 < len(args) {
+			presetName = args[i+1]
+			i++
+		} else if strings.HasPrefix(args[i], "--columns=") {
+			presetName = strings.TrimPrefix(args[i], "--columns=")
+		} else {
+			remainingArgs = append(remainingArgs, args[i])
+		}
+	}
+	return remainingArgs, presetName
+}
+
+// Apply the named column preset for just this invocation by overriding the in-memory config,
+// without persisting the change to the config file
+func applyColumnPreset(ctx context.Context, presetName string) error {
+	config := hctx.GetConf(ctx)
+	preset, ok := config.ColumnPresets[presetName]
+	if !ok {
+		presetNames := make([]string, 0, len(config.ColumnPresets))
+		for name := range config.ColumnPresets {
+			presetNames = append(presetNames, name)
+		}
+		slices.Sort(presetNames)
+		return fmt.Errorf("no column preset named %#v (existing presets: %#v), create one via `hishtory config-add column-preset`", presetName, presetNames)
+	}
+	config.DisplayedColumns = preset
+	return nil
+}
+
 var tqueryCmd = &cobra.Command{
 	Use:                "tquery",
 	Short:              "Interactively query your shell history in a TUI interface",
@@ -70,12 +164,51 @@ var exportCmd = &cobra.Command{
 	Use:                "export",
 	Short:              "Export your shell history and display just the raw commands",
 	GroupID:            GROUP_ID_QUERYING,
-	Long:               strings.ReplaceAll(EXAMPLE_QUERIES, "SUBCOMMAND", "export"),
+	Long:               strings.ReplaceAll(EXAMPLE_QUERIES, "SUBCOMMAND", "export") + "\n\nPass --format markdown to instead render the matching entries as a markdown runbook with timestamps, working directories, and fenced command blocks. Pass --format atuin-sqlite (optionally with --output path/to/history.db) to write a sqlite database in atuin's history format.",
 	DisableFlagParsing: true,
 	Run: func(cmd *cobra.Command, args []string) {
 		ctx := hctx.MakeContext()
 		lib.CheckFatalError(lib.ProcessDeletionRequests(ctx))
-		export(ctx, strings.Join(args, " "))
+		// Since this command has DisableFlagParsing=true (so that flag-like tokens can be part of
+		// search queries), we have to manually extract the --format and --output flags from the args
+		format := "raw"
+		output := ""
+		filteredArgs := make([]string, 0)
+		for i := 0; i < len(args); i++ {
+			if args[i] == "--format" && i+1 < len(args) {
+				format = args[i+1]
+				i++
+				continue
+			}
+			if strings.HasPrefix(args[i], "--format=") {
+				format = strings.TrimPrefix(args[i], "--format=")
+				continue
+			}
+			if args[i] == "--output" && i+1 < len(args) {
+				output = args[i+1]
+				i++
+				continue
+			}
+			if strings.HasPrefix(args[i], "--output=") {
+				output = strings.TrimPrefix(args[i], "--output=")
+				continue
+			}
+			filteredArgs = append(filteredArgs, args[i])
+		}
+		query := strings.Join(filteredArgs, " ")
+		switch format {
+		case "raw":
+			export(ctx, query)
+		case "markdown":
+			lib.CheckFatalError(exportToMarkdown(ctx, os.Stdout, query))
+		case "atuin-sqlite":
+			if output == "" {
+				output = "hishtory-atuin-export.db"
+			}
+			lib.CheckFatalError(exportToAtuinSqlite(ctx, query, output))
+		default:
+			lib.CheckFatalError(fmt.Errorf("unsupported export format %#v, must be one of: raw, markdown, atuin-sqlite (for JSON, see 'hishtory export-json')", format))
+		}
 	},
 }
 
@@ -111,6 +244,20 @@ var updateLocalDbFromRemoteCmd = &cobra.Command{
 		// are always reasonably complete and fast (even when offline).
 		ctx := hctx.MakeContext()
 		config := hctx.GetConf(ctx)
+		// Occasionally check whether the local DB has grown past max-db-size and evict old
+		// entries if so. This runs even in offline mode, since eviction is purely local.
+		if rand.Intn(20) == 0 {
+			err := lib.MaybeEvictOldEntries(ctx)
+			if err != nil {
+				hctx.GetLogger().Warnf("updateLocalDbFromRemote: Failed to MaybeEvictOldEntries: %v", err)
+			}
+			// Also clean up orphaned presaved entries from shells that crashed before their
+			// command finished, which would otherwise accumulate forever
+			err = maybeCleanOrphanedPresaves(ctx)
+			if err != nil {
+				hctx.GetLogger().Warnf("updateLocalDbFromRemote: Failed to maybeCleanOrphanedPresaves: %v", err)
+			}
+		}
 		if config.IsOffline {
 			return
 		}
@@ -128,6 +275,12 @@ var updateLocalDbFromRemoteCmd = &cobra.Command{
 			} else if err != nil {
 				hctx.GetLogger().Warnf("updateLocalDbFromRemote: Failed to ProcessDeletionRequests: %v", err)
 			}
+			if config.EnableConfigSync {
+				_, err = lib.DownloadSyncedConfig(ctx)
+				if err != nil {
+					hctx.GetLogger().Warnf("updateLocalDbFromRemote: Failed to DownloadSyncedConfig: %v", err)
+				}
+			}
 		}
 	},
 }
@@ -160,6 +313,7 @@ func query(ctx context.Context, query string) {
 		}
 	}
 	lib.CheckFatalError(displayBannerIfSet(ctx))
+	lib.CheckFatalError(lib.MaybeWarnAboutDbSize(ctx))
 	numResults := 25
 	data, err := lib.Search(ctx, db, query, numResults*5)
 	lib.CheckFatalError(err)
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	"fmt"
+	"net/url"
 	"os"
 	"strings"
 	"time"
@@ -11,6 +12,7 @@ import (
 	"github.com/ddworken/hishtory/client/data"
 	"github.com/ddworken/hishtory/client/hctx"
 	"github.com/ddworken/hishtory/client/lib"
+	"github.com/ddworken/hishtory/client/tui"
 	"github.com/ddworken/hishtory/shared"
 
 	"github.com/spf13/cobra"
@@ -22,11 +24,28 @@ var redactCmd = &cobra.Command{
 	Use:                "redact",
 	Aliases:            []string{"delete"},
 	Short:              "Query for matching commands and remove them from your shell history",
-	Long:               "This removes history entries on the current machine and on all remote machines. Supports the same query format as 'hishtory query'.",
+	Long:               "This removes history entries on the current machine and on all remote machines. Supports the same query format as 'hishtory query'. Pass --interactive to review the matching entries and check/uncheck individual ones before they're deleted.",
 	GroupID:            GROUP_ID_MANAGEMENT,
 	DisableFlagParsing: true,
 	Run: func(cmd *cobra.Command, args []string) {
 		ctx := hctx.MakeContext()
+		// Since this command has DisableFlagParsing=true (so that flag-like tokens can be part of
+		// search queries), we have to manually extract the --verify and --interactive flags from the args
+		verify := false
+		interactive := false
+		filteredArgs := make([]string, 0)
+		for _, arg := range args {
+			if arg == "--verify" {
+				verify = true
+				continue
+			}
+			if arg == "--interactive" {
+				interactive = true
+				continue
+			}
+			filteredArgs = append(filteredArgs, arg)
+		}
+		args = filteredArgs
 		skipOnlineRedaction := false
 		if !hctx.GetConf(ctx).IsOffline && !lib.CanReachHishtoryServer(ctx) {
 			fmt.Printf("Cannot reach hishtory backend (is this device offline?) so redaction will only apply to this device and not other synced devices. Would you like to continue with a local-only redaction anyways? [y/N] ")
@@ -42,11 +61,11 @@ var redactCmd = &cobra.Command{
 		lib.CheckFatalError(lib.RetrieveAdditionalEntriesFromRemote(ctx, "redact"))
 		lib.CheckFatalError(lib.ProcessDeletionRequests(ctx))
 		query := strings.Join(args, " ")
-		lib.CheckFatalError(redact(ctx, query, os.Getenv("HISHTORY_REDACT_FORCE") != "", skipOnlineRedaction))
+		lib.CheckFatalError(redact(ctx, query, interactive, os.Getenv("HISHTORY_REDACT_FORCE") != "", skipOnlineRedaction, verify))
 	},
 }
 
-func redact(ctx context.Context, query string, skipUserConfirmation, skipOnlineRedaction bool) error {
+func redact(ctx context.Context, query string, interactive, skipUserConfirmation, skipOnlineRedaction, verify bool) error {
 	tx, err := lib.MakeWhereQueryFromSearch(ctx, hctx.GetDb(ctx), query)
 	if err != nil {
 		return err
@@ -56,7 +75,18 @@ func redact(ctx context.Context, query string, skipUserConfirmation, skipOnlineR
 	if res.Error != nil {
 		return res.Error
 	}
-	if skipUserConfirmation {
+	if interactive {
+		// Let the user check/uncheck individual entries, which also serves as the confirmation
+		historyEntries, err = tui.PickEntriesToRedact(ctx, historyEntries)
+		if err != nil {
+			return err
+		}
+		if len(historyEntries) == 0 {
+			fmt.Println("Aborting redact since no entries were selected")
+			return nil
+		}
+		fmt.Printf("Permanently deleting %d entries\n", len(historyEntries))
+	} else if skipUserConfirmation {
 		fmt.Printf("Permanently deleting %d entries\n", len(historyEntries))
 	} else {
 		fmt.Printf("This will permanently delete %d entries, are you sure? [y/N] ", len(historyEntries))
@@ -70,28 +100,44 @@ func redact(ctx context.Context, query string, skipUserConfirmation, skipOnlineR
 			return nil
 		}
 	}
-	tx, err = lib.MakeWhereQueryFromSearch(ctx, hctx.GetDb(ctx), query)
-	if err != nil {
-		return err
+	if interactive {
+		// Delete exactly the entries that the user selected, rather than everything matching the query
+		entryIds := make([]string, 0, len(historyEntries))
+		for _, entry := range historyEntries {
+			entryIds = append(entryIds, entry.EntryId)
+		}
+		res = hctx.GetDb(ctx).Where("entry_id IN ?", entryIds).Delete(&data.HistoryEntry{})
+	} else {
+		tx, err = lib.MakeWhereQueryFromSearch(ctx, hctx.GetDb(ctx), query)
+		if err != nil {
+			return err
+		}
+		res = tx.Delete(&data.HistoryEntry{})
 	}
-	res = tx.Delete(&data.HistoryEntry{})
 	if res.Error != nil {
 		return res.Error
 	}
 	if res.RowsAffected > int64(len(historyEntries))+1 || res.RowsAffected < int64(len(historyEntries))-1 {
 		return fmt.Errorf("DB deleted %d rows, when we only expected to delete %d rows, something may have gone wrong", res.RowsAffected, len(historyEntries))
 	}
-	err = deleteOnRemoteInstances(ctx, historyEntries)
+	deletionRequest, err := deleteOnRemoteInstances(ctx, historyEntries)
 	if err != nil && !skipOnlineRedaction {
 		return err
 	}
+	if verify {
+		if deletionRequest == nil || err != nil {
+			fmt.Println("Skipping redaction verification since the deletion request was not sent to the backend")
+			return nil
+		}
+		return verifyRedactionApplied(ctx, deletionRequest.SendTime)
+	}
 	return nil
 }
 
-func deleteOnRemoteInstances(ctx context.Context, historyEntries []*data.HistoryEntry) error {
+func deleteOnRemoteInstances(ctx context.Context, historyEntries []*data.HistoryEntry) (*shared.DeletionRequest, error) {
 	config := hctx.GetConf(ctx)
 	if config.IsOffline {
-		return nil
+		return nil, nil
 	}
 
 	var deletionRequest shared.DeletionRequest
@@ -103,7 +149,53 @@ func deleteOnRemoteInstances(ctx context.Context, historyEntries []*data.History
 			shared.MessageIdentifier{DeviceId: entry.DeviceId, EndTime: entry.EndTime, EntryId: entry.EntryId},
 		)
 	}
-	return lib.SendDeletionRequest(ctx, deletionRequest)
+	err := lib.SendDeletionRequest(ctx, deletionRequest)
+	if err != nil {
+		return nil, err
+	}
+	return &deletionRequest, nil
+}
+
+// How long `hishtory redact --verify` will wait for other devices to acknowledge that they've
+// applied the deletion before giving up
+const redactVerificationTimeout = 60 * time.Second
+
+// Poll the backend until all of the user's other devices have downloaded (and thus applied) the
+// deletion request that was just sent, or until we hit redactVerificationTimeout. Reports which
+// devices are still pending, so users know which machines haven't yet applied the deletion.
+func verifyRedactionApplied(ctx context.Context, sendTime time.Time) error {
+	config := hctx.GetConf(ctx)
+	// The backend may truncate the sub-second precision of SendTime when storing it, so query with
+	// a second of slack to ensure we match the deletion request that we just created
+	sendTimeParam := url.QueryEscape(sendTime.Add(-time.Second).UTC().Format(time.RFC3339Nano))
+	deadline := time.Now().Add(redactVerificationTimeout)
+	fmt.Println("Waiting for other devices to apply the deletion...")
+	for {
+		respBody, err := lib.ApiGet(ctx, "/api/v1/get-deletion-request-status?user_id="+data.UserId(config.UserSecret)+"&send_time="+sendTimeParam)
+		if err != nil {
+			return fmt.Errorf("failed to check the status of the deletion request: %w", err)
+		}
+		var statuses []shared.DeletionRequestStatus
+		err = lib.UnmarshalServerResponse(respBody, &statuses)
+		if err != nil {
+			return fmt.Errorf("failed to parse deletion request statuses: %w", err)
+		}
+		pendingDevices := make([]string, 0)
+		for _, status := range statuses {
+			if status.DeviceId != config.DeviceId && status.ReadCount == 0 {
+				pendingDevices = append(pendingDevices, status.DeviceId)
+			}
+		}
+		if len(pendingDevices) == 0 {
+			fmt.Println("All devices have applied the deletion")
+			return nil
+		}
+		if time.Now().After(deadline) {
+			fmt.Printf("Timed out waiting for %d device(s) to apply the deletion: %s\nThese devices will apply the deletion the next time they come online.\n", len(pendingDevices), strings.Join(pendingDevices, ", "))
+			return nil
+		}
+		time.Sleep(time.Second)
+	}
 }
 
 func init() {
@@ -5,16 +5,67 @@ package cmd
 
 import (
 	"os"
+	"strings"
 
+	"github.com/ddworken/hishtory/client/data"
+	"github.com/ddworken/hishtory/client/hctx"
 	"github.com/ddworken/hishtory/client/lib"
 
 	"github.com/spf13/cobra"
 )
 
+var profileFlag *string
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "hishtory",
 	Short: "hiSHtory: Better shell history",
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if *profileFlag != "" {
+			// Profiles are implemented by selecting a separate data directory (and thus a separate
+			// secret key, DB, and config), so expose the flag via the same env variable that the
+			// shell hooks use to select which profile commands are recorded into
+			os.Setenv("HISHTORY_PROFILE", *profileFlag)
+		}
+		lib.CheckFatalError(data.ValidateHishtoryPath())
+		maybeRecordAuditEvent(cmd, args)
+	},
+}
+
+// The top-level commands whose invocations get appended to the local audit log (see
+// hctx.RecordAuditEvent): the ones that change configuration, enable or disable recording, redact
+// history, or perform key operations
+var auditedCommands = map[string]bool{
+	"config-set":    true,
+	"config-add":    true,
+	"config-delete": true,
+	"enable":        true,
+	"disable":       true,
+	"redact":        true,
+	"install":       true,
+	"init":          true,
+	"uninstall":     true,
+}
+
+func maybeRecordAuditEvent(cmd *cobra.Command, args []string) {
+	// Walk up to the top-level command (the direct child of the root command)
+	topLevel := cmd
+	for topLevel.HasParent() && topLevel.Parent().HasParent() {
+		topLevel = topLevel.Parent()
+	}
+	if !auditedCommands[topLevel.Name()] {
+		return
+	}
+	action := cmd.CommandPath()
+	if topLevel.Name() == "install" || topLevel.Name() == "init" {
+		// Don't log the arguments for key operations, since they can contain the secret key
+		if len(args) > 0 {
+			action += " [arguments redacted]"
+		}
+	} else if len(args) > 0 {
+		action += " " + strings.Join(args, " ")
+	}
+	hctx.RecordAuditEvent(action)
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -32,4 +83,5 @@ func init() {
 	rootCmd.AddGroup(&cobra.Group{ID: GROUP_ID_CONFIG, Title: "Configuration"})
 	rootCmd.AddGroup(&cobra.Group{ID: GROUP_ID_INSTALL, Title: "Installation"})
 	rootCmd.Version = "v0." + lib.Version
+	profileFlag = rootCmd.PersistentFlags().String("profile", "", "The hishtory profile to use (e.g. `work` or `personal`), each profile has its own secret key, history DB, and config")
 }
@@ -3,13 +3,16 @@ package cmd
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
 	"os/user"
-	"reflect"
+	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"syscall"
@@ -41,6 +44,7 @@ var saveHistoryEntryCmd = &cobra.Command{
 	DisableFlagParsing: true,
 	Run: func(cmd *cobra.Command, args []string) {
 		ctx := hctx.MakeContext()
+		lib.CheckFatalError(maybeResumeInitialSync(ctx))
 		lib.CheckFatalError(maybeUploadSkippedHistoryEntries(ctx))
 		lib.CheckFatalError(maybeSubmitPendingDeletionRequests(ctx))
 		saveHistoryEntry(ctx)
@@ -58,6 +62,22 @@ var presaveHistoryEntryCmd = &cobra.Command{
 	},
 }
 
+// maybeResumeInitialSync resumes an initial device sync that got interrupted partway through
+// (e.g. because the device went offline mid-install), picking up from the persisted cursor. A
+// no-op in the common case where the initial sync completed during install.
+func maybeResumeInitialSync(ctx context.Context) error {
+	config := hctx.GetConf(ctx)
+	if !config.InitialSyncInProgress || config.IsOffline {
+		return nil
+	}
+	err := bootstrapDevicePaginated(ctx, config, hctx.GetDb(ctx), config.UserSecret, false)
+	if lib.IsOfflineError(ctx, err) {
+		// We're still offline, so try again later
+		return nil
+	}
+	return err
+}
+
 func maybeSubmitPendingDeletionRequests(ctx context.Context) error {
 	config := hctx.GetConf(ctx)
 	if config.IsOffline {
@@ -84,12 +104,111 @@ func maybeSubmitPendingDeletionRequests(ctx context.Context) error {
 	return hctx.SetConfig(config)
 }
 
+// The number of entries uploaded per request when draining the upload journal, to bound the
+// memory usage and request size when a device comes back online after a long offline stretch
+const uploadJournalChunkSize = 1000
+
+// syncIsDue returns whether the next push to the backend is due, per the configured
+// sync-interval. With the default "on-command" setting every save syncs immediately; with a
+// duration setting, saves in between just get journaled locally and pushed in a batch once the
+// interval has elapsed.
+func syncIsDue(config *hctx.ClientConfig) bool {
+	if config.SyncInterval == "" || config.SyncInterval == "on-command" {
+		return true
+	}
+	interval, err := parseDigestDuration(config.SyncInterval)
+	if err != nil {
+		// An invalid sync-interval shouldn't silently stop syncing
+		hctx.GetLogger().Warnf("failed to parse sync-interval %#v, syncing immediately: %v", config.SyncInterval, err)
+		return true
+	}
+	return time.Since(time.Unix(config.LastSyncTimestamp, 0)) >= interval
+}
+
+// markSyncCompleted records when a batched push happened, so that syncIsDue knows when the next
+// one is due. A no-op with the default on-command setting, to avoid unnecessary config writes.
+func markSyncCompleted(config *hctx.ClientConfig) error {
+	if config.SyncInterval == "" || config.SyncInterval == "on-command" {
+		return nil
+	}
+	config.LastSyncTimestamp = time.Now().Unix()
+	return hctx.SetConfig(config)
+}
+
 func maybeUploadSkippedHistoryEntries(ctx context.Context) error {
 	config := hctx.GetConf(ctx)
-	if !config.HaveMissedUploads {
+	if config.IsOffline {
 		return nil
 	}
-	if config.IsOffline {
+	if !syncIsDue(config) {
+		// The batching window from the configured sync-interval is still open, so leave the
+		// journaled entries for a later batched push
+		return nil
+	}
+	db := hctx.GetDb(ctx)
+
+	// Retrieve the journal of entries that the backend hasn't acked yet
+	journalEntries, err := lib.RetryingDbFunctionWithResult(func() ([]*data.UploadJournalEntry, error) {
+		var journalEntries []*data.UploadJournalEntry
+		if res := db.Find(&journalEntries); res.Error != nil {
+			return nil, fmt.Errorf("failed to read the upload journal: %w", res.Error)
+		}
+		return journalEntries, nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(journalEntries) == 0 {
+		// Also check the legacy timestamp-based flag, which may have been set by an older version
+		// of hishtory before this device upgraded
+		return maybeUploadSkippedHistoryEntriesLegacy(ctx)
+	}
+
+	// Upload exactly the journaled entries, in chunks. Journal rows whose entry has since been
+	// deleted locally (e.g. a pre-saved entry that was replaced by the finished command, or a
+	// redacted entry) have nothing to upload and just get cleared.
+	hctx.GetLogger().Infof("Uploading %d history entries that previously failed to upload\n", len(journalEntries))
+	for _, chunk := range shared.Chunks(journalEntries, uploadJournalChunkSize) {
+		entryIds := make([]string, 0, len(chunk))
+		for _, journalEntry := range chunk {
+			entryIds = append(entryIds, journalEntry.EntryId)
+		}
+		var entries []*data.HistoryEntry
+		if res := db.Where("entry_id IN ?", entryIds).Find(&entries); res.Error != nil {
+			return fmt.Errorf("failed to retrieve history entries that haven't been uploaded yet: %w", res.Error)
+		}
+		if len(entries) > 0 {
+			jsonValue, err := lib.EncryptAndMarshal(config, entries)
+			if err != nil {
+				return err
+			}
+			_, err = lib.ApiPost(ctx, "/api/v1/submit?source_device_id="+config.DeviceId, "application/json", jsonValue)
+			if err != nil {
+				// Failed to upload the history entries, so we must still be offline. Leave the
+				// journal as-is and we'll try again later.
+				return nil
+			}
+		}
+		// The backend acked this chunk, so clear it from the journal
+		err = lib.RetryingDbFunction(func() error {
+			if res := db.Where("entry_id IN ?", entryIds).Delete(&data.UploadJournalEntry{}); res.Error != nil {
+				return fmt.Errorf("failed to clear acked entries from the upload journal: %w", res.Error)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The pre-journal retry flow: upload everything after the recorded timestamp. Only still used for
+// the one-time drain of a MissedUploadTimestamp that was written by an older version of hishtory
+// before this device upgraded to the journal-based flow.
+func maybeUploadSkippedHistoryEntriesLegacy(ctx context.Context) error {
+	config := hctx.GetConf(ctx)
+	if !config.HaveMissedUploads {
 		return nil
 	}
 
@@ -121,17 +240,57 @@ func maybeUploadSkippedHistoryEntries(ctx context.Context) error {
 	return nil
 }
 
-func handlePotentialUploadFailure(ctx context.Context, err error, config *hctx.ClientConfig, entryTimestamp time.Time) {
+// Record the given entries in the upload journal, so that exactly these entries get uploaded by a
+// later push — either once the backend is reachable again, or once the configured sync-interval's
+// batching window elapses
+func journalPendingUploads(ctx context.Context, entries []*data.HistoryEntry) error {
+	db := hctx.GetDb(ctx)
+	for _, entry := range entries {
+		journalEntry := data.UploadJournalEntry{EntryId: entry.EntryId, Date: time.Now()}
+		err := lib.RetryingDbFunction(func() error {
+			var count int64
+			if res := db.Model(&data.UploadJournalEntry{}).Where("entry_id = ?", journalEntry.EntryId).Count(&count); res.Error != nil {
+				return fmt.Errorf("failed to check the upload journal: %w", res.Error)
+			}
+			if count > 0 {
+				// Already journaled, e.g. because a pre-save and the final save both failed
+				return nil
+			}
+			if res := db.Create(&journalEntry); res.Error != nil {
+				return fmt.Errorf("failed to journal an unuploaded history entry: %w", res.Error)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clearJournaledUploads removes the given entries from the upload journal, marking them as synced
+// now that the backend has acknowledged them
+func clearJournaledUploads(ctx context.Context, entries []*data.HistoryEntry) error {
+	db := hctx.GetDb(ctx)
+	entryIds := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		entryIds = append(entryIds, entry.EntryId)
+	}
+	return lib.RetryingDbFunction(func() error {
+		if res := db.Where("entry_id IN ?", entryIds).Delete(&data.UploadJournalEntry{}); res.Error != nil {
+			return fmt.Errorf("failed to clear acked entries from the upload journal: %w", res.Error)
+		}
+		return nil
+	})
+}
+
+// handlePotentialUploadFailure inspects the error from an upload attempt. Note that the entries
+// were journaled before the attempt (and only get cleared from the journal once the backend acks
+// them), so an offline failure needs no extra bookkeeping here and just gets retried later.
+func handlePotentialUploadFailure(ctx context.Context, err error) {
 	if err != nil {
 		if lib.IsOfflineError(ctx, err) {
 			hctx.GetLogger().Warnf("Failed to remotely persist hishtory entry because we failed to connect to the remote server! This is likely because the device is offline, but also could be because the remote server is having reliability issues. Original error: %v", err)
-			if !config.HaveMissedUploads {
-				config.HaveMissedUploads = true
-				// Set MissedUploadTimestamp to `entry timestamp - 1` so that the current entry will get
-				// uploaded once network access is regained.
-				config.MissedUploadTimestamp = entryTimestamp.UTC().Unix() - 1
-				lib.CheckFatalError(hctx.SetConfig(config))
-			}
 		} else {
 			lib.CheckFatalError(err)
 		}
@@ -146,6 +305,10 @@ func presaveHistoryEntry(ctx context.Context) {
 	if !config.EnablePresaving {
 		return
 	}
+	if len(os.Args) > 2 && (slices.Contains(config.PresavingDisabledShells, os.Args[2]) || slices.Contains(config.RecordingDisabledShells, os.Args[2])) {
+		// Presaving (or recording entirely) is disabled for the shell that invoked us
+		return
+	}
 
 	// Build the basic entry with metadata retrieved from runtime
 	entry, err := buildPreArgsHistoryEntry(ctx)
@@ -158,13 +321,26 @@ func presaveHistoryEntry(ctx context.Context) {
 	shellName := os.Args[2]
 	cmd, err := extractCommandFromArg(ctx, shellName, os.Args[3] /* isPresave = */, true)
 	lib.CheckFatalError(err)
-	entry.Command = cmd
+	entry.Command = lib.MaybeTruncateCommand(ctx, cmd)
 	if strings.HasPrefix(entry.Command, " ") || strings.TrimSpace(entry.Command) == "" {
 		// Don't save commands that start with a space
 		return
 	}
+	if lib.IsNonPrintableHeavy(entry.Command) {
+		switch hctx.GetConf(ctx).NonPrintableCommandPolicy {
+		case "keep":
+		case "skip":
+			return
+		default:
+			entry.Command = lib.SanitizeNonPrintableCommand(entry.Command)
+		}
+	}
+	if lib.ApplySecretScan(config.SecretScanMode, entry) {
+		return
+	}
 	entry.StartTime = parseCrossPlatformTime(os.Args[4])
 	entry.EndTime = time.Unix(0, 0).UTC()
+	entry.EntryId = presaveEntryId(entry.DeviceId, os.Args[4], entry.Command)
 
 	// And persist it locally.
 	db := hctx.GetDb(ctx)
@@ -172,12 +348,23 @@ func presaveHistoryEntry(ctx context.Context) {
 	lib.CheckFatalError(err)
 	db.Commit()
 
-	// And persist it remotely
-	if !config.IsOffline {
+	// And persist it remotely, unless the secret scanner flagged it as local-only
+	if !config.IsOffline && !entry.LocalOnly {
+		// Journal the entry first, so that it's guaranteed to get retried if the upload fails or
+		// gets interrupted. It's only cleared from the journal once the backend acks it.
+		lib.CheckFatalError(journalPendingUploads(ctx, []*data.HistoryEntry{entry}))
+		if !syncIsDue(config) {
+			// The sync-interval batching window is still open, so leave the entry journaled for
+			// the next batched push
+			return
+		}
 		jsonValue, err := lib.EncryptAndMarshal(config, []*data.HistoryEntry{entry})
 		lib.CheckFatalError(err)
 		_, err = lib.ApiPost(ctx, "/api/v1/submit?source_device_id="+config.DeviceId, "application/json", jsonValue)
-		handlePotentialUploadFailure(ctx, err, config, entry.StartTime)
+		handlePotentialUploadFailure(ctx, err)
+		if err == nil {
+			lib.CheckFatalError(clearJournaledUploads(ctx, []*data.HistoryEntry{entry}))
+		}
 	}
 }
 
@@ -187,6 +374,10 @@ func saveHistoryEntry(ctx context.Context) {
 		hctx.GetLogger().Infof("Skipping saving a history entry because hishtory is disabled\n")
 		return
 	}
+	if len(os.Args) > 2 && slices.Contains(config.RecordingDisabledShells, os.Args[2]) {
+		hctx.GetLogger().Infof("Skipping saving a history entry because recording is disabled for shell=%#v\n", os.Args[2])
+		return
+	}
 	entry, err := buildHistoryEntry(ctx, os.Args)
 	lib.CheckFatalError(err)
 	if entry == nil {
@@ -197,27 +388,36 @@ func saveHistoryEntry(ctx context.Context) {
 
 	// Drop any entries from pre-saving since they're no longer needed
 	if config.EnablePresaving {
-		lib.CheckFatalError(deletePresavedEntries(ctx, entry, false))
+		lib.CheckFatalError(deletePresavedEntries(ctx, entry, os.Args[5], false))
 	}
 
 	// Persist it locally
 	err = lib.ReliableDbCreate(db, *entry)
 	lib.CheckFatalError(err)
 
-	// Persist it remotely
-	if !config.IsOffline {
-		jsonValue, err := lib.EncryptAndMarshal(config, []*data.HistoryEntry{entry})
-		lib.CheckFatalError(err)
-		w, err := lib.ApiPost(ctx, "/api/v1/submit?source_device_id="+config.DeviceId, "application/json", jsonValue)
-		handlePotentialUploadFailure(ctx, err, config, entry.StartTime)
-		if err == nil {
-			submitResponse := shared.SubmitResponse{}
-			err := json.Unmarshal(w, &submitResponse)
-			if err != nil {
-				lib.CheckFatalError(fmt.Errorf("failed to deserialize response from /api/v1/submit: %w", err))
+	// Persist it remotely, unless the secret scanner flagged it as local-only
+	if !config.IsOffline && !entry.LocalOnly {
+		// Journal the entry first, so that it's guaranteed to get retried if the upload fails or
+		// gets interrupted. It's only cleared from the journal once the backend acks it.
+		lib.CheckFatalError(journalPendingUploads(ctx, []*data.HistoryEntry{entry}))
+		// If the sync-interval batching window is still open, leave the entry journaled for the
+		// next batched push; otherwise sync it now
+		if syncIsDue(config) {
+			jsonValue, err := lib.EncryptAndMarshal(config, []*data.HistoryEntry{entry})
+			lib.CheckFatalError(err)
+			w, err := lib.ApiPost(ctx, "/api/v1/submit?source_device_id="+config.DeviceId, "application/json", jsonValue)
+			handlePotentialUploadFailure(ctx, err)
+			if err == nil {
+				lib.CheckFatalError(clearJournaledUploads(ctx, []*data.HistoryEntry{entry}))
+				lib.CheckFatalError(markSyncCompleted(config))
+				submitResponse := shared.SubmitResponse{}
+				err := json.Unmarshal(w, &submitResponse)
+				if err != nil {
+					lib.CheckFatalError(fmt.Errorf("failed to deserialize response from /api/v1/submit: %w", err))
+				}
+				lib.CheckFatalError(lib.HandleDeletionRequests(ctx, submitResponse.DeletionRequests))
+				lib.CheckFatalError(handleDumpRequests(ctx, submitResponse.DumpRequests))
 			}
-			lib.CheckFatalError(lib.HandleDeletionRequests(ctx, submitResponse.DeletionRequests))
-			lib.CheckFatalError(handleDumpRequests(ctx, submitResponse.DumpRequests))
 		}
 	}
 
@@ -226,33 +426,43 @@ func saveHistoryEntry(ctx context.Context) {
 	}
 }
 
-func deletePresavedEntries(ctx context.Context, entry *data.HistoryEntry, isRetry bool) error {
+// presaveEntryId returns the deterministic entry ID used for pre-saved entries. The shell hooks
+// pass the same raw start time string to both presaveHistoryEntry and saveHistoryEntry, so deriving
+// the ID from it lets the finalized save look the pre-saved entry up by ID rather than by matching
+// timestamps, which can be skewed between the two invocations by DST shifts or NTP corrections.
+func presaveEntryId(deviceId, unparsedStartTime, command string) string {
+	hash := sha256.Sum256([]byte(fmt.Sprintf("presave|%s|%s|%s", deviceId, unparsedStartTime, command)))
+	return hex.EncodeToString(hash[:])
+}
+
+func deletePresavedEntries(ctx context.Context, entry *data.HistoryEntry, unparsedStartTime string, isRetry bool) error {
 	db := hctx.GetDb(ctx)
 
-	// Create the query to find the presaved entries
-	query := "cwd:" + entry.CurrentWorkingDirectory
-	query += " start_time:" + strconv.FormatInt(entry.StartTime.Unix(), 10)
-	query += " end_time:1970/01/01_00:00:00_+00:00"
-	matchingEntryQuery, err := lib.MakeWhereQueryFromSearch(ctx, db, query)
-	if err != nil {
-		return fmt.Errorf("failed to query for pre-saved history entry: %w", err)
-	}
-	matchingEntryQuery = matchingEntryQuery.Where("command = ?", entry.Command).Where("device_id = ?", entry.DeviceId).Session(&gorm.Session{})
+	// Create the query to find the presaved entries. The primary match is on the deterministic
+	// pre-save entry ID. We also match any orphaned pre-saved entries for the same command in the
+	// same directory that started within a day of this entry, to clean up entries left behind by
+	// older versions (which matched on timestamps and could be orphaned by clock corrections).
+	entryId := presaveEntryId(entry.DeviceId, unparsedStartTime, entry.Command)
+	matchingEntryQuery := db.Model(&data.HistoryEntry{}).
+		Where("device_id = ? AND command = ? AND end_time = ?", entry.DeviceId, entry.Command, time.Unix(0, 0).UTC()).
+		Where("entry_id = ? OR (current_working_directory = ? AND start_time BETWEEN ? AND ?)",
+			entryId, entry.CurrentWorkingDirectory, entry.StartTime.Add(-24*time.Hour), entry.StartTime.Add(24*time.Hour)).
+		Session(&gorm.Session{})
 
-	// Get the presaved entry since we need it for doing remote deletes
-	presavedEntry, err := lib.RetryingDbFunctionWithResult(func() (data.HistoryEntry, error) {
-		var presavedEntry data.HistoryEntry
-		res := matchingEntryQuery.Find(&presavedEntry)
+	// Get the presaved entries since we need them for doing remote deletes
+	presavedEntries, err := lib.RetryingDbFunctionWithResult(func() ([]*data.HistoryEntry, error) {
+		var presavedEntries []*data.HistoryEntry
+		res := matchingEntryQuery.Find(&presavedEntries)
 		if res.Error != nil {
-			return presavedEntry, fmt.Errorf("failed to search for presaved entry for cmd=%#v: %w", entry.Command, res.Error)
+			return nil, fmt.Errorf("failed to search for presaved entry for cmd=%#v: %w", entry.Command, res.Error)
 		}
-		return presavedEntry, nil
+		return presavedEntries, nil
 	})
 	if err != nil {
 		return err
 	}
-	if reflect.ValueOf(presavedEntry).IsZero() {
-		// Presaved entry is zero, aka there is no presaved entry. This can happen either due to:
+	if len(presavedEntries) == 0 {
+		// There is no presaved entry. This can happen either due to:
 		//
 		// 1. A failure in presaving, or this feature was just enabled (in which case there is nothing to do here)
 		// 2. A race condition where presaving hasn't finished, but we're looking for the entry here
@@ -265,7 +475,7 @@ func deletePresavedEntries(ctx context.Context, entry *data.HistoryEntry, isRetr
 			return nil
 		} else {
 			time.Sleep(500 * time.Millisecond)
-			return deletePresavedEntries(ctx, entry, true)
+			return deletePresavedEntries(ctx, entry, unparsedStartTime, true)
 		}
 	}
 
@@ -282,16 +492,18 @@ func deletePresavedEntries(ctx context.Context, entry *data.HistoryEntry, isRetr
 		return err
 	}
 
-	// And delete it remotely
+	// And delete them remotely
 	config := hctx.GetConf(ctx)
 	if !config.IsOffline {
 		var deletionRequest shared.DeletionRequest
 		deletionRequest.SendTime = time.Now()
 		deletionRequest.UserId = data.UserId(config.UserSecret)
-		deletionRequest.Messages.Ids = append(deletionRequest.Messages.Ids,
-			// Note that we aren't specifying an EndTime here since pre-saved entries don't have an EndTime
-			shared.MessageIdentifier{DeviceId: presavedEntry.DeviceId, EntryId: presavedEntry.EntryId},
-		)
+		for _, presavedEntry := range presavedEntries {
+			deletionRequest.Messages.Ids = append(deletionRequest.Messages.Ids,
+				// Note that we aren't specifying an EndTime here since pre-saved entries don't have an EndTime
+				shared.MessageIdentifier{DeviceId: presavedEntry.DeviceId, EntryId: presavedEntry.EntryId},
+			)
+		}
 		err = lib.SendDeletionRequest(ctx, deletionRequest)
 		if lib.IsOfflineError(ctx, err) {
 			// Cache the deletion request to send once the client comes back online
@@ -310,6 +522,8 @@ func handleDumpRequests(ctx context.Context, dumpRequests []*shared.DumpRequest)
 		lib.CheckFatalError(lib.RetrieveAdditionalEntriesFromRemote(ctx, "newclient"))
 		entries, err := lib.Search(ctx, db, "", 0)
 		lib.CheckFatalError(err)
+		// Never upload entries that the secret scanner flagged as local-only
+		entries = slices.DeleteFunc(entries, func(entry *data.HistoryEntry) bool { return entry.LocalOnly })
 		var encEntries []*shared.EncHistoryEntry
 		for _, entry := range entries {
 			enc, err := data.EncryptHistoryEntry(config.UserSecret, *entry)
@@ -332,6 +546,14 @@ func handleDumpRequests(ctx context.Context, dumpRequests []*shared.DumpRequest)
 func buildPreArgsHistoryEntry(ctx context.Context) (*data.HistoryEntry, error) {
 	var entry data.HistoryEntry
 
+	// Pause recording entirely while any of the configured env vars is set (to any value,
+	// including an empty string), e.g. for direnv-managed sensitive contexts
+	for _, envVar := range hctx.GetConf(ctx).PauseWhenEnvVars {
+		if _, isSet := os.LookupEnv(envVar); isSet {
+			return nil, nil
+		}
+	}
+
 	// user
 	user, err := user.Current()
 	if err != nil {
@@ -339,6 +561,13 @@ func buildPreArgsHistoryEntry(ctx context.Context) (*data.HistoryEntry, error) {
 	}
 	entry.LocalUsername = user.Username
 
+	// original user, if this shell is running under sudo/su. Note that sudo (and su on distros
+	// where it is a wrapper around sudo) sets SUDO_USER, but a bare `su -` does not, so this is
+	// best-effort detection.
+	if sudoUser := os.Getenv("SUDO_USER"); sudoUser != "" && sudoUser != user.Username {
+		entry.OriginalUsername = sudoUser
+	}
+
 	// cwd and homedir
 	cwd, homedir, err := getCwd(ctx)
 	if err != nil {
@@ -361,6 +590,31 @@ func buildPreArgsHistoryEntry(ctx context.Context) (*data.HistoryEntry, error) {
 	// entry ID
 	entry.EntryId = uuid.Must(uuid.NewRandom()).String()
 
+	// session ID, as exported by the shell hooks
+	entry.SessionId = os.Getenv("HISHTORY_SESSION_ID")
+
+	// shell nesting level and the shell's parent process, which distinguish nested shell
+	// sessions (e.g. scripts spawning bash, nix-shell, poetry shell) from top-level ones
+	if shlvl, err := strconv.Atoi(os.Getenv("SHLVL")); err == nil {
+		entry.Shlvl = &shlvl
+	}
+	entry.ParentProcess = getShellParentProcessName()
+
+	// git repo and branch, plus the per-directory recording opt-out
+	if rawCwd, err := getCwdWithoutSubstitution(); err == nil {
+		if isInIgnoredDirectory(ctx, rawCwd) {
+			// This directory has opted out of recording, so skip building an entry entirely
+			return nil, nil
+		}
+		entry.GitRepo, entry.GitBranch = getGitInfo(rawCwd)
+	}
+
+	// terminal emulator and TTY, if enabled
+	if config.EnableTerminalMetadata {
+		entry.TermProgram = os.Getenv("TERM_PROGRAM")
+		entry.Tty = getTty()
+	}
+
 	// custom columns
 	cc, err := buildCustomColumns(ctx)
 	if err != nil {
@@ -379,7 +633,7 @@ func buildHistoryEntry(ctx context.Context, args []string) (*data.HistoryEntry,
 	shell := args[2]
 
 	entry, err := buildPreArgsHistoryEntry(ctx)
-	if err != nil {
+	if err != nil || entry == nil {
 		return nil, err
 	}
 
@@ -401,12 +655,53 @@ func buildHistoryEntry(ctx context.Context, args []string) (*data.HistoryEntry,
 	if err != nil {
 		return nil, err
 	}
-	entry.Command = cmd
+	entry.Command = lib.MaybeTruncateCommand(ctx, cmd)
 	if strings.TrimSpace(entry.Command) == "" {
 		// Skip recording empty commands where the user just hits enter in their terminal
 		return nil, nil
 	}
 
+	// Detect pasted binary/clipboard garbage and skip or sanitize it per the configured policy
+	if lib.IsNonPrintableHeavy(entry.Command) {
+		switch hctx.GetConf(ctx).NonPrintableCommandPolicy {
+		case "keep":
+			// Record it unchanged
+		case "skip":
+			return nil, nil
+		default:
+			entry.Command = lib.SanitizeNonPrintableCommand(entry.Command)
+		}
+	}
+
+	// Scan for secrets (AWS keys, tokens, passwords passed via CLI flags) and apply the configured
+	// policy, so that credentials pasted into commands never leave this machine
+	if lib.ApplySecretScan(hctx.GetConf(ctx).SecretScanMode, entry) {
+		return nil, nil
+	}
+
+	// Record the target of ssh invocations as a custom column, so that they can be searched via
+	// `remote_host:prod-host` and displayed by adding a remote_host column
+	if remoteHost := lib.ParseSshRemoteHost(entry.Command); remoteHost != "" {
+		entry.CustomColumns = append(entry.CustomColumns, data.CustomColumn{Name: "remote_host", Val: remoteHost})
+	}
+
+	// Optionally derive the entry ID from a hash of the entry's contents, so that re-recording
+	// or re-importing the same command doesn't create a near-duplicate entry
+	if hctx.GetConf(ctx).ContentAddressedEntryIds {
+		entry.EntryId = data.ContentAddressedEntryId(entry)
+	}
+
+	// had_stderr and output size, which the shell hooks only pass when output capture is enabled
+	if len(args) >= 8 {
+		hadStderr := args[6] == "1"
+		entry.HadStderr = &hadStderr
+		outputSize, err := strconv.ParseInt(args[7], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse output size %#v: %w", args[7], err)
+		}
+		entry.OutputSize = &outputSize
+	}
+
 	return entry, nil
 }
 
@@ -654,6 +949,123 @@ func getCwdWithoutSubstitution() (string, error) {
 	return "", err
 }
 
+// getTty returns the TTY that this process is attached to, or an empty string if it can't be
+// determined. Note that zsh exports $TTY, and on Linux we can fall back to resolving stdin via
+// /proc, but on other platforms with other shells this may return an empty string.
+// The name of the marker file that opts a directory (and everything under it) out of hishtory
+// recording, for e.g. client-confidential repos where no command metadata may leave the directory
+const hishtoryIgnoreMarker = ".hishtory-ignore"
+
+// isInIgnoredDirectory returns whether the given directory has opted out of hishtory recording,
+// either via a .hishtory-ignore marker file in it (or in a parent directory), or by matching one
+// of the ignored-directories globs from the config
+func isInIgnoredDirectory(ctx context.Context, rawCwd string) bool {
+	config := hctx.GetConf(ctx)
+	homedir := hctx.GetHome(ctx)
+	for dir := filepath.Clean(rawCwd); ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, hishtoryIgnoreMarker)); err == nil {
+			return true
+		}
+		for _, glob := range config.IgnoredDirectories {
+			if strings.HasPrefix(glob, "~/") {
+				glob = filepath.Join(homedir, glob[2:])
+			}
+			if matched, err := filepath.Match(glob, dir); err == nil && matched {
+				return true
+			}
+		}
+		if dir == filepath.Dir(dir) {
+			// We've reached the root directory
+			return false
+		}
+	}
+}
+
+// getShellParentProcessName returns the name of the process that spawned the shell that ran this
+// command (e.g. a terminal emulator, tmux, sshd, or a script interpreter), or an empty string if
+// it couldn't be determined. This hishtory process's parent is the shell itself, so this looks up
+// the shell's parent. It reads /proc where available and falls back to `ps` elsewhere (e.g. macOS).
+func getShellParentProcessName() string {
+	shellPid := os.Getppid()
+	if statBytes, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", shellPid)); err == nil {
+		// The stat format is "pid (comm) state ppid ...", and comm can itself contain spaces and
+		// parens, so parse from after the last closing paren
+		stat := string(statBytes)
+		if idx := strings.LastIndex(stat, ") "); idx != -1 {
+			fields := strings.Fields(stat[idx+2:])
+			if len(fields) >= 2 {
+				if comm, err := os.ReadFile(fmt.Sprintf("/proc/%s/comm", fields[1])); err == nil {
+					return strings.TrimSpace(string(comm))
+				}
+			}
+		}
+	}
+	if out, err := exec.Command("ps", "-o", "ppid=", "-p", strconv.Itoa(shellPid)).Output(); err == nil {
+		parentPid := strings.TrimSpace(string(out))
+		if parentPid != "" {
+			if out, err := exec.Command("ps", "-o", "comm=", "-p", parentPid).Output(); err == nil {
+				return filepath.Base(strings.TrimSpace(string(out)))
+			}
+		}
+	}
+	return ""
+}
+
+func getTty() string {
+	if tty := os.Getenv("TTY"); tty != "" {
+		return tty
+	}
+	if tty, err := os.Readlink("/proc/self/fd/0"); err == nil && strings.HasPrefix(tty, "/dev/") {
+		return tty
+	}
+	return ""
+}
+
+// getGitInfo returns the git repository (the name of the repo's root directory) and the currently
+// checked out branch for the given directory, or empty strings if the directory isn't inside a git
+// repo. This reads `.git/HEAD` directly rather than shelling out to `git`, so that it stays fast
+// (a handful of stat calls plus one small file read) and works on machines without git installed.
+func getGitInfo(cwd string) (string, string) {
+	dir := cwd
+	for {
+		gitPath := filepath.Join(dir, ".git")
+		if fi, err := os.Stat(gitPath); err == nil {
+			gitDir := gitPath
+			if !fi.IsDir() {
+				// For worktrees and submodules, `.git` is a file containing a pointer to the actual git dir
+				contents, err := os.ReadFile(gitPath)
+				if err != nil {
+					return "", ""
+				}
+				gitDir = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(string(contents)), "gitdir:"))
+				if !filepath.IsAbs(gitDir) {
+					gitDir = filepath.Join(dir, gitDir)
+				}
+			}
+			repo := filepath.Base(dir)
+			headContents, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+			if err != nil {
+				return repo, ""
+			}
+			head := strings.TrimSpace(string(headContents))
+			if strings.HasPrefix(head, "ref: refs/heads/") {
+				return repo, strings.TrimPrefix(head, "ref: refs/heads/")
+			}
+			if len(head) >= 8 {
+				// A detached HEAD, so record a prefix of the commit hash rather than a branch name
+				return repo, head[:8]
+			}
+			return repo, ""
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			// We hit the filesystem root without finding a .git, so this isn't a git repo
+			return "", ""
+		}
+		dir = parent
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(saveHistoryEntryCmd)
 	rootCmd.AddCommand(presaveHistoryEntryCmd)
@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ddworken/hishtory/client/data"
+	"github.com/ddworken/hishtory/client/hctx"
+	"github.com/ddworken/hishtory/client/lib"
+	"github.com/ddworken/hishtory/shared"
+
+	"github.com/spf13/cobra"
+)
+
+var shareCmd = &cobra.Command{
+	Use:                "share",
+	Short:              "Query for matching commands and share them with another hishtory user",
+	Long:               "Re-encrypts the matching history entries for the recipient's sharing public key and delivers them through the backend, so only the recipient can read them. Supports the same query format as 'hishtory query'. The recipient is identified by their user ID (shown in 'hishtory status -v') and must have run 'hishtory share-receive' at least once to publish their public key.",
+	GroupID:            GROUP_ID_MANAGEMENT,
+	DisableFlagParsing: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		// Since this command has DisableFlagParsing=true (so that flag-like tokens can be part of
+		// search queries), we have to manually extract the --with flag from the args
+		recipientUserId := ""
+		filteredArgs := make([]string, 0)
+		for i := 0; i < len(args); i++ {
+			if args[i] == "--with" && i+1 < len(args) {
+				recipientUserId = args[i+1]
+				i++
+				continue
+			}
+			if strings.HasPrefix(args[i], "--with=") {
+				recipientUserId = strings.TrimPrefix(args[i], "--with=")
+				continue
+			}
+			filteredArgs = append(filteredArgs, args[i])
+		}
+		if recipientUserId == "" {
+			lib.CheckFatalError(fmt.Errorf("hishtory share requires --with <their-user-id> to specify who to share with"))
+		}
+		query := strings.Join(filteredArgs, " ")
+		lib.CheckFatalError(share(ctx, query, recipientUserId))
+	},
+}
+
+var shareReceiveCmd = &cobra.Command{
+	Use:     "share-receive",
+	Short:   "Retrieve history entries that other hishtory users have shared with you",
+	Long:    "Publishes your sharing public key (which opts you in to receiving shared entries) and then downloads any entries that other users have shared with you via 'hishtory share'. Received entries are tagged with a 'shared-from' custom column identifying the sender's user ID.",
+	GroupID: GROUP_ID_MANAGEMENT,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		lib.CheckFatalError(shareReceive(ctx))
+	},
+}
+
+func share(ctx context.Context, query, recipientUserId string) error {
+	config := hctx.GetConf(ctx)
+	if config.IsOffline {
+		return fmt.Errorf("cannot share history entries from an offline installation of hishtory")
+	}
+	if recipientUserId == data.UserId(config.UserSecret) {
+		return fmt.Errorf("cannot share history entries with yourself, since all of your devices already sync them")
+	}
+	entries, err := lib.Search(ctx, hctx.GetDb(ctx), query, 0)
+	if err != nil {
+		return fmt.Errorf("failed to search for entries to share: %w", err)
+	}
+	if len(entries) == 0 {
+		fmt.Println("No history entries matched the given query, so nothing was shared")
+		return nil
+	}
+	fmt.Printf("This will share %d entries with %s, are you sure? [y/N] ", len(entries), recipientUserId)
+	reader := bufio.NewReader(os.Stdin)
+	resp, err := reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if strings.TrimSpace(resp) != "y" {
+		fmt.Printf("Aborting share per user response of %#v\n", strings.TrimSpace(resp))
+		return nil
+	}
+	recipientPublicKey, err := getSharingPublicKey(ctx, recipientUserId)
+	if err != nil {
+		return err
+	}
+	sharedEntries := make([]*shared.SharedHistoryEntry, 0, len(entries))
+	for _, entry := range entries {
+		sealed, err := data.SealEntryForSharing(recipientPublicKey, *entry)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt entry for sharing: %w", err)
+		}
+		sharedEntries = append(sharedEntries, &shared.SharedHistoryEntry{
+			RecipientUserId: recipientUserId,
+			SenderUserId:    data.UserId(config.UserSecret),
+			EncryptedData:   sealed,
+			Date:            time.Now(),
+		})
+	}
+	reqBody, err := json.Marshal(sharedEntries)
+	if err != nil {
+		return fmt.Errorf("failed to marshal shared entries: %w", err)
+	}
+	_, err = lib.ApiPost(ctx, "/api/v1/share/submit", "application/json", reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to send shared entries to the backend: %w", err)
+	}
+	fmt.Printf("Shared %d entries with %s. They'll receive them the next time they run `hishtory share-receive`.\n", len(sharedEntries), recipientUserId)
+	return nil
+}
+
+func getSharingPublicKey(ctx context.Context, userId string) ([]byte, error) {
+	respBody, err := lib.ApiGet(ctx, "/api/v1/share/get-public-key?user_id="+userId)
+	if err != nil {
+		if strings.Contains(err.Error(), "status_code=404") {
+			return nil, fmt.Errorf("%s hasn't published a sharing public key, so entries can't be shared with them. Ask them to run `hishtory share-receive` once to opt in to receiving shared entries", userId)
+		}
+		return nil, fmt.Errorf("failed to retrieve the recipient's sharing public key: %w", err)
+	}
+	var publicKey shared.SharingPublicKey
+	if err := lib.UnmarshalServerResponse(respBody, &publicKey); err != nil {
+		return nil, fmt.Errorf("failed to parse the recipient's sharing public key: %w", err)
+	}
+	return publicKey.PublicKey, nil
+}
+
+func shareReceive(ctx context.Context) error {
+	config := hctx.GetConf(ctx)
+	if config.IsOffline {
+		return fmt.Errorf("cannot receive shared history entries on an offline installation of hishtory")
+	}
+	userId := data.UserId(config.UserSecret)
+	publicKey, _, err := data.SharingKeyPair(config.UserSecret)
+	if err != nil {
+		return err
+	}
+	// Publishing the public key is what opts this user in to receiving shared entries, so do it
+	// on every invocation to make sure it stays published
+	_, err = lib.ApiPost(ctx, "/api/v1/share/put-public-key?user_id="+userId+"&public_key="+base64.URLEncoding.EncodeToString(publicKey[:]), "application/json", []byte{})
+	if err != nil {
+		return fmt.Errorf("failed to publish the sharing public key: %w", err)
+	}
+	respBody, err := lib.ApiGet(ctx, "/api/v1/share/receive?user_id="+userId)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve shared entries from the backend: %w", err)
+	}
+	var sharedEntries []*shared.SharedHistoryEntry
+	if err := lib.UnmarshalServerResponse(respBody, &sharedEntries); err != nil {
+		return fmt.Errorf("failed to parse shared entries: %w", err)
+	}
+	if len(sharedEntries) == 0 {
+		fmt.Println("No new shared history entries")
+		return nil
+	}
+	db := hctx.GetDb(ctx)
+	receivedEntries := make([]*data.HistoryEntry, 0, len(sharedEntries))
+	for _, sharedEntry := range sharedEntries {
+		entry, err := data.OpenSharedEntry(config.UserSecret, sharedEntry.EncryptedData)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt shared entry: %w", err)
+		}
+		// Tag the entry with who shared it, so it can be found via `hishtory query shared-from:...`
+		entry.CustomColumns = append(entry.CustomColumns, data.CustomColumn{Name: "shared-from", Val: sharedEntry.SenderUserId})
+		if lib.AddToDbIfNew(db, entry) {
+			receivedEntries = append(receivedEntries, &entry)
+		}
+	}
+	// Re-upload the received entries to this user's own keyspace so that their other devices
+	// pick them up via the normal syncing flow
+	if len(receivedEntries) > 0 {
+		jsonValue, err := lib.EncryptAndMarshal(config, receivedEntries)
+		if err != nil {
+			return err
+		}
+		_, err = lib.ApiPost(ctx, "/api/v1/submit?source_device_id="+config.DeviceId, "application/json", jsonValue)
+		if err != nil {
+			return fmt.Errorf("failed to sync received entries to the backend: %w", err)
+		}
+	}
+	fmt.Printf("Received %d shared history entries\n", len(receivedEntries))
+	return nil
+}
+
+var shareWebhookCmd = &cobra.Command{
+	Use:                "share-webhook",
+	Short:              "Post the most recent history entry matching the given query to the configured webhook",
+	Long:               "Posts a formatted snippet of the most recent history entry matching the given query (command, host, time, and exit code) to the webhook URL configured via `hishtory config-set webhook-url`, e.g. a Slack incoming webhook, for quickly telling a teammate exactly what was run. Supports the same query format as 'hishtory query'. In the TUI, the highlighted entry can be shared the same way via the share keybinding (ctrl+u by default).",
+	GroupID:            GROUP_ID_MANAGEMENT,
+	DisableFlagParsing: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		lib.CheckFatalError(shareToWebhook(ctx, strings.Join(args, " ")))
+	},
+}
+
+func shareToWebhook(ctx context.Context, query string) error {
+	entries, err := lib.Search(ctx, hctx.GetDb(ctx), query, 1)
+	if err != nil {
+		return fmt.Errorf("failed to search for the entry to share: %w", err)
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("no history entries matched the given query, so nothing was shared")
+	}
+	if err := lib.ShareEntryToWebhook(ctx, entries[0]); err != nil {
+		return err
+	}
+	fmt.Printf("Shared `%s` to the configured webhook\n", entries[0].Command)
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(shareCmd)
+	rootCmd.AddCommand(shareReceiveCmd)
+	rootCmd.AddCommand(shareWebhookCmd)
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ddworken/hishtory/client/data"
+	"github.com/ddworken/hishtory/client/hctx"
+	"github.com/ddworken/hishtory/client/lib"
+
+	"github.com/spf13/cobra"
+)
+
+// How many entries `hishtory stats` displays per section
+const statsTopEntriesCount = 10
+
+// How many days of history the `hishtory stats` daily activity section covers
+const statsActivityDays = 30
+
+// The width in characters of the longest bar in the daily activity section
+const statsActivityBarWidth = 40
+
+var statsCmd = &cobra.Command{
+	Use:     "stats",
+	Short:   "Show stats about your shell history: top commands, directories, hosts, and daily activity",
+	GroupID: GROUP_ID_QUERYING,
+	Long:    "Show stats about your shell history: the most frequently run commands, the directories and hosts they were run in, and a graph of daily activity. The stats are rendered from a materialized per-day aggregates table that is updated incrementally as entries are recorded, so they display instantly even on DBs with millions of entries. Deleting entries (e.g. via `hishtory redact`) can cause the aggregates to drift; run `hishtory stats rebuild` to correct them.",
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		lib.CheckFatalError(displayStats(ctx))
+	},
+}
+
+var statsRebuildCmd = &cobra.Command{
+	Use:   "rebuild",
+	Short: "Rebuild the materialized stats aggregates from scratch",
+	Long:  "Rebuild the materialized per-day stats aggregates from scratch by scanning the full history DB, for backfilling after upgrading from a hishtory version without aggregates and for correcting drift after entries were deleted.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		lib.CheckFatalError(lib.RebuildDayAggregates(hctx.GetDb(ctx)))
+		fmt.Println("Successfully rebuilt the stats aggregates")
+	},
+}
+
+func displayStats(ctx context.Context) error {
+	db := hctx.GetDb(ctx)
+	// Backfill the aggregates on the first run after upgrading from a hishtory version that
+	// didn't maintain them
+	var numAggregates int64
+	if res := db.Model(&data.DayAggregate{}).Count(&numAggregates); res.Error != nil {
+		return fmt.Errorf("failed to count the stats aggregates: %w", res.Error)
+	}
+	if numAggregates == 0 {
+		if err := lib.RebuildDayAggregates(db); err != nil {
+			return err
+		}
+	}
+	for _, section := range []struct {
+		title     string
+		dimension string
+	}{
+		{"Top Commands", "command"},
+		{"Top Directories", "cwd"},
+		{"Top Hosts", "hostname"},
+	} {
+		var rows []struct {
+			Value string
+			Total int64
+		}
+		res := db.Raw("SELECT value, SUM(count) AS total FROM day_aggregates WHERE dimension = ? GROUP BY value ORDER BY total DESC LIMIT ?",
+			section.dimension, statsTopEntriesCount).Scan(&rows)
+		if res.Error != nil {
+			return fmt.Errorf("failed to query the %s aggregates: %w", section.dimension, res.Error)
+		}
+		fmt.Println(section.title + ":")
+		for _, row := range rows {
+			fmt.Printf("\t%6d  %s\n", row.Total, row.Value)
+		}
+	}
+	var days []struct {
+		Day   string
+		Total int64
+	}
+	res := db.Raw("SELECT day, SUM(count) AS total FROM day_aggregates WHERE dimension = 'command' GROUP BY day ORDER BY day DESC LIMIT ?",
+		statsActivityDays).Scan(&days)
+	if res.Error != nil {
+		return fmt.Errorf("failed to query the daily activity aggregates: %w", res.Error)
+	}
+	var maxTotal int64
+	for _, day := range days {
+		maxTotal = max(maxTotal, day.Total)
+	}
+	fmt.Printf("Daily Activity (last %d days):\n", statsActivityDays)
+	// Displayed oldest-first so that the graph reads left-to-right chronologically
+	for i := len(days) - 1; i >= 0; i-- {
+		barWidth := int(days[i].Total * statsActivityBarWidth / maxTotal)
+		fmt.Printf("\t%s %6d %s\n", days[i].Day, days[i].Total, strings.Repeat("█", barWidth))
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(statsCmd)
+	statsCmd.AddCommand(statsRebuildCmd)
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -28,9 +29,11 @@ var statusCmd = &cobra.Command{
 		if *verbose {
 			fmt.Printf("User ID: %s\n", data.UserId(config.UserSecret))
 			fmt.Printf("Device ID: %s\n", config.DeviceId)
-			printOnlineStatus(config)
+			printOnlineStatus(ctx, config)
+			printDbSize(ctx, config)
 		}
 		fmt.Printf("Commit Hash: %s\n", lib.GitCommit)
+		warnOnMissingShellHooks(ctx)
 		if *configFlag {
 			y, err := yaml.Marshal(config)
 			if err != nil {
@@ -42,7 +45,7 @@ var statusCmd = &cobra.Command{
 	},
 }
 
-func printOnlineStatus(config *hctx.ClientConfig) {
+func printOnlineStatus(ctx context.Context, config *hctx.ClientConfig) {
 	if config.IsOffline {
 		fmt.Println("Sync Mode: Disabled")
 	} else {
@@ -50,15 +53,48 @@ func printOnlineStatus(config *hctx.ClientConfig) {
 		if lib.GetServerHostname() != lib.DefaultServerHostname {
 			fmt.Println("Sync Server: " + lib.GetServerHostname())
 		}
-		if config.HaveMissedUploads || len(config.PendingDeletionRequests) > 0 {
+		var numJournaledUploads int64
+		if err := hctx.GetDb(ctx).Model(&data.UploadJournalEntry{}).Count(&numJournaledUploads).Error; err != nil {
+			hctx.GetLogger().Warnf("failed to count the upload journal: %v", err)
+		}
+		if numJournaledUploads > 0 || config.HaveMissedUploads || len(config.PendingDeletionRequests) > 0 {
 			fmt.Println("Sync Status: Unsynced (device is offline?)")
-			fmt.Printf("  HaveMissedUploads=%v MissedUploadTimestamp=%v len(PendingDeletionRequests)=%v\n", config.HaveMissedUploads, config.MissedUploadTimestamp, len(config.PendingDeletionRequests))
+			fmt.Printf("  len(UploadJournal)=%v HaveMissedUploads=%v MissedUploadTimestamp=%v len(PendingDeletionRequests)=%v\n", numJournaledUploads, config.HaveMissedUploads, config.MissedUploadTimestamp, len(config.PendingDeletionRequests))
 		} else {
 			fmt.Println("Sync Status: Synced")
 		}
 	}
 }
 
+// warnOnMissingShellHooks warns if any installed shell's config file has lost the hishtory shell
+// hooks (e.g. because a dotfile sync overwrote them), since that makes recording silently stop
+func warnOnMissingShellHooks(ctx context.Context) {
+	missingShells, err := getShellsWithMissingHooks(hctx.GetHome(ctx))
+	if err != nil {
+		hctx.GetLogger().Warnf("failed to check for missing shell hooks: %v", err)
+		return
+	}
+	if len(missingShells) > 0 {
+		fmt.Printf("Warning: The shell config files for %s are missing the hishtory shell hooks, so new commands run in them are not being recorded. Run `hishtory repair-install` to fix this.\n", strings.Join(missingShells, ", "))
+	}
+}
+
+func printDbSize(ctx context.Context, config *hctx.ClientConfig) {
+	dbSizeMb, err := lib.GetDbSizeMb(ctx)
+	if err != nil {
+		lib.CheckFatalError(err)
+	}
+	numEntries, err := lib.CountStoredEntries(hctx.GetDb(ctx))
+	if err != nil {
+		lib.CheckFatalError(err)
+	}
+	if config.MaxDbSizeMb > 0 {
+		fmt.Printf("DB Size: %dMB (max: %dMB, %d entries)\n", dbSizeMb, config.MaxDbSizeMb, numEntries)
+	} else {
+		fmt.Printf("DB Size: %dMB (%d entries)\n", dbSizeMb, numEntries)
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(statusCmd)
 	verbose = statusCmd.Flags().BoolP("verbose", "v", false, "Display verbose hiSHtory information")
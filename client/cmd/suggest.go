@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ddworken/hishtory/client/data"
+	"github.com/ddworken/hishtory/client/hctx"
+	"github.com/ddworken/hishtory/client/lib"
+
+	"github.com/spf13/cobra"
+)
+
+var suggestPrefix *string
+
+// How long the suggest cache is served before it gets rebuilt from the DB. Suggestions are purely
+// cosmetic, so serving slightly stale results is fine in exchange for sub-prompt-latency lookups.
+const suggestCacheTtl = 60 * time.Second
+
+// How many of the most recent history entries are scanned when rebuilding the suggest cache
+const suggestCacheSize = 10_000
+
+var suggestCmd = &cobra.Command{
+	Use:    "suggest",
+	Hidden: true,
+	Short:  "[Internal-only] Suggest the most recent command matching the given prefix, used to power zsh-autosuggestions",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		suggestion, err := suggest(ctx, *suggestPrefix)
+		lib.CheckFatalError(err)
+		if suggestion != "" {
+			fmt.Println(suggestion)
+		}
+	},
+}
+
+// suggestCache is a cache of the most recent distinct commands (most recent first), persisted to
+// SUGGEST_CACHE_PATH so that repeated `hishtory suggest` invocations (one per keystroke when used
+// as a zsh-autosuggestions strategy) don't each have to query the full history table
+type suggestCache struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	Commands    []string  `json:"commands"`
+}
+
+// dedupeSuggestCommands dedupes the given commands while preserving the most-recent-first
+// ordering, since for suggestions only the most recent occurrence of each command matters
+func dedupeSuggestCommands(commands []string) []string {
+	seenCommands := make(map[string]bool)
+	dedupedCommands := make([]string, 0, len(commands))
+	for _, command := range commands {
+		if !seenCommands[command] {
+			seenCommands[command] = true
+			dedupedCommands = append(dedupedCommands, command)
+		}
+	}
+	return dedupedCommands
+}
+
+func getSuggestCachePath(ctx context.Context) string {
+	return filepath.Join(hctx.GetHome(ctx), data.GetHishtoryPath(), data.SUGGEST_CACHE_PATH)
+}
+
+// readSuggestCache reads the persisted suggest cache. Returns the zero cache (which is always
+// considered stale and thus triggers a rebuild) if the file doesn't exist or can't be parsed,
+// since the cache is best-effort.
+func readSuggestCache(ctx context.Context) suggestCache {
+	var cache suggestCache
+	contents, err := os.ReadFile(getSuggestCachePath(ctx))
+	if err != nil {
+		return cache
+	}
+	if err := json.Unmarshal(contents, &cache); err != nil {
+		hctx.GetLogger().Warnf("failed to parse the suggest cache file: %v", err)
+	}
+	return cache
+}
+
+// rebuildSuggestCache rebuilds the suggest cache from the most recent history entries and
+// persists it for future invocations
+func rebuildSuggestCache(ctx context.Context) (suggestCache, error) {
+	db := hctx.GetDb(ctx)
+	var commands []string
+	res := db.Model(&data.HistoryEntry{}).Order("start_time DESC").Limit(suggestCacheSize).Pluck("command", &commands)
+	if res.Error != nil {
+		return suggestCache{}, fmt.Errorf("failed to rebuild the suggest cache: %w", res.Error)
+	}
+	cache := suggestCache{GeneratedAt: time.Now(), Commands: dedupeSuggestCommands(commands)}
+	serialized, err := json.Marshal(cache)
+	if err != nil {
+		return suggestCache{}, fmt.Errorf("failed to serialize the suggest cache: %w", err)
+	}
+	if err := os.WriteFile(getSuggestCachePath(ctx), serialized, 0o600); err != nil {
+		return suggestCache{}, fmt.Errorf("failed to write the suggest cache: %w", err)
+	}
+	return cache, nil
+}
+
+// suggest returns the most recently run command that starts with (and is longer than) the given
+// prefix, or the empty string if there is none. It is served from the warm cache of recent
+// commands when possible, and falls back to querying the full history table for prefixes that
+// only match older entries.
+func suggest(ctx context.Context, prefix string) (string, error) {
+	if prefix == "" {
+		return "", nil
+	}
+	// Prefer the suggest daemon (see start-suggest-daemon) when it is running, since it answers
+	// from a hot in-memory index without touching the DB at all
+	if results, err := querySuggestDaemon(ctx, prefix, "prefix"); err == nil {
+		if len(results) > 0 {
+			return results[0], nil
+		}
+	} else {
+		cache := readSuggestCache(ctx)
+		if time.Since(cache.GeneratedAt) > suggestCacheTtl {
+			var err error
+			cache, err = rebuildSuggestCache(ctx)
+			if err != nil {
+				return "", err
+			}
+		}
+		for _, command := range cache.Commands {
+			if strings.HasPrefix(command, prefix) && command != prefix {
+				return command, nil
+			}
+		}
+	}
+	// Escape the LIKE metacharacters in the prefix so that e.g. `grep -r "foo%` matches literally
+	escapedPrefix := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix)
+	var commands []string
+	res := hctx.GetDb(ctx).Model(&data.HistoryEntry{}).Where(`command LIKE ? ESCAPE '\' AND command != ?`, escapedPrefix+"%", prefix).Order("start_time DESC").Limit(1).Pluck("command", &commands)
+	if res.Error != nil {
+		return "", fmt.Errorf("failed to search for a suggestion: %w", res.Error)
+	}
+	if len(commands) == 0 {
+		return "", nil
+	}
+	return commands[0], nil
+}
+
+func init() {
+	rootCmd.AddCommand(suggestCmd)
+	suggestPrefix = suggestCmd.Flags().String("prefix", "", "The already-typed prefix of the command to suggest a completion for")
+}
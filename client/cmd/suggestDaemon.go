@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ddworken/hishtory/client/data"
+	"github.com/ddworken/hishtory/client/hctx"
+	"github.com/ddworken/hishtory/client/lib"
+
+	"github.com/spf13/cobra"
+)
+
+// The maximum number of results returned for a single daemon query
+const suggestDaemonMaxResults = 10
+
+// How often the daemon refreshes its in-memory index from the DB
+const suggestDaemonRefreshInterval = 10 * time.Second
+
+// How long the CLI waits to connect to (and hear back from) the daemon before falling back to
+// querying SQLite directly. Kept short since the daemon answers from memory, so anything slower
+// than this means the daemon isn't healthy.
+const suggestDaemonTimeout = 50 * time.Millisecond
+
+// suggestDaemonRequest is a single newline-delimited JSON request sent to the suggest daemon's
+// unix socket
+type suggestDaemonRequest struct {
+	Query string `json:"query"`
+	// Either "prefix" (commands starting with the query) or "substring" (commands containing it)
+	Mode string `json:"mode"`
+}
+
+// suggestDaemonResponse is the newline-delimited JSON response to a suggestDaemonRequest, with
+// matching commands ordered most-recent-first
+type suggestDaemonResponse struct {
+	Results []string `json:"results"`
+}
+
+var startSuggestDaemonCmd = &cobra.Command{
+	Use:    "start-suggest-daemon",
+	Hidden: true,
+	Short:  "[Internal-only] Start the suggestion daemon that keeps a hot in-memory index of recent history entries and answers prefix/substring queries over a unix socket",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		lib.CheckFatalError(runSuggestDaemon(ctx))
+	},
+}
+
+func getSuggestDaemonSocketPath(ctx context.Context) string {
+	return filepath.Join(hctx.GetHome(ctx), data.GetHishtoryPath(), data.SUGGEST_DAEMON_SOCKET_PATH)
+}
+
+// suggestDaemonIndex is the daemon's in-memory index: the most recent distinct commands, most
+// recent first, periodically refreshed from the DB
+type suggestDaemonIndex struct {
+	mu       sync.RWMutex
+	commands []string
+}
+
+func (idx *suggestDaemonIndex) refresh(ctx context.Context) error {
+	db := hctx.GetDb(ctx)
+	var commands []string
+	res := db.Model(&data.HistoryEntry{}).Order("start_time DESC").Limit(suggestCacheSize).Pluck("command", &commands)
+	if res.Error != nil {
+		return fmt.Errorf("failed to refresh the suggest daemon index: %w", res.Error)
+	}
+	dedupedCommands := dedupeSuggestCommands(commands)
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.commands = dedupedCommands
+	return nil
+}
+
+func (idx *suggestDaemonIndex) search(query, mode string) []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	results := make([]string, 0)
+	for _, command := range idx.commands {
+		if command == query {
+			// An exact match isn't useful as a suggestion, since there is nothing left to complete
+			continue
+		}
+		var matches bool
+		if mode == "substring" {
+			matches = strings.Contains(command, query)
+		} else {
+			matches = strings.HasPrefix(command, query)
+		}
+		if matches {
+			results = append(results, command)
+			if len(results) >= suggestDaemonMaxResults {
+				break
+			}
+		}
+	}
+	return results
+}
+
+func runSuggestDaemon(ctx context.Context) error {
+	socketPath := getSuggestDaemonSocketPath(ctx)
+	// Remove any stale socket left behind by a previous daemon that didn't shut down cleanly
+	if err := os.Remove(socketPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove the stale suggest daemon socket %s: %w", socketPath, err)
+	}
+	idx := &suggestDaemonIndex{}
+	if err := idx.refresh(ctx); err != nil {
+		return err
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on the suggest daemon socket %s: %w", socketPath, err)
+	}
+	defer listener.Close()
+	go func() {
+		for range time.Tick(suggestDaemonRefreshInterval) {
+			if err := idx.refresh(ctx); err != nil {
+				hctx.GetLogger().Warnf("%v", err)
+			}
+		}
+	}()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return fmt.Errorf("failed to accept a connection on the suggest daemon socket: %w", err)
+		}
+		go handleSuggestDaemonConn(conn, idx)
+	}
+}
+
+func handleSuggestDaemonConn(conn net.Conn, idx *suggestDaemonIndex) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var request suggestDaemonRequest
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+			hctx.GetLogger().Warnf("the suggest daemon received an unparseable request: %v", err)
+			return
+		}
+		serialized, err := json.Marshal(suggestDaemonResponse{Results: idx.search(request.Query, request.Mode)})
+		if err != nil {
+			hctx.GetLogger().Warnf("the suggest daemon failed to serialize a response: %v", err)
+			return
+		}
+		if _, err := conn.Write(append(serialized, '\n')); err != nil {
+			return
+		}
+	}
+}
+
+// querySuggestDaemon queries the suggest daemon over its unix socket. Returns an error if the
+// daemon isn't running (or doesn't answer within suggestDaemonTimeout), in which case callers
+// are expected to fall back to querying SQLite directly.
+func querySuggestDaemon(ctx context.Context, query, mode string) ([]string, error) {
+	conn, err := net.DialTimeout("unix", getSuggestDaemonSocketPath(ctx), suggestDaemonTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the suggest daemon: %w", err)
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(suggestDaemonTimeout)); err != nil {
+		return nil, fmt.Errorf("failed to set a deadline on the suggest daemon connection: %w", err)
+	}
+	serialized, err := json.Marshal(suggestDaemonRequest{Query: query, Mode: mode})
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize the suggest daemon request: %w", err)
+	}
+	if _, err := conn.Write(append(serialized, '\n')); err != nil {
+		return nil, fmt.Errorf("failed to send the suggest daemon request: %w", err)
+	}
+	responseLine, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the suggest daemon response: %w", err)
+	}
+	var response suggestDaemonResponse
+	if err := json.Unmarshal(responseLine, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse the suggest daemon response: %w", err)
+	}
+	return response.Results, nil
+}
+
+func init() {
+	rootCmd.AddCommand(startSuggestDaemonCmd)
+}
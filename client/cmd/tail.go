@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ddworken/hishtory/client/data"
+	"github.com/ddworken/hishtory/client/hctx"
+	"github.com/ddworken/hishtory/client/lib"
+
+	"github.com/spf13/cobra"
+)
+
+// How often `hishtory tail` polls the local DB (and the backend, for entries recorded on other
+// devices) for newly recorded entries
+const tailPollInterval = 2 * time.Second
+
+// How many entries `hishtory tail` fetches per poll. Only entries that are newer than the last
+// printed one are displayed, so this just bounds how many entries can arrive in a single poll
+// interval without being missed.
+const tailPollBatchSize = 100
+
+var tailNumLines *int
+
+var tailCmd = &cobra.Command{
+	Use:     "tail",
+	Short:   "Live-print shell commands as they are recorded, similar to `tail -f`",
+	GroupID: GROUP_ID_QUERYING,
+	Long:    "Print the most recent history entries and then follow the local DB, printing new entries as they are recorded on this device or sync in from your other devices (e.g. for watching what a long-running deployment script is executing on another host). Optionally takes a search query to filter the displayed entries, with the same syntax as `hishtory query`.",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		lib.CheckFatalError(tailEntries(ctx, strings.Join(args, " "), *tailNumLines))
+	},
+}
+
+func tailEntries(ctx context.Context, query string, numLines int) error {
+	db := hctx.GetDb(ctx)
+	config := hctx.GetConf(ctx)
+	if err := retrieveEntriesForTail(ctx); err != nil {
+		return err
+	}
+	entries, err := lib.Search(ctx, db, query, numLines)
+	if err != nil {
+		return err
+	}
+	// lib.Search returns the most recent entries first, so print them in reverse to get the
+	// chronological ordering that tail -f produces
+	var lastEndTime time.Time
+	printedIds := make(map[string]bool)
+	for i := len(entries) - 1; i >= 0; i-- {
+		printTailEntry(config, entries[i])
+		if entries[i].EndTime.After(lastEndTime) {
+			lastEndTime = entries[i].EndTime
+			printedIds = make(map[string]bool)
+		}
+		printedIds[entries[i].EntryId] = true
+	}
+	for {
+		time.Sleep(tailPollInterval)
+		if err := retrieveEntriesForTail(ctx); err != nil {
+			return err
+		}
+		entries, err := lib.Search(ctx, db, query, tailPollBatchSize)
+		if err != nil {
+			return err
+		}
+		for i := len(entries) - 1; i >= 0; i-- {
+			entry := entries[i]
+			if entry.EndTime.Before(lastEndTime) || (entry.EndTime.Equal(lastEndTime) && printedIds[entry.EntryId]) {
+				continue
+			}
+			printTailEntry(config, entry)
+			if entry.EndTime.After(lastEndTime) {
+				lastEndTime = entry.EndTime
+				printedIds = make(map[string]bool)
+			}
+			printedIds[entry.EntryId] = true
+		}
+	}
+}
+
+// retrieveEntriesForTail pulls down any entries recorded on other devices, tolerating the device
+// being (or going) offline since tailing local entries is still useful without syncing
+func retrieveEntriesForTail(ctx context.Context) error {
+	err := lib.RetrieveAdditionalEntriesFromRemote(ctx, "tail")
+	if err != nil && !lib.IsOfflineError(ctx, err) {
+		return err
+	}
+	return nil
+}
+
+func printTailEntry(config *hctx.ClientConfig, entry *data.HistoryEntry) {
+	fmt.Printf("%s\t%s\t%s\n", entry.EndTime.Local().Format(config.TimestampFormat), entry.Hostname, entry.Command)
+}
+
+func init() {
+	rootCmd.AddCommand(tailCmd)
+	tailNumLines = tailCmd.Flags().IntP("lines", "n", 10, "Number of recent entries to print before starting to follow")
+}
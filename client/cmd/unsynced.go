@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/ddworken/hishtory/client/data"
+	"github.com/ddworken/hishtory/client/hctx"
+	"github.com/ddworken/hishtory/client/lib"
+
+	"github.com/spf13/cobra"
+)
+
+var unsyncedCmd = &cobra.Command{
+	Use:     "unsynced",
+	Short:   "Inspect history entries that haven't been acknowledged by the sync server yet",
+	GroupID: GROUP_ID_MANAGEMENT,
+}
+
+var unsyncedCountCmd = &cobra.Command{
+	Use:   "count",
+	Short: "Print the number of history entries that haven't been acknowledged by the sync server yet",
+	Long:  "Entries are journaled locally before each upload and only cleared once the backend acknowledges them, so this count is an exact measure of what is pending (whether due to being offline, upload failures, or an open sync-interval batching window). Zero means every entry has been durably synced.",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := hctx.MakeContext()
+		config := hctx.GetConf(ctx)
+		if config.IsOffline {
+			lib.CheckFatalError(fmt.Errorf("this is an offline installation of hishtory, so no entries are ever synced"))
+		}
+		var numUnsynced int64
+		lib.CheckFatalError(hctx.GetDb(ctx).Model(&data.UploadJournalEntry{}).Count(&numUnsynced).Error)
+		fmt.Println(numUnsynced)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(unsyncedCmd)
+	unsyncedCmd.AddCommand(unsyncedCountCmd)
+}
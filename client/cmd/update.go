@@ -3,7 +3,6 @@ package cmd
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -12,12 +11,14 @@ import (
 	"runtime"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/ddworken/hishtory/client/data"
 	"github.com/ddworken/hishtory/client/hctx"
 	"github.com/ddworken/hishtory/client/lib"
 	"github.com/ddworken/hishtory/shared"
 
+	"github.com/google/uuid"
 	"github.com/spf13/cobra"
 )
 
@@ -30,6 +31,64 @@ var updateCmd = &cobra.Command{
 	},
 }
 
+var selfTestCmd = &cobra.Command{
+	Use:    "self-test",
+	Hidden: true,
+	Short:  "[Internal-only] Run a quick end-to-end self-test of this binary (used to validate updates)",
+	Run: func(cmd *cobra.Command, args []string) {
+		lib.CheckFatalError(selfTest(hctx.MakeContext()))
+	},
+}
+
+// selfTest checks that this binary can perform the basic operations that hishtory depends on:
+// record a hidden test entry, query it back, delete it, and reach the sync server. It is run by
+// `hishtory update` against the newly installed binary, so that a broken update gets rolled back
+// instead of leaving many machines with a binary that can't record history.
+func selfTest(ctx context.Context) error {
+	db := hctx.GetDb(ctx)
+	config := hctx.GetConf(ctx)
+	testCommand := "hishtory-self-test-" + uuid.Must(uuid.NewRandom()).String()
+	entry := data.HistoryEntry{
+		LocalUsername:           "self-test",
+		Hostname:                "self-test",
+		Command:                 testCommand,
+		CurrentWorkingDirectory: "/",
+		HomeDirectory:           "/",
+		ExitCode:                0,
+		StartTime:               time.Now(),
+		EndTime:                 time.Now(),
+		DeviceId:                config.DeviceId,
+		EntryId:                 uuid.Must(uuid.NewRandom()).String(),
+	}
+	if err := db.Create(&entry).Error; err != nil {
+		return fmt.Errorf("self-test failed to record a test entry: %w", err)
+	}
+	// Delete the test entry even if querying it back fails, so that a failed self-test doesn't
+	// leave it behind in the user's history
+	defer func() {
+		_ = db.Where("entry_id = ?", entry.EntryId).Delete(&data.HistoryEntry{}).Error
+	}()
+	results, err := lib.Search(ctx, db, testCommand, 1)
+	if err != nil {
+		return fmt.Errorf("self-test failed to query the test entry: %w", err)
+	}
+	if len(results) != 1 {
+		return fmt.Errorf("self-test query for the test entry returned %d results, expected 1", len(results))
+	}
+	if !config.IsOffline {
+		if _, err := lib.ApiGet(ctx, "/api/v1/ping"); err != nil {
+			if lib.IsOfflineError(ctx, err) {
+				// Being offline isn't the new binary's fault, so don't fail the self-test (and
+				// thus trigger a rollback) over it
+				fmt.Println("Warning: hishtory is offline, so the self-test skipped pinging the sync server")
+			} else {
+				return fmt.Errorf("self-test failed to ping the sync server: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
 var validateBinaryCmd = &cobra.Command{
 	Use:    "validate-binary",
 	Hidden: true,
@@ -57,7 +116,7 @@ func GetDownloadData(ctx context.Context) (shared.UpdateInfo, error) {
 		return shared.UpdateInfo{}, fmt.Errorf("failed to download update info: %w", err)
 	}
 	var downloadData shared.UpdateInfo
-	err = json.Unmarshal(respBody, &downloadData)
+	err = lib.UnmarshalServerResponse(respBody, &downloadData)
 	if err != nil {
 		return shared.UpdateInfo{}, fmt.Errorf("failed to parse update info: %w", err)
 	}
@@ -93,12 +152,20 @@ func update(ctx context.Context) error {
 		}
 	}
 
+	// Save a copy of the currently installed binary, so that we can roll back to it if the new
+	// version fails its self-test
+	installedBinaryPath := path.Join(hctx.GetHome(ctx), data.GetHishtoryPath(), "hishtory")
+	backupBinaryPath := installedBinaryPath + ".prev"
+	err = copyFile(installedBinaryPath, backupBinaryPath)
+	if err != nil {
+		return fmt.Errorf("failed to back up the current binary before updating: %w", err)
+	}
+
 	// Unlink the existing binary so we can overwrite it even though it is still running
 	if runtime.GOOS == "linux" {
-		homedir := hctx.GetHome(ctx)
-		err = syscall.Unlink(path.Join(homedir, data.GetHishtoryPath(), "hishtory"))
+		err = syscall.Unlink(installedBinaryPath)
 		if err != nil {
-			return fmt.Errorf("failed to unlink %s for update: %w", path.Join(homedir, data.GetHishtoryPath(), "hishtory"), err)
+			return fmt.Errorf("failed to unlink %s for update: %w", installedBinaryPath, err)
 		}
 	}
 
@@ -120,6 +187,23 @@ func update(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("failed to install update (stderr=%#v), is %s in a noexec directory? (if so, set the TMPDIR environment variable): %w", stderr.String(), getTmpClientPath(), err)
 	}
+
+	// Run a quick self-test against the newly installed binary, and roll back to the saved
+	// previous binary if it fails, so that automatic updates across many machines are safe
+	cmd = exec.Command(installedBinaryPath, "self-test")
+	stdout = bytes.Buffer{}
+	cmd.Stdout = &stdout
+	stderr = bytes.Buffer{}
+	cmd.Stderr = &stderr
+	selfTestErr := cmd.Run()
+	if selfTestErr != nil {
+		rollbackErr := rollbackUpdate(backupBinaryPath, installedBinaryPath)
+		if rollbackErr != nil {
+			return fmt.Errorf("the updated binary failed its self-test (stdout=%#v, stderr=%#v: %v), and rolling back to the previous binary also failed: %w", stdout.String(), stderr.String(), selfTestErr, rollbackErr)
+		}
+		return fmt.Errorf("the updated binary failed its self-test (stdout=%#v, stderr=%#v), so hishtory was rolled back to v0.%s: %w", stdout.String(), stderr.String(), lib.Version, selfTestErr)
+	}
+	_ = os.Remove(backupBinaryPath)
 	fmt.Printf("Successfully updated hishtory from v0.%s to %s\n", lib.Version, getPossiblyOverriddenVersion(downloadData))
 
 	// Delete the file after installing to prevent issues like #227
@@ -127,6 +211,22 @@ func update(ctx context.Context) error {
 	return nil
 }
 
+// rollbackUpdate restores the saved previous binary after a failed update, so that the machine is
+// left with a known-working hishtory rather than a broken one
+func rollbackUpdate(backupBinaryPath, installedBinaryPath string) error {
+	// Unlink rather than overwrite in place, since the broken binary may still be running
+	if err := syscall.Unlink(installedBinaryPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to unlink %s for rollback: %w", installedBinaryPath, err)
+	}
+	if err := copyFile(backupBinaryPath, installedBinaryPath); err != nil {
+		return fmt.Errorf("failed to restore the previous binary: %w", err)
+	}
+	if err := os.Chmod(installedBinaryPath, 0o700); err != nil {
+		return fmt.Errorf("failed to make the restored binary executable: %w", err)
+	}
+	return os.Remove(backupBinaryPath)
+}
+
 func verifyBinaryMac(ctx context.Context, binaryPath string, downloadData shared.UpdateInfo) error {
 	// On Mac, binary verification is a bit more complicated since mac binaries are code
 	// signed. To verify a signed binary, we:
@@ -318,6 +418,7 @@ func downloadFile(filename, url string) error {
 
 func init() {
 	rootCmd.AddCommand(updateCmd)
+	rootCmd.AddCommand(selfTestCmd)
 	rootCmd.AddCommand(validateBinaryCmd)
 	validateBinaryCmd.PersistentFlags().Bool("is_macos", false, "Whether the binary we are validating is for MacOS")
 	validateBinaryCmd.PersistentFlags().String("macos_unsigned_binary", "", "The path to the unsigned MacOS binary, if is_macos=true")
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/ddworken/hishtory/client/hctx"
 	"github.com/ddworken/hishtory/client/lib"
@@ -16,6 +17,9 @@ var (
 	disableAuth *bool
 	forceCreds  *string
 	port        *int
+	shareFilter *string
+	shareTtl    *time.Duration
+	scopeFilter *string
 )
 
 var webUiCmd = &cobra.Command{
@@ -36,7 +40,10 @@ var webUiCmd = &cobra.Command{
 		if *disableAuth && *forceCreds != "" {
 			lib.CheckFatalError(fmt.Errorf("cannot specify both --disable-auth and --force-creds"))
 		}
-		lib.CheckFatalError(webui.StartWebUiServer(hctx.MakeContext(), *port, *disableAuth, overridenUsername, overridenPassword))
+		if *disableAuth && *shareFilter != "" {
+			lib.CheckFatalError(fmt.Errorf("cannot specify both --disable-auth and --share-filter"))
+		}
+		lib.CheckFatalError(webui.StartWebUiServer(hctx.MakeContext(), *port, *disableAuth, overridenUsername, overridenPassword, *shareFilter, *shareTtl, *scopeFilter))
 		os.Exit(1)
 	},
 }
@@ -46,4 +53,7 @@ func init() {
 	disableAuth = webUiCmd.Flags().Bool("disable-auth", false, "Disable authentication for the Web UI (Warning: This means your entire shell history will be accessible from the local web server)")
 	forceCreds = webUiCmd.Flags().String("force-creds", "", "Specify the credentials to use for basic auth in the form `user:password`")
 	port = webUiCmd.Flags().Int("port", 8000, "The port for the web server to listen on")
+	shareFilter = webUiCmd.Flags().String("share-filter", "", "Generate a time-limited read-only share URL that only exposes entries matching this filter (e.g. `cwd:~/infra`), so a guest can browse that slice of your history without your credentials")
+	shareTtl = webUiCmd.Flags().Duration("share-ttl", time.Hour, "How long the --share-filter URL stays valid")
+	scopeFilter = webUiCmd.Flags().String("scope", "", "Restrict every search to entries matching this filter (e.g. `cwd:~/project`), regardless of the user-supplied query, for safely exposing a subset of history")
 }
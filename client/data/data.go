@@ -8,21 +8,43 @@ import (
 	"crypto/sha256"
 	"database/sql/driver"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"regexp"
 	"strings"
 	"time"
 
 	"github.com/ddworken/hishtory/shared"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
 )
 
 const (
 	KdfUserID        = "user_id"
 	KdfEncryptionKey = "encryption_key"
-	CONFIG_PATH      = ".hishtory.config"
+	// The legacy JSON config file, still read (and migrated) if CONFIG_TOML_PATH doesn't exist yet
+	CONFIG_PATH = ".hishtory.config"
+	// The TOML config file, which is the authoritative config format since it supports comments
+	// and is thus practical to hand-edit
+	CONFIG_TOML_PATH = ".hishtory.config.toml"
 	DB_PATH          = ".hishtory.db"
+	// An optional JSON file containing rules (regex -> drop/rewrite/tag) that are applied to
+	// commands while importing them from existing shell history files
+	IMPORT_RULES_PATH = ".hishtory.import-rules.json"
+	// A JSON file containing the last TUI search state for each terminal session, so that it can
+	// be restored via a keybinding (only written when enable-tui-state-restore is set)
+	TUI_STATE_PATH = ".hishtory.tui-state.json"
+	// A JSON file containing the most recent distinct commands, used as a warm cache so that
+	// `hishtory suggest` can answer prefix queries quickly enough for inline autosuggestions
+	SUGGEST_CACHE_PATH = ".hishtory.suggest-cache.json"
+	// The unix socket that the suggest daemon (`hishtory start-suggest-daemon`) listens on to
+	// answer prefix/substring queries from its in-memory index of recent entries
+	SUGGEST_DAEMON_SOCKET_PATH = ".hishtory.suggest-daemon.sock"
 )
 
 const (
@@ -41,6 +63,58 @@ type HistoryEntry struct {
 	DeviceId                string        `json:"device_id" gorm:"uniqueIndex:compositeindex"`
 	EntryId                 string        `json:"entry_id" gorm:"uniqueIndex:compositeindex,uniqueIndex:entry_id_index"`
 	CustomColumns           CustomColumns `json:"custom_columns"`
+	// The terminal emulator (from TERM_PROGRAM) that the command ran in. Only recorded if
+	// enable-terminal-metadata is set, so empty by default.
+	TermProgram string `json:"term_program,omitempty"`
+	// The TTY that the command ran in. Only recorded if enable-terminal-metadata is set.
+	Tty string `json:"tty,omitempty"`
+	// The ID of the shell session that ran this command, as exported by the shell hooks via
+	// HISHTORY_SESSION_ID. Empty for entries that predate this feature or were imported.
+	SessionId string `json:"session_id,omitempty" gorm:"index:session_id_index"`
+	// The original user that the shell belongs to when running under sudo/su, as detected from
+	// SUDO_USER. Empty if the shell isn't running as a different user than the one that started it.
+	OriginalUsername string `json:"original_username,omitempty"`
+	// The git repository (the name of the repo's root directory) that the command ran in, if any
+	GitRepo string `json:"git_repo,omitempty"`
+	// The git branch that was checked out when the command ran, if any
+	GitBranch string `json:"git_branch,omitempty"`
+	// Whether the command wrote to stderr. Nil if this wasn't captured, either because output
+	// capture is disabled or because the entry predates this feature.
+	HadStderr *bool `json:"had_stderr,omitempty"`
+	// The approximate number of bytes the command wrote to stderr. Nil if this wasn't captured.
+	OutputSize *int64 `json:"output_size,omitempty"`
+	// The shell nesting level (from SHLVL) that the command ran at. Nested shells (e.g. scripts
+	// spawning bash, nix-shell, poetry shell) record values greater than 1, which can be filtered
+	// via e.g. `shlvl:>1`. Nil if SHLVL wasn't set or couldn't be parsed.
+	Shlvl *int `json:"shlvl,omitempty"`
+	// The name of the process that spawned the shell that ran this command (e.g. a terminal
+	// emulator, tmux, sshd, or a script interpreter), which helps tell nested shell sessions
+	// apart. Empty if it couldn't be determined.
+	ParentProcess string `json:"parent_process,omitempty"`
+	// Whether this entry must never be uploaded to the backend, e.g. because the secret scanner
+	// matched it and secret-scan-mode is set to local-only
+	LocalOnly bool `json:"local_only,omitempty"`
+}
+
+// Records a history entry that was saved locally but hasn't been acked by the backend yet (e.g.
+// because the device was offline). Reconnecting uploads exactly the journaled entries, rather than
+// re-encrypting and re-uploading everything after a timestamp.
+type UploadJournalEntry struct {
+	EntryId string `json:"entry_id" gorm:"primaryKey"`
+	// When the upload first failed
+	Date time.Time `json:"date"`
+}
+
+// DayAggregate is one row of the materialized per-day aggregates table: the number of history
+// entries recorded on the given day for the given dimension ("command", "cwd", or "hostname")
+// and value. Maintained incrementally as entries are inserted so that stats render instantly
+// even on multi-million entry DBs, and rebuildable from scratch via `hishtory stats rebuild`.
+type DayAggregate struct {
+	// The day the entries started on, formatted as YYYY-MM-DD
+	Day       string `json:"day" gorm:"uniqueIndex:day_aggregate_idx"`
+	Dimension string `json:"dimension" gorm:"uniqueIndex:day_aggregate_idx"`
+	Value     string `json:"value" gorm:"uniqueIndex:day_aggregate_idx"`
+	Count     int64  `json:"count"`
 }
 
 type CustomColumns []CustomColumn
@@ -67,6 +141,14 @@ func (h *HistoryEntry) GoString() string {
 	return fmt.Sprintf("%#v", *h)
 }
 
+// ContentAddressedEntryId returns a deterministic entry ID derived from the fields that identify a
+// command, so that recording or importing the same command twice produces the same entry ID (and is
+// thus deduplicated server-side) rather than creating a near-duplicate entry.
+func ContentAddressedEntryId(entry *HistoryEntry) string {
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%s|%s", entry.Command, entry.StartTime.Unix(), entry.Hostname, entry.CurrentWorkingDirectory)))
+	return hex.EncodeToString(hash[:])
+}
+
 func sha256hmac(key, additionalData string) []byte {
 	h := hmac.New(sha256.New, []byte(key))
 	h.Write([]byte(additionalData))
@@ -81,6 +163,72 @@ func EncryptionKey(userSecret string) []byte {
 	return sha256hmac(userSecret, KdfEncryptionKey)
 }
 
+// The salt used when deriving a secret key from a passphrase via `hishtory init --passphrase`.
+// It is deliberately a fixed application-specific value (rather than a random per-user one) so
+// that the same passphrase derives the same secret key on every machine, which is the whole point
+// of passphrase-based initialization.
+const passphraseKdfSalt = "hishtory-passphrase-kdf-v1"
+
+// DeriveKeyFromPassphrase derives a hishtory secret key from a human-memorable passphrase using
+// Argon2id, so that devices can be synced by remembering a passphrase rather than by copying a
+// random secret key between machines via some other channel.
+func DeriveKeyFromPassphrase(passphrase string) string {
+	key := argon2.IDKey([]byte(passphrase), []byte(passphraseKdfSalt), 1, 64*1024, 4, 32)
+	return base64.URLEncoding.EncodeToString(key)
+}
+
+// The KDF context used when deriving a user's X25519 sharing keypair from their secret key. Since
+// the keypair is derived deterministically from the user secret, every one of the user's devices
+// has the same keypair without needing any key syncing.
+const KdfSharingKey = "sharing_key_v1"
+
+// SharingKeyPair derives the X25519 keypair used for `hishtory share`: other users seal entries
+// to the public key, and any of this user's devices can open them with the private key
+func SharingKeyPair(userSecret string) (publicKey, privateKey *[32]byte, err error) {
+	privateKey = new([32]byte)
+	copy(privateKey[:], sha256hmac(userSecret, KdfSharingKey))
+	publicKeyBytes, err := curve25519.X25519(privateKey[:], curve25519.Basepoint)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to derive the sharing public key: %w", err)
+	}
+	publicKey = new([32]byte)
+	copy(publicKey[:], publicKeyBytes)
+	return publicKey, privateKey, nil
+}
+
+// SealEntryForSharing encrypts the given entry to another user's sharing public key, so that
+// only the recipient can read it (the backend just sees an opaque sealed box)
+func SealEntryForSharing(recipientPublicKey []byte, entry HistoryEntry) ([]byte, error) {
+	if len(recipientPublicKey) != 32 {
+		return nil, fmt.Errorf("invalid sharing public key length %d", len(recipientPublicKey))
+	}
+	plaintext, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	var publicKey [32]byte
+	copy(publicKey[:], recipientPublicKey)
+	return box.SealAnonymous(nil, plaintext, &publicKey, rand.Reader)
+}
+
+// OpenSharedEntry decrypts an entry that another user sealed to this user's sharing public key
+func OpenSharedEntry(userSecret string, sealed []byte) (HistoryEntry, error) {
+	publicKey, privateKey, err := SharingKeyPair(userSecret)
+	if err != nil {
+		return HistoryEntry{}, err
+	}
+	plaintext, ok := box.OpenAnonymous(nil, sealed, publicKey, privateKey)
+	if !ok {
+		return HistoryEntry{}, fmt.Errorf("failed to decrypt shared history entry, was it sealed for a different user?")
+	}
+	var entry HistoryEntry
+	err = json.Unmarshal(plaintext, &entry)
+	if err != nil {
+		return HistoryEntry{}, err
+	}
+	return entry, nil
+}
+
 func makeAead(userSecret string) (cipher.AEAD, error) {
 	key := EncryptionKey(userSecret)
 	block, err := aes.NewCipher(key)
@@ -171,14 +319,28 @@ func DecryptHistoryEntry(userSecret string, entry shared.EncHistoryEntry) (Histo
 	return decryptedEntry, nil
 }
 
+// Valid profile names, so that a profile name can safely be used as part of a directory name
+var profileNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
 func ValidateHishtoryPath() error {
 	hishtoryPath := os.Getenv("HISHTORY_PATH")
 	if strings.HasPrefix(hishtoryPath, "/") {
 		return fmt.Errorf("HISHTORY_PATH must be a relative path")
 	}
+	if profile := GetProfile(); profile != "" && !profileNameRegexp.MatchString(profile) {
+		return fmt.Errorf("HISHTORY_PROFILE %#v must only contain letters, numbers, dashes, and underscores", profile)
+	}
 	return nil
 }
 
+// GetProfile returns the name of the currently selected profile, or the empty string for the
+// default profile. Profiles have fully separate data directories (and thus separate secret keys,
+// DBs, and configs) and are selected via the --profile flag or the HISHTORY_PROFILE env variable
+// (the latter is what the shell hooks use to select which profile commands are recorded into).
+func GetProfile() string {
+	return os.Getenv("HISHTORY_PROFILE")
+}
+
 func GetHishtoryPath() string {
 	err := ValidateHishtoryPath()
 	if err != nil {
@@ -189,5 +351,8 @@ func GetHishtoryPath() string {
 	if hishtoryPath != "" {
 		return hishtoryPath
 	}
+	if profile := GetProfile(); profile != "" {
+		return defaultHishtoryPath + "-" + profile
+	}
 	return defaultHishtoryPath
 }
@@ -0,0 +1,31 @@
+#!/bin/sh
+# Entrypoint for the hiSHtory client container: initializes the client against an existing
+# account, keeps the local DB synced with the backend, and serves the web UI.
+set -eu
+
+if [ -z "${HISHTORY_SECRET_KEY:-}" ]; then
+    echo "HISHTORY_SECRET_KEY must be set to the secret key of an existing hiSHtory account (see \`hishtory status\` on an initialized device)" >&2
+    exit 1
+fi
+
+# Initialize on first boot only, so that restarts don't wipe the local DB and re-bootstrap
+if [ ! -e "$HOME/.hishtory/.hishtory.config" ] && [ ! -e "$HOME/.hishtory/.hishtory.config.toml" ]; then
+    # There is no shell history inside the container worth importing
+    HISHTORY_SKIP_INIT_IMPORT=1 hishtory init "$HISHTORY_SECRET_KEY"
+fi
+
+# Keep the local DB up to date with the backend. On a normal install this happens as a side
+# effect of the shell hooks running on every command, but there is no shell in this container,
+# so run the same internal command on a timer. Note that it intentionally only syncs a random
+# fraction of the invocations, so the loop interval is shorter than the effective sync interval.
+(
+    while true; do
+        hishtory updateLocalDbFromRemote || true
+        sleep "${HISHTORY_SYNC_INTERVAL:-15}"
+    done
+) &
+
+if [ -n "${HISHTORY_WEB_UI_CREDS:-}" ]; then
+    exec hishtory start-web-ui --force-creds "$HISHTORY_WEB_UI_CREDS"
+fi
+exec hishtory start-web-ui
@@ -0,0 +1,38 @@
+package hctx
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path"
+	"time"
+
+	"github.com/ddworken/hishtory/client/data"
+)
+
+// RecordAuditEvent appends a line describing an administrative action (a config change,
+// enabling/disabling recording, a redaction, or a key operation) to the local audit log at
+// ~/.hishtory/audit.log, so that admins of shared machines can review how hishtory itself was
+// manipulated. The file is only ever opened for appending, and audit logging is best-effort:
+// failures are logged but never block the action itself.
+func RecordAuditEvent(action string) {
+	homedir, err := os.UserHomeDir()
+	if err != nil {
+		GetLogger().Warnf("failed to record audit event %#v: failed to retrieve homedir: %v", action, err)
+		return
+	}
+	username := "unknown"
+	if currentUser, err := user.Current(); err == nil {
+		username = currentUser.Username
+	}
+	line := fmt.Sprintf("%s user=%s action=%#v\n", time.Now().UTC().Format(time.RFC3339), username, action)
+	auditFile, err := os.OpenFile(path.Join(homedir, data.GetHishtoryPath(), "audit.log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		GetLogger().Warnf("failed to record audit event %#v: %v", action, err)
+		return
+	}
+	defer auditFile.Close()
+	if _, err := auditFile.WriteString(line); err != nil {
+		GetLogger().Warnf("failed to record audit event %#v: %v", action, err)
+	}
+}
@@ -17,6 +17,7 @@ import (
 	// Needed to use sqlite without CGO
 	"github.com/glebarez/sqlite"
 	"github.com/google/uuid"
+	"github.com/pelletier/go-toml/v2"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/natefinch/lumberjack.v2"
 	"gorm.io/gorm"
@@ -109,6 +110,8 @@ func OpenLocalSqliteDb() (*gorm.DB, error) {
 		return nil, err
 	}
 	db.AutoMigrate(&data.HistoryEntry{})
+	db.AutoMigrate(&data.UploadJournalEntry{})
+	db.AutoMigrate(&data.DayAggregate{})
 	db.Exec("PRAGMA journal_mode = WAL")
 	db.Exec("pragma mmap_size = 268435456")
 	db.Exec("CREATE INDEX IF NOT EXISTS start_time_index ON history_entries(start_time)")
@@ -145,6 +148,54 @@ func MakeContext() context.Context {
 	return ctx
 }
 
+// MakeStandaloneContext builds a context around the given hishtory DB file with an in-memory
+// default config, without requiring hishtory to be installed or initialized on this machine.
+// Used by `hishtory query --db` for searching a DB that was copied over from another machine
+// (e.g. to a rescue box) or restored from a backup. The DB is opened read-only so that
+// inspecting a backup can't modify it.
+func MakeStandaloneContext(dbPath string) (context.Context, error) {
+	ctx := context.Background()
+	var config ClientConfig
+	applyConfigDefaults(&config)
+	config.IsOffline = true
+	// Disable the DB size warnings, since they check (and persist a warning timestamp for) this
+	// machine's own hishtory install rather than the DB file being queried
+	config.DbSizeWarningThresholdMb = -1
+	config.DbCountWarningThreshold = -1
+	ctx = context.WithValue(ctx, ConfigCtxKey, &config)
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, fmt.Errorf("failed to open the DB at %s: %w", dbPath, err)
+	}
+	newLogger := logger.New(
+		GetLogger().WithField("fromSQL", true),
+		logger.Config{
+			SlowThreshold:             100 * time.Millisecond,
+			LogLevel:                  logger.Warn,
+			IgnoreRecordNotFoundError: false,
+			Colorful:                  false,
+		},
+	)
+	dsn := fmt.Sprintf("file:%s?mode=ro", dbPath)
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{SkipDefaultTransaction: true, Logger: newLogger})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the DB at %s: %w", dbPath, err)
+	}
+	tx, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Ping(); err != nil {
+		return nil, err
+	}
+	ctx = context.WithValue(ctx, DbCtxKey, db)
+	homedir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get homedir: %w", err)
+	}
+	ctx = context.WithValue(ctx, HomedirCtxKey, homedir)
+	return ctx, nil
+}
+
 func GetConf(ctx context.Context) *ClientConfig {
 	v := ctx.Value(ConfigCtxKey)
 	if v != nil {
@@ -170,63 +221,197 @@ func GetHome(ctx context.Context) string {
 }
 
 type ClientConfig struct {
+	// The version of the config file format, used to run configMigrations when the format changes
+	ConfigVersion int `json:"config_version" yaml:"-" toml:"config_version"`
 	// The user secret that is used to derive encryption keys for syncing history entries
-	UserSecret string `json:"user_secret" yaml:"-"`
+	UserSecret string `json:"user_secret" yaml:"-" toml:"user_secret"`
 	// Whether hishtory recording is enabled
-	IsEnabled bool `json:"is_enabled" yaml:"-"`
+	IsEnabled bool `json:"is_enabled" yaml:"-" toml:"is_enabled"`
 	// A device ID used to track which history entry came from which device for remote syncing
-	DeviceId string `json:"device_id" yaml:"-"`
+	DeviceId string `json:"device_id" yaml:"-" toml:"device_id"`
 	// Used for skipping history entries prefixed with a space in bash
-	LastPreSavedHistoryLine string `json:"last_presaved_history_line" yaml:"-"`
+	LastPreSavedHistoryLine string `json:"last_presaved_history_line" yaml:"-" toml:"last_presaved_history_line"`
 	// Used for skipping history entries prefixed with a space in bash
-	LastSavedHistoryLine string `json:"last_saved_history_line" yaml:"-"`
+	LastSavedHistoryLine string `json:"last_saved_history_line" yaml:"-" toml:"last_saved_history_line"`
 	// Used for uploading history entries that we failed to upload due to a missing network connection
-	HaveMissedUploads     bool  `json:"have_missed_uploads" yaml:"-"`
-	MissedUploadTimestamp int64 `json:"missed_upload_timestamp" yaml:"-"`
+	HaveMissedUploads     bool  `json:"have_missed_uploads" yaml:"-" toml:"have_missed_uploads"`
+	MissedUploadTimestamp int64 `json:"missed_upload_timestamp" yaml:"-" toml:"missed_upload_timestamp"`
+	// How often saved entries get pushed to the backend: either "on-command" (the default, push on
+	// every saved command) or a duration like "30s" or "5m", in which case saves in between get
+	// batched locally in the upload journal and pushed together once the interval has elapsed
+	SyncInterval string `json:"sync_interval" toml:"sync_interval"`
+	// When the last batched push to the backend happened, used with SyncInterval to decide when
+	// the next push is due
+	LastSyncTimestamp int64 `json:"last_sync_timestamp" yaml:"-" toml:"last_sync_timestamp"`
+	// Tracks a partially completed initial device sync, so that if bootstrapping gets interrupted
+	// (e.g. by going offline) it resumes from the last received chunk in a later session rather
+	// than restarting from scratch
+	InitialSyncInProgress bool `json:"initial_sync_in_progress" yaml:"-" toml:"initial_sync_in_progress"`
+	// The (date, entry ID) cursor identifying the last chunk that the initial sync received
+	InitialSyncCursorDate string `json:"initial_sync_cursor_date" yaml:"-" toml:"initial_sync_cursor_date"`
+	InitialSyncCursorId   string `json:"initial_sync_cursor_id" yaml:"-" toml:"initial_sync_cursor_id"`
+	// Whether queries run while the initial device sync is still incomplete should lazily fetch
+	// the most recent remote entries, so that brand new devices are immediately useful rather
+	// than returning incomplete results until the full download finishes
+	LazySearchFetch bool `json:"lazy_search_fetch" toml:"lazy_search_fetch"`
 	// Used for uploading deletion requests that we failed to upload due to a missed network connection
 	// Note that this is only applicable for deleting pre-saved entries. For interactive deletion, we just
 	// show the user an error message if they're offline.
-	PendingDeletionRequests []shared.DeletionRequest `json:"pending_deletion_requests" yaml:"-"`
+	PendingDeletionRequests []shared.DeletionRequest `json:"pending_deletion_requests" yaml:"-" toml:"pending_deletion_requests"`
 	// Used for avoiding double imports of .bash_history
-	HaveCompletedInitialImport bool `json:"have_completed_initial_import" yaml:"-"`
+	HaveCompletedInitialImport bool `json:"have_completed_initial_import" yaml:"-" toml:"have_completed_initial_import"`
 	// Whether control-r bindings are enabled
-	ControlRSearchEnabled bool `json:"enable_control_r_search"`
+	ControlRSearchEnabled bool `json:"enable_control_r_search" toml:"enable_control_r_search"`
 	// The set of columns that the user wants to be displayed
-	DisplayedColumns []string `json:"displayed_columns"`
+	DisplayedColumns []string `json:"displayed_columns" toml:"displayed_columns"`
 	// Custom columns
-	CustomColumns []CustomColumnDefinition `json:"custom_columns"`
+	CustomColumns []CustomColumnDefinition `json:"custom_columns" toml:"custom_columns"`
 	// Whether to force enable a compact mode for the TUI
-	ForceCompactMode bool `json:"force_compact_mode"`
+	ForceCompactMode bool `json:"force_compact_mode" toml:"force_compact_mode"`
 	// Whether this is an offline instance of hishtory with no syncing
-	IsOffline bool `json:"is_offline"`
+	IsOffline bool `json:"is_offline" toml:"is_offline"`
 	// Whether duplicate commands should be displayed
-	FilterDuplicateCommands bool `json:"filter_duplicate_commands"`
+	FilterDuplicateCommands bool `json:"filter_duplicate_commands" toml:"filter_duplicate_commands"`
 	// A format string for the timestamp
-	TimestampFormat string `json:"timestamp_format"`
+	TimestampFormat string `json:"timestamp_format" toml:"timestamp_format"`
 	// Beta mode, enables unspecified additional beta features
 	// Currently: This enables pre-saving of history entries to better handle long-running commands
-	BetaMode bool `json:"beta_mode"`
+	BetaMode bool `json:"beta_mode" toml:"beta_mode"`
 	// Whether to highlight matches in search results
-	HighlightMatches bool `json:"highlight_matches"`
+	HighlightMatches bool `json:"highlight_matches" toml:"highlight_matches"`
 	// Whether to enable AI completion
-	AiCompletion bool `json:"ai_completion"`
+	AiCompletion bool `json:"ai_completion" toml:"ai_completion"`
 	// Whether to enable presaving
-	EnablePresaving bool `json:"enable_presaving"`
+	EnablePresaving bool `json:"enable_presaving" toml:"enable_presaving"`
 	// The current color scheme for the TUI
-	ColorScheme ColorScheme `json:"color_scheme"`
+	ColorScheme ColorScheme `json:"color_scheme" toml:"color_scheme"`
 	// A default filter that will be applied to all search queries
-	DefaultFilter string `json:"default_filter"`
+	DefaultFilter string `json:"default_filter" toml:"default_filter"`
 	// The endpoint to use for AI suggestions
-	AiCompletionEndpoint string `json:"ai_completion_endpoint"`
+	AiCompletionEndpoint string `json:"ai_completion_endpoint" toml:"ai_completion_endpoint"`
+	// The backend to use for AI suggestions. Either "openai" (the default, also used for
+	// OpenAI-compatible endpoints) or "ollama" (for Ollama/llama.cpp style local endpoints)
+	AiCompletionBackend string `json:"ai_completion_backend" toml:"ai_completion_backend"`
+	// The number of recent commands to include as context in AI suggestion prompts, along
+	// with the current working directory and OS. Zero (the default) shares no context.
+	AiCompletionContextCommands int `json:"ai_completion_context_commands" toml:"ai_completion_context_commands"`
 	// Custom key bindings for the TUI
-	KeyBindings keybindings.SerializableKeyMap `json:"key_bindings"`
+	KeyBindings keybindings.SerializableKeyMap `json:"key_bindings" toml:"key_bindings"`
 	// The log level for hishtory (e.g., "debug", "info", "warn", "error")
-	LogLevel logrus.Level `json:"log_level"`
+	LogLevel logrus.Level `json:"log_level" toml:"log_level"`
 	// Whether the TUI should render in full-screen mode
-	FullScreenRendering bool `json:"full_screen_rendering"`
+	FullScreenRendering bool `json:"full_screen_rendering" toml:"full_screen_rendering"`
 	// Columns that are used for default searches.
 	// See https://github.com/ddworken/hishtory/issues/268 for context on this.
-	DefaultSearchColumns []string `json:"default_search_columns"`
+	DefaultSearchColumns []string `json:"default_search_columns" toml:"default_search_columns"`
+	// The size of the local DB (in megabytes) above which hishtory will periodically warn
+	// the user to prune their history. Set to -1 to disable these warnings.
+	DbSizeWarningThresholdMb int64 `json:"db_size_warning_threshold_mb" toml:"db_size_warning_threshold_mb"`
+	// The number of history entries above which hishtory will periodically warn
+	// the user to prune their history. Set to -1 to disable these warnings.
+	DbCountWarningThreshold int64 `json:"db_count_warning_threshold" toml:"db_count_warning_threshold"`
+	// What to do with commands that are mostly non-printable characters (e.g. a pasted binary
+	// blob): "sanitize" (the default) replaces the non-printable characters and records the
+	// rest, "skip" doesn't record the command at all, and "keep" records it unchanged
+	NonPrintableCommandPolicy string `json:"non_printable_command_policy" toml:"non_printable_command_policy"`
+	// The maximum length (in bytes) of a stored command. Longer commands are truncated and
+	// marked with an explicit truncation marker (see `hishtory doctor` for a report of
+	// truncated entries). Set to -1 to disable truncation.
+	MaxCommandLength int `json:"max_command_length" toml:"max_command_length"`
+	// The maximum size of the local DB (in megabytes). When exceeded, the oldest entries are
+	// evicted from the local DB (leaving remote copies intact) to stay under this limit. Set
+	// to 0 to disable eviction.
+	MaxDbSizeMb int64 `json:"max_db_size_mb" toml:"max_db_size_mb"`
+	// The last time that we warned the user about their DB size, used to ensure
+	// that we only warn about this once per week
+	LastDbSizeWarningTimestamp int64 `json:"last_db_size_warning_timestamp" yaml:"-" toml:"last_db_size_warning_timestamp"`
+	// Whether to sync selected config options (e.g. displayed columns and the color
+	// scheme) across devices via an encrypted settings document on the backend
+	EnableConfigSync bool `json:"enable_config_sync" toml:"enable_config_sync"`
+	// Named presets of displayed columns that can be selected for a single invocation
+	// via `hishtory query --columns <name>` or cycled through in the TUI
+	ColumnPresets map[string][]string `json:"column_presets" toml:"column_presets"`
+	// Whether the shell hooks should capture whether each command wrote to stderr (and
+	// approximately how many bytes). Requires restarting your shell to take effect, and
+	// is currently only supported for bash and zsh.
+	EnableOutputCapture bool `json:"enable_output_capture" toml:"enable_output_capture"`
+	// A map from hostname regex to a display alias (e.g. `ip-10-.*` -> `aws-dev`), applied
+	// when displaying and searching entries without rewriting any stored data
+	HostnameAliases map[string]string `json:"hostname_aliases" toml:"hostname_aliases"`
+	// A map from device ID to a human-friendly display name (e.g. `prod-bastion`), shown in the
+	// Device column and matchable via the `device:` search atom. Useful for telling machines
+	// apart when hostnames are reused.
+	DeviceNames map[string]string `json:"device_names" toml:"device_names"`
+	// The retention policy used by `hishtory prune` (e.g. "90d" or "1y"). Empty means entries
+	// are kept forever.
+	RetentionPolicy string `json:"retention_policy" toml:"retention_policy"`
+	// Whether to derive entry IDs from a hash of (command, start time, hostname, cwd) rather than
+	// a random UUID, so that recording the same command twice is deduplicated server-side
+	ContentAddressedEntryIds bool `json:"content_addressed_entry_ids" toml:"content_addressed_entry_ids"`
+	// Whether to record the terminal emulator (TERM_PROGRAM) and TTY that each command ran in.
+	// Off by default since this is mostly useful for debugging which terminal produced entries.
+	EnableTerminalMetadata bool `json:"enable_terminal_metadata" toml:"enable_terminal_metadata"`
+	// Whether to remember the last TUI search state (query, cursor position, and displayed columns)
+	// per terminal session, so that it can be restored via a keybinding after accidentally exiting
+	EnableTuiStateRestore bool `json:"enable_tui_state_restore" toml:"enable_tui_state_restore"`
+	// A list of directory globs (e.g. ~/work/secret-*) where commands are never recorded. A
+	// directory can also opt out of recording by containing a .hishtory-ignore marker file.
+	IgnoredDirectories []string `json:"ignored_directories" toml:"ignored_directories"`
+	// What to do when the secret scanner matches a command (e.g. one containing an AWS key or a
+	// --password= flag): "off" (the default) to record it unchanged, "mask" to replace the matched
+	// substring, "skip" to not record it, or "local-only" to record it without uploading it
+	SecretScanMode string `json:"secret_scan_mode" toml:"secret_scan_mode"`
+	// The shared channels that this device has joined (see `hishtory channel-join`). Entries are
+	// only ever published to a channel explicitly, via `hishtory channel-publish`.
+	SharedChannels []SharedChannelConfig `json:"shared_channels" yaml:"-" toml:"shared_channels"`
+	// The list of shells (one or more of: bash, zsh, fish) for which hishtory yields the
+	// control-r binding to other plugins (e.g. atuin, mcfly, or fzf) instead of binding its own
+	// search TUI. See `hishtory doctor` for detecting which plugins compete for control-r.
+	ControlRYieldShells []string `json:"control_r_yield_shells" toml:"control_r_yield_shells"`
+	// The list of shells (one or more of: bash, zsh, fish) in which presaving of long-running
+	// commands is skipped even when presaving is enabled, to ease debugging the shell
+	// integration one piece at a time
+	PresavingDisabledShells []string `json:"presaving_disabled_shells" toml:"presaving_disabled_shells"`
+	// The list of shells (one or more of: bash, zsh, fish) in which recording of history
+	// entries (including presaving) is disabled entirely, while still leaving the rest of the
+	// integration (e.g. the control-r binding) active
+	RecordingDisabledShells []string `json:"recording_disabled_shells" toml:"recording_disabled_shells"`
+	// The list of environment variable names that pause recording: if any of them is set (to any
+	// value, including an empty string) when a command runs, the command is not recorded. Useful
+	// for e.g. direnv-managed directories where a sensitive context is signalled via the
+	// environment.
+	PauseWhenEnvVars []string `json:"pause_when_env_vars" toml:"pause_when_env_vars"`
+	// The shell command to run when a long-running command recorded on another device finishes
+	// and its entry syncs in (e.g. `notify-send hiSHtory "$HISHTORY_COMMAND finished on
+	// $HISHTORY_HOSTNAME"`). The entry's details are exposed via the HISHTORY_COMMAND,
+	// HISHTORY_HOSTNAME, HISHTORY_RUNTIME, and HISHTORY_EXIT_CODE environment variables.
+	// Notifications are disabled when empty.
+	NotificationCommand string `json:"notification_command" toml:"notification_command"`
+	// The minimum runtime (a duration like "30s" or "5m") that a remote command must exceed for
+	// its completion to trigger the notification-command. Defaults to 1m when empty.
+	NotificationMinRuntime string `json:"notification_min_runtime" toml:"notification_min_runtime"`
+	// The webhook URL that `hishtory share-webhook` (and the matching TUI keybinding) posts the
+	// selected entry to. The payload is a JSON object with a single "text" field, so any
+	// Slack-compatible incoming webhook works. Sharing to a webhook is disabled when empty.
+	WebhookUrl string `json:"webhook_url" toml:"webhook_url"`
+	// The age (in the same format as the retention policy, e.g. "90d" or "2w") after which a
+	// presaved entry that never finalized (e.g. because the shell crashed) is considered
+	// orphaned and cleaned up automatically. Defaults to 7d when empty; set to "none" to
+	// disable the automatic cleanup, in which case orphans are only deleted via
+	// `hishtory prune --presaved`.
+	PresaveOrphanRetention string `json:"presave_orphan_retention" toml:"presave_orphan_retention"`
+}
+
+// SharedChannelConfig describes a "shared channel": a separate keyspace on the backend encrypted
+// with a shared team secret, used for maintaining a curated pool of useful commands alongside
+// personal history
+type SharedChannelConfig struct {
+	// The local name of the channel
+	Name string `json:"name" toml:"name"`
+	// The shared team secret that the channel's keyspace is derived from and encrypted with
+	Secret string `json:"secret" toml:"secret"`
+	// The device ID that this client registered in the channel's keyspace
+	DeviceId string `json:"device_id" toml:"device_id"`
 }
 
 type ColorScheme struct {
@@ -269,16 +454,140 @@ func GetDefaultColorScheme() ColorScheme {
 	}
 }
 
+// The current version of the config file format. Bump this (and add an entry to configMigrations)
+// whenever the config file format changes in a way that requires migrating existing config files.
+const currentConfigVersion = 1
+
+// configMigrations maps a config version to the migration that upgrades a config from that version
+// to the next one. Migrations are applied in order by migrateClientConfig until the config is at
+// currentConfigVersion. Version 0 is the original unversioned format, and upgrading it to version 1
+// requires no changes, so there is no entry for it.
+var configMigrations = map[int]func(*ClientConfig){}
+
+// migrateClientConfig upgrades the given config to currentConfigVersion in memory and returns
+// whether any migrations were applied. The migrated config is persisted on the next SetConfig call.
+func migrateClientConfig(config *ClientConfig) bool {
+	migrated := false
+	for config.ConfigVersion < currentConfigVersion {
+		if migration, ok := configMigrations[config.ConfigVersion]; ok {
+			migration(config)
+		}
+		config.ConfigVersion++
+		migrated = true
+	}
+	return migrated
+}
+
+// readConfig parses the config from disk into the given struct. The TOML config file is
+// authoritative if it exists. Otherwise the legacy JSON config is read and migrated to TOML, so
+// that the migration happens exactly once per install.
+func readConfig(config *ClientConfig) error {
+	homedir, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to retrieve homedir: %w", err)
+	}
+	tomlContents, err := os.ReadFile(path.Join(homedir, data.GetHishtoryPath(), data.CONFIG_TOML_PATH))
+	if err == nil {
+		if err := toml.Unmarshal(tomlContents, config); err != nil {
+			return fmt.Errorf("failed to parse TOML config file: %w", err)
+		}
+		return nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read TOML config file: %w", err)
+	}
+	// There is no TOML config file yet, so read the legacy JSON config
+	jsonContents, err := GetConfigContents()
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(jsonContents, config); err != nil {
+		return fmt.Errorf("failed to parse config file: %w", err)
+	}
+	// One-time migration: persist the parsed config as TOML so that all future reads and writes
+	// use the TOML file. The legacy JSON config is left in place as an extra backup.
+	if err := SetConfig(config); err != nil {
+		return fmt.Errorf("failed to migrate the config file to TOML: %w", err)
+	}
+	return nil
+}
+
+var (
+	// An in-process cache of the parsed config, invalidated via the config file's mtime, so that
+	// hot paths (e.g. per-keystroke queries in the TUI) don't re-read and re-parse the config file
+	cachedConfig      *ClientConfig
+	cachedConfigMtime time.Time
+	configCacheMutex  sync.RWMutex
+)
+
+// getConfigMtime returns the mtime of the TOML config file, or the zero time if it can't be
+// statted (in which case the config cache is bypassed)
+func getConfigMtime() time.Time {
+	homedir, err := os.UserHomeDir()
+	if err != nil {
+		return time.Time{}
+	}
+	stat, err := os.Stat(path.Join(homedir, data.GetHishtoryPath(), data.CONFIG_TOML_PATH))
+	if err != nil {
+		return time.Time{}
+	}
+	return stat.ModTime()
+}
+
+// GetConfig returns a read-only snapshot of the config: a value copy that is safe to read without
+// locking and whose scalar fields can be freely mutated before passing it to SetConfig. Parsed
+// configs are cached in-process and invalidated when the config file's mtime changes.
 func GetConfig() (ClientConfig, error) {
-	data, err := GetConfigContents()
+	mtime := getConfigMtime()
+	if !mtime.IsZero() {
+		configCacheMutex.RLock()
+		if cachedConfig != nil && mtime.Equal(cachedConfigMtime) {
+			config := *cachedConfig
+			configCacheMutex.RUnlock()
+			return config, nil
+		}
+		configCacheMutex.RUnlock()
+	}
+	config, err := getConfigNoCache()
 	if err != nil {
-		return ClientConfig{}, err
+		return config, err
+	}
+	if !mtime.IsZero() {
+		configCacheMutex.Lock()
+		cachedConfigCopy := config
+		cachedConfig = &cachedConfigCopy
+		cachedConfigMtime = mtime
+		configCacheMutex.Unlock()
 	}
+	return config, nil
+}
+
+func getConfigNoCache() (ClientConfig, error) {
 	var config ClientConfig
-	err = json.Unmarshal(data, &config)
+	err := readConfig(&config)
 	if err != nil {
-		return ClientConfig{}, fmt.Errorf("failed to parse config file: %w", err)
+		// The config file is missing or corrupted (e.g. truncated by a crash mid-write), so try to
+		// recover from the .bak copy that SetConfig maintains
+		restoredConfig, restoreErr := restoreConfigFromBackup()
+		if restoreErr != nil {
+			return ClientConfig{}, err
+		}
+		// Note that we can't use GetLogger() here since GetLogger() calls GetConfig()
+		fmt.Fprintf(os.Stderr, "Warning: Restored hishtory config from backup after failing to read it: %v\n", err)
+		config = restoredConfig
+	}
+	migrateClientConfig(&config)
+	applyConfigDefaults(&config)
+	// Apply any admin-managed policy last, so that policy-enforced settings always win over the
+	// user's config
+	if err := applyClientPolicy(&config); err != nil {
+		return ClientConfig{}, err
 	}
+	return config, nil
+}
+
+// applyConfigDefaults fills in the default values for any config settings that aren't set
+func applyConfigDefaults(config *ClientConfig) {
 	config.KeyBindings = config.KeyBindings.WithDefaults()
 	if len(config.DisplayedColumns) == 0 {
 		config.DisplayedColumns = []string{"Hostname", "CWD", "Timestamp", "Runtime", "Exit Code", "Command"}
@@ -298,20 +607,122 @@ func GetConfig() (ClientConfig, error) {
 	if config.AiCompletionEndpoint == "" {
 		config.AiCompletionEndpoint = "https://api.openai.com/v1/chat/completions"
 	}
+	if config.AiCompletionBackend == "" {
+		config.AiCompletionBackend = "openai"
+	}
 	if config.LogLevel == logrus.Level(0) {
 		config.LogLevel = logrus.InfoLevel
 	}
 	if len(config.DefaultSearchColumns) == 0 {
 		config.DefaultSearchColumns = []string{"command", "hostname", "current_working_directory"}
 	}
-	return config, nil
+	if config.DbSizeWarningThresholdMb == 0 {
+		config.DbSizeWarningThresholdMb = 500
+	}
+	if config.DbCountWarningThreshold == 0 {
+		config.DbCountWarningThreshold = 1_000_000
+	}
+	if config.MaxCommandLength == 0 {
+		config.MaxCommandLength = 512_000
+	}
+}
+
+// restoreConfigFromBackup reads and parses the .bak copy of the config file that SetConfig
+// maintains, for recovering from a missing or corrupted config file. It falls back to the legacy
+// JSON config (and its backup) for installs that predate the TOML config format.
+func restoreConfigFromBackup() (ClientConfig, error) {
+	homedir, err := os.UserHomeDir()
+	if err != nil {
+		return ClientConfig{}, fmt.Errorf("failed to retrieve homedir: %w", err)
+	}
+	var config ClientConfig
+	tomlBackupPath := path.Join(homedir, data.GetHishtoryPath(), data.CONFIG_TOML_PATH) + ".bak"
+	if contents, err := os.ReadFile(tomlBackupPath); err == nil {
+		if err := toml.Unmarshal(contents, &config); err == nil {
+			return config, nil
+		}
+	}
+	legacyJsonPath := path.Join(homedir, data.GetHishtoryPath(), data.CONFIG_PATH)
+	for _, backupPath := range []string{legacyJsonPath, legacyJsonPath + ".bak"} {
+		if contents, err := os.ReadFile(backupPath); err == nil {
+			if err := json.Unmarshal(contents, &config); err == nil {
+				return config, nil
+			}
+		}
+	}
+	return ClientConfig{}, fmt.Errorf("failed to restore the config from any backup")
+}
+
+// writeFileAndSync writes the given contents to the given path and fsyncs the file before closing
+// it, so that a crash or power loss right after the write can't leave a truncated file behind
+func writeFileAndSync(path string, contents []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(contents); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// acquireConfigLock takes an exclusive lock for writing the config file, so that two concurrent
+// hishtory processes can't interleave their writes. It is implemented via a lock file rather than
+// flock(2) since flock isn't portable. Returns a function that releases the lock.
+func acquireConfigLock(configPath string) (func(), error) {
+	lockPath := configPath + ".lock"
+	for i := 0; i < 500; i++ {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			f.Close()
+			return func() { _ = os.Remove(lockPath) }, nil
+		}
+		if stat, statErr := os.Stat(lockPath); statErr == nil && time.Since(stat.ModTime()) > 10*time.Second {
+			// The lock was left behind by a process that crashed while holding it, so steal it
+			_ = os.Remove(lockPath)
+			continue
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil, fmt.Errorf("failed to acquire the config file lock at %s", lockPath)
+}
+
+// The comment header written at the top of the TOML config file, since TOML (unlike JSON)
+// supports comments and is thus practical to hand-edit
+const configTomlHeader = `# hiSHtory configuration file.
+#
+# This file can be hand-edited while no hishtory commands are running, though most settings are
+# more conveniently changed via ` + "`hishtory config-set`" + ` (run ` + "`hishtory config-set --help`" + ` for the
+# list of available options). Note that hishtory rewrites this file whenever the config changes,
+# so custom comments will not be preserved.
+`
+
+// isValidTomlConfig returns whether the given bytes parse as a TOML config, for deciding whether
+// the current config file is worth preserving as a backup
+func isValidTomlConfig(contents []byte) bool {
+	var scratch ClientConfig
+	return toml.Unmarshal(contents, &scratch) == nil
 }
 
 func SetConfig(config *ClientConfig) error {
-	serializedConfig, err := json.Marshal(config)
+	config.ConfigVersion = currentConfigVersion
+	// Serialize a copy with any policy-enforced values stripped, so that the policy isn't baked
+	// into the user's config file. The caller's copy keeps the policy applied, since it may
+	// still be used for in-memory enforcement.
+	persistedConfig := *config
+	if err := stripClientPolicy(&persistedConfig); err != nil {
+		return err
+	}
+	serializedConfig, err := toml.Marshal(persistedConfig)
 	if err != nil {
 		return fmt.Errorf("failed to serialize config: %w", err)
 	}
+	serializedConfig = append([]byte(configTomlHeader+"\n"), serializedConfig...)
 	homedir, err := os.UserHomeDir()
 	if err != nil {
 		return fmt.Errorf("failed to retrieve homedir: %w", err)
@@ -320,9 +731,21 @@ func SetConfig(config *ClientConfig) error {
 	if err != nil {
 		return err
 	}
-	configPath := path.Join(homedir, data.GetHishtoryPath(), data.CONFIG_PATH)
+	configPath := path.Join(homedir, data.GetHishtoryPath(), data.CONFIG_TOML_PATH)
+	releaseLock, err := acquireConfigLock(configPath)
+	if err != nil {
+		return err
+	}
+	defer releaseLock()
+	// Preserve the current config as a .bak copy (if it is valid) so that GetConfig can
+	// recover from a config file that got truncated or corrupted
+	if currentContents, err := os.ReadFile(configPath); err == nil && isValidTomlConfig(currentContents) {
+		if err := writeFileAndSync(configPath+".bak", currentContents); err != nil {
+			return fmt.Errorf("failed to write config backup file: %w", err)
+		}
+	}
 	stagedConfigPath := configPath + ".tmp-" + uuid.Must(uuid.NewRandom()).String()
-	err = os.WriteFile(stagedConfigPath, serializedConfig, 0o644)
+	err = writeFileAndSync(stagedConfigPath, serializedConfig)
 	if err != nil {
 		return fmt.Errorf("failed to write config: %w", err)
 	}
@@ -330,6 +753,10 @@ func SetConfig(config *ClientConfig) error {
 	if err != nil {
 		return fmt.Errorf("failed to replace config file with the updated version: %w", err)
 	}
+	// Invalidate the config cache so that the next GetConfig re-reads the file we just wrote
+	configCacheMutex.Lock()
+	cachedConfig = nil
+	configCacheMutex.Unlock()
 	return nil
 }
 
@@ -338,7 +765,11 @@ func InitConfig() error {
 	if err != nil {
 		return err
 	}
-	_, err = os.Stat(path.Join(homedir, data.GetHishtoryPath(), data.CONFIG_PATH))
+	_, err = os.Stat(path.Join(homedir, data.GetHishtoryPath(), data.CONFIG_TOML_PATH))
+	if errors.Is(err, os.ErrNotExist) {
+		// Also check for a legacy JSON config, which readConfig will migrate to TOML on first read
+		_, err = os.Stat(path.Join(homedir, data.GetHishtoryPath(), data.CONFIG_PATH))
+	}
 	if errors.Is(err, os.ErrNotExist) {
 		return SetConfig(&ClientConfig{})
 	}
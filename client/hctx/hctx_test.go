@@ -0,0 +1,101 @@
+package hctx
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ddworken/hishtory/client/data"
+	"github.com/ddworken/hishtory/shared/testutils"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	// Set env variable
+	defer testutils.BackupAndRestoreEnv("HISHTORY_TEST")()
+	os.Setenv("HISHTORY_TEST", "1")
+	m.Run()
+}
+
+// fillWithTestValues recursively sets every exported field of the given value to a deterministic
+// non-zero value, so that round-trip tests cover every config field (including ones added later)
+// without having to enumerate them by hand
+func fillWithTestValues(v reflect.Value, counter *int) {
+	if v.Type() == reflect.TypeOf(time.Time{}) {
+		v.Set(reflect.ValueOf(time.Date(2023, 4, 5, 6, 7, 8, 0, time.UTC)))
+		return
+	}
+	switch v.Kind() {
+	case reflect.String:
+		*counter++
+		v.SetString(fmt.Sprintf("test-value-%d", *counter))
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		*counter++
+		v.SetInt(int64(*counter))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		*counter++
+		v.SetUint(uint64(*counter))
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+		fillWithTestValues(v.Index(0), counter)
+	case reflect.Map:
+		v.Set(reflect.MakeMap(v.Type()))
+		key := reflect.New(v.Type().Key()).Elem()
+		fillWithTestValues(key, counter)
+		value := reflect.New(v.Type().Elem()).Elem()
+		fillWithTestValues(value, counter)
+		v.SetMapIndex(key, value)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				fillWithTestValues(v.Field(i), counter)
+			}
+		}
+	case reflect.Ptr:
+		v.Set(reflect.New(v.Type().Elem()))
+		fillWithTestValues(v.Elem(), counter)
+	}
+}
+
+func TestJsonConfigMigration(t *testing.T) {
+	defer testutils.BackupAndRestore(t)()
+
+	// Build a config with every field set to a non-zero value, so that any field that the
+	// JSON→TOML migration drops or mangles fails the comparison below
+	var config ClientConfig
+	counter := 0
+	fillWithTestValues(reflect.ValueOf(&config).Elem(), &counter)
+	// The fields that the migration itself is expected to rewrite
+	config.ConfigVersion = currentConfigVersion
+	config.LogLevel = logrus.WarnLevel
+
+	// Write it as a legacy JSON config, with no TOML config present
+	homedir, err := os.UserHomeDir()
+	require.NoError(t, err)
+	require.NoError(t, MakeHishtoryDir())
+	serialized, err := json.Marshal(config)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path.Join(homedir, data.GetHishtoryPath(), data.CONFIG_PATH), serialized, 0o644))
+	tomlPath := path.Join(homedir, data.GetHishtoryPath(), data.CONFIG_TOML_PATH)
+	require.NoError(t, os.RemoveAll(tomlPath))
+
+	// Loading the config reads the legacy JSON config and migrates it to TOML
+	loadedConfig, err := GetConfig()
+	require.NoError(t, err)
+	require.Equal(t, config, loadedConfig)
+	_, err = os.Stat(tomlPath)
+	require.NoError(t, err, "expected the migration to have created a TOML config file")
+
+	// Reloading now reads the migrated TOML config, which must also preserve every field
+	reloadedConfig, err := GetConfig()
+	require.NoError(t, err)
+	require.Equal(t, config, reloadedConfig)
+}
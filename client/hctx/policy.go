@@ -0,0 +1,131 @@
+package hctx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+
+	"github.com/ddworken/hishtory/client/data"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// DefaultPolicyPath is where admin-managed policy files live. Since it is outside the user's home
+// directory, writing it requires root, so users can't simply edit it to lift the policy.
+const DefaultPolicyPath = "/etc/hishtory/policy.toml"
+
+// ClientPolicy is an admin-managed policy (read from /etc/hishtory/policy.toml) that enforces
+// settings org-wide. Policy settings are applied on every config load, after the user's own
+// config file is read, so user-level config (including `hishtory config-set`) cannot override
+// them.
+type ClientPolicy struct {
+	// Force offline mode, disabling all syncing regardless of the user's config
+	ForceOfflineMode bool `toml:"force_offline_mode"`
+	// Disable AI completion and explanations regardless of the user's config
+	DisableAiCompletion bool `toml:"disable_ai_completion"`
+	// Directory globs where commands are never recorded, enforced in addition to the user's own
+	// ignored_directories
+	MandatoryIgnoredDirectories []string `toml:"mandatory_ignored_directories"`
+	// If non-empty, forces the secret scan mode to one of: off, mask, skip, local-only
+	ForceSecretScanMode string `toml:"force_secret_scan_mode"`
+}
+
+// getPolicyPath returns the path to the policy file. Overridable via HISHTORY_POLICY_PATH for
+// tests, since they can't write to /etc/.
+func getPolicyPath() string {
+	if policyPath := os.Getenv("HISHTORY_POLICY_PATH"); policyPath != "" {
+		return policyPath
+	}
+	return DefaultPolicyPath
+}
+
+// readClientPolicy reads and parses the policy file. Most machines have no policy file, which is
+// not an error and yields the zero policy that enforces nothing. A policy file that exists but
+// can't be read or parsed is an error, so that a compliance-mandated policy never gets silently
+// skipped.
+func readClientPolicy() (ClientPolicy, error) {
+	var policy ClientPolicy
+	contents, err := os.ReadFile(getPolicyPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return policy, nil
+	}
+	if err != nil {
+		return policy, fmt.Errorf("failed to read the policy file %s: %w", getPolicyPath(), err)
+	}
+	if err := toml.Unmarshal(contents, &policy); err != nil {
+		return policy, fmt.Errorf("failed to parse the policy file %s: %w", getPolicyPath(), err)
+	}
+	if policy.ForceSecretScanMode != "" && !slices.Contains([]string{"off", "mask", "skip", "local-only"}, policy.ForceSecretScanMode) {
+		return policy, fmt.Errorf("the policy file %s has an invalid force_secret_scan_mode %#v, must be one of: off, mask, skip, local-only", getPolicyPath(), policy.ForceSecretScanMode)
+	}
+	return policy, nil
+}
+
+// applyClientPolicy overrides the given config with any settings enforced by the admin-managed
+// policy file
+func applyClientPolicy(config *ClientConfig) error {
+	policy, err := readClientPolicy()
+	if err != nil {
+		return err
+	}
+	if policy.ForceOfflineMode {
+		config.IsOffline = true
+	}
+	if policy.DisableAiCompletion {
+		config.AiCompletion = false
+	}
+	if policy.ForceSecretScanMode != "" {
+		config.SecretScanMode = policy.ForceSecretScanMode
+	}
+	for _, dir := range policy.MandatoryIgnoredDirectories {
+		if !slices.Contains(config.IgnoredDirectories, dir) {
+			config.IgnoredDirectories = append(config.IgnoredDirectories, dir)
+		}
+	}
+	return nil
+}
+
+// stripClientPolicy reverts any policy-enforced values in the given config back to the user's own
+// on-disk settings. SetConfig calls this before serializing, so that policy-derived values (which
+// applyClientPolicy merges into every loaded config) never get baked into the user's config file,
+// where they would outlive the policy file itself.
+func stripClientPolicy(config *ClientConfig) error {
+	policy, err := readClientPolicy()
+	if err != nil {
+		return err
+	}
+	if !policy.ForceOfflineMode && !policy.DisableAiCompletion && policy.ForceSecretScanMode == "" && len(policy.MandatoryIgnoredDirectories) == 0 {
+		return nil
+	}
+	// Read the on-disk config directly rather than via readConfig, since readConfig recurses
+	// into SetConfig when migrating a legacy JSON config. If there is no config on disk yet (or
+	// it doesn't parse), the zero config is the right fallback: the user never set these values.
+	var onDiskConfig ClientConfig
+	homedir, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to retrieve homedir: %w", err)
+	}
+	if contents, err := os.ReadFile(path.Join(homedir, data.GetHishtoryPath(), data.CONFIG_TOML_PATH)); err == nil {
+		_ = toml.Unmarshal(contents, &onDiskConfig)
+	} else if contents, err := os.ReadFile(path.Join(homedir, data.GetHishtoryPath(), data.CONFIG_PATH)); err == nil {
+		_ = json.Unmarshal(contents, &onDiskConfig)
+	}
+	if policy.ForceOfflineMode {
+		config.IsOffline = onDiskConfig.IsOffline
+	}
+	if policy.DisableAiCompletion {
+		config.AiCompletion = onDiskConfig.AiCompletion
+	}
+	if policy.ForceSecretScanMode != "" {
+		config.SecretScanMode = onDiskConfig.SecretScanMode
+	}
+	if len(policy.MandatoryIgnoredDirectories) > 0 {
+		config.IgnoredDirectories = slices.DeleteFunc(slices.Clone(config.IgnoredDirectories), func(dir string) bool {
+			return slices.Contains(policy.MandatoryIgnoredDirectories, dir) && !slices.Contains(onDiskConfig.IgnoredDirectories, dir)
+		})
+	}
+	return nil
+}
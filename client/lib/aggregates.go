@@ -0,0 +1,67 @@
+package lib
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ddworken/hishtory/client/data"
+	"github.com/ddworken/hishtory/client/hctx"
+
+	"gorm.io/gorm"
+)
+
+// dayAggregateDimensions returns the per-entry dimensions that are rolled up into the
+// day_aggregates table, mapped to the history_entries column they're derived from
+var dayAggregateDimensions = map[string]string{
+	"command":  "command",
+	"cwd":      "current_working_directory",
+	"hostname": "hostname",
+}
+
+// IncrementDayAggregates updates the materialized per-day aggregates table for the given newly
+// inserted entry. Presaved entries are skipped, since they get deleted and replaced by a regular
+// entry once the command finishes. Errors are logged rather than returned, since a failure to
+// update the aggregates (which can be rebuilt at any time via `hishtory stats rebuild`) shouldn't
+// block saving the entry itself.
+func IncrementDayAggregates(db *gorm.DB, entry data.HistoryEntry) {
+	if entry.EndTime.Equal(time.Unix(0, 0).UTC()) {
+		return
+	}
+	for dimension, column := range dayAggregateDimensions {
+		var value string
+		switch column {
+		case "command":
+			value = entry.Command
+		case "current_working_directory":
+			value = entry.CurrentWorkingDirectory
+		case "hostname":
+			value = entry.Hostname
+		}
+		res := db.Exec(`INSERT INTO day_aggregates (day, dimension, value, count) VALUES (date(?), ?, ?, 1) `+
+			`ON CONFLICT(day, dimension, value) DO UPDATE SET count = count + 1`,
+			entry.StartTime, dimension, value)
+		if res.Error != nil {
+			hctx.GetLogger().Warnf("failed to update day aggregates for dimension=%s: %v", dimension, res.Error)
+		}
+	}
+}
+
+// RebuildDayAggregates rebuilds the materialized per-day aggregates table from scratch, for
+// backfilling after an import and for correcting any drift from deleted entries (the incremental
+// updates in IncrementDayAggregates only handle inserts)
+func RebuildDayAggregates(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM day_aggregates").Error; err != nil {
+			return fmt.Errorf("failed to clear the day aggregates table: %w", err)
+		}
+		for dimension, column := range dayAggregateDimensions {
+			res := tx.Exec(fmt.Sprintf("INSERT INTO day_aggregates (day, dimension, value, count) "+
+				"SELECT date(start_time), '%s', %s, COUNT(*) FROM history_entries WHERE end_time != ? GROUP BY 1, 3", dimension, column),
+				time.Unix(0, 0).UTC())
+			if res.Error != nil {
+				return fmt.Errorf("failed to rebuild day aggregates for dimension=%s: %w", dimension, res.Error)
+			}
+		}
+		return nil
+	})
+}
@@ -1,8 +1,26 @@
+# Include guard. If this file gets sourced twice, the setup below would run twice (the event
+# handler functions themselves would be replaced rather than duplicated, but e.g. the color
+# support detection would still re-run).
+if set -q _hishtory_fish_config_sourced
+    return
+end
+set --global _hishtory_fish_config_sourced true
+
 # For detecting color rendering support for this terminal, see #134
 hishtory getColorSupport
 export _hishtory_tui_color=$status
 
-function _hishtory_post_exec --on-event fish_preexec 
+# Note: The optional output capture supported by the bash and zsh hooks (enable-output-capture)
+# isn't implemented here, since fish has no equivalent of `exec 2> ...` for persistently
+# redirecting the shell's stderr
+
+# Export a per-shell-session ID so that history entries can be grouped by terminal session
+# (searchable via `session:current`). Subshells inherit their parent's session ID.
+if [ -z "$HISHTORY_SESSION_ID" ]
+    set -x HISHTORY_SESSION_ID (cat /proc/sys/kernel/random/uuid 2>/dev/null; or uuidgen 2>/dev/null; or echo (date +%s)-(random))
+end
+
+function _hishtory_post_exec --on-event fish_preexec
     # Runs after <ENTER>, but before the command is executed
     set --global _hishtory_command $argv
     set --global _hishtory_start_time (hishtory getTimestamp)
@@ -38,6 +56,16 @@ function __hishtory_on_control_r
 	rm -f $tmp
 end
 
-[ (hishtory config-get enable-control-r) = true ] && bind \cr __hishtory_on_control_r
+function __hishtory_bind_control_r
+	bind \cr __hishtory_on_control_r
+	# Also bind explicitly in the vi-mode keymaps (see fish_vi_key_bindings), since the bare bind
+	# above only applies to the emacs-style default bindings. Harmless when vi-mode isn't enabled.
+	bind -M insert \cr __hishtory_on_control_r
+	bind -M default \cr __hishtory_on_control_r
+end
+
+# The binding is skipped if the user configured hishtory to yield control-r to another plugin in
+# fish (see `hishtory config-add control-r-yield-shells fish` and `hishtory doctor`)
+[ (hishtory config-get enable-control-r) = true ] && ! hishtory config-get control-r-yield-shells | grep -qw fish && __hishtory_bind_control_r
 
 hishtory completion fish | source
\ No newline at end of file
@@ -2,13 +2,42 @@
 
 # Include guard. This file is sourced in multiple places, but we want it to only execute once. 
 # This trick is from https://stackoverflow.com/questions/7518584/is-there-any-mechanism-in-shell-script-alike-include-guard-in-c
-if [ -n "$__hishtory_bash_config_sourced" ]; then return; fi
+if [ -n "${__hishtory_bash_config_sourced:-}" ]; then return; fi
 __hishtory_bash_config_sourced=true
 
 # For detecting color rendering support for this terminal, see #134
 hishtory getColorSupport
 export _hishtory_tui_color=$?
 
+# Stock macOS still ships bash 3.2, so feature-detect rather than assuming bash 4+ and fall back
+# where possible (see __hishtory_bind_control_r) instead of silently degrading
+__hishtory_bash_major_version=${BASH_VERSINFO[0]:-3}
+
+# Optionally capture whether commands write to stderr (and approximately how many bytes) by
+# teeing the shell's stderr through a temp file. Opt-in via `hishtory config-set enable-output-capture true`.
+if [ "$(hishtory config-get enable-output-capture)" = true ]; then
+  __hishtory_stderr_file=$(mktemp)
+  exec 2> >(tee -a "$__hishtory_stderr_file" >&2)
+  # Delete the capture file when the shell exits, chaining any EXIT trap that the user's
+  # dotfiles already installed (the same extraction trick as for the DEBUG trap below)
+  __hishtory_existing_exit_trap="$(trap -p EXIT)"
+  if [ -n "$__hishtory_existing_exit_trap" ]; then
+    __hishtory_existing_exit_trap=${__hishtory_existing_exit_trap#trap -- \'}
+    __hishtory_existing_exit_trap=${__hishtory_existing_exit_trap%\' EXIT}
+    __hishtory_existing_exit_trap=${__hishtory_existing_exit_trap//\'\\\'\'/\'}
+    trap "$__hishtory_existing_exit_trap; rm -f \"\$__hishtory_stderr_file\"" EXIT
+  else
+    trap 'rm -f "$__hishtory_stderr_file"' EXIT
+  fi
+  unset __hishtory_existing_exit_trap
+fi
+
+# Export a per-shell-session ID so that history entries can be grouped by terminal session
+# (searchable via `session:current`). Subshells inherit their parent's session ID.
+if [ -z "${HISHTORY_SESSION_ID:-}" ]; then
+  export HISHTORY_SESSION_ID=$(cat /proc/sys/kernel/random/uuid 2>/dev/null || uuidgen 2>/dev/null || echo "$(date +%s)-$$-$RANDOM")
+fi
+
 # Implementation of running before/after every command based on https://jichu4n.com/posts/debug-trap-and-prompt_command-in-bash/
 function __hishtory_precommand() {
   if [ -z "${HISHTORY_AT_PROMPT:-}" ]; then
@@ -18,6 +47,9 @@ function __hishtory_precommand() {
 
   # Run before every command
   HISHTORY_START_TIME=`hishtory getTimestamp`
+  if [ -n "${__hishtory_stderr_file:-}" ]; then
+    __hishtory_stderr_offset=$(wc -c < "$__hishtory_stderr_file")
+  fi
   CMD=`history 1`
   if ! [ -z "CMD " ] ; then
     # This code with $LAST_PRESAVED_COMMAND and $LAST_SAVED_COMMAND is necessary to work around a quirk of
@@ -30,14 +62,28 @@ function __hishtory_precommand() {
     # command twice in a row, we won't pre-save the second entry. But this seems reasonably unlikely
     # such that it is worth accepting this issue to mitigate the duplicate entries observed in
     # https://github.com/ddworken/hishtory/issues/215.
-    if [[ "$CMD" != "$LAST_PRESAVED_COMMAND" ]] &&  [[ "$CMD" != "$LAST_SAVED_COMMAND" ]]; then 
+    if [[ "$CMD" != "${LAST_PRESAVED_COMMAND:-}" ]] &&  [[ "$CMD" != "${LAST_SAVED_COMMAND:-}" ]]; then
       (hishtory presaveHistoryEntry bash "$CMD" $HISHTORY_START_TIME &) 2>&1 >/dev/null # Background Run
       # hishtory presaveHistoryEntry bash "$CMD" $HISHTORY_START_TIME 2>&1 >/dev/null # Foreground Run
     fi 
   fi
   LAST_PRESAVED_COMMAND=$CMD
 }
-trap "__hishtory_precommand" DEBUG
+
+# Install the DEBUG trap without clobbering any trap that the user's dotfiles (e.g. bash-it)
+# already installed: extract the existing trap body from `trap -p` and chain it before ours, the
+# same way bash-preexec does. The existing trap runs first so that it observes the original $?.
+__hishtory_existing_debug_trap="$(trap -p DEBUG)"
+if [ -n "$__hishtory_existing_debug_trap" ]; then
+  # `trap -p` prints `trap -- '<body>' DEBUG` with embedded single quotes escaped as '\''
+  __hishtory_existing_debug_trap=${__hishtory_existing_debug_trap#trap -- \'}
+  __hishtory_existing_debug_trap=${__hishtory_existing_debug_trap%\' DEBUG}
+  __hishtory_existing_debug_trap=${__hishtory_existing_debug_trap//\'\\\'\'/\'}
+  trap "$__hishtory_existing_debug_trap; __hishtory_precommand" DEBUG
+else
+  trap "__hishtory_precommand" DEBUG
+fi
+unset __hishtory_existing_debug_trap
 
 HISHTORY_FIRST_PROMPT=1
 function __hishtory_postcommand() {
@@ -51,7 +97,20 @@ function __hishtory_postcommand() {
 
   # Run after every prompt
   CMD=`history 1`
-  (hishtory saveHistoryEntry bash $EXIT_CODE "$CMD" $HISHTORY_START_TIME &) 2>&1 >/dev/null # Background Run
+  if [ -n "${__hishtory_stderr_file:-}" ]; then
+    # Note that this is approximate, since tee flushes asynchronously and the shell itself may
+    # also write to stderr in between commands
+    __hishtory_output_size=$(( $(wc -c < "$__hishtory_stderr_file") - ${__hishtory_stderr_offset:-0} ))
+    __hishtory_had_stderr=0
+    # Written as an if-statement rather than `[ ... ] && ...` so that it composes with `set -e`
+    if [ "$__hishtory_output_size" -gt 0 ]; then __hishtory_had_stderr=1; fi
+    # Truncate the capture file so that it doesn't grow for the lifetime of the shell. tee
+    # opened it with O_APPEND, so it keeps writing at the (new) end of the file.
+    : > "$__hishtory_stderr_file"
+    (hishtory saveHistoryEntry bash $EXIT_CODE "$CMD" $HISHTORY_START_TIME $__hishtory_had_stderr $__hishtory_output_size &) 2>&1 >/dev/null # Background Run
+  else
+    (hishtory saveHistoryEntry bash $EXIT_CODE "$CMD" $HISHTORY_START_TIME &) 2>&1 >/dev/null # Background Run
+  fi
   # hishtory saveHistoryEntry bash $EXIT_CODE "$CMD" $HISHTORY_START_TIME 2>&1 >/dev/null # Foreground Run
 
   LAST_SAVED_COMMAND=$CMD
@@ -60,8 +119,9 @@ function __hishtory_postcommand() {
 
   return $EXIT_CODE
 }
-PROMPT_COMMAND="__hishtory_postcommand; $PROMPT_COMMAND"
-export HISTTIMEFORMAT=$HISTTIMEFORMAT
+# Note the :- fallbacks so that sourcing this works under `set -u`
+PROMPT_COMMAND="__hishtory_postcommand; ${PROMPT_COMMAND:-}"
+export HISTTIMEFORMAT=${HISTTIMEFORMAT:-}
 
 __history_control_r() {
 	READLINE_LINE=$(HISHTORY_TERM_INTEGRATION=1 HISHTORY_SHELL_NAME=bash hishtory tquery "$READLINE_LINE")
@@ -69,7 +129,28 @@ __history_control_r() {
 }
 
 __hishtory_bind_control_r() {
-  bind -x '"\C-r": __history_control_r'
+  if [ "$__hishtory_bash_major_version" -ge 4 ]; then
+    bind -x '"\C-r": __history_control_r'
+  else
+    # bash 3.2 (the stock macOS bash) supports bind -x, but not the READLINE_LINE/READLINE_POINT
+    # variables that __history_control_r uses to replace the current line (they were added in bash
+    # 4.0). So instead emulate it with a readline macro that replaces the line with the tquery
+    # selection via command substitution (the same approach that fzf uses for old bashes). Note
+    # that unlike the bash 4+ path, this fallback doesn't pass the partially typed line to tquery
+    # as the initial query.
+    bind '"\C-r": "\C-e\C-u`HISHTORY_TERM_INTEGRATION=1 HISHTORY_SHELL_NAME=bash hishtory tquery`\e\C-e\er"'
+  fi
 }
 
-[ "$(hishtory config-get enable-control-r)" = true ] && __hishtory_bind_control_r
+# Written as an if-statement rather than `[ ... ] && ...` so that sourcing this file doesn't
+# return non-zero (and thus trip `set -e` or ERR traps) when control-r is disabled. The binding is
+# also skipped if the user configured hishtory to yield control-r to another plugin in bash (see
+# `hishtory config-add control-r-yield-shells bash` and `hishtory doctor`).
+if [ "$(hishtory config-get enable-control-r)" = true ] && ! hishtory config-get control-r-yield-shells | grep -qw bash; then __hishtory_bind_control_r; fi
+
+# Wire up tab completions for the hishtory CLI itself. The generated completion script depends on
+# helpers from the bash-completion package (preinstalled on most Linux distros, `brew install
+# bash-completion` on macOS), so only source it when those are available.
+if type _get_comp_words_by_ref &>/dev/null; then
+  source <(hishtory completion bash)
+fi
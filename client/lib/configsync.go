@@ -0,0 +1,99 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ddworken/hishtory/client/data"
+	"github.com/ddworken/hishtory/client/hctx"
+	"github.com/ddworken/hishtory/shared"
+)
+
+// The subset of config options that are synced across devices when config syncing is enabled.
+// Note that we deliberately only sync UX-related options here, since most other config options
+// (e.g. the device ID or sync state) are inherently device-specific.
+type SyncedConfig struct {
+	DisplayedColumns []string                      `json:"displayed_columns"`
+	CustomColumns    []hctx.CustomColumnDefinition `json:"custom_columns"`
+	ColorScheme      hctx.ColorScheme              `json:"color_scheme"`
+	DefaultFilter    string                        `json:"default_filter"`
+}
+
+// Upload the synced subset of this device's config to the backend as an encrypted settings
+// document, so that other devices can retrieve it
+func UploadSyncedConfig(ctx context.Context) error {
+	config := hctx.GetConf(ctx)
+	if config.IsOffline {
+		return fmt.Errorf("cannot sync config because this device is offline")
+	}
+	syncedConfig := SyncedConfig{
+		DisplayedColumns: config.DisplayedColumns,
+		CustomColumns:    config.CustomColumns,
+		ColorScheme:      config.ColorScheme,
+		DefaultFilter:    config.DefaultFilter,
+	}
+	serialized, err := json.Marshal(syncedConfig)
+	if err != nil {
+		return fmt.Errorf("failed to serialize config for syncing: %w", err)
+	}
+	userId := data.UserId(config.UserSecret)
+	ciphertext, nonce, err := data.Encrypt(config.UserSecret, serialized, []byte(userId))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt config for syncing: %w", err)
+	}
+	encSettings := shared.EncSettings{
+		UserId:        userId,
+		EncryptedData: ciphertext,
+		Nonce:         nonce,
+		Date:          time.Now(),
+	}
+	reqBody, err := json.Marshal(encSettings)
+	if err != nil {
+		return fmt.Errorf("failed to marshal encrypted settings: %w", err)
+	}
+	_, err = ApiPost(ctx, "/api/v1/set-settings", "application/json", reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to upload synced config to the backend: %w", err)
+	}
+	return nil
+}
+
+// Download the encrypted settings document from the backend (if one exists) and apply the synced
+// config options to this device's config. Returns whether a synced config was found and applied.
+func DownloadSyncedConfig(ctx context.Context) (bool, error) {
+	config := hctx.GetConf(ctx)
+	if config.IsOffline {
+		return false, fmt.Errorf("cannot sync config because this device is offline")
+	}
+	userId := data.UserId(config.UserSecret)
+	respBody, err := ApiGet(ctx, "/api/v1/get-settings?user_id="+userId)
+	if err != nil {
+		if strings.Contains(err.Error(), "status_code=404") {
+			// No synced config has been uploaded yet, so there is nothing to apply
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to download synced config from the backend: %w", err)
+	}
+	var encSettings shared.EncSettings
+	err = UnmarshalServerResponse(respBody, &encSettings)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse synced config from the backend: %w", err)
+	}
+	plaintext, err := data.Decrypt(config.UserSecret, encSettings.EncryptedData, []byte(userId), encSettings.Nonce)
+	if err != nil {
+		return false, fmt.Errorf("failed to decrypt synced config: %w", err)
+	}
+	var syncedConfig SyncedConfig
+	err = json.Unmarshal(plaintext, &syncedConfig)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse decrypted synced config: %w", err)
+	}
+	config.DisplayedColumns = syncedConfig.DisplayedColumns
+	config.CustomColumns = syncedConfig.CustomColumns
+	config.ColorScheme = syncedConfig.ColorScheme
+	config.DefaultFilter = syncedConfig.DefaultFilter
+	return true, hctx.SetConfig(config)
+}
@@ -0,0 +1,80 @@
+package lib
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/ddworken/hishtory/client/data"
+	"github.com/ddworken/hishtory/client/hctx"
+)
+
+// A listener that is invoked whenever an entry recorded on another device is synced into the
+// local DB (see OnRemoteEntrySynced)
+type RemoteEntrySyncedListener func(ctx context.Context, entry data.HistoryEntry)
+
+var remoteEntrySyncedListeners []RemoteEntrySyncedListener
+
+// OnRemoteEntrySynced subscribes the given listener to entries recorded on other devices as they
+// sync into the local DB. Listeners only fire for the ongoing sync path (not for the initial
+// device bootstrap), so they see entries shortly after the remote command finishes.
+func OnRemoteEntrySynced(listener RemoteEntrySyncedListener) {
+	remoteEntrySyncedListeners = append(remoteEntrySyncedListeners, listener)
+}
+
+func notifyRemoteEntrySynced(ctx context.Context, entry data.HistoryEntry) {
+	for _, listener := range remoteEntrySyncedListeners {
+		listener(ctx, entry)
+	}
+}
+
+// The default for the notification-min-runtime config: how long a remote command must have run
+// for its completion to trigger the notification-command
+const defaultNotificationMinRuntime = time.Minute
+
+// How recently a remote command must have finished for its completion to trigger the
+// notification-command, so that backfills of older entries (e.g. after a device was offline for
+// a while) don't replay a burst of stale notifications
+const notificationMaxStaleness = 10 * time.Minute
+
+// maybeNotifyFinishedCommand runs the configured notification-command when a long-running
+// command recorded on another device finishes and its final entry syncs in. This is how e.g.
+// `notify-send` can alert about a deployment script finishing on another host. The entry's
+// details are exposed to the command via HISHTORY_* environment variables.
+func maybeNotifyFinishedCommand(ctx context.Context, entry data.HistoryEntry) {
+	config := hctx.GetConf(ctx)
+	if config.NotificationCommand == "" {
+		return
+	}
+	minRuntime := defaultNotificationMinRuntime
+	if config.NotificationMinRuntime != "" {
+		parsed, err := time.ParseDuration(config.NotificationMinRuntime)
+		if err != nil {
+			hctx.GetLogger().Warnf("failed to parse notification-min-runtime=%#v, using the default of %s: %v", config.NotificationMinRuntime, defaultNotificationMinRuntime, err)
+		} else {
+			minRuntime = parsed
+		}
+	}
+	if entry.EndTime.Sub(entry.StartTime) < minRuntime {
+		return
+	}
+	if time.Since(entry.EndTime) > notificationMaxStaleness {
+		return
+	}
+	cmd := exec.Command("sh", "-c", config.NotificationCommand)
+	cmd.Env = append(os.Environ(),
+		"HISHTORY_COMMAND="+entry.Command,
+		"HISHTORY_HOSTNAME="+entry.Hostname,
+		"HISHTORY_RUNTIME="+entry.EndTime.Sub(entry.StartTime).Round(time.Second).String(),
+		"HISHTORY_EXIT_CODE="+strconv.Itoa(entry.ExitCode),
+	)
+	if err := cmd.Run(); err != nil {
+		hctx.GetLogger().Warnf("failed to run the notification-command %#v: %v", config.NotificationCommand, err)
+	}
+}
+
+func init() {
+	OnRemoteEntrySynced(maybeNotifyFinishedCommand)
+}
@@ -0,0 +1,320 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ddworken/hishtory/client/data"
+	"github.com/ddworken/hishtory/client/hctx"
+
+	"github.com/araddon/dateparse"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// DefaultWarpDbPath returns the default location of Warp's command history database for this
+// platform, or an empty string if none of the known locations exist
+func DefaultWarpDbPath(ctx context.Context) string {
+	homedir := hctx.GetHome(ctx)
+	candidates := []string{
+		filepath.Join(homedir, "Library/Application Support/dev.warp.Warp-Stable/warp.sqlite"),
+		filepath.Join(homedir, ".local/state/warp-terminal/warp.sqlite"),
+	}
+	for _, candidate := range candidates {
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// ImportWarpHistory imports the command history from the given Warp terminal database,
+// preserving the working directory, exit code, and timestamps that Warp captured for each
+// command. Entries are deduplicated via their content-addressed entry IDs, so re-running the
+// import doesn't create duplicates.
+func ImportWarpHistory(ctx context.Context, dbPath string) (int, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return 0, fmt.Errorf("failed to read the Warp history database at %s: %w", dbPath, err)
+	}
+	// Open the DB read-only so that importing can't modify Warp's history
+	warpDb, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=ro", dbPath)), &gorm.Config{SkipDefaultTransaction: true})
+	if err != nil {
+		return 0, fmt.Errorf("failed to open the Warp history database at %s: %w", dbPath, err)
+	}
+	var rows []struct {
+		Command     string
+		Pwd         string
+		ExitCode    int
+		StartTs     string
+		CompletedTs string
+	}
+	res := warpDb.Raw("SELECT command, pwd, exit_code, start_ts, completed_ts FROM commands WHERE command != '' ORDER BY start_ts").Scan(&rows)
+	if res.Error != nil {
+		return 0, fmt.Errorf("failed to query the Warp history database (was it created by an incompatible Warp version?): %w", res.Error)
+	}
+	currentUser, err := user.Current()
+	if err != nil {
+		return 0, err
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return 0, err
+	}
+	homedir := hctx.GetHome(ctx)
+	config := hctx.GetConf(ctx)
+	db := hctx.GetDb(ctx)
+	numImported := 0
+	for _, row := range rows {
+		startTime, err := dateparse.ParseLocal(row.StartTs)
+		if err != nil {
+			// Skip entries whose timestamps don't parse rather than failing the whole import
+			hctx.GetLogger().Warnf("skipping Warp history entry with unparseable start_ts=%#v: %v", row.StartTs, err)
+			continue
+		}
+		endTime := startTime
+		if parsed, err := dateparse.ParseLocal(row.CompletedTs); err == nil {
+			endTime = parsed
+		}
+		cwd := row.Pwd
+		if cwd == "" {
+			cwd = "Unknown"
+		}
+		entry := normalizeEntryTimezone(data.HistoryEntry{
+			LocalUsername:           currentUser.Username,
+			Hostname:                hostname,
+			Command:                 strings.TrimSpace(row.Command),
+			CurrentWorkingDirectory: cwd,
+			HomeDirectory:           homedir,
+			ExitCode:                row.ExitCode,
+			StartTime:               startTime,
+			EndTime:                 endTime,
+			DeviceId:                config.DeviceId,
+		})
+		entry.EntryId = data.ContentAddressedEntryId(&entry)
+		if AddToDbIfNew(db, entry) {
+			numImported++
+		}
+	}
+	return numImported, finishMetadataImport(ctx)
+}
+
+// DefaultIterm2HistoryPath returns the default location of iTerm2's shell-integration command
+// history, or an empty string if it doesn't exist
+func DefaultIterm2HistoryPath(ctx context.Context) string {
+	candidate := filepath.Join(hctx.GetHome(ctx), "Library/Application Support/iTerm2/CommandHistory.plist")
+	if _, err := os.Stat(candidate); err == nil {
+		return candidate
+	}
+	return ""
+}
+
+// ImportIterm2History imports the command history that iTerm2's shell integration captured,
+// preserving the working directory, exit code, timestamp, and host attribution for each command.
+// The file must be an XML plist: iTerm2 writes it as a binary plist, which can be converted via
+// `plutil -convert xml1`. Entries are deduplicated via their content-addressed entry IDs, so
+// re-running the import doesn't create duplicates.
+func ImportIterm2History(ctx context.Context, plistPath string) (int, error) {
+	contents, err := os.ReadFile(plistPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the iTerm2 command history at %s: %w", plistPath, err)
+	}
+	if bytes.HasPrefix(contents, []byte("bplist")) {
+		return 0, fmt.Errorf("the iTerm2 command history at %s is a binary plist, convert it to XML first via `plutil -convert xml1 -o /tmp/CommandHistory.xml %s`", plistPath, plistPath)
+	}
+	parsed, err := parsePlistXml(contents)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse the iTerm2 command history at %s: %w", plistPath, err)
+	}
+	hostsToCommands, ok := parsed.(map[string]any)
+	if !ok {
+		return 0, fmt.Errorf("the iTerm2 command history at %s doesn't have the expected structure (expected a dict at the top level)", plistPath)
+	}
+	currentUser, err := user.Current()
+	if err != nil {
+		return 0, err
+	}
+	localHostname, err := os.Hostname()
+	if err != nil {
+		return 0, err
+	}
+	homedir := hctx.GetHome(ctx)
+	config := hctx.GetConf(ctx)
+	db := hctx.GetDb(ctx)
+	numImported := 0
+	for hostKey, commands := range hostsToCommands {
+		// iTerm2 keys its command history by "username@hostname"
+		username, hostname, found := strings.Cut(hostKey, "@")
+		if !found {
+			username = currentUser.Username
+			hostname = localHostname
+		}
+		commandList, ok := commands.([]any)
+		if !ok {
+			continue
+		}
+		for _, rawCommand := range commandList {
+			command, ok := rawCommand.(map[string]any)
+			if !ok {
+				continue
+			}
+			cmd, ok := command["command"].(string)
+			if !ok || strings.TrimSpace(cmd) == "" {
+				continue
+			}
+			useTimes, _ := command["use times"].([]any)
+			for _, rawUse := range useTimes {
+				entry := data.HistoryEntry{
+					LocalUsername:           username,
+					Hostname:                hostname,
+					Command:                 strings.TrimSpace(cmd),
+					CurrentWorkingDirectory: "Unknown",
+					HomeDirectory:           homedir,
+					DeviceId:                config.DeviceId,
+				}
+				switch use := rawUse.(type) {
+				case float64:
+					entry.StartTime = time.Unix(int64(use), 0).UTC()
+				case map[string]any:
+					if t, ok := use["time"].(float64); ok {
+						entry.StartTime = time.Unix(int64(t), 0).UTC()
+					}
+					if directory, ok := use["directory"].(string); ok && directory != "" {
+						entry.CurrentWorkingDirectory = directory
+					}
+					if status, ok := use["status"].(int64); ok {
+						entry.ExitCode = int(status)
+					}
+				default:
+					continue
+				}
+				if entry.StartTime.IsZero() {
+					continue
+				}
+				entry.EndTime = entry.StartTime
+				entry = normalizeEntryTimezone(entry)
+				entry.EntryId = data.ContentAddressedEntryId(&entry)
+				if AddToDbIfNew(db, entry) {
+					numImported++
+				}
+			}
+		}
+	}
+	return numImported, finishMetadataImport(ctx)
+}
+
+// finishMetadataImport runs the same post-import steps as the regular shell history import:
+// uploading the new entries for syncing, checkpointing the WAL, and backfilling the stats
+// aggregates
+func finishMetadataImport(ctx context.Context) error {
+	if err := Reupload(ctx); err != nil {
+		return fmt.Errorf("failed to upload the imported entries: %w", err)
+	}
+	db := hctx.GetDb(ctx)
+	db.Exec("PRAGMA wal_checkpoint")
+	return RebuildDayAggregates(db)
+}
+
+// parsePlistXml parses an XML plist into nested Go values: <dict> to map[string]any, <array> to
+// []any, <string>/<date>/<data> to string, <integer> to int64, <real> to float64, and
+// <true/>/<false/> to bool. Only the XML plist format is supported (not binary plists).
+func parsePlistXml(contents []byte) (any, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(contents))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		if element, ok := token.(xml.StartElement); ok {
+			if element.Name.Local == "plist" {
+				continue
+			}
+			return parsePlistElement(decoder, element)
+		}
+	}
+}
+
+func parsePlistElement(decoder *xml.Decoder, start xml.StartElement) (any, error) {
+	switch start.Name.Local {
+	case "dict":
+		result := make(map[string]any)
+		key := ""
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch t := token.(type) {
+			case xml.StartElement:
+				if t.Name.Local == "key" {
+					if err := decoder.DecodeElement(&key, &t); err != nil {
+						return nil, err
+					}
+				} else {
+					value, err := parsePlistElement(decoder, t)
+					if err != nil {
+						return nil, err
+					}
+					result[key] = value
+				}
+			case xml.EndElement:
+				return result, nil
+			}
+		}
+	case "array":
+		result := make([]any, 0)
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch t := token.(type) {
+			case xml.StartElement:
+				value, err := parsePlistElement(decoder, t)
+				if err != nil {
+					return nil, err
+				}
+				result = append(result, value)
+			case xml.EndElement:
+				return result, nil
+			}
+		}
+	case "string", "date", "data":
+		var value string
+		if err := decoder.DecodeElement(&value, &start); err != nil {
+			return nil, err
+		}
+		return value, nil
+	case "integer":
+		var value string
+		if err := decoder.DecodeElement(&value, &start); err != nil {
+			return nil, err
+		}
+		return strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	case "real":
+		var value string
+		if err := decoder.DecodeElement(&value, &start); err != nil {
+			return nil, err
+		}
+		return strconv.ParseFloat(strings.TrimSpace(value), 64)
+	case "true":
+		if err := decoder.Skip(); err != nil {
+			return nil, err
+		}
+		return true, nil
+	case "false":
+		if err := decoder.Skip(); err != nil {
+			return nil, err
+		}
+		return false, nil
+	default:
+		return nil, fmt.Errorf("unsupported plist element <%s>", start.Name.Local)
+	}
+}
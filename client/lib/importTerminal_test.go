@@ -0,0 +1,223 @@
+package lib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ddworken/hishtory/client/data"
+	"github.com/ddworken/hishtory/client/hctx"
+	"github.com/ddworken/hishtory/shared/testutils"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// makeOfflineTestContext initializes a fresh offline hishtory install, so that the post-import
+// steps (e.g. Reupload) don't try to contact a backend
+func makeOfflineTestContext(t *testing.T) (context.Context, func()) {
+	restore := testutils.BackupAndRestore(t)
+	require.NoError(t, hctx.InitConfig())
+	config, err := hctx.GetConfig()
+	require.NoError(t, err)
+	config.IsOffline = true
+	require.NoError(t, hctx.SetConfig(&config))
+	return hctx.MakeContext(), restore
+}
+
+// makeFakeWarpDb writes a sqlite DB with Warp's commands schema (plus the given extra columns, to
+// mimic schema differences across Warp versions) and the given rows
+func makeFakeWarpDb(t *testing.T, extraColumns string, rows [][]any) string {
+	dbPath := filepath.Join(t.TempDir(), "warp.sqlite")
+	warpDb, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{SkipDefaultTransaction: true})
+	require.NoError(t, err)
+	schema := "CREATE TABLE commands (id INTEGER PRIMARY KEY, command TEXT, pwd TEXT, exit_code INTEGER, start_ts TEXT, completed_ts TEXT"
+	if extraColumns != "" {
+		schema += ", " + extraColumns
+	}
+	schema += ")"
+	require.NoError(t, warpDb.Exec(schema).Error)
+	for _, row := range rows {
+		require.NoError(t, warpDb.Exec("INSERT INTO commands (command, pwd, exit_code, start_ts, completed_ts) VALUES (?, ?, ?, ?, ?)", row...).Error)
+	}
+	return dbPath
+}
+
+func TestImportWarpHistory(t *testing.T) {
+	ctx, restore := makeOfflineTestContext(t)
+	defer restore()
+
+	dbPath := makeFakeWarpDb(t, "session_id TEXT, shell TEXT", [][]any{
+		{"echo warp-one", "/tmp", 0, "2023-04-05 06:07:08", "2023-04-05 06:07:09"},
+		{"make build", "/home/user/repo", 2, "2023-04-06 10:00:00", "2023-04-06 10:05:00"},
+		// Empty commands are excluded by the import query
+		{"", "/tmp", 0, "2023-04-07 11:00:00", "2023-04-07 11:00:01"},
+		// Entries with unparseable timestamps are skipped rather than failing the import
+		{"echo bad-ts", "/tmp", 0, "not-a-timestamp", ""},
+		// A missing pwd falls back to "Unknown"
+		{"echo no-pwd", "", 1, "2023-04-08 12:00:00", "2023-04-08 12:00:01"},
+	})
+
+	numImported, err := ImportWarpHistory(ctx, dbPath)
+	require.NoError(t, err)
+	require.Equal(t, 3, numImported)
+
+	db := hctx.GetDb(ctx)
+	var entries []*data.HistoryEntry
+	require.NoError(t, db.Order("start_time").Find(&entries).Error)
+	require.Len(t, entries, 3)
+	require.Equal(t, "echo warp-one", entries[0].Command)
+	require.Equal(t, "/tmp", entries[0].CurrentWorkingDirectory)
+	require.Equal(t, 0, entries[0].ExitCode)
+	require.Equal(t, int64(1), entries[0].EndTime.Unix()-entries[0].StartTime.Unix())
+	require.Equal(t, "make build", entries[1].Command)
+	require.Equal(t, 2, entries[1].ExitCode)
+	require.Equal(t, "echo no-pwd", entries[2].Command)
+	require.Equal(t, "Unknown", entries[2].CurrentWorkingDirectory)
+	for _, entry := range entries {
+		require.NotEmpty(t, entry.EntryId)
+		require.Equal(t, data.ContentAddressedEntryId(entry), entry.EntryId)
+	}
+
+	// Re-running the import is idempotent thanks to the content-addressed entry IDs
+	numImported, err = ImportWarpHistory(ctx, dbPath)
+	require.NoError(t, err)
+	require.Equal(t, 0, numImported)
+	require.NoError(t, db.Find(&entries).Error)
+	require.Len(t, entries, 3)
+}
+
+func TestImportWarpHistoryIncompatibleSchema(t *testing.T) {
+	ctx, restore := makeOfflineTestContext(t)
+	defer restore()
+
+	// A missing file is an error rather than a silent no-op
+	_, err := ImportWarpHistory(ctx, filepath.Join(t.TempDir(), "does-not-exist.sqlite"))
+	require.ErrorContains(t, err, "failed to read the Warp history database")
+
+	// A DB without the expected columns (e.g. from an incompatible Warp version) is an error
+	dbPath := filepath.Join(t.TempDir(), "warp.sqlite")
+	warpDb, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{SkipDefaultTransaction: true})
+	require.NoError(t, err)
+	require.NoError(t, warpDb.Exec("CREATE TABLE commands (id INTEGER PRIMARY KEY, command TEXT)").Error)
+	_, err = ImportWarpHistory(ctx, dbPath)
+	require.ErrorContains(t, err, "failed to query the Warp history database")
+}
+
+func TestImportIterm2History(t *testing.T) {
+	ctx, restore := makeOfflineTestContext(t)
+	defer restore()
+
+	plist := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>alice@remote-host</key>
+	<array>
+		<dict>
+			<key>command</key>
+			<string>echo iterm-one</string>
+			<key>use times</key>
+			<array>
+				<real>1680674828</real>
+				<dict>
+					<key>time</key>
+					<real>1680761228</real>
+					<key>directory</key>
+					<string>/home/alice/repo</string>
+					<key>status</key>
+					<integer>3</integer>
+				</dict>
+			</array>
+		</dict>
+		<dict>
+			<key>command</key>
+			<string> </string>
+			<key>use times</key>
+			<array>
+				<real>1680847628</real>
+			</array>
+		</dict>
+	</array>
+</dict>
+</plist>`
+	plistPath := filepath.Join(t.TempDir(), "CommandHistory.plist")
+	require.NoError(t, os.WriteFile(plistPath, []byte(plist), 0o644))
+
+	numImported, err := ImportIterm2History(ctx, plistPath)
+	require.NoError(t, err)
+	require.Equal(t, 2, numImported)
+
+	db := hctx.GetDb(ctx)
+	var entries []*data.HistoryEntry
+	require.NoError(t, db.Order("start_time").Find(&entries).Error)
+	require.Len(t, entries, 2)
+	require.Equal(t, "echo iterm-one", entries[0].Command)
+	require.Equal(t, "alice", entries[0].LocalUsername)
+	require.Equal(t, "remote-host", entries[0].Hostname)
+	require.Equal(t, int64(1680674828), entries[0].StartTime.Unix())
+	require.Equal(t, "Unknown", entries[0].CurrentWorkingDirectory)
+	require.Equal(t, 0, entries[0].ExitCode)
+	require.Equal(t, int64(1680761228), entries[1].StartTime.Unix())
+	require.Equal(t, "/home/alice/repo", entries[1].CurrentWorkingDirectory)
+	require.Equal(t, 3, entries[1].ExitCode)
+
+	// Re-running the import is idempotent thanks to the content-addressed entry IDs
+	numImported, err = ImportIterm2History(ctx, plistPath)
+	require.NoError(t, err)
+	require.Equal(t, 0, numImported)
+	require.NoError(t, db.Find(&entries).Error)
+	require.Len(t, entries, 2)
+}
+
+func TestImportIterm2HistoryInvalidInputs(t *testing.T) {
+	ctx, restore := makeOfflineTestContext(t)
+	defer restore()
+
+	// A missing file is an error rather than a silent no-op
+	_, err := ImportIterm2History(ctx, filepath.Join(t.TempDir(), "does-not-exist.plist"))
+	require.ErrorContains(t, err, "failed to read the iTerm2 command history")
+
+	// Binary plists are rejected with a pointer at plutil for converting them
+	binaryPath := filepath.Join(t.TempDir(), "binary.plist")
+	require.NoError(t, os.WriteFile(binaryPath, []byte("bplist00\x00\x01\x02"), 0o644))
+	_, err = ImportIterm2History(ctx, binaryPath)
+	require.ErrorContains(t, err, "plutil -convert xml1")
+
+	// Malformed XML is an error
+	malformedPath := filepath.Join(t.TempDir(), "malformed.plist")
+	require.NoError(t, os.WriteFile(malformedPath, []byte("<plist><dict><key>unclosed"), 0o644))
+	_, err = ImportIterm2History(ctx, malformedPath)
+	require.ErrorContains(t, err, "failed to parse the iTerm2 command history")
+
+	// A plist whose top level isn't a dict is an error
+	arrayPath := filepath.Join(t.TempDir(), "array.plist")
+	require.NoError(t, os.WriteFile(arrayPath, []byte(`<plist version="1.0"><array/></plist>`), 0o644))
+	_, err = ImportIterm2History(ctx, arrayPath)
+	require.ErrorContains(t, err, "expected a dict at the top level")
+}
+
+func TestParsePlistXml(t *testing.T) {
+	parsed, err := parsePlistXml([]byte(`<plist version="1.0"><dict>
+		<key>s</key><string>str</string>
+		<key>i</key><integer>42</integer>
+		<key>r</key><real>1.5</real>
+		<key>t</key><true/>
+		<key>f</key><false/>
+		<key>a</key><array><integer>1</integer><string>two</string></array>
+	</dict></plist>`))
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{
+		"s": "str",
+		"i": int64(42),
+		"r": 1.5,
+		"t": true,
+		"f": false,
+		"a": []any{int64(1), "two"},
+	}, parsed)
+
+	_, err = parsePlistXml([]byte(`<plist><unsupported-element/></plist>`))
+	require.ErrorContains(t, err, "unsupported plist element <unsupported-element>")
+}
@@ -3,9 +3,12 @@ package lib
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
 	"database/sql"
 	_ "embed" // for embedding config.sh
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -21,7 +24,9 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
+	"unicode"
 
 	"github.com/ddworken/hishtory/client/data"
 	"github.com/ddworken/hishtory/client/hctx"
@@ -32,7 +37,6 @@ import (
 	"github.com/eko/gocache/lib/v4/cache"
 	"github.com/eko/gocache/lib/v4/store"
 	ristretto_store "github.com/eko/gocache/store/ristretto/v4"
-	"github.com/google/uuid"
 	"github.com/schollz/progressbar/v3"
 	"golang.org/x/exp/slices"
 	"gorm.io/gorm"
@@ -59,7 +63,9 @@ var ImportBatchSize = 100
 // Funnily enough, 256KB actually wasn't enough. See https://github.com/ddworken/hishtory/issues/93
 var maxSupportedLineLengthForImport = 512_000
 
-func AddToDbIfNew(db *gorm.DB, entry data.HistoryEntry) {
+// AddToDbIfNew inserts the given entry into the local DB unless an identical entry already exists.
+// Returns whether the entry was inserted.
+func AddToDbIfNew(db *gorm.DB, entry data.HistoryEntry) bool {
 	tx := db.Where("local_username = ?", entry.LocalUsername)
 	tx = tx.Where("hostname = ?", entry.Hostname)
 	tx = tx.Where("command = ?", entry.Command)
@@ -73,7 +79,10 @@ func AddToDbIfNew(db *gorm.DB, entry data.HistoryEntry) {
 	if len(results) == 0 {
 		db.Create(normalizeEntryTimezone(entry))
 		// TODO: check the error here and bubble it up
+		IncrementDayAggregates(db, entry)
+		return true
 	}
+	return false
 }
 
 func getCustomColumnValue(ctx context.Context, header string, entry data.HistoryEntry) (string, error) {
@@ -96,7 +105,7 @@ func BuildTableRow(ctx context.Context, columnNames []string, entry data.History
 	for _, header := range columnNames {
 		switch header {
 		case "Hostname", "hostname", "hn":
-			row = append(row, entry.Hostname)
+			row = append(row, AliasedHostname(ctx, entry.Hostname))
 		case "CWD", "cwd":
 			row = append(row, entry.CurrentWorkingDirectory)
 		case "Timestamp", "timestamp", "ts":
@@ -118,6 +127,56 @@ func BuildTableRow(ctx context.Context, columnNames []string, entry data.History
 			row = append(row, commandRenderer(entry.Command))
 		case "User", "user":
 			row = append(row, entry.LocalUsername)
+		case "Terminal", "terminal", "term_program":
+			row = append(row, entry.TermProgram)
+		case "TTY", "tty":
+			row = append(row, entry.Tty)
+		case "Session", "session", "session_id":
+			// Display just a prefix of the session UUID, which is plenty to visually group
+			// entries from the same terminal session without wasting horizontal space
+			if len(entry.SessionId) > 8 {
+				row = append(row, entry.SessionId[:8])
+			} else {
+				row = append(row, entry.SessionId)
+			}
+		case "Device", "device", "device_id":
+			row = append(row, DeviceDisplayName(ctx, entry.DeviceId))
+		case "Sudo", "sudo":
+			if entry.OriginalUsername == "" {
+				row = append(row, "")
+			} else {
+				row = append(row, entry.OriginalUsername+" → "+entry.LocalUsername)
+			}
+		case "Command Length", "Command_Length", "command_length", "len":
+			row = append(row, fmt.Sprintf("%d", len(entry.Command)))
+		case "Arg Count", "Arg_Count", "arg_count", "args":
+			row = append(row, fmt.Sprintf("%d", countCommandArgs(entry.Command)))
+		case "Pipeline Stages", "Pipeline_Stages", "pipeline_stages", "pipeline":
+			row = append(row, fmt.Sprintf("%d", countPipelineStages(entry.Command)))
+		case "Git Repo", "Git_Repo", "git_repo", "repo":
+			row = append(row, entry.GitRepo)
+		case "Git Branch", "Git_Branch", "git_branch", "branch":
+			row = append(row, entry.GitBranch)
+		case "Had Stderr", "Had_Stderr", "had_stderr":
+			if entry.HadStderr == nil {
+				row = append(row, "N/A")
+			} else {
+				row = append(row, fmt.Sprintf("%v", *entry.HadStderr))
+			}
+		case "Shlvl", "shlvl", "SHLVL":
+			if entry.Shlvl == nil {
+				row = append(row, "N/A")
+			} else {
+				row = append(row, fmt.Sprintf("%d", *entry.Shlvl))
+			}
+		case "Parent Process", "Parent_Process", "parent_process", "parent":
+			row = append(row, entry.ParentProcess)
+		case "Output Size", "Output_Size", "output_size":
+			if entry.OutputSize == nil {
+				row = append(row, "N/A")
+			} else {
+				row = append(row, fmt.Sprintf("%d", *entry.OutputSize))
+			}
 		default:
 			customColumnValue, err := getCustomColumnValue(ctx, header, entry)
 			if err != nil {
@@ -129,6 +188,71 @@ func BuildTableRow(ctx context.Context, columnNames []string, entry data.History
 	return row, nil
 }
 
+// Compiled hostname alias regexes, memoized since AliasedHostname is called for every displayed
+// row in the TUI. Regexes that fail to compile are cached as nil and skipped.
+var cachedHostnameAliasRegexes map[string]*regexp.Regexp = make(map[string]*regexp.Regexp)
+
+func getCompiledHostnameAliasRegex(regexStr string) *regexp.Regexp {
+	if re, ok := cachedHostnameAliasRegexes[regexStr]; ok {
+		return re
+	}
+	re, err := regexp.Compile("^(?:" + regexStr + ")$")
+	if err != nil {
+		hctx.GetLogger().Warnf("skipping hostname alias with invalid regex %#v: %v", regexStr, err)
+		re = nil
+	}
+	cachedHostnameAliasRegexes[regexStr] = re
+	return re
+}
+
+// Apply the configured hostname aliases to the given hostname. Returns the display alias for the
+// first (alphabetically by regex) alias whose regex matches the full hostname, or the hostname
+// itself if no alias matches.
+func AliasedHostname(ctx context.Context, hostname string) string {
+	config := hctx.GetConf(ctx)
+	if len(config.HostnameAliases) == 0 {
+		return hostname
+	}
+	regexStrs := make([]string, 0, len(config.HostnameAliases))
+	for regexStr := range config.HostnameAliases {
+		regexStrs = append(regexStrs, regexStr)
+	}
+	slices.Sort(regexStrs)
+	for _, regexStr := range regexStrs {
+		re := getCompiledHostnameAliasRegex(regexStr)
+		if re != nil && re.MatchString(hostname) {
+			return config.HostnameAliases[regexStr]
+		}
+	}
+	return hostname
+}
+
+// The display name for the given device ID: the name configured via `hishtory config-add
+// device-name` if there is one, or else a prefix of the device UUID (mirroring the Session
+// column), which is plenty to tell devices apart without wasting horizontal space.
+func DeviceDisplayName(ctx context.Context, deviceId string) string {
+	config := hctx.GetConf(ctx)
+	if name, ok := config.DeviceNames[deviceId]; ok {
+		return name
+	}
+	if len(deviceId) > 8 {
+		return deviceId[:8]
+	}
+	return deviceId
+}
+
+// The number of arguments in the given command, counted as the number of whitespace-separated
+// tokens after the command name itself
+func countCommandArgs(command string) int {
+	return max(len(strings.Fields(command))-1, 0)
+}
+
+// The number of pipeline stages in the given command. Note that this doesn't account for quoted
+// or escaped pipe characters, so it is an approximation for unusual commands.
+func countPipelineStages(command string) int {
+	return strings.Count(command, "|") + 1
+}
+
 // Make a regex that matches the non-tokenized bits of the given query
 func MakeRegexFromQuery(query string) string {
 	tokens := tokenize(strings.TrimSpace(query))
@@ -233,9 +357,9 @@ func ImportHistory(ctx context.Context, shouldReadStdin, force bool) (int, error
 	if !slices.Contains(inputFiles, zHistPath) {
 		inputFiles = append(inputFiles, zHistPath)
 	}
-	entriesIter := parseFishHistory(homedir)
+	entriesIter := taggedWithSource(getFishHistoryPath(homedir), parseFishHistory(homedir))
 	for _, file := range inputFiles {
-		entriesIter = concatIterators(entriesIter, readFileToIterator(file))
+		entriesIter = concatIterators(entriesIter, taggedWithSource(file, readFileToIterator(file)))
 	}
 	totalNumEntries, err := countLinesInFiles(inputFiles...)
 	if err != nil {
@@ -246,7 +370,7 @@ func ImportHistory(ctx context.Context, shouldReadStdin, force bool) (int, error
 		if err != nil {
 			return 0, fmt.Errorf("failed to read stdin: %w", err)
 		}
-		entriesIter = concatIterators(entriesIter, Values(extraEntries))
+		entriesIter = concatIterators(entriesIter, taggedWithSource("stdin", Values(extraEntries)))
 		totalNumEntries += len(extraEntries)
 	}
 	fishLines, err := countLinesInFile(getFishHistoryPath(homedir))
@@ -254,7 +378,6 @@ func ImportHistory(ctx context.Context, shouldReadStdin, force bool) (int, error
 		return 0, fmt.Errorf("failed to count fish history lines during hishtory import: %w", err)
 	}
 	totalNumEntries += fishLines
-	db := hctx.GetDb(ctx)
 	currentUser, err := user.Current()
 	if err != nil {
 		return 0, err
@@ -263,34 +386,224 @@ func ImportHistory(ctx context.Context, shouldReadStdin, force bool) (int, error
 	if err != nil {
 		return 0, err
 	}
+	numEntriesImported, err := importEntriesFromIterator(ctx, entriesIter, totalNumEntries, currentUser.Username, hostname)
+	if err != nil {
+		return 0, err
+	}
+	config.HaveCompletedInitialImport = true
+	err = hctx.SetConfig(config)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark initial import as completed, this may lead to duplicate history entries: %w", err)
+	}
+	return numEntriesImported, nil
+}
+
+// ImportHistoryFromFiles imports history entries from the given history files, attributing them to
+// the given username and hostname (rather than the invoking user's). This is meant for admins
+// migrating shared machines, where the files being imported may belong to other users.
+func ImportHistoryFromFiles(ctx context.Context, inputFiles []string, username, hostname string) (int, error) {
+	if username == "" {
+		currentUser, err := user.Current()
+		if err != nil {
+			return 0, err
+		}
+		username = currentUser.Username
+	}
+	if hostname == "" {
+		h, err := os.Hostname()
+		if err != nil {
+			return 0, err
+		}
+		hostname = h
+	}
+	entriesIter := Values([]importedCommand{})
+	for _, file := range inputFiles {
+		// Unlike the default import which silently skips missing files, an explicitly requested
+		// file that doesn't exist is an error
+		if _, err := os.Stat(file); err != nil {
+			return 0, fmt.Errorf("failed to import history file %#v: %w", file, err)
+		}
+		entriesIter = concatIterators(entriesIter, taggedWithSource(file, readFileToIterator(file)))
+	}
+	totalNumEntries, err := countLinesInFiles(inputFiles...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count input lines during hishtory import: %w", err)
+	}
+	return importEntriesFromIterator(ctx, entriesIter, totalNumEntries, username, hostname)
+}
+
+// An import rule from the optional import rules file (see data.IMPORT_RULES_PATH), applied to each
+// command while importing existing shell history. This makes it possible to clean up bogus lines,
+// old secrets, or tool-specific noise in one pass rather than via post-import redactions. E.g.:
+//
+//	[{"match": "^#", "action": "drop"},
+//	 {"match": "--password=\\S+", "action": "rewrite", "replacement": "--password=REDACTED"},
+//	 {"match": "^kubectl ", "action": "tag", "tag": "k8s"}]
+type ImportRule struct {
+	// The regex that commands are matched against
+	Match string `json:"match"`
+	// The action to take for matching commands: one of "drop", "rewrite", or "tag"
+	Action string `json:"action"`
+	// For action=="rewrite", the replacement for the matched portion of the command. Supports
+	// capture group references like $1.
+	Replacement string `json:"replacement,omitempty"`
+	// For action=="tag", the tag to attach to the entry as a custom column named "tag"
+	Tag string `json:"tag,omitempty"`
+}
+
+type compiledImportRule struct {
+	rule  ImportRule
+	regex *regexp.Regexp
+}
+
+// A command being imported, along with the file (or "stdin") that it came from
+type importedCommand struct {
+	cmd        string
+	sourceFile string
+}
+
+// taggedWithSource tags each command from the given iterator with the file it came from, so that
+// imported entries can be assigned deterministic entry IDs based on their source
+func taggedWithSource(sourceFile string, lines iter.Seq2[string, error]) iter.Seq2[importedCommand, error] {
+	return func(yield func(importedCommand, error) bool) {
+		lines(func(cmd string, err error) bool {
+			return yield(importedCommand{cmd: cmd, sourceFile: sourceFile}, err)
+		})
+	}
+}
+
+// importedEntryId returns a deterministic entry ID for the n-th occurrence of the given command in
+// the given source file. Since this is a pure function of the imported content, re-running an
+// import produces the same entry IDs, which lets filterAlreadyImportedEntries skip entries that
+// were already imported and makes imports idempotent.
+func importedEntryId(sourceFile, cmd string, occurrence int) string {
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%s", sourceFile, occurrence, cmd)))
+	return "import-" + hex.EncodeToString(hash[:])
+}
+
+// filterAlreadyImportedEntries returns the entries from the given batch whose entry IDs aren't
+// already present in the local DB, so that re-running an import doesn't create duplicate entries
+func filterAlreadyImportedEntries(db *gorm.DB, batch []data.HistoryEntry) ([]data.HistoryEntry, error) {
+	entryIds := make([]string, 0, len(batch))
+	for _, entry := range batch {
+		entryIds = append(entryIds, entry.EntryId)
+	}
+	var existingIds []string
+	err := RetryingDbFunction(func() error {
+		return db.Model(&data.HistoryEntry{}).Where("entry_id IN ?", entryIds).Pluck("entry_id", &existingIds).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for already-imported entries: %w", err)
+	}
+	if len(existingIds) == 0 {
+		return batch, nil
+	}
+	existing := make(map[string]bool, len(existingIds))
+	for _, entryId := range existingIds {
+		existing[entryId] = true
+	}
+	filtered := make([]data.HistoryEntry, 0, len(batch))
+	for _, entry := range batch {
+		if !existing[entry.EntryId] {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered, nil
+}
+
+func getImportRules(ctx context.Context) ([]compiledImportRule, error) {
+	path := filepath.Join(hctx.GetHome(ctx), data.GetHishtoryPath(), data.IMPORT_RULES_PATH)
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read import rules file %#v: %w", path, err)
+	}
+	var rules []ImportRule
+	if err := json.Unmarshal(contents, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse import rules file %#v: %w", path, err)
+	}
+	compiledRules := make([]compiledImportRule, 0, len(rules))
+	for _, rule := range rules {
+		if rule.Action != "drop" && rule.Action != "rewrite" && rule.Action != "tag" {
+			return nil, fmt.Errorf("import rule %#v has invalid action %#v, must be one of drop/rewrite/tag", rule.Match, rule.Action)
+		}
+		regex, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return nil, fmt.Errorf("import rule %#v has an invalid regex: %w", rule.Match, err)
+		}
+		compiledRules = append(compiledRules, compiledImportRule{rule: rule, regex: regex})
+	}
+	return compiledRules, nil
+}
+
+// applyImportRules applies the given import rules to the given command. Returns the (possibly
+// rewritten) command, any tags to attach to the entry, and whether the command should be dropped.
+func applyImportRules(rules []compiledImportRule, cmd string) (string, []string, bool) {
+	var tags []string
+	for _, rule := range rules {
+		if !rule.regex.MatchString(cmd) {
+			continue
+		}
+		switch rule.rule.Action {
+		case "drop":
+			return "", nil, true
+		case "rewrite":
+			cmd = rule.regex.ReplaceAllString(cmd, rule.rule.Replacement)
+		case "tag":
+			tags = append(tags, rule.rule.Tag)
+		}
+	}
+	return cmd, tags, false
+}
+
+func importEntriesFromIterator(ctx context.Context, entriesIter iter.Seq2[importedCommand, error], totalNumEntries int, username, hostname string) (int, error) {
+	config := hctx.GetConf(ctx)
+	homedir := hctx.GetHome(ctx)
+	db := hctx.GetDb(ctx)
+	importRules, err := getImportRules(ctx)
+	if err != nil {
+		return 0, err
+	}
 	numEntriesImported := 0
+	numDuplicatesSkipped := 0
 	var iteratorError error = nil
 	var batch []data.HistoryEntry
 	importTimestamp := time.Now().UTC()
-	importEntryId := uuid.Must(uuid.NewRandom()).String()
+	// The number of times each (source file, command) pair has been seen so far, so that repeated
+	// commands within one file still get distinct entry IDs
+	occurrenceCounts := make(map[string]int)
 	var bar *progressbar.ProgressBar
 	if totalNumEntries > NUM_IMPORTED_ENTRIES_SLOW {
 		fmt.Println("Importing existing history entries")
 		bar = progressbar.Default(int64(totalNumEntries))
 		defer bar.Finish()
 	}
-	entriesIter(func(cmd string, err error) bool {
+	entriesIter(func(ic importedCommand, err error) bool {
 		if err != nil {
 			iteratorError = err
 			return false
 		}
-		cmd = stripZshWeirdness(cmd)
+		cmd := stripZshWeirdness(ic.cmd)
 		if isBashWeirdness(cmd) || strings.HasPrefix(cmd, " ") {
 			return true
 		}
+		cmd, tags, dropped := applyImportRules(importRules, cmd)
+		if dropped || strings.TrimSpace(cmd) == "" {
+			return true
+		}
+		cmd = MaybeTruncateCommand(ctx, cmd)
 		// Set the timestamps so that they are monotonically increasing
 		startTime := importTimestamp.Add(time.Millisecond * time.Duration(numEntriesImported*2))
 		endTime := startTime.Add(time.Millisecond)
-		// And set the entryId in a similar way. This isn't critical from a correctness POV, but uuid.NewRandom() is
-		// quite slow, so this makes imports considerably faster
-		entryId := importEntryId + fmt.Sprintf("%d", numEntriesImported)
+		// And derive the entry ID from a hash of the imported content, so that re-running an
+		// import is idempotent rather than creating duplicate entries
+		occurrenceKey := ic.sourceFile + "|" + cmd
+		entryId := importedEntryId(ic.sourceFile, cmd, occurrenceCounts[occurrenceKey])
+		occurrenceCounts[occurrenceKey]++
 		entry := normalizeEntryTimezone(data.HistoryEntry{
-			LocalUsername:           currentUser.Username,
+			LocalUsername:           username,
 			Hostname:                hostname,
 			Command:                 cmd,
 			CurrentWorkingDirectory: "Unknown",
@@ -301,18 +614,29 @@ func ImportHistory(ctx context.Context, shouldReadStdin, force bool) (int, error
 			DeviceId:                config.DeviceId,
 			EntryId:                 entryId,
 		})
+		for _, tag := range tags {
+			entry.CustomColumns = append(entry.CustomColumns, data.CustomColumn{Name: "tag", Val: tag})
+		}
 		batch = append(batch, entry)
 		if len(batch) > ImportBatchSize {
-			err = RetryingDbFunction(func() error {
-				if err := db.Create(batch).Error; err != nil {
-					return fmt.Errorf("failed to import batch of history entries: %w", err)
-				}
-				return nil
-			})
+			filteredBatch, err := filterAlreadyImportedEntries(db, batch)
 			if err != nil {
-				iteratorError = fmt.Errorf("failed to insert imported history entry: %w", err)
+				iteratorError = err
 				return false
 			}
+			numDuplicatesSkipped += len(batch) - len(filteredBatch)
+			if len(filteredBatch) > 0 {
+				err = RetryingDbFunction(func() error {
+					if err := db.Create(filteredBatch).Error; err != nil {
+						return fmt.Errorf("failed to import batch of history entries: %w", err)
+					}
+					return nil
+				})
+				if err != nil {
+					iteratorError = fmt.Errorf("failed to insert imported history entry: %w", err)
+					return false
+				}
+			}
 			batch = make([]data.HistoryEntry, 0)
 		}
 		numEntriesImported += 1
@@ -329,28 +653,38 @@ func ImportHistory(ctx context.Context, shouldReadStdin, force bool) (int, error
 	}
 	// Also create any entries remaining in an unfinished batch
 	if len(batch) > 0 {
-		err = RetryingDbFunction(func() error {
-			if err := db.Create(batch).Error; err != nil {
-				return fmt.Errorf("failed to import final batch of history entries: %w", err)
-			}
-			return nil
-		})
+		filteredBatch, err := filterAlreadyImportedEntries(db, batch)
 		if err != nil {
 			return 0, err
 		}
+		numDuplicatesSkipped += len(batch) - len(filteredBatch)
+		if len(filteredBatch) > 0 {
+			err := RetryingDbFunction(func() error {
+				if err := db.Create(filteredBatch).Error; err != nil {
+					return fmt.Errorf("failed to import final batch of history entries: %w", err)
+				}
+				return nil
+			})
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	if numDuplicatesSkipped > 0 {
+		fmt.Printf("Skipped %d already-imported history entries\n", numDuplicatesSkipped)
 	}
 	err = Reupload(ctx)
 	if err != nil {
 		return 0, fmt.Errorf("failed to upload hishtory import: %w", err)
 	}
-	config.HaveCompletedInitialImport = true
-	err = hctx.SetConfig(config)
-	if err != nil {
-		return 0, fmt.Errorf("failed to mark initial import as completed, this may lead to duplicate history entries: %w", err)
-	}
 	// Trigger a checkpoint so that these bulk entries are added from the WAL to the main DB
 	db.Exec("PRAGMA wal_checkpoint")
-	return numEntriesImported, nil
+	// Backfill the materialized stats aggregates with the newly imported entries, since the bulk
+	// import path skips the incremental per-entry updates
+	if err := RebuildDayAggregates(db); err != nil {
+		return 0, fmt.Errorf("failed to rebuild the day aggregates after importing: %w", err)
+	}
+	return numEntriesImported - numDuplicatesSkipped, nil
 }
 
 func ReadStdin() ([]string, error) {
@@ -394,8 +728,8 @@ func parseFishHistory(homedir string) iter.Seq2[string, error] {
 
 // Concatenate two iterators.
 // TODO: Equivalent of the future Go stdlib function iter.Concat2.
-func concatIterators(iters ...iter.Seq2[string, error]) iter.Seq2[string, error] {
-	return func(yield func(string, error) bool) {
+func concatIterators[T any](iters ...iter.Seq2[T, error]) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
 		for _, seq := range iters {
 			seq(yield)
 		}
@@ -462,6 +796,7 @@ func ApiGet(ctx context.Context, path string) ([]byte, error) {
 		return nil, fmt.Errorf("failed to create GET: %w", err)
 	}
 	req.Header.Set("X-Hishtory-Version", "v0."+Version)
+	req.Header.Set("X-Hishtory-Protocol-Version", strconv.Itoa(shared.ProtocolVersion))
 	req.Header.Set("X-Hishtory-Device-Id", hctx.GetConf(ctx).DeviceId)
 	req.Header.Set("X-Hishtory-User-Id", data.UserId(hctx.GetConf(ctx).UserSecret))
 	resp, err := GetHttpClient().Do(req)
@@ -469,6 +804,8 @@ func ApiGet(ctx context.Context, path string) ([]byte, error) {
 		return nil, fmt.Errorf("failed to GET %s%s: %w", GetServerHostname(), path, err)
 	}
 	defer resp.Body.Close()
+	updateServerCompressionSupport(resp)
+	updateServerProtocolVersion(resp)
 	if resp.StatusCode != 200 {
 		return nil, fmt.Errorf("failed to GET %s%s: status_code=%d", GetServerHostname(), path, resp.StatusCode)
 	}
@@ -481,17 +818,43 @@ func ApiGet(ctx context.Context, path string) ([]byte, error) {
 	return respBody, nil
 }
 
+// Whether the backend has advertised (via the Accept-Encoding response header, per RFC 7694)
+// that it accepts gzip'd request bodies. Starts out false so that the first request to an older
+// backend is never compressed, and flips to true once a response advertises support.
+var serverAcceptsCompressedBodies atomic.Bool
+
+// Request bodies smaller than this aren't worth compressing, since the bandwidth savings for a
+// single history entry don't justify the CPU cost
+const compressionThresholdBytes = 4096
+
 func ApiPost(ctx context.Context, path, contentType string, reqBody []byte) ([]byte, error) {
 	if os.Getenv("HISHTORY_SIMULATE_NETWORK_ERROR") != "" {
 		return nil, fmt.Errorf("simulated network error: dial tcp: lookup api.hishtory.dev")
 	}
 	start := time.Now()
+	compressed := false
+	if serverAcceptsCompressedBodies.Load() && len(reqBody) >= compressionThresholdBytes {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(reqBody); err != nil {
+			return nil, fmt.Errorf("failed to compress request body: %w", err)
+		}
+		if err := gz.Close(); err != nil {
+			return nil, fmt.Errorf("failed to compress request body: %w", err)
+		}
+		reqBody = buf.Bytes()
+		compressed = true
+	}
 	req, err := http.NewRequest("POST", GetServerHostname()+path, bytes.NewBuffer(reqBody))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create POST: %w", err)
 	}
 	req.Header.Set("Content-Type", contentType)
+	if compressed {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
 	req.Header.Set("X-Hishtory-Version", "v0."+Version)
+	req.Header.Set("X-Hishtory-Protocol-Version", strconv.Itoa(shared.ProtocolVersion))
 	req.Header.Set("X-Hishtory-Device-Id", hctx.GetConf(ctx).DeviceId)
 	req.Header.Set("X-Hishtory-User-Id", data.UserId(hctx.GetConf(ctx).UserSecret))
 	resp, err := GetHttpClient().Do(req)
@@ -499,6 +862,8 @@ func ApiPost(ctx context.Context, path, contentType string, reqBody []byte) ([]b
 		return nil, fmt.Errorf("failed to POST %s: %w", GetServerHostname()+path, err)
 	}
 	defer resp.Body.Close()
+	updateServerCompressionSupport(resp)
+	updateServerProtocolVersion(resp)
 	if resp.StatusCode != 200 {
 		return nil, fmt.Errorf("failed to POST %s: status_code=%d", GetServerHostname()+path, resp.StatusCode)
 	}
@@ -511,6 +876,44 @@ func ApiPost(ctx context.Context, path, contentType string, reqBody []byte) ([]b
 	return respBody, nil
 }
 
+// updateServerCompressionSupport records whether the backend accepts gzip'd request bodies, as
+// advertised via the Accept-Encoding response header. Note that response *decompression* needs no
+// handling here, since net/http transparently negotiates and decompresses gzip'd responses.
+func updateServerCompressionSupport(resp *http.Response) {
+	if strings.Contains(resp.Header.Get("Accept-Encoding"), "gzip") {
+		serverAcceptsCompressedBodies.Store(true)
+	}
+}
+
+// The wire protocol version that the backend advertised via the X-Hishtory-Protocol-Version
+// response header, or zero if it hasn't advertised one (e.g. an older backend)
+var serverProtocolVersion atomic.Int64
+
+// updateServerProtocolVersion records the wire protocol version that the backend speaks, so that
+// UnmarshalServerResponse can turn decode failures against newer backends into a clear "please
+// update" message
+func updateServerProtocolVersion(resp *http.Response) {
+	if version, err := strconv.Atoi(resp.Header.Get("X-Hishtory-Protocol-Version")); err == nil {
+		serverProtocolVersion.Store(int64(version))
+	}
+}
+
+// UnmarshalServerResponse unmarshals a JSON response from the backend. It is a drop-in
+// replacement for json.Unmarshal, except that if decoding fails against a backend that speaks a
+// newer wire protocol version than this client, the returned error tells the user to update
+// hishtory on this device, rather than surfacing an opaque JSON decode failure caused by the
+// version skew.
+func UnmarshalServerResponse(respBody []byte, out any) error {
+	err := json.Unmarshal(respBody, out)
+	if err == nil {
+		return nil
+	}
+	if serverVersion := serverProtocolVersion.Load(); serverVersion > shared.ProtocolVersion {
+		return fmt.Errorf("the server speaks protocol version %d, but this client only supports version %d, please update hishtory on this device (e.g. via `hishtory update`): %w", serverVersion, shared.ProtocolVersion, err)
+	}
+	return err
+}
+
 func IsOfflineError(ctx context.Context, err error) bool {
 	if err == nil {
 		return false
@@ -591,9 +994,13 @@ func RetryingDbFunctionWithResult[T any](dbFunc func() (T, error)) (T, error) {
 
 func ReliableDbCreate(db *gorm.DB, entry data.HistoryEntry) error {
 	entry = normalizeEntryTimezone(entry)
-	return RetryingDbFunction(func() error {
+	err := RetryingDbFunction(func() error {
 		return db.Create(entry).Error
 	})
+	if err == nil {
+		IncrementDayAggregates(db, entry)
+	}
+	return err
 }
 
 func EncryptAndMarshal(config *hctx.ClientConfig, entries []*data.HistoryEntry) ([]byte, error) {
@@ -643,11 +1050,30 @@ func Reupload(ctx context.Context) error {
 		if len(entries) == 0 {
 			if currentOffset == 0 && numEntries != 0 {
 				return fmt.Errorf("found no entries for reuploading, something went wrong")
-			} else {
-				return nil
 			}
+			// Everything that the backend was missing has now been uploaded and acked, so the
+			// upload journal can be settled in full
+			err = RetryingDbFunction(func() error {
+				return hctx.GetDb(ctx).Exec("DELETE FROM upload_journal_entries").Error
+			})
+			if err != nil {
+				return fmt.Errorf("failed to clear the upload journal after reuploading: %w", err)
+			}
+			return nil
 		}
 		currentOffset += searchChunkSize
+		// Never upload entries that the secret scanner flagged as local-only
+		entries = slices.DeleteFunc(entries, func(entry *data.HistoryEntry) bool { return entry.LocalOnly })
+		// Ask the backend which of these entries it is actually missing, so that a reupload after
+		// a partial outage only sends the delta rather than the full history
+		numCandidateEntries := len(entries)
+		entries, err = filterToEntriesMissingFromBackend(ctx, entries)
+		if err != nil {
+			return fmt.Errorf("failed to reupload due to failed manifest diff: %w", err)
+		}
+		if bar != nil {
+			_ = bar.Add(numCandidateEntries - len(entries))
+		}
 		// This number is a balance between speed, and ensuring that we don't send too much data
 		// in a single request (since large individual requests are extremely slow). From benchmarking,
 		// it is apparent that this value seems to work quite well.
@@ -673,12 +1099,59 @@ func Reupload(ctx context.Context) error {
 	}
 }
 
+// filterToEntriesMissingFromBackend sends the backend a compact manifest of the given entries'
+// IDs and filters them down to the ones that the backend has no record of. If the backend is too
+// old to support manifest diffing, this returns all of the entries so that the reupload degrades
+// to the old upload-everything behavior.
+func filterToEntriesMissingFromBackend(ctx context.Context, entries []*data.HistoryEntry) ([]*data.HistoryEntry, error) {
+	config := hctx.GetConf(ctx)
+	missingIds := make(map[string]bool)
+	// This number bounds the size of each manifest request while still keeping the number of
+	// round-trips low for large histories
+	manifestChunkSize := 10_000
+	for _, chunk := range shared.Chunks(entries, manifestChunkSize) {
+		entryIds := make([]string, 0, len(chunk))
+		for _, entry := range chunk {
+			entryIds = append(entryIds, entry.EntryId)
+		}
+		reqBody, err := json.Marshal(shared.ManifestDiffRequest{EntryIds: entryIds})
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal the manifest diff request: %w", err)
+		}
+		respBody, err := ApiPost(ctx, "/api/v1/manifest-diff?user_id="+data.UserId(config.UserSecret), "application/json", reqBody)
+		if err != nil {
+			if strings.Contains(err.Error(), "status_code=404") {
+				// The backend doesn't support manifest diffing, so upload everything
+				return entries, nil
+			}
+			return nil, err
+		}
+		var resp shared.ManifestDiffResponse
+		if err := UnmarshalServerResponse(respBody, &resp); err != nil {
+			return nil, fmt.Errorf("failed to parse the manifest diff response: %w", err)
+		}
+		for _, id := range resp.MissingEntryIds {
+			missingIds[id] = true
+		}
+	}
+	missingEntries := make([]*data.HistoryEntry, 0)
+	for _, entry := range entries {
+		if missingIds[entry.EntryId] {
+			missingEntries = append(missingEntries, entry)
+		}
+	}
+	return missingEntries, nil
+}
+
 func RetrieveAdditionalEntriesFromRemote(ctx context.Context, queryReason string) error {
 	db := hctx.GetDb(ctx)
 	config := hctx.GetConf(ctx)
 	if config.IsOffline {
 		return nil
 	}
+	if err := maybeLazyFetchRecentRemoteEntries(ctx); err != nil {
+		return err
+	}
 	respBody, err := ApiGet(ctx, "/api/v1/query?device_id="+config.DeviceId+"&user_id="+data.UserId(config.UserSecret)+"&queryReason="+queryReason)
 	if IsOfflineError(ctx, err) {
 		return nil
@@ -687,7 +1160,7 @@ func RetrieveAdditionalEntriesFromRemote(ctx context.Context, queryReason string
 		return err
 	}
 	var retrievedEntries []*shared.EncHistoryEntry
-	err = json.Unmarshal(respBody, &retrievedEntries)
+	err = UnmarshalServerResponse(respBody, &retrievedEntries)
 	if err != nil {
 		return fmt.Errorf("failed to load JSON response: %w", err)
 	}
@@ -696,11 +1169,54 @@ func RetrieveAdditionalEntriesFromRemote(ctx context.Context, queryReason string
 		if err != nil {
 			return fmt.Errorf("failed to decrypt history entry from server: %w", err)
 		}
-		AddToDbIfNew(db, decEntry)
+		if AddToDbIfNew(db, decEntry) && decEntry.DeviceId != config.DeviceId {
+			notifyRemoteEntrySynced(ctx, decEntry)
+		}
 	}
 	return ProcessDeletionRequests(ctx)
 }
 
+// The number of the most recent remote entries that each query lazily fetches while the initial
+// device sync is still incomplete
+const lazySearchFetchPageSize = 1000
+
+// maybeLazyFetchRecentRemoteEntries makes brand new devices immediately useful: while the initial
+// sync is still downloading the full history dump, each query fetches and decrypts the most
+// recent remote entries on demand, so that searches cover recent history even before the full
+// download finishes. Entries stay end-to-end encrypted, they're just downloaded lazily.
+func maybeLazyFetchRecentRemoteEntries(ctx context.Context) error {
+	config := hctx.GetConf(ctx)
+	if !config.LazySearchFetch || !config.InitialSyncInProgress {
+		return nil
+	}
+	respBody, err := ApiGet(ctx, fmt.Sprintf("/api/v1/bootstrap-paginated?user_id=%s&device_id=%s&limit=%d&order=desc", data.UserId(config.UserSecret), config.DeviceId, lazySearchFetchPageSize))
+	if IsOfflineError(ctx, err) {
+		return nil
+	}
+	if err != nil {
+		if strings.Contains(err.Error(), "status_code=404") {
+			// The server is an old version that doesn't support paginated bootstrapping, so there
+			// is nothing to lazily fetch from
+			return nil
+		}
+		return err
+	}
+	var retrievedEntries []*shared.EncHistoryEntry
+	err = UnmarshalServerResponse(respBody, &retrievedEntries)
+	if err != nil {
+		return fmt.Errorf("failed to load JSON response: %w", err)
+	}
+	db := hctx.GetDb(ctx)
+	for _, entry := range retrievedEntries {
+		decEntry, err := data.DecryptHistoryEntry(config.UserSecret, *entry)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt history entry from server: %w", err)
+		}
+		AddToDbIfNew(db, decEntry)
+	}
+	return nil
+}
+
 func ProcessDeletionRequests(ctx context.Context) error {
 	config := hctx.GetConf(ctx)
 	if config.IsOffline {
@@ -714,7 +1230,7 @@ func ProcessDeletionRequests(ctx context.Context) error {
 		return err
 	}
 	var deletionRequests []*shared.DeletionRequest
-	err = json.Unmarshal(resp, &deletionRequests)
+	err = UnmarshalServerResponse(resp, &deletionRequests)
 	if err != nil {
 		return err
 	}
@@ -880,6 +1396,23 @@ func retryingSearch(ctx context.Context, db *gorm.DB, query string, limit, offse
 	if err != nil {
 		return nil, err
 	}
+	tx = applySearchOrdering(ctx, tx, limit, offset)
+	var historyEntries []*data.HistoryEntry
+	result := tx.Find(&historyEntries)
+	if result.Error != nil {
+		if strings.Contains(result.Error.Error(), SQLITE_LOCKED_ERR_MSG) && currentRetryNum < SEARCH_RETRY_COUNT {
+			hctx.GetLogger().Infof("Ignoring err=%v and retrying search query, cnt=%d", result.Error, currentRetryNum)
+			time.Sleep(time.Duration(currentRetryNum*rand.Intn(50)) * time.Millisecond)
+			return retryingSearch(ctx, db, query, limit, offset, currentRetryNum+1)
+		}
+		return nil, fmt.Errorf("DB query error: %w", result.Error)
+	}
+	return historyEntries, nil
+}
+
+// applySearchOrdering applies the ordering, limit, and offset that all search queries use to the
+// given transaction
+func applySearchOrdering(ctx context.Context, tx *gorm.DB, limit, offset int) *gorm.DB {
 	if hctx.GetConf(ctx).EnablePresaving {
 		// Sort by StartTime when presaving is enabled, since presaved entries may not have an end time
 		tx = tx.Order("start_time DESC")
@@ -892,17 +1425,42 @@ func retryingSearch(ctx context.Context, db *gorm.DB, query string, limit, offse
 	if offset > 0 {
 		tx = tx.Offset(offset)
 	}
-	var historyEntries []*data.HistoryEntry
-	result := tx.Find(&historyEntries)
+	return tx
+}
+
+// ExplainSearch prints the SQL that the given search query generates, sqlite's plan for executing
+// it, and how long it actually takes, to help diagnose slow searches over large histories. The
+// indices created by `hishtory optimize-db` show up in the query plan once sqlite uses them.
+func ExplainSearch(ctx context.Context, db *gorm.DB, query string, limit int) error {
+	tx, err := MakeWhereQueryFromSearch(ctx, db, query)
+	if err != nil {
+		return err
+	}
+	tx = applySearchOrdering(ctx, tx, limit, 0)
+	var entries []*data.HistoryEntry
+	stmt := tx.Session(&gorm.Session{DryRun: true}).Find(&entries).Statement
+	fmt.Println("SQL:")
+	fmt.Println("  " + db.Dialector.Explain(stmt.SQL.String(), stmt.Vars...))
+	var plan []struct {
+		Id     int
+		Parent int
+		Detail string
+	}
+	result := db.WithContext(ctx).Raw("EXPLAIN QUERY PLAN "+stmt.SQL.String(), stmt.Vars...).Scan(&plan)
 	if result.Error != nil {
-		if strings.Contains(result.Error.Error(), SQLITE_LOCKED_ERR_MSG) && currentRetryNum < SEARCH_RETRY_COUNT {
-			hctx.GetLogger().Infof("Ignoring err=%v and retrying search query, cnt=%d", result.Error, currentRetryNum)
-			time.Sleep(time.Duration(currentRetryNum*rand.Intn(50)) * time.Millisecond)
-			return retryingSearch(ctx, db, query, limit, offset, currentRetryNum+1)
-		}
-		return nil, fmt.Errorf("DB query error: %w", result.Error)
+		return fmt.Errorf("failed to retrieve the query plan: %w", result.Error)
 	}
-	return historyEntries, nil
+	fmt.Println("Query plan:")
+	for _, row := range plan {
+		fmt.Println("  " + row.Detail)
+	}
+	start := time.Now()
+	results, err := Search(ctx, db, query, limit)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Timing:\n  %d results in %s\n", len(results), time.Since(start).String())
+	return nil
 }
 
 var SUPPORTED_DEFAULT_COLUMNS = []string{"command", "hostname", "current_working_directory"}
@@ -937,10 +1495,24 @@ func parseAtomizedToken(ctx context.Context, token string) (string, any, any, er
 	val := unescape(splitToken[1])
 	switch field {
 	case "user":
-		return "(local_username = ?)", val, nil, nil
+		// Match the original user too, so that commands run under sudo/su are still findable
+		// by the user that actually typed them
+		return "(local_username = ? OR original_username = ?)", val, val, nil
 	case "host":
 		fallthrough
 	case "hostname":
+		aliasedHostnames, err := getHostnamesMatchingAlias(ctx, val)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		if len(aliasedHostnames) > 0 {
+			// The value is a configured hostname alias, so also match the hostnames that alias to it
+			serialized, err := json.Marshal(aliasedHostnames)
+			if err != nil {
+				return "", nil, nil, fmt.Errorf("failed to serialize aliased hostnames: %w", err)
+			}
+			return "(instr(hostname, ?) > 0 OR hostname IN (SELECT value FROM json_each(?)))", val, string(serialized), nil
+		}
 		return "(instr(hostname, ?) > 0)", val, nil, nil
 	case "cwd":
 		return "(instr(current_working_directory, ?) > 0 OR instr(REPLACE(current_working_directory, '~/', home_directory), ?) > 0)", strings.TrimSuffix(val, "/"), strings.TrimSuffix(val, "/"), nil
@@ -976,6 +1548,86 @@ func parseAtomizedToken(ctx context.Context, token string) (string, any, any, er
 		return "(CAST(strftime(\"%s\",end_time) AS INTEGER) = ?)", strconv.FormatInt(t.Unix(), 10), nil, nil
 	case "command":
 		return "(instr(command, ?) > 0)", val, nil, nil
+	case "command_length", "len":
+		op, num, err := parseNumericAtomValue(val)
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("failed to parse %s:%s as a number: %w", field, val, err)
+		}
+		return fmt.Sprintf("(LENGTH(command) %s ?)", op), num, nil, nil
+	case "args", "arg_count":
+		op, num, err := parseNumericAtomValue(val)
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("failed to parse %s:%s as a number: %w", field, val, err)
+		}
+		// Note that this approximates the argument count as the number of space characters in the
+		// command, which matches the Arg Count column for commands that are separated by single spaces
+		return fmt.Sprintf("((LENGTH(TRIM(command)) - LENGTH(REPLACE(TRIM(command), ' ', ''))) %s ?)", op), num, nil, nil
+	case "pipeline", "pipeline_stages":
+		op, num, err := parseNumericAtomValue(val)
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("failed to parse %s:%s as a number: %w", field, val, err)
+		}
+		return fmt.Sprintf("((LENGTH(command) - LENGTH(REPLACE(command, '|', '')) + 1) %s ?)", op), num, nil, nil
+	case "shlvl":
+		op, num, err := parseNumericAtomValue(val)
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("failed to parse %s:%s as a number: %w", field, val, err)
+		}
+		return fmt.Sprintf("(shlvl %s ?)", op), num, nil, nil
+	case "parent", "parent_process":
+		return "(instr(parent_process, ?) > 0)", val, nil, nil
+	case "tty":
+		return "(instr(tty, ?) > 0)", val, nil, nil
+	case "terminal", "term_program":
+		return "(instr(term_program, ?) > 0)", val, nil, nil
+	case "session", "session_id":
+		if val == "current" {
+			sessionId := os.Getenv("HISHTORY_SESSION_ID")
+			if sessionId == "" {
+				return "", nil, nil, fmt.Errorf("cannot search session:current because HISHTORY_SESSION_ID is not set, are you running outside of a shell with hishtory hooks?")
+			}
+			return "(session_id = ?)", sessionId, nil, nil
+		}
+		// Support searching by the truncated session ID prefix that the Session column displays
+		return "(instr(session_id, ?) = 1)", val, nil, nil
+	case "device", "device_id":
+		deviceIds := make([]string, 0)
+		for deviceId, name := range hctx.GetConf(ctx).DeviceNames {
+			if name == val {
+				deviceIds = append(deviceIds, deviceId)
+			}
+		}
+		if len(deviceIds) > 0 {
+			// The value is a configured device name, so match all the devices with that name
+			serialized, err := json.Marshal(deviceIds)
+			if err != nil {
+				return "", nil, nil, fmt.Errorf("failed to serialize device IDs: %w", err)
+			}
+			return "(device_id IN (SELECT value FROM json_each(?)) OR instr(device_id, ?) = 1)", string(serialized), val, nil
+		}
+		// Support searching by the truncated device ID prefix that the Device column displays
+		return "(instr(device_id, ?) = 1)", val, nil, nil
+	case "repo", "git_repo":
+		return "(instr(git_repo, ?) > 0)", val, nil, nil
+	case "branch", "git_branch":
+		return "(instr(git_branch, ?) > 0)", val, nil, nil
+	case "had_stderr":
+		// Note that entries recorded without output capture have a NULL had_stderr, so they
+		// never match this atom
+		switch val {
+		case "true":
+			return "(had_stderr = ?)", true, nil, nil
+		case "false":
+			return "(had_stderr = ?)", false, nil, nil
+		default:
+			return "", nil, nil, fmt.Errorf("failed to parse had_stderr:%s, must be one of true/false", val)
+		}
+	case "output_size":
+		op, num, err := parseNumericAtomValue(val)
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("failed to parse %s:%s as a number: %w", field, val, err)
+		}
+		return fmt.Sprintf("(output_size %s ?)", op), num, nil, nil
 	default:
 		q, args, err := buildCustomColumnSearchQuery(ctx, field, val)
 		if err != nil {
@@ -988,6 +1640,83 @@ func parseAtomizedToken(ctx context.Context, token string) (string, any, any, er
 	}
 }
 
+// If the given search value is a configured hostname alias, return the hostnames in the local DB
+// that alias to it (so that e.g. `hostname:aws-dev` matches entries recorded on `ip-10-0-1-2`).
+// Returns nil if the value isn't an alias or if no stored hostnames match.
+func getHostnamesMatchingAlias(ctx context.Context, alias string) ([]string, error) {
+	config := hctx.GetConf(ctx)
+	isAlias := false
+	for _, a := range config.HostnameAliases {
+		if a == alias {
+			isAlias = true
+			break
+		}
+	}
+	if !isAlias {
+		return nil, nil
+	}
+	hostnames, err := getDistinctHostnamesFromDb(ctx)
+	if err != nil {
+		return nil, err
+	}
+	matchingHostnames := make([]string, 0)
+	for _, hostname := range hostnames {
+		if AliasedHostname(ctx, hostname) == alias {
+			matchingHostnames = append(matchingHostnames, hostname)
+		}
+	}
+	return matchingHostnames, nil
+}
+
+var cachedDistinctHostnames []string
+
+func getDistinctHostnamesFromDb(ctx context.Context) ([]string, error) {
+	if len(cachedDistinctHostnames) > 0 {
+		// Note: We memoize this function since it is called repeatedly in the TUI and querying the
+		// entire DB for every updated search is quite inefficient. This is reasonable since the set
+		// of hostnames shouldn't ever change within the lifetime of one hishtory process.
+		return cachedDistinctHostnames, nil
+	}
+	db := hctx.GetDb(ctx)
+	rows, err := RetryingDbFunctionWithResult(func() (*sql.Rows, error) {
+		return db.Raw("SELECT DISTINCT hostname FROM history_entries").Rows()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for list of hostnames: %w", err)
+	}
+	hostnames := make([]string, 0)
+	for rows.Next() {
+		var hostname string
+		err = rows.Scan(&hostname)
+		if err != nil {
+			return nil, err
+		}
+		hostnames = append(hostnames, hostname)
+	}
+	cachedDistinctHostnames = hostnames
+	return hostnames, nil
+}
+
+// Parse the value of a numeric search atom (e.g. `args:>5`) that optionally starts with a
+// comparison operator. Returns the SQL comparison operator (from a fixed allowlist, so it is
+// safe to interpolate into a query) along with the numeric value. Values with no operator
+// prefix are matched exactly.
+func parseNumericAtomValue(val string) (string, int, error) {
+	op := "="
+	for _, prefix := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(val, prefix) {
+			op = prefix
+			val = strings.TrimPrefix(val, prefix)
+			break
+		}
+	}
+	num, err := strconv.Atoi(val)
+	if err != nil {
+		return "", 0, err
+	}
+	return op, num, nil
+}
+
 func buildCustomColumnSearchQuery(ctx context.Context, columnName, columnVal string) (string, []any, error) {
 	knownCustomColumns, err := GetAllCustomColumnNames(ctx)
 	if err != nil {
@@ -1156,6 +1885,238 @@ func SendDeletionRequest(ctx context.Context, deletionRequest shared.DeletionReq
 	return nil
 }
 
+// How often we remind users to prune their history once their DB crosses the configured thresholds
+const dbSizeWarningInterval = 7 * 24 * time.Hour
+
+// Check whether the local DB has crossed the configured size/count thresholds and, if so, print a warning
+// pointing the user at maintenance commands. Warnings are rate-limited to once per dbSizeWarningInterval
+// so that we nudge users towards maintenance without being overly spammy.
+func MaybeWarnAboutDbSize(ctx context.Context) error {
+	config := hctx.GetConf(ctx)
+	if config.DbSizeWarningThresholdMb < 0 && config.DbCountWarningThreshold < 0 {
+		return nil
+	}
+	if time.Since(time.Unix(config.LastDbSizeWarningTimestamp, 0)) < dbSizeWarningInterval {
+		return nil
+	}
+	warnings := make([]string, 0)
+	if config.DbSizeWarningThresholdMb >= 0 {
+		dbSizeMb, err := GetDbSizeMb(ctx)
+		if err != nil {
+			return err
+		}
+		if dbSizeMb > config.DbSizeWarningThresholdMb {
+			warnings = append(warnings, fmt.Sprintf("Warning: the hishtory DB is %dMB (threshold: %dMB), which may slow down searches.", dbSizeMb, config.DbSizeWarningThresholdMb))
+		}
+	}
+	if config.DbCountWarningThreshold >= 0 {
+		numEntries, err := CountStoredEntries(hctx.GetDb(ctx))
+		if err != nil {
+			return fmt.Errorf("failed to count the number of stored history entries: %w", err)
+		}
+		if numEntries > config.DbCountWarningThreshold {
+			warnings = append(warnings, fmt.Sprintf("Warning: hishtory is storing %d history entries (threshold: %d), which may slow down searches.", numEntries, config.DbCountWarningThreshold))
+		}
+	}
+	if len(warnings) == 0 {
+		return nil
+	}
+	for _, warning := range warnings {
+		fmt.Println(warning)
+	}
+	fmt.Println("Consider deleting unneeded entries (e.g. via `hishtory redact` or a retention policy via `hishtory config-set retention` + `hishtory prune`), or raise these thresholds via `hishtory config-set db-size-warning-threshold`/`hishtory config-set db-count-warning-threshold` (set to -1 to disable this warning).")
+	config.LastDbSizeWarningTimestamp = time.Now().Unix()
+	return hctx.SetConfig(config)
+}
+
+// Commands are considered non-printable-heavy (and thus likely pasted binary/clipboard garbage
+// rather than a real command) if more than this fraction of their runes are non-printable
+const nonPrintableCommandThreshold = 0.25
+
+// IsNonPrintableHeavy returns whether the given command contains so many non-printable characters
+// that it is likely binary/clipboard garbage rather than a real command
+func IsNonPrintableHeavy(cmd string) bool {
+	numNonPrintable := 0
+	numRunes := 0
+	for _, r := range cmd {
+		numRunes++
+		if r == '\t' || r == '\n' || r == '\r' {
+			continue
+		}
+		if !unicode.IsPrint(r) || r == unicode.ReplacementChar {
+			numNonPrintable++
+		}
+	}
+	return numNonPrintable > 0 && float64(numNonPrintable)/float64(numRunes) > nonPrintableCommandThreshold
+}
+
+// SanitizeNonPrintableCommand replaces all non-printable characters in the given command with the
+// unicode replacement character and appends an explicit marker, so that any printable parts stay
+// searchable without breaking the table renderer
+func SanitizeNonPrintableCommand(cmd string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' || unicode.IsPrint(r) {
+			return r
+		}
+		return unicode.ReplacementChar
+	}, cmd) + " [hishtory:sanitized]"
+}
+
+// Regexes for secrets that should never leave this machine, in the style of gitleaks. These are
+// deliberately high-precision patterns, since a false positive here mangles a legitimate command.
+var secretRegexes = []*regexp.Regexp{
+	// AWS access key IDs
+	regexp.MustCompile(`(A3T[A-Z0-9]|AKIA|AGPA|AIDA|AROA|AIPA|ANPA|ANVA|ASIA)[A-Z0-9]{16}`),
+	// GitHub tokens
+	regexp.MustCompile(`(ghp|gho|ghu|ghs|ghr)_[A-Za-z0-9]{36}`),
+	// GitHub fine-grained personal access tokens
+	regexp.MustCompile(`github_pat_[A-Za-z0-9_]{82}`),
+	// Slack tokens
+	regexp.MustCompile(`xox[baprs]-[A-Za-z0-9-]{10,}`),
+	// Stripe keys
+	regexp.MustCompile(`(sk|rk)_(test|live)_[A-Za-z0-9]{20,}`),
+	// Passwords passed via CLI flags
+	regexp.MustCompile(`--?passw(or)?d(=|\s+)\S+`),
+	// Bearer tokens in curl-style headers
+	regexp.MustCompile(`(?i)authorization:\s*bearer\s+[^'"\s]+`),
+}
+
+// The marker that replaces secrets matched by the secret scanner when secret-scan-mode is `mask`
+const SecretMask = "[hishtory:masked-secret]"
+
+// MaskSecrets scans the given command for secrets (AWS keys, tokens, passwords passed via CLI
+// flags, etc.) and returns the command with any matched substrings replaced by SecretMask, along
+// with whether anything matched
+func MaskSecrets(cmd string) (string, bool) {
+	foundSecret := false
+	for _, secretRegex := range secretRegexes {
+		if secretRegex.MatchString(cmd) {
+			foundSecret = true
+			cmd = secretRegex.ReplaceAllString(cmd, SecretMask)
+		}
+	}
+	return cmd, foundSecret
+}
+
+// ApplySecretScan applies the given secret-scan-mode to the entry: "mask" replaces any matched
+// secrets with SecretMask, "skip" drops entries containing a secret, and "local-only" flags them
+// so that they are never uploaded. Returns whether the entry should be skipped entirely.
+func ApplySecretScan(mode string, entry *data.HistoryEntry) bool {
+	switch mode {
+	case "mask":
+		entry.Command, _ = MaskSecrets(entry.Command)
+	case "skip":
+		if _, foundSecret := MaskSecrets(entry.Command); foundSecret {
+			return true
+		}
+	case "local-only":
+		if _, foundSecret := MaskSecrets(entry.Command); foundSecret {
+			entry.LocalOnly = true
+		}
+	}
+	return false
+}
+
+// The marker appended to commands that were truncated because they exceeded the configured
+// max-command-length, so that truncated entries are identifiable (e.g. via `hishtory doctor`)
+const CommandTruncationMarker = " [hishtory:truncated]"
+
+// MaybeTruncateCommand truncates the given command to the configured max-command-length, appending
+// an explicit truncation marker so that truncated entries are identifiable
+func MaybeTruncateCommand(ctx context.Context, cmd string) string {
+	maxLength := hctx.GetConf(ctx).MaxCommandLength
+	if maxLength <= 0 || len(cmd) <= maxLength {
+		return cmd
+	}
+	return cmd[:maxLength] + CommandTruncationMarker
+}
+
+// GetDbSizeMb returns the size of the local DB file in megabytes
+func GetDbSizeMb(ctx context.Context) (int64, error) {
+	dbPath := filepath.Join(hctx.GetHome(ctx), data.GetHishtoryPath(), data.DB_PATH)
+	fileInfo, err := os.Stat(dbPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check the size of the hishtory DB: %w", err)
+	}
+	return fileInfo.Size() / 1_000_000, nil
+}
+
+// MaybeEvictOldEntries checks whether the local DB has exceeded the configured max-db-size and, if
+// so, evicts the oldest entries from the local DB until it is back under the limit. This only
+// deletes local copies (e.g. for constrained devices); remote copies on other devices are left
+// intact, so no deletion requests are issued.
+func MaybeEvictOldEntries(ctx context.Context) error {
+	config := hctx.GetConf(ctx)
+	if config.MaxDbSizeMb <= 0 {
+		return nil
+	}
+	dbSizeMb, err := GetDbSizeMb(ctx)
+	if err != nil {
+		return err
+	}
+	if dbSizeMb <= config.MaxDbSizeMb {
+		return nil
+	}
+	db := hctx.GetDb(ctx)
+	numEntries, err := CountStoredEntries(db)
+	if err != nil {
+		return err
+	}
+	if numEntries == 0 {
+		return nil
+	}
+	// Estimate the number of entries to evict based on the fraction of the DB that is over the
+	// limit, with 10% of slack since the file doesn't shrink until it is vacuumed
+	numToEvict := int64(float64(numEntries) * (1.1 - float64(config.MaxDbSizeMb)/float64(dbSizeMb)))
+	if numToEvict <= 0 {
+		return nil
+	}
+	if numToEvict > numEntries {
+		numToEvict = numEntries
+	}
+	err = RetryingDbFunction(func() error {
+		// Order by start_time rather than end_time: presaved entries use an end_time of the unix
+		// epoch as a sentinel, which would otherwise make them the first ones evicted no matter
+		// how recently they started
+		return db.Exec("DELETE FROM history_entries WHERE rowid IN (SELECT rowid FROM history_entries ORDER BY start_time ASC LIMIT ?)", numToEvict).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to evict old history entries: %w", err)
+	}
+	// Vacuum so that the DB file actually shrinks below the configured limit
+	if err := db.Exec("VACUUM").Error; err != nil {
+		return fmt.Errorf("failed to vacuum the DB after evicting old history entries: %w", err)
+	}
+	hctx.GetLogger().Infof("Evicted %d old history entries from the local DB to stay under max-db-size=%dMB (remote copies are unaffected)", numToEvict, config.MaxDbSizeMb)
+	return nil
+}
+
+// ParseRetentionDuration parses a retention policy like "90d", "26w", "6m", or "1y" into a
+// time.Duration. Months and years are approximated as 30 and 365 days respectively.
+func ParseRetentionDuration(val string) (time.Duration, error) {
+	val = strings.TrimSpace(val)
+	if len(val) < 2 {
+		return 0, fmt.Errorf("failed to parse retention policy %#v, must be a number followed by one of d/w/m/y (e.g. 90d or 1y)", val)
+	}
+	num, err := strconv.Atoi(val[:len(val)-1])
+	if err != nil || num <= 0 {
+		return 0, fmt.Errorf("failed to parse retention policy %#v, must be a number followed by one of d/w/m/y (e.g. 90d or 1y)", val)
+	}
+	day := 24 * time.Hour
+	switch val[len(val)-1] {
+	case 'd':
+		return time.Duration(num) * day, nil
+	case 'w':
+		return time.Duration(num) * 7 * day, nil
+	case 'm':
+		return time.Duration(num) * 30 * day, nil
+	case 'y':
+		return time.Duration(num) * 365 * day, nil
+	default:
+		return 0, fmt.Errorf("failed to parse retention policy %#v, must be a number followed by one of d/w/m/y (e.g. 90d or 1y)", val)
+	}
+}
+
 func CountStoredEntries(db *gorm.DB) (int64, error) {
 	return RetryingDbFunctionWithResult(func() (int64, error) {
 		var count int64
@@ -0,0 +1,73 @@
+package lib
+
+import (
+	"strings"
+)
+
+// sshFlagsWithArguments is the set of ssh flags that consume the next argument, so that parsing
+// `ssh -p 2222 example.com` doesn't mistake the port for the target host
+var sshFlagsWithArguments = map[string]bool{
+	"-B": true,
+	"-b": true,
+	"-c": true,
+	"-D": true,
+	"-E": true,
+	"-e": true,
+	"-F": true,
+	"-I": true,
+	"-i": true,
+	"-J": true,
+	"-L": true,
+	"-l": true,
+	"-m": true,
+	"-O": true,
+	"-o": true,
+	"-P": true,
+	"-p": true,
+	"-Q": true,
+	"-R": true,
+	"-S": true,
+	"-W": true,
+	"-w": true,
+}
+
+// ParseSshRemoteHost returns the target host of an ssh invocation (e.g. "user@prod-host" for
+// `ssh -p 2222 user@prod-host uptime`), or an empty string if the given command isn't an ssh
+// invocation or its target couldn't be determined. Commands where ssh appears later in a
+// pipeline or after env var assignments are intentionally not parsed, since reliably tokenizing
+// arbitrary shell syntax isn't possible here.
+func ParseSshRemoteHost(command string) string {
+	tokens := strings.Fields(command)
+	if len(tokens) < 2 || tokens[0] != "ssh" {
+		return ""
+	}
+	loginName := ""
+	for i := 1; i < len(tokens); i++ {
+		token := tokens[i]
+		if strings.HasPrefix(token, "-") {
+			if token == "-l" && i+1 < len(tokens) {
+				loginName = tokens[i+1]
+			}
+			if sshFlagsWithArguments[token] {
+				i++
+			}
+			continue
+		}
+		if strings.HasPrefix(token, "ssh://") {
+			token = strings.TrimPrefix(token, "ssh://")
+			// Strip any path and port suffix from the URI form
+			token, _, _ = strings.Cut(token, "/")
+			if lastColon := strings.LastIndex(token, ":"); lastColon != -1 {
+				token = token[:lastColon]
+			}
+		}
+		if token == "" {
+			return ""
+		}
+		if loginName != "" && !strings.Contains(token, "@") {
+			return loginName + "@" + token
+		}
+		return token
+	}
+	return ""
+}
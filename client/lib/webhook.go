@@ -0,0 +1,37 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/ddworken/hishtory/client/data"
+	"github.com/ddworken/hishtory/client/hctx"
+)
+
+// ShareEntryToWebhook posts a formatted snippet of the given history entry (command, host, time,
+// and exit code) to the webhook URL configured via `hishtory config-set webhook-url`. The payload
+// is a JSON object with a single "text" field, so any Slack-compatible incoming webhook works.
+func ShareEntryToWebhook(ctx context.Context, entry *data.HistoryEntry) error {
+	config := hctx.GetConf(ctx)
+	if config.WebhookUrl == "" {
+		return fmt.Errorf("no webhook URL is configured, set one via `hishtory config-set webhook-url <url>`")
+	}
+	text := fmt.Sprintf("`%s` ran on %s at %s (exit code %d)", entry.Command, entry.Hostname, entry.StartTime.Local().Format(config.TimestampFormat), entry.ExitCode)
+	payload, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return fmt.Errorf("failed to serialize the webhook payload: %w", err)
+	}
+	resp, err := GetHttpClient().Post(config.WebhookUrl, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to post to the configured webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("the configured webhook returned status code %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -38,6 +38,8 @@ type Model struct {
 	hcol    int
 	hstep   int
 	hcursor int
+
+	softWrap bool
 }
 
 // CellPosition holds row and column indexes.
@@ -536,6 +538,19 @@ func (m *Model) MoveRight(n int) {
 	m.UpdateViewport()
 }
 
+// ToggleSoftWrap toggles soft-wrapping of the selected row. When enabled, cells in the selected
+// row that are too long to fit in their column are wrapped onto multiple lines instead of being
+// truncated, so that e.g. a long command can be read in place.
+func (m *Model) ToggleSoftWrap() {
+	m.softWrap = !m.softWrap
+	m.UpdateViewport()
+}
+
+// SoftWrapEnabled returns whether soft-wrapping of the selected row is enabled.
+func (m Model) SoftWrapEnabled() bool {
+	return m.softWrap
+}
+
 // FromValues create the table rows from a simple string. It uses `\n` by
 // default for getting all the rows and the given separator for the fields on
 // each row.
@@ -573,8 +588,36 @@ func (m *Model) columnNeedsScrolling(columnIdxToCheck int) bool {
 	return false
 }
 
+// rowNeedsWrapping returns whether any cell in the given row is too wide for its column
+func (m *Model) rowNeedsWrapping(rowID int) bool {
+	for columnIdx, value := range m.rows[rowID] {
+		if RuneWidthWithCache(strings.TrimRight(value, " ")) > m.cols[columnIdx].Width {
+			return true
+		}
+	}
+	return false
+}
+
+// renderSoftWrappedRow renders the given row with overly long cells wrapped onto multiple lines
+// instead of truncated. Note that this skips Styles.RenderCell (and thus the highlighting of
+// matches), since the cell renderer assumes single-line cells.
+func (m *Model) renderSoftWrappedRow(rowID int) string {
+	s := make([]string, 0, len(m.cols))
+	for i, value := range m.rows[rowID] {
+		// Strip the padding that was added to fill the column, since otherwise it would wrap
+		// onto blank continuation lines
+		wrapped := runewidth.Wrap(strings.TrimRight(value, " "), m.cols[i].Width)
+		s = append(s, m.styles.Cell.Render(lipgloss.NewStyle().Width(m.cols[i].Width).Render(wrapped)))
+	}
+	row := lipgloss.JoinHorizontal(lipgloss.Top, s...)
+	return m.styles.Selected.Render(row)
+}
+
 func (m *Model) renderRow(rowID int) string {
 	isRowSelected := rowID == m.cursor
+	if m.softWrap && isRowSelected && m.rowNeedsWrapping(rowID) {
+		return m.renderSoftWrappedRow(rowID)
+	}
 	s := make([]string, 0, len(m.cols))
 	for i, value := range m.rows[rowID] {
 		style := lipgloss.NewStyle().Width(m.cols[i].Width).MaxWidth(m.cols[i].Width).Inline(true)
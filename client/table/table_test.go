@@ -65,6 +65,28 @@ func TestHScoll(t *testing.T) {
 	testutils.CompareGoldens(t, table.View(), "unittestTable-truncatedTable-right2")
 }
 
+func TestSoftWrap(t *testing.T) {
+	table := New(
+		WithColumns([]Column{{Title: "Column1", Width: 10}, {Title: "Column2", Width: 20}}),
+		WithRows([]Row{
+			{"a1", "a2345"},
+			{"b1", "b23"},
+			{"c1", "c1234567890abcdefghijklmnopqrstuvwxyz"},
+		}),
+	)
+	// Soft-wrap is off by default, so the long row is truncated
+	testutils.CompareGoldens(t, table.View(), "unittestTable-truncatedTable")
+	// Toggling it on doesn't change anything while a short row is selected
+	table.ToggleSoftWrap()
+	testutils.CompareGoldens(t, table.View(), "unittestTable-truncatedTable")
+	// But once the long row is selected, it gets expanded onto multiple lines
+	table.SetCursor(2)
+	testutils.CompareGoldens(t, table.View(), "unittestTable-softWrappedTable")
+	// And toggling it back off re-truncates it
+	table.ToggleSoftWrap()
+	testutils.CompareGoldens(t, table.View(), "unittestTable-truncatedTable-selected2")
+}
+
 func deepEqual(a, b []Row) bool {
 	if len(a) != len(b) {
 		return false
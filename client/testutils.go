@@ -72,6 +72,69 @@ func (b bashTester) ShellName() string {
 	return "bash"
 }
 
+// bash32Tester is a bashTester that runs scripts under a specific bash binary, used for testing
+// that the shell hooks still work under bash 3.2 (the version that stock macOS still ships). Use
+// findBash32Binary to locate such a binary.
+type bash32Tester struct {
+	bashPath string
+}
+
+func (b bash32Tester) RunInteractiveShell(t testing.TB, script string) string {
+	out, err := b.RunInteractiveShellRelaxed(t, "set -emo pipefail\n"+script)
+	if err != nil {
+		_, filename, line, _ := runtime.Caller(1)
+		require.NoError(t, err, fmt.Sprintf("error when running command at %s:%dv", filename, line))
+	}
+	return out
+}
+
+func (b bash32Tester) RunInteractiveShellRelaxed(t testing.TB, script string) (string, error) {
+	cmd := exec.Command(b.bashPath, "-i")
+	cmd.Stdin = strings.NewReader(script)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("unexpected error when running commands, out=%#v, err=%#v: %w", stdout.String(), stderr.String(), err)
+	}
+	outStr := stdout.String()
+	require.NotContains(t, outStr, "hishtory fatal error", "Ran command, but hishtory had a fatal error!")
+	return outStr, nil
+}
+
+func (b bash32Tester) RunInteractiveShellBackground(t testing.TB, script string) error {
+	cmd := exec.Command(b.bashPath, "-i")
+	// SetSid: true is required to prevent SIGTTIN signal killing the entire test
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	cmd.Stdin = strings.NewReader(script)
+	cmd.Stdout = nil
+	cmd.Stderr = nil
+	return cmd.Start()
+}
+
+func (b bash32Tester) ShellName() string {
+	return "bash"
+}
+
+// findBash32Binary returns the path to a bash 3.2 binary if one is available (either a dedicated
+// bash-3.2 binary on the PATH, or /bin/bash on macOS where that is still bash 3.2), or "" if
+// there isn't one, in which case the bash 3.2 tests should be skipped.
+func findBash32Binary() string {
+	for _, candidate := range []string{"bash-3.2", "bash3.2", "bash32", "/bin/bash"} {
+		binaryPath, err := exec.LookPath(candidate)
+		if err != nil {
+			continue
+		}
+		out, err := exec.Command(binaryPath, "-c", `echo "${BASH_VERSINFO[0]}.${BASH_VERSINFO[1]}"`).Output()
+		if err == nil && strings.TrimSpace(string(out)) == "3.2" {
+			return binaryPath
+		}
+	}
+	return ""
+}
+
 type zshTester struct{}
 
 func (z zshTester) RunInteractiveShell(t testing.TB, script string) string {
@@ -0,0 +1,116 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ddworken/hishtory/client/data"
+	"github.com/ddworken/hishtory/client/hctx"
+	"github.com/ddworken/hishtory/client/lib"
+)
+
+// The maximum number of distinct values that tab completion for a search atom cycles through
+const maxAtomCompletions = 10
+
+// The search atoms whose values can be tab-completed from a plain column of the local DB, mapped
+// to that column. Custom column atoms are also completable, but are handled separately since
+// their values live inside the custom_columns JSON blob.
+var completableAtomColumns = map[string]string{
+	"user":     "local_username",
+	"host":     "hostname",
+	"hostname": "hostname",
+	"cwd":      "current_working_directory",
+}
+
+// parseAtomForCompletion checks whether the cursor in the given search query sits in the value of
+// a search atom (e.g. with the cursor at the end of `ls hostname:lap`). If so, it returns the
+// atom name (with any leading `-` for negated atoms stripped), the partially typed value, and the
+// index in the query where that value starts (i.e. just after the colon), so that tab completion
+// can replace the partial value with a completed one.
+func parseAtomForCompletion(query string, cursor int) (atom string, partialValue string, valueStart int, ok bool) {
+	if cursor > len(query) || cursor < 0 {
+		return "", "", 0, false
+	}
+	// Find the start of the whitespace-delimited token that the cursor is in, honoring
+	// backslash-escaped spaces the same way that tokenize() in client/lib does
+	tokenStart := 0
+	for i := cursor - 1; i >= 0; i-- {
+		if query[i] == ' ' && (i == 0 || query[i-1] != '\\') {
+			tokenStart = i + 1
+			break
+		}
+	}
+	token := query[tokenStart:cursor]
+	colonIdx := -1
+	for i := 0; i < len(token); i++ {
+		if token[i] == ':' && (i == 0 || token[i-1] != '\\') {
+			colonIdx = i
+			break
+		}
+	}
+	if colonIdx <= 0 {
+		return "", "", 0, false
+	}
+	atom = strings.TrimPrefix(token[:colonIdx], "-")
+	if atom == "" {
+		return "", "", 0, false
+	}
+	return atom, unescapeAtomValue(token[colonIdx+1:]), tokenStart + colonIdx + 1, true
+}
+
+// unescapeAtomValue removes the backslash escaping from a partially typed atom value (e.g. for
+// escaped spaces in `cwd:foo\ bar`)
+func unescapeAtomValue(val string) string {
+	var sb strings.Builder
+	for i := 0; i < len(val); i++ {
+		if val[i] == '\\' && i+1 < len(val) {
+			i++
+		}
+		sb.WriteByte(val[i])
+	}
+	return sb.String()
+}
+
+// escapeAtomValue backslash-escapes a completed atom value so that it survives query tokenization
+// when inserted into the search box (e.g. for directory names containing spaces)
+func escapeAtomValue(val string) string {
+	return strings.NewReplacer(`\`, `\\`, ` `, `\ `).Replace(val)
+}
+
+// getAtomValueCompletions returns up to maxAtomCompletions distinct values from the local DB for
+// the given search atom that contain the partially typed value, mirroring the substring matching
+// that the atom itself uses when searching. Returns no completions for atoms whose values aren't
+// enumerable (e.g. timestamps).
+func getAtomValueCompletions(ctx context.Context, atom string, partialValue string) ([]string, error) {
+	db := hctx.GetDb(ctx)
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(partialValue) + "%"
+	completions := make([]string, 0)
+	if column, ok := completableAtomColumns[atom]; ok {
+		res := db.Model(&data.HistoryEntry{}).
+			Where(column+` LIKE ? ESCAPE '\' AND `+column+" != ''", pattern).
+			Distinct().
+			Order(column).
+			Limit(maxAtomCompletions).
+			Pluck(column, &completions)
+		if res.Error != nil {
+			return nil, fmt.Errorf("failed to query for %s: completions: %w", atom, res.Error)
+		}
+		return completions, nil
+	}
+	customColumnNames, err := lib.GetAllCustomColumnNames(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the list of custom columns: %w", err)
+	}
+	if !slices.Contains(customColumnNames, atom) {
+		return nil, nil
+	}
+	res := db.Raw(`SELECT DISTINCT json_extract(value, '$.value') FROM history_entries, json_each(custom_columns) `+
+		`WHERE json_extract(value, '$.name') = ? AND json_extract(value, '$.value') LIKE ? ESCAPE '\' ORDER BY 1 LIMIT ?`,
+		atom, pattern, maxAtomCompletions).Scan(&completions)
+	if res.Error != nil {
+		return nil, fmt.Errorf("failed to query for %s: completions: %w", atom, res.Error)
+	}
+	return completions, nil
+}
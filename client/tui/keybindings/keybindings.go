@@ -19,6 +19,16 @@ type SerializableKeyMap struct {
 	TableLeft               []string
 	TableRight              []string
 	DeleteEntry             []string
+	ExplainCommand          []string
+	ShareEntry              []string
+	CycleColumnPreset       []string
+	ToggleSessionFilter     []string
+	ToggleHostFilter        []string
+	RestoreLastState        []string
+	ToggleTaskView          []string
+	ExportTaskScript        []string
+	ToggleSoftWrap          []string
+	CompleteAtomValue       []string
 	Help                    []string
 	Quit                    []string
 	JumpStartOfInput        []string
@@ -102,6 +112,46 @@ func (s SerializableKeyMap) ToKeyMap() KeyMap {
 			key.WithKeys(s.DeleteEntry...),
 			key.WithHelp(prettifyKeyBinding(s.DeleteEntry[0]), "delete the highlighted entry "),
 		),
+		ExplainCommand: key.NewBinding(
+			key.WithKeys(s.ExplainCommand...),
+			key.WithHelp(prettifyKeyBinding(s.ExplainCommand[0]), "explain the highlighted entry "),
+		),
+		ShareEntry: key.NewBinding(
+			key.WithKeys(s.ShareEntry...),
+			key.WithHelp(prettifyKeyBinding(s.ShareEntry[0]), "share the highlighted entry "),
+		),
+		CycleColumnPreset: key.NewBinding(
+			key.WithKeys(s.CycleColumnPreset...),
+			key.WithHelp(prettifyKeyBinding(s.CycleColumnPreset[0]), "cycle through column presets "),
+		),
+		ToggleSessionFilter: key.NewBinding(
+			key.WithKeys(s.ToggleSessionFilter...),
+			key.WithHelp(prettifyKeyBinding(s.ToggleSessionFilter[0]), "filter to this session "),
+		),
+		ToggleHostFilter: key.NewBinding(
+			key.WithKeys(s.ToggleHostFilter...),
+			key.WithHelp(prettifyKeyBinding(s.ToggleHostFilter[0]), "filter to this host "),
+		),
+		RestoreLastState: key.NewBinding(
+			key.WithKeys(s.RestoreLastState...),
+			key.WithHelp(prettifyKeyBinding(s.RestoreLastState[0]), "restore the last search "),
+		),
+		ToggleTaskView: key.NewBinding(
+			key.WithKeys(s.ToggleTaskView...),
+			key.WithHelp(prettifyKeyBinding(s.ToggleTaskView[0]), "group results into tasks "),
+		),
+		ExportTaskScript: key.NewBinding(
+			key.WithKeys(s.ExportTaskScript...),
+			key.WithHelp(prettifyKeyBinding(s.ExportTaskScript[0]), "export the task as a script "),
+		),
+		ToggleSoftWrap: key.NewBinding(
+			key.WithKeys(s.ToggleSoftWrap...),
+			key.WithHelp(prettifyKeyBinding(s.ToggleSoftWrap[0]), "soft-wrap the selected row "),
+		),
+		CompleteAtomValue: key.NewBinding(
+			key.WithKeys(s.CompleteAtomValue...),
+			key.WithHelp(prettifyKeyBinding(s.CompleteAtomValue[0]), "complete search atom values "),
+		),
 		Help: key.NewBinding(
 			key.WithKeys(s.Help...),
 			key.WithHelp(prettifyKeyBinding(s.Help[0]), "help "),
@@ -163,6 +213,36 @@ func (s SerializableKeyMap) WithDefaults() SerializableKeyMap {
 	if len(s.DeleteEntry) == 0 {
 		s.DeleteEntry = DefaultKeyMap.DeleteEntry.Keys()
 	}
+	if len(s.ExplainCommand) == 0 {
+		s.ExplainCommand = DefaultKeyMap.ExplainCommand.Keys()
+	}
+	if len(s.ShareEntry) == 0 {
+		s.ShareEntry = DefaultKeyMap.ShareEntry.Keys()
+	}
+	if len(s.CycleColumnPreset) == 0 {
+		s.CycleColumnPreset = DefaultKeyMap.CycleColumnPreset.Keys()
+	}
+	if len(s.ToggleSessionFilter) == 0 {
+		s.ToggleSessionFilter = DefaultKeyMap.ToggleSessionFilter.Keys()
+	}
+	if len(s.ToggleHostFilter) == 0 {
+		s.ToggleHostFilter = DefaultKeyMap.ToggleHostFilter.Keys()
+	}
+	if len(s.RestoreLastState) == 0 {
+		s.RestoreLastState = DefaultKeyMap.RestoreLastState.Keys()
+	}
+	if len(s.ToggleTaskView) == 0 {
+		s.ToggleTaskView = DefaultKeyMap.ToggleTaskView.Keys()
+	}
+	if len(s.ExportTaskScript) == 0 {
+		s.ExportTaskScript = DefaultKeyMap.ExportTaskScript.Keys()
+	}
+	if len(s.ToggleSoftWrap) == 0 {
+		s.ToggleSoftWrap = DefaultKeyMap.ToggleSoftWrap.Keys()
+	}
+	if len(s.CompleteAtomValue) == 0 {
+		s.CompleteAtomValue = DefaultKeyMap.CompleteAtomValue.Keys()
+	}
 	if len(s.Help) == 0 {
 		s.Help = DefaultKeyMap.Help.Keys()
 	}
@@ -196,6 +276,16 @@ type KeyMap struct {
 	TableLeft               key.Binding
 	TableRight              key.Binding
 	DeleteEntry             key.Binding
+	ExplainCommand          key.Binding
+	ShareEntry              key.Binding
+	CycleColumnPreset       key.Binding
+	ToggleSessionFilter     key.Binding
+	ToggleHostFilter        key.Binding
+	RestoreLastState        key.Binding
+	ToggleTaskView          key.Binding
+	ExportTaskScript        key.Binding
+	ToggleSoftWrap          key.Binding
+	CompleteAtomValue       key.Binding
 	Help                    key.Binding
 	Quit                    key.Binding
 	JumpStartOfInput        key.Binding
@@ -217,6 +307,16 @@ func (k KeyMap) ToSerializable() SerializableKeyMap {
 		TableLeft:               k.TableLeft.Keys(),
 		TableRight:              k.TableRight.Keys(),
 		DeleteEntry:             k.DeleteEntry.Keys(),
+		ExplainCommand:          k.ExplainCommand.Keys(),
+		ShareEntry:              k.ShareEntry.Keys(),
+		CycleColumnPreset:       k.CycleColumnPreset.Keys(),
+		ToggleSessionFilter:     k.ToggleSessionFilter.Keys(),
+		ToggleHostFilter:        k.ToggleHostFilter.Keys(),
+		RestoreLastState:        k.RestoreLastState.Keys(),
+		ToggleTaskView:          k.ToggleTaskView.Keys(),
+		ExportTaskScript:        k.ExportTaskScript.Keys(),
+		ToggleSoftWrap:          k.ToggleSoftWrap.Keys(),
+		CompleteAtomValue:       k.CompleteAtomValue.Keys(),
 		Help:                    k.Help.Keys(),
 		Quit:                    k.Quit.Keys(),
 		JumpStartOfInput:        k.JumpStartOfInput.Keys(),
@@ -243,9 +343,16 @@ func (k KeyMap) ShortHelp() []key.Binding {
 func (k KeyMap) FullHelp() [][]key.Binding {
 	return [][]key.Binding{
 		{fakeTitleKeyBinding, k.Up, k.Left, k.SelectEntry, k.SelectEntryAndChangeDir},
-		{fakeEmptyKeyBinding, k.Down, k.Right, k.DeleteEntry},
-		{fakeEmptyKeyBinding, k.PageUp, k.TableLeft, k.Quit},
-		{fakeEmptyKeyBinding, k.PageDown, k.TableRight, k.Help},
+		{fakeEmptyKeyBinding, k.Down, k.Right, k.DeleteEntry, k.ExplainCommand},
+		{fakeEmptyKeyBinding, k.PageUp, k.TableLeft, k.Quit, k.CycleColumnPreset},
+		{fakeEmptyKeyBinding, k.PageDown, k.TableRight, k.Help, k.ToggleSessionFilter},
+		{fakeEmptyKeyBinding, fakeEmptyKeyBinding, fakeEmptyKeyBinding, fakeEmptyKeyBinding, k.ToggleHostFilter},
+		{fakeEmptyKeyBinding, fakeEmptyKeyBinding, fakeEmptyKeyBinding, fakeEmptyKeyBinding, k.RestoreLastState},
+		{fakeEmptyKeyBinding, fakeEmptyKeyBinding, fakeEmptyKeyBinding, fakeEmptyKeyBinding, k.ToggleTaskView},
+		{fakeEmptyKeyBinding, fakeEmptyKeyBinding, fakeEmptyKeyBinding, fakeEmptyKeyBinding, k.ExportTaskScript},
+		{fakeEmptyKeyBinding, fakeEmptyKeyBinding, fakeEmptyKeyBinding, fakeEmptyKeyBinding, k.ToggleSoftWrap},
+		{fakeEmptyKeyBinding, fakeEmptyKeyBinding, fakeEmptyKeyBinding, fakeEmptyKeyBinding, k.CompleteAtomValue},
+		{fakeEmptyKeyBinding, fakeEmptyKeyBinding, fakeEmptyKeyBinding, fakeEmptyKeyBinding, k.ShareEntry},
 	}
 }
 
@@ -299,6 +406,46 @@ var DefaultKeyMap = KeyMap{
 		key.WithKeys("ctrl+k"),
 		key.WithHelp("ctrl+k", "delete the highlighted entry "),
 	),
+	ExplainCommand: key.NewBinding(
+		key.WithKeys("ctrl+o"),
+		key.WithHelp("ctrl+o", "explain the highlighted entry "),
+	),
+	ShareEntry: key.NewBinding(
+		key.WithKeys("ctrl+u"),
+		key.WithHelp("ctrl+u", "share the highlighted entry "),
+	),
+	CycleColumnPreset: key.NewBinding(
+		key.WithKeys("ctrl+t"),
+		key.WithHelp("ctrl+t", "cycle through column presets "),
+	),
+	ToggleSessionFilter: key.NewBinding(
+		key.WithKeys("ctrl+s"),
+		key.WithHelp("ctrl+s", "filter to this session "),
+	),
+	ToggleHostFilter: key.NewBinding(
+		key.WithKeys("ctrl+b"),
+		key.WithHelp("ctrl+b", "filter to this host "),
+	),
+	RestoreLastState: key.NewBinding(
+		key.WithKeys("ctrl+g"),
+		key.WithHelp("ctrl+g", "restore the last search "),
+	),
+	ToggleTaskView: key.NewBinding(
+		key.WithKeys("ctrl+y"),
+		key.WithHelp("ctrl+y", "group results into tasks "),
+	),
+	ExportTaskScript: key.NewBinding(
+		key.WithKeys("ctrl+v"),
+		key.WithHelp("ctrl+v", "export the task as a script "),
+	),
+	ToggleSoftWrap: key.NewBinding(
+		key.WithKeys("ctrl+w"),
+		key.WithHelp("ctrl+w", "soft-wrap the selected row "),
+	),
+	CompleteAtomValue: key.NewBinding(
+		key.WithKeys("tab"),
+		key.WithHelp("tab", "complete search atom values "),
+	),
 	Help: key.NewBinding(
 		key.WithKeys("ctrl+h"),
 		key.WithHelp("ctrl+h", "help "),
@@ -0,0 +1,162 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ddworken/hishtory/client/data"
+	"github.com/ddworken/hishtory/client/hctx"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// The model for the interactive redaction picker opened by `hishtory redact --interactive`. It is
+// deliberately much simpler than the main search TUI: a fixed checklist of the matching entries
+// where the user can check/uncheck individual entries before confirming the deletion.
+type redactPickerModel struct {
+	ctx context.Context
+
+	// The entries that matched the redact query
+	entries []*data.HistoryEntry
+	// Whether each entry is checked for deletion, parallel to entries
+	checked []bool
+	// The index of the highlighted entry
+	cursor int
+	// The index of the first displayed entry, used for scrolling long lists
+	scrollOffset int
+
+	// Whether the user confirmed the deletion (vs aborting)
+	confirmed bool
+	quitting  bool
+}
+
+func initialRedactPickerModel(ctx context.Context, entries []*data.HistoryEntry) redactPickerModel {
+	checked := make([]bool, len(entries))
+	for i := range checked {
+		// Start with everything checked, since the user already queried for these entries
+		checked[i] = true
+	}
+	return redactPickerModel{ctx: ctx, entries: entries, checked: checked}
+}
+
+func (m redactPickerModel) Init() tea.Cmd {
+	return nil
+}
+
+// How many entries the redaction picker displays at once
+func (m redactPickerModel) pageSize() int {
+	_, height, err := getTerminalSize()
+	if err != nil {
+		return 10
+	}
+	// Leave room for the header and footer lines
+	return max(height-4, 1)
+}
+
+func (m redactPickerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "up", "ctrl+p":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+		case "down", "ctrl+n":
+			if m.cursor < len(m.entries)-1 {
+				m.cursor++
+			}
+		case "pgup":
+			m.cursor = max(m.cursor-m.pageSize(), 0)
+		case "pgdown":
+			m.cursor = min(m.cursor+m.pageSize(), len(m.entries)-1)
+		case " ":
+			m.checked[m.cursor] = !m.checked[m.cursor]
+		case "a":
+			// Toggle all: uncheck everything if anything is checked, otherwise check everything
+			anyChecked := false
+			for _, c := range m.checked {
+				anyChecked = anyChecked || c
+			}
+			for i := range m.checked {
+				m.checked[i] = !anyChecked
+			}
+		case "enter":
+			m.confirmed = true
+			m.quitting = true
+			return m, tea.Quit
+		case "esc", "ctrl+c", "ctrl+d", "q":
+			m.quitting = true
+			return m, tea.Quit
+		}
+		// Keep the highlighted entry visible
+		if m.cursor < m.scrollOffset {
+			m.scrollOffset = m.cursor
+		}
+		if m.cursor >= m.scrollOffset+m.pageSize() {
+			m.scrollOffset = m.cursor - m.pageSize() + 1
+		}
+	}
+	return m, nil
+}
+
+func (m redactPickerModel) View() string {
+	if m.quitting {
+		return ""
+	}
+	config := hctx.GetConf(m.ctx)
+	numChecked := 0
+	for _, c := range m.checked {
+		if c {
+			numChecked++
+		}
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Redact %d/%d entries (space: toggle, a: toggle all, enter: delete, esc: abort)\n\n", numChecked, len(m.entries)))
+	width, _, err := getTerminalSize()
+	if err != nil {
+		width = 80
+	}
+	end := min(m.scrollOffset+m.pageSize(), len(m.entries))
+	for i := m.scrollOffset; i < end; i++ {
+		cursor := "  "
+		if i == m.cursor {
+			cursor = "> "
+		}
+		checkbox := "[ ]"
+		if m.checked[i] {
+			checkbox = "[x]"
+		}
+		line := fmt.Sprintf("%s%s %s  %s", cursor, checkbox, m.entries[i].StartTime.Local().Format(config.TimestampFormat), commandEscaper(m.entries[i].Command))
+		if len(line) > width {
+			line = line[:max(width-3, 0)] + "..."
+		}
+		sb.WriteString(line + "\n")
+	}
+	return sb.String()
+}
+
+// PickEntriesToRedact displays the given entries in a TUI checklist so that the user can choose
+// which ones to delete. Returns the checked entries, or an empty slice if the user aborted.
+func PickEntriesToRedact(ctx context.Context, entries []*data.HistoryEntry) ([]*data.HistoryEntry, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	p := tea.NewProgram(initialRedactPickerModel(ctx, entries), tea.WithOutput(os.Stderr))
+	finalModel, err := p.Run()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run the interactive redaction picker: %w", err)
+	}
+	m, ok := finalModel.(redactPickerModel)
+	if !ok || !m.confirmed {
+		return nil, nil
+	}
+	ret := make([]*data.HistoryEntry, 0)
+	for i, entry := range m.entries {
+		if m.checked[i] {
+			ret = append(ret, entry)
+		}
+	}
+	return ret, nil
+}
@@ -1,6 +1,7 @@
 package tui
 
 import (
+	"bufio"
 	"context"
 	_ "embed" // for embedding config.sh
 	"encoding/json"
@@ -8,6 +9,8 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime/debug"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -99,6 +102,68 @@ type model struct {
 
 	// Whether we've finished the first load of results. If we haven't, we refuse to run additional queries to avoid race conditions with how we handle invalid initial queries.
 	hasFinishedFirstLoad bool
+
+	// The state of the AI explanation overlay for the highlighted entry. Nil if the overlay isn't being displayed.
+	aiExplanation *aiExplanationState
+
+	// The displayed columns from when the TUI started, so that cycling through column presets can
+	// return to the user's configured columns
+	originalDisplayedColumns []string
+
+	// Whether results are restricted to the current shell session (toggled via a keybinding)
+	sessionFilterActive bool
+	// Whether results are restricted to the current hostname (toggled via a keybinding)
+	hostFilterActive bool
+
+	// The cursor position to restore once the next set of query results loads. Only set while
+	// restoring a saved TUI state, nil otherwise.
+	pendingCursorRestore *int
+
+	// Whether results are grouped into task sections (toggled via a keybinding)
+	taskViewEnabled bool
+	// The tasks that are currently collapsed in the task view, keyed by task ID
+	collapsedTasks map[string]bool
+	// The ungrouped rows and entries from the last query, so that collapsing/expanding a task
+	// can rebuild the task view without re-running the query
+	rawRows    []table.Row
+	rawEntries []*data.HistoryEntry
+	// For each displayed row, the ID of the task whose header it is (or "" for entry rows).
+	// Empty when the task view is disabled.
+	taskRowIds []string
+	// A status message from exporting a task as a script, displayed above the table. Cleared
+	// when the search query changes.
+	taskExportStatus string
+
+	// A status message from sharing an entry to the configured webhook, displayed above the
+	// table. Cleared when the search query changes.
+	shareStatus string
+
+	// Tab completion state for search atom values: the candidate values being cycled through,
+	// the index of the currently applied candidate, and the query text before/after the value
+	// being completed. Empty when no completion is in progress; reset by any other keypress.
+	atomCompletions      []string
+	atomCompletionIndex  int
+	atomCompletionPrefix string
+	atomCompletionSuffix string
+
+	// Lazy pagination state (see maybeLoadMoreResults): the offset to fetch the next page of
+	// search results from, whether more pages may exist, and whether a page fetch is in flight
+	nextSearchOffset     int
+	moreResultsMayExist  bool
+	isLoadingMoreResults bool
+}
+
+type aiExplanationState struct {
+	// The command that is being explained
+	command string
+	// The explanation of the command, once it has been retrieved
+	explanation string
+	// Whether we're still waiting on the AI endpoint
+	isLoading bool
+	// An error from retrieving the explanation, if one occurred
+	err error
+	// How many lines the user has scrolled down in the overlay
+	scrollOffset int
 }
 
 type (
@@ -109,6 +174,19 @@ type (
 	}
 )
 
+type webhookShareMsg struct {
+	// An error from posting to the webhook, if one occurred
+	err error
+}
+
+type aiExplanationMsg struct {
+	// The command that was explained. Used to ensure that we don't display a stale explanation
+	// if the overlay was closed and reopened on a different entry.
+	command     string
+	explanation string
+	err         error
+}
+
 type asyncQueryFinishedMsg struct {
 	// The query ID finished running. Used to ensure that we only process this message if it is the latest query to finish.
 	queryId int
@@ -127,6 +205,20 @@ type asyncQueryFinishedMsg struct {
 	isFirstQuery bool
 }
 
+type asyncMoreResultsMsg struct {
+	// The (filter-expanded) query that this page of results belongs to. Used to drop pages that
+	// finish loading after the query has changed.
+	forQuery string
+	// The additional table rows and entries to append
+	rows    []table.Row
+	entries []*data.HistoryEntry
+	// The number of raw search results that were consumed, used to advance the pagination offset
+	// past entries that were filtered out as duplicates
+	numSearchResults int
+	// An error from searching, if one occurred
+	searchErr error
+}
+
 func initialModel(ctx context.Context, shellName, initialQuery string) model {
 	s := spinner.New()
 	s.Spinner = spinner.Dot
@@ -154,7 +246,7 @@ func initialModel(ctx context.Context, shellName, initialQuery string) model {
 		queryInput.SetValue(initialQuery)
 	}
 	CURRENT_QUERY_FOR_HIGHLIGHTING = initialQuery
-	return model{ctx: ctx, spinner: s, isLoading: true, table: nil, tableEntries: []*data.HistoryEntry{}, runQuery: &initialQuery, queryInput: queryInput, help: help.New(), shellName: shellName, hasFinishedFirstLoad: false}
+	return model{ctx: ctx, spinner: s, isLoading: true, table: nil, tableEntries: []*data.HistoryEntry{}, runQuery: &initialQuery, queryInput: queryInput, help: help.New(), shellName: shellName, hasFinishedFirstLoad: false, originalDisplayedColumns: cfg.DisplayedColumns, collapsedTasks: make(map[string]bool)}
 }
 
 func (m model) Init() tea.Cmd {
@@ -169,6 +261,12 @@ func updateTable(m model, rows []table.Row, entries []*data.HistoryEntry, search
 	if searchErr != nil {
 		return m
 	}
+	m.rawRows = rows
+	m.rawEntries = entries
+	m.taskRowIds = nil
+	if m.taskViewEnabled {
+		rows, entries, m.taskRowIds = groupRowsIntoTasks(m, rows, entries)
+	}
 	m.tableEntries = entries
 	initialCursor := 0
 	if m.table != nil {
@@ -190,10 +288,65 @@ func updateTable(m model, rows []table.Row, entries []*data.HistoryEntry, search
 	}
 	m.lastQuery = *m.runQuery
 	m.runQuery = nil
+	// A fresh set of results was just loaded, so reset the lazy pagination state (see
+	// maybeLoadMoreResults)
+	m.nextSearchOffset = getNumEntriesNeeded(m.ctx)
+	m.moreResultsMayExist = true
+	m.isLoadingMoreResults = false
 	preventTableOverscrolling(m)
 	return m
 }
 
+// Once the cursor is within this many rows of the bottom of the loaded results, the next page
+// gets fetched in the background
+const lazyLoadThresholdRows = 10
+
+// maybeLoadMoreResults kicks off an async fetch of the next page of search results once the
+// cursor nears the bottom of the already-loaded rows, so that the user can scroll arbitrarily far
+// back through their history without the TUI running a huge upfront query
+func maybeLoadMoreResults(m model) (model, tea.Cmd) {
+	if m.table == nil || !m.moreResultsMayExist || m.isLoadingMoreResults {
+		return m, nil
+	}
+	if m.runQuery != nil && *m.runQuery != m.lastQuery {
+		// A new query is about to run, which will reset the pagination state anyways
+		return m, nil
+	}
+	if m.table.Cursor() < len(m.tableEntries)-lazyLoadThresholdRows {
+		return m, nil
+	}
+	conf := hctx.GetConf(m.ctx)
+	query := addToggledFilters(m, m.lastQuery)
+	if conf.AiCompletion && strings.HasPrefix(query, "?") && len(query) > 1 {
+		// AI suggestions aren't paginated
+		return m, nil
+	}
+	defaultFilter := conf.DefaultFilter
+	if m.queryInput.Prompt == "" {
+		// The default filter was cleared for this session, so don't apply it
+		defaultFilter = ""
+	}
+	// Seed the duplicate filter with the commands that are already displayed, so that later pages
+	// don't re-show commands from earlier ones
+	seenCommands := make(map[string]bool)
+	if conf.FilterDuplicateCommands {
+		for _, entry := range m.rawEntries {
+			if entry != nil {
+				seenCommands[strings.TrimSpace(entry.Command)] = true
+			}
+		}
+	}
+	m.isLoadingMoreResults = true
+	offset := m.nextSearchOffset
+	numEntries := getNumEntriesNeeded(m.ctx)
+	ctx := m.ctx
+	columnNames := conf.DisplayedColumns
+	return m, func() tea.Msg {
+		rows, entries, numSearchResults, err := getMoreRows(ctx, columnNames, defaultFilter, query, numEntries, offset, seenCommands)
+		return asyncMoreResultsMsg{forQuery: query, rows: rows, entries: entries, numSearchResults: numSearchResults, searchErr: err}
+	}
+}
+
 func preventTableOverscrolling(m model) {
 	if m.table != nil {
 		if m.table.Cursor() >= len(m.tableEntries) {
@@ -209,6 +362,7 @@ func runQueryAndUpdateTable(m model, forceUpdateTable, maintainCursor bool) tea.
 		if m.runQuery != nil {
 			query = *m.runQuery
 		}
+		query = addToggledFilters(m, query)
 		queryId := allocateQueryId()
 		conf := hctx.GetConf(m.ctx)
 		defaultFilter := conf.DefaultFilter
@@ -232,6 +386,20 @@ func runQueryAndUpdateTable(m model, forceUpdateTable, maintainCursor bool) tea.
 	return nil
 }
 
+// addToggledFilters appends the search atoms for the "this session" and "this host" filter
+// toggles to the given query
+func addToggledFilters(m model, query string) string {
+	if m.sessionFilterActive {
+		query += " session:current"
+	}
+	if m.hostFilterActive {
+		if hostname, err := os.Hostname(); err == nil {
+			query += " hostname:" + hostname
+		}
+	}
+	return strings.TrimSpace(query)
+}
+
 func sanitizeEscapeCodes(input string) string {
 	re := regexp.MustCompile(`\d\d;rgb:[0-9a-f]{4}/[0-9a-f]{4}/[0-9a-f]{4}`)
 	return re.ReplaceAllString(input, "")
@@ -241,22 +409,46 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	m.queryInput.SetValue(sanitizeEscapeCodes(m.queryInput.Value()))
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if m.aiExplanation != nil {
+			// The explanation overlay is open, so keys only scroll or close the overlay
+			switch {
+			case key.Matches(msg, loadedKeyBindings.Up):
+				if m.aiExplanation.scrollOffset > 0 {
+					m.aiExplanation.scrollOffset--
+				}
+			case key.Matches(msg, loadedKeyBindings.Down):
+				m.aiExplanation.scrollOffset++
+			case key.Matches(msg, loadedKeyBindings.Quit), key.Matches(msg, loadedKeyBindings.ExplainCommand):
+				m.aiExplanation = nil
+			}
+			return m, nil
+		}
 		switch {
 		case key.Matches(msg, loadedKeyBindings.Quit):
 			m.quitting = true
+			saveTuiState(m)
 			return m, tea.Quit
 		case key.Matches(msg, loadedKeyBindings.SelectEntry):
 			if len(m.tableEntries) != 0 && m.table != nil {
+				if m.tableEntries[m.table.Cursor()] == nil {
+					// The cursor is on a task header row, so collapse/expand the task rather than selecting
+					return toggleTaskCollapsed(m), nil
+				}
 				m.selected = Selected
 			}
+			saveTuiState(m)
 			return m, tea.Quit
 		case key.Matches(msg, loadedKeyBindings.SelectEntryAndChangeDir):
 			if len(m.tableEntries) != 0 && m.table != nil {
+				if m.tableEntries[m.table.Cursor()] == nil {
+					return toggleTaskCollapsed(m), nil
+				}
 				m.selected = SelectedWithChangeDir
 			}
+			saveTuiState(m)
 			return m, tea.Quit
 		case key.Matches(msg, loadedKeyBindings.DeleteEntry):
-			if m.table == nil {
+			if m.table == nil || len(m.tableEntries) == 0 || m.tableEntries[m.table.Cursor()] == nil {
 				return m, nil
 			}
 			err := deleteHistoryEntry(m.ctx, *m.tableEntries[m.table.Cursor()])
@@ -267,6 +459,131 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			cmd := runQueryAndUpdateTable(m, true, true)
 			preventTableOverscrolling(m)
 			return m, cmd
+		case key.Matches(msg, loadedKeyBindings.ExplainCommand):
+			if m.table == nil || len(m.tableEntries) == 0 || m.tableEntries[m.table.Cursor()] == nil {
+				return m, nil
+			}
+			command := m.tableEntries[m.table.Cursor()].Command
+			m.aiExplanation = &aiExplanationState{command: command, isLoading: true}
+			return m, tea.Batch(m.spinner.Tick, func() tea.Msg {
+				explanation, err := ai.GetAiExplanation(m.ctx, m.shellName, command)
+				return aiExplanationMsg{command: command, explanation: explanation, err: err}
+			})
+		case key.Matches(msg, loadedKeyBindings.ShareEntry):
+			if m.table == nil || len(m.tableEntries) == 0 || m.tableEntries[m.table.Cursor()] == nil {
+				return m, nil
+			}
+			entry := *m.tableEntries[m.table.Cursor()]
+			m.shareStatus = fmt.Sprintf("%s Sharing the entry to the configured webhook...", m.spinner.View())
+			return m, tea.Batch(m.spinner.Tick, func() tea.Msg {
+				return webhookShareMsg{err: lib.ShareEntryToWebhook(m.ctx, &entry)}
+			})
+		case key.Matches(msg, loadedKeyBindings.CycleColumnPreset):
+			if !cycleColumnPreset(m.ctx, m.originalDisplayedColumns) {
+				return m, nil
+			}
+			// The columns changed, so throw away the cached column widths and rebuild the table
+			bigQueryResults = nil
+			m.table = nil
+			cmd := runQueryAndUpdateTable(m, true, true)
+			return m, cmd
+		case key.Matches(msg, loadedKeyBindings.ToggleSessionFilter):
+			if !m.sessionFilterActive && os.Getenv("HISHTORY_SESSION_ID") == "" {
+				// There is no current session to filter to (e.g. hishtory was run outside of
+				// a shell with the hishtory hooks), so ignore the toggle
+				return m, nil
+			}
+			m.sessionFilterActive = !m.sessionFilterActive
+			cmd := runQueryAndUpdateTable(m, true, true)
+			return m, cmd
+		case key.Matches(msg, loadedKeyBindings.ToggleHostFilter):
+			m.hostFilterActive = !m.hostFilterActive
+			cmd := runQueryAndUpdateTable(m, true, true)
+			return m, cmd
+		case key.Matches(msg, loadedKeyBindings.RestoreLastState):
+			state := loadTuiState(m.ctx)
+			if state == nil {
+				return m, nil
+			}
+			conf := hctx.GetConf(m.ctx)
+			if len(state.DisplayedColumns) > 0 && !slices.Equal(conf.DisplayedColumns, state.DisplayedColumns) {
+				// Restore the columns in-memory only (like cycling column presets), so the columns
+				// changed and we need to throw away the cached column widths and rebuild the table
+				conf.DisplayedColumns = state.DisplayedColumns
+				bigQueryResults = nil
+				m.table = nil
+			}
+			m.queryInput.SetValue(state.SearchQuery)
+			m.queryInput.SetCursor(len(state.SearchQuery))
+			searchQuery := state.SearchQuery
+			m.runQuery = &searchQuery
+			CURRENT_QUERY_FOR_HIGHLIGHTING = searchQuery
+			m.pendingCursorRestore = &state.CursorPosition
+			cmd := runQueryAndUpdateTable(m, true, false)
+			return m, cmd
+		case key.Matches(msg, loadedKeyBindings.ToggleTaskView):
+			m.taskViewEnabled = !m.taskViewEnabled
+			m = refreshTaskView(m)
+			if m.table != nil {
+				m.table.SetCursor(0)
+			}
+			return m, nil
+		case key.Matches(msg, loadedKeyBindings.ExportTaskScript):
+			if m.table == nil || len(m.tableEntries) == 0 {
+				return m, nil
+			}
+			if !m.taskViewEnabled {
+				m.taskExportStatus = fmt.Sprintf("Enable the task view (%s) to export a task as a script", loadedKeyBindings.ToggleTaskView.Help().Key)
+				return m, nil
+			}
+			taskEntries := taskEntriesForCursor(m)
+			if len(taskEntries) == 0 {
+				return m, nil
+			}
+			filename, err := exportTaskAsScript(taskEntries)
+			if err != nil {
+				m.taskExportStatus = fmt.Sprintf("Warning: failed to export the task: %v", err)
+			} else {
+				m.taskExportStatus = fmt.Sprintf("Exported %d commands to %s", len(taskEntries), filename)
+			}
+			return m, nil
+		case key.Matches(msg, loadedKeyBindings.ToggleSoftWrap):
+			if m.table == nil {
+				return m, nil
+			}
+			m.table.ToggleSoftWrap()
+			return m, nil
+		case key.Matches(msg, loadedKeyBindings.CompleteAtomValue):
+			if len(m.atomCompletions) == 0 {
+				atom, partialValue, valueStart, ok := parseAtomForCompletion(m.queryInput.Value(), m.queryInput.Position())
+				if !ok {
+					return m, nil
+				}
+				completions, err := getAtomValueCompletions(m.ctx, atom, partialValue)
+				if err != nil {
+					hctx.GetLogger().Warnf("failed to get completions for search atom %s: %v", atom, err)
+					return m, nil
+				}
+				if len(completions) == 0 {
+					return m, nil
+				}
+				m.atomCompletions = completions
+				m.atomCompletionIndex = 0
+				m.atomCompletionPrefix = m.queryInput.Value()[:valueStart]
+				m.atomCompletionSuffix = m.queryInput.Value()[m.queryInput.Position():]
+			} else {
+				// Tab was pressed again with no other keys in between, so cycle to the next candidate
+				m.atomCompletionIndex = (m.atomCompletionIndex + 1) % len(m.atomCompletions)
+			}
+			completed := m.atomCompletionPrefix + escapeAtomValue(m.atomCompletions[m.atomCompletionIndex])
+			m.queryInput.SetValue(completed + m.atomCompletionSuffix)
+			m.queryInput.SetCursor(len(completed))
+			searchQuery := m.queryInput.Value()
+			m.runQuery = &searchQuery
+			CURRENT_QUERY_FOR_HIGHLIGHTING = searchQuery
+			cmd := runQueryAndUpdateTable(m, false, false)
+			preventTableOverscrolling(m)
+			return m, cmd
 		case key.Matches(msg, loadedKeyBindings.Help):
 			m.help.ShowAll = !m.help.ShowAll
 			return m, nil
@@ -297,6 +614,8 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 			return m, nil
 		default:
+			// Any other keypress ends the current tab completion cycle
+			m.atomCompletions = nil
 			pendingCommands := tea.Batch()
 			if m.table != nil {
 				t, cmd1 := m.table.Update(msg)
@@ -317,9 +636,12 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			searchQuery := m.queryInput.Value()
 			m.runQuery = &searchQuery
 			CURRENT_QUERY_FOR_HIGHLIGHTING = searchQuery
+			m.taskExportStatus = ""
+			m.shareStatus = ""
 			cmd3 := runQueryAndUpdateTable(m, forceUpdateTable, false)
 			preventTableOverscrolling(m)
-			return m, tea.Batch(pendingCommands, cmd2, cmd3)
+			m, cmd4 := maybeLoadMoreResults(m)
+			return m, tea.Batch(pendingCommands, cmd2, cmd3, cmd4)
 		}
 	case tea.WindowSizeMsg:
 		m.help.Width = msg.Width
@@ -335,6 +657,20 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case doneDownloadingMsg:
 		m.isLoading = false
 		return m, nil
+	case webhookShareMsg:
+		if msg.err != nil {
+			m.shareStatus = fmt.Sprintf("Warning: failed to share the entry: %v", msg.err)
+		} else {
+			m.shareStatus = "Shared the entry to the configured webhook"
+		}
+		return m, nil
+	case aiExplanationMsg:
+		if m.aiExplanation != nil && m.aiExplanation.command == msg.command {
+			m.aiExplanation.isLoading = false
+			m.aiExplanation.explanation = msg.explanation
+			m.aiExplanation.err = msg.err
+		}
+		return m, nil
 	case asyncQueryFinishedMsg:
 		if msg.queryId > LAST_PROCESSED_QUERY_ID {
 			LAST_PROCESSED_QUERY_ID = msg.queryId
@@ -342,21 +678,63 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if msg.overriddenSearchQuery != nil {
 				m.queryInput.SetValue(*msg.overriddenSearchQuery)
 			}
+			if m.pendingCursorRestore != nil {
+				if m.table != nil && *m.pendingCursorRestore < len(m.tableEntries) {
+					m.table.SetCursor(*m.pendingCursorRestore)
+				}
+				m.pendingCursorRestore = nil
+			}
 		}
 		if msg.isFirstQuery {
 			m.hasFinishedFirstLoad = true
 		}
 		return m, nil
+	case asyncMoreResultsMsg:
+		m.isLoadingMoreResults = false
+		if msg.forQuery != addToggledFilters(m, m.lastQuery) {
+			// The query changed while this page was loading, so drop it
+			return m, nil
+		}
+		if msg.searchErr != nil {
+			hctx.GetLogger().Warnf("failed to lazily load more search results: %v", msg.searchErr)
+			return m, nil
+		}
+		if msg.numSearchResults < getNumEntriesNeeded(m.ctx) {
+			// This page was short, so the end of the history has been reached
+			m.moreResultsMayExist = false
+		}
+		m.nextSearchOffset += msg.numSearchResults
+		if len(msg.entries) == 0 {
+			// Every result in this page was filtered out as a duplicate, so go straight to the
+			// next page
+			return maybeLoadMoreResults(m)
+		}
+		m.rawRows = append(m.rawRows, msg.rows...)
+		m.rawEntries = append(m.rawEntries, msg.entries...)
+		rows := m.rawRows
+		entries := m.rawEntries
+		m.taskRowIds = nil
+		if m.taskViewEnabled {
+			rows, entries, m.taskRowIds = groupRowsIntoTasks(m, rows, entries)
+		}
+		m.tableEntries = entries
+		cursor := m.table.Cursor()
+		m.table.SetRows(rows)
+		m.table.SetCursor(cursor)
+		// Most of this page may have been filtered out as duplicates, so check whether the next
+		// page should be fetched right away
+		return maybeLoadMoreResults(m)
 	default:
 		var cmd tea.Cmd
-		if m.isLoading {
+		if m.isLoading || (m.aiExplanation != nil && m.aiExplanation.isLoading) {
 			m.spinner, cmd = m.spinner.Update(msg)
 			return m, cmd
 		} else {
 			if m.table != nil {
 				t, cmd := m.table.Update(msg)
 				m.table = &t
-				return m, cmd
+				m, cmd2 := maybeLoadMoreResults(m)
+				return m, tea.Batch(cmd, cmd2)
 			}
 			return m, nil
 		}
@@ -417,6 +795,12 @@ func (m model) View() string {
 	if m.searchErr != nil {
 		additionalMessages = append(additionalMessages, fmt.Sprintf("Warning: failed to search: %v", m.searchErr))
 	}
+	if m.taskExportStatus != "" {
+		additionalMessages = append(additionalMessages, m.taskExportStatus)
+	}
+	if m.shareStatus != "" {
+		additionalMessages = append(additionalMessages, m.shareStatus)
+	}
 	if LAST_PROCESSED_QUERY_ID < LAST_DISPATCHED_QUERY_ID && time.Since(LAST_DISPATCHED_QUERY_TIMESTAMP) > time.Second {
 		additionalMessages = append(additionalMessages, fmt.Sprintf("%s Executing search query...", m.spinner.View()))
 	}
@@ -432,7 +816,22 @@ func (m model) View() string {
 	if isCompactHeightMode(m.ctx) {
 		additionalSpacing = ""
 	}
-	return fmt.Sprintf("%s%s%s%sSearch Query: %s\n%s%s\n", additionalSpacing, additionalMessagesStr, m.banner, additionalSpacing, m.queryInput.View(), additionalSpacing, renderNullableTable(m, helpView)) + helpView
+	mainView := renderNullableTable(m, helpView)
+	if m.aiExplanation != nil {
+		mainView = renderAiExplanationOverlay(m)
+	}
+	filterChips := ""
+	if m.sessionFilterActive || m.hostFilterActive {
+		chips := make([]string, 0)
+		if m.sessionFilterActive {
+			chips = append(chips, "[this session]")
+		}
+		if m.hostFilterActive {
+			chips = append(chips, "[this host]")
+		}
+		filterChips = "Active Filters: " + strings.Join(chips, " ") + "\n"
+	}
+	return fmt.Sprintf("%s%s%s%sSearch Query: %s\n%s%s%s\n", additionalSpacing, additionalMessagesStr, m.banner, additionalSpacing, m.queryInput.View(), filterChips, additionalSpacing, mainView) + helpView
 }
 
 func isExtraCompactHeightMode(ctx context.Context) bool {
@@ -480,6 +879,292 @@ func renderNullableTable(m model, helpText string) string {
 	return baseStyle.Render(m.table.View())
 }
 
+// Cycle the in-memory displayed columns to the next configured column preset (and after the last
+// preset, back to the user's configured columns), without persisting any changes to the config
+// file. Returns whether the displayed columns were changed.
+func cycleColumnPreset(ctx context.Context, originalColumns []string) bool {
+	config := hctx.GetConf(ctx)
+	if len(config.ColumnPresets) == 0 {
+		return false
+	}
+	presetNames := make([]string, 0, len(config.ColumnPresets))
+	for presetName := range config.ColumnPresets {
+		presetNames = append(presetNames, presetName)
+	}
+	slices.Sort(presetNames)
+	currentIdx := -1
+	for i, presetName := range presetNames {
+		if slices.Equal(config.ColumnPresets[presetName], config.DisplayedColumns) {
+			currentIdx = i
+			break
+		}
+	}
+	if currentIdx == len(presetNames)-1 {
+		// We're on the last preset, so cycle back to the original columns
+		config.DisplayedColumns = originalColumns
+	} else {
+		config.DisplayedColumns = config.ColumnPresets[presetNames[currentIdx+1]]
+	}
+	return true
+}
+
+// The last TUI search state for a single terminal session, so that accidentally exiting the TUI
+// doesn't lose a carefully built search query
+// The maximum gap between the start times of two consecutive commands for them to be considered
+// part of the same task in the task view
+const taskTimeGap = 30 * time.Minute
+
+// taskBoundaries returns the half-open [start, end) ranges of each heuristically detected task.
+// Entries are ordered newest first, so a task extends forward while each entry is close enough in
+// time to the more recent one and ran in the same directory.
+func taskBoundaries(entries []*data.HistoryEntry) [][]int {
+	var boundaries [][]int
+	for start := 0; start < len(entries); {
+		end := start + 1
+		for end < len(entries) &&
+			entries[end].CurrentWorkingDirectory == entries[start].CurrentWorkingDirectory &&
+			entries[end-1].StartTime.Sub(entries[end].StartTime) < taskTimeGap {
+			end++
+		}
+		boundaries = append(boundaries, []int{start, end})
+		start = end
+	}
+	return boundaries
+}
+
+// groupRowsIntoTasks rewrites the table rows for the task view. Consecutive entries are
+// heuristically grouped into a task as long as they ran in the same directory without a large time
+// gap. Each task gets a header row (represented by a nil entry in the parallel entries slice), and
+// the rows of collapsed tasks are omitted. Also returns, for each displayed row, the ID of the task
+// whose header it is (or "" for entry rows).
+func groupRowsIntoTasks(m model, rows []table.Row, entries []*data.HistoryEntry) ([]table.Row, []*data.HistoryEntry, []string) {
+	conf := hctx.GetConf(m.ctx)
+	commandColumn := slices.Index(conf.DisplayedColumns, "Command")
+	if commandColumn == -1 {
+		commandColumn = len(conf.DisplayedColumns) - 1
+	}
+	var groupedRows []table.Row
+	var groupedEntries []*data.HistoryEntry
+	var taskRowIds []string
+	for _, boundary := range taskBoundaries(entries) {
+		start, end := boundary[0], boundary[1]
+		// Key the task by its most recent entry, so that collapsed state survives re-grouping
+		taskId := entries[start].EntryId
+		marker := "▼"
+		if m.collapsedTasks[taskId] {
+			marker = "▶"
+		}
+		headerRow := make(table.Row, len(conf.DisplayedColumns))
+		headerRow[commandColumn] = fmt.Sprintf("%s %s — %s · %s · %d commands", marker,
+			entries[end-1].StartTime.Local().Format("Jan 2 15:04"),
+			entries[start].StartTime.Local().Format("15:04"),
+			entries[start].CurrentWorkingDirectory, end-start)
+		groupedRows = append(groupedRows, headerRow)
+		groupedEntries = append(groupedEntries, nil)
+		taskRowIds = append(taskRowIds, taskId)
+		if !m.collapsedTasks[taskId] {
+			groupedRows = append(groupedRows, rows[start:end]...)
+			groupedEntries = append(groupedEntries, entries[start:end]...)
+			for i := start; i < end; i++ {
+				taskRowIds = append(taskRowIds, "")
+			}
+		}
+	}
+	// Preserve any padding rows from the raw rows so that the table stays full-height
+	for len(groupedRows) < len(rows) {
+		groupedRows = append(groupedRows, table.Row{})
+	}
+	return groupedRows, groupedEntries, taskRowIds
+}
+
+// refreshTaskView rebuilds the displayed rows from the last query's results, e.g. after toggling
+// the task view or collapsing a task, without re-running the query
+func refreshTaskView(m model) model {
+	if m.table == nil {
+		return m
+	}
+	rows := m.rawRows
+	entries := m.rawEntries
+	m.taskRowIds = nil
+	if m.taskViewEnabled {
+		rows, entries, m.taskRowIds = groupRowsIntoTasks(m, rows, entries)
+	}
+	m.tableEntries = entries
+	m.table.SetRows(rows)
+	preventTableOverscrolling(m)
+	return m
+}
+
+// taskEntriesForCursor returns the (ungrouped) entries of the task whose header or member row the
+// cursor is currently on, or nil if the cursor isn't within a task
+func taskEntriesForCursor(m model) []*data.HistoryEntry {
+	// Walk upwards from the cursor to find the task's header row
+	taskId := ""
+	for i := min(m.table.Cursor(), len(m.taskRowIds)-1); i >= 0; i-- {
+		if m.taskRowIds[i] != "" {
+			taskId = m.taskRowIds[i]
+			break
+		}
+	}
+	if taskId == "" {
+		return nil
+	}
+	for _, boundary := range taskBoundaries(m.rawEntries) {
+		if m.rawEntries[boundary[0]].EntryId == taskId {
+			return m.rawEntries[boundary[0]:boundary[1]]
+		}
+	}
+	return nil
+}
+
+// exportTaskAsScript writes the commands of the given task (oldest first) to a runnable script in
+// the current directory, with comments recording when and where each command ran. Returns the name
+// of the written file.
+func exportTaskAsScript(entries []*data.HistoryEntry) (string, error) {
+	var sb strings.Builder
+	sb.WriteString("#!/bin/bash\n")
+	sb.WriteString(fmt.Sprintf("# Exported by hishtory on %s\n", time.Now().Local().Format("Jan 2 2006 15:04:05")))
+	sb.WriteString("set -e\n")
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		sb.WriteString(fmt.Sprintf("\n# %s (cwd: %s, exit code: %d)\n", entry.StartTime.Local().Format(time.RFC3339), entry.CurrentWorkingDirectory, entry.ExitCode))
+		sb.WriteString(entry.Command + "\n")
+	}
+	filename := fmt.Sprintf("hishtory-task-%s.sh", time.Now().Local().Format("20060102-150405"))
+	err := os.WriteFile(filename, []byte(sb.String()), 0o700)
+	if err != nil {
+		return "", fmt.Errorf("failed to write script to %s: %w", filename, err)
+	}
+	return filename, nil
+}
+
+// toggleTaskCollapsed collapses or expands the task whose header row the cursor is on
+func toggleTaskCollapsed(m model) model {
+	cursor := m.table.Cursor()
+	if cursor < len(m.taskRowIds) && m.taskRowIds[cursor] != "" {
+		taskId := m.taskRowIds[cursor]
+		m.collapsedTasks[taskId] = !m.collapsedTasks[taskId]
+		m = refreshTaskView(m)
+	}
+	return m
+}
+
+type savedTuiState struct {
+	SearchQuery      string    `json:"search_query"`
+	CursorPosition   int       `json:"cursor_position"`
+	DisplayedColumns []string  `json:"displayed_columns"`
+	SavedAt          time.Time `json:"saved_at"`
+}
+
+// How long a saved TUI state is kept before being pruned, since terminal sessions rarely outlive this
+const tuiStateTtl = 24 * time.Hour
+
+func getTuiStatePath(ctx context.Context) string {
+	return filepath.Join(hctx.GetHome(ctx), data.GetHishtoryPath(), data.TUI_STATE_PATH)
+}
+
+// readTuiStates reads the saved TUI states for all terminal sessions, keyed by session ID. Returns
+// an empty map if the state file doesn't exist or can't be parsed, since saved state is best-effort.
+func readTuiStates(ctx context.Context) map[string]savedTuiState {
+	states := make(map[string]savedTuiState)
+	contents, err := os.ReadFile(getTuiStatePath(ctx))
+	if err != nil {
+		return states
+	}
+	if err := json.Unmarshal(contents, &states); err != nil {
+		hctx.GetLogger().Warnf("failed to parse the TUI state file: %v", err)
+	}
+	return states
+}
+
+// saveTuiState persists the current search query, cursor position, and displayed columns for this
+// terminal session, so that the next TUI invocation in the same session can restore them
+func saveTuiState(m model) {
+	if !hctx.GetConf(m.ctx).EnableTuiStateRestore {
+		return
+	}
+	sessionId := os.Getenv("HISHTORY_SESSION_ID")
+	if sessionId == "" {
+		return
+	}
+	states := readTuiStates(m.ctx)
+	for id, state := range states {
+		if time.Since(state.SavedAt) > tuiStateTtl {
+			delete(states, id)
+		}
+	}
+	cursor := 0
+	if m.table != nil {
+		cursor = m.table.Cursor()
+	}
+	states[sessionId] = savedTuiState{
+		SearchQuery:      m.queryInput.Value(),
+		CursorPosition:   cursor,
+		DisplayedColumns: hctx.GetConf(m.ctx).DisplayedColumns,
+		SavedAt:          time.Now(),
+	}
+	serialized, err := json.Marshal(states)
+	if err != nil {
+		hctx.GetLogger().Warnf("failed to serialize the TUI state: %v", err)
+		return
+	}
+	if err := os.WriteFile(getTuiStatePath(m.ctx), serialized, 0o644); err != nil {
+		hctx.GetLogger().Warnf("failed to write the TUI state file: %v", err)
+	}
+}
+
+// loadTuiState returns the saved TUI state for this terminal session, or nil if there isn't one
+func loadTuiState(ctx context.Context) *savedTuiState {
+	if !hctx.GetConf(ctx).EnableTuiStateRestore {
+		return nil
+	}
+	sessionId := os.Getenv("HISHTORY_SESSION_ID")
+	if sessionId == "" {
+		return nil
+	}
+	if state, ok := readTuiStates(ctx)[sessionId]; ok && time.Since(state.SavedAt) <= tuiStateTtl {
+		return &state
+	}
+	return nil
+}
+
+// Render the AI explanation overlay that is displayed in place of the table when the user hits
+// the explain-command key on a highlighted entry. The overlay is scrollable via the up/down keys.
+func renderAiExplanationOverlay(m model) string {
+	baseStyle := getBaseStyle(*hctx.GetConf(m.ctx))
+	terminalWidth, _, err := getTerminalSize()
+	if err != nil {
+		hctx.GetLogger().Warnf("getTerminalSize() return err=%#v, defaulting the explanation overlay to a width of 80", err)
+		terminalWidth = 80
+	}
+	contentWidth := max(terminalWidth-4, 20)
+	var body string
+	if m.aiExplanation.isLoading {
+		body = fmt.Sprintf("%s Retrieving an explanation of this command...", m.spinner.View())
+	} else if m.aiExplanation.err != nil {
+		body = fmt.Sprintf("Failed to retrieve an explanation: %v", m.aiExplanation.err)
+	} else {
+		body = m.aiExplanation.explanation
+	}
+	header := "Explaining: " + commandEscaper(m.aiExplanation.command)
+	footer := "Press " + loadedKeyBindings.ExplainCommand.Keys()[0] + " to close, ↑/↓ to scroll"
+	// Wrap the explanation to the terminal width, and then handle scrolling by truncating it to
+	// the lines that are currently visible
+	wrapped := lipgloss.NewStyle().Width(contentWidth).Render(header + "\n\n" + body + "\n\n" + footer)
+	lines := strings.Split(wrapped, "\n")
+	overlayHeight := getTableHeight(m.ctx)
+	maxScrollOffset := max(len(lines)-overlayHeight, 0)
+	if m.aiExplanation.scrollOffset > maxScrollOffset {
+		m.aiExplanation.scrollOffset = maxScrollOffset
+	}
+	visibleLines := lines[m.aiExplanation.scrollOffset:min(m.aiExplanation.scrollOffset+overlayHeight, len(lines))]
+	for len(visibleLines) < overlayHeight {
+		// Pad the overlay to the same height as the table so that the TUI doesn't resize
+		visibleLines = append(visibleLines, "")
+	}
+	return baseStyle.Render(strings.Join(visibleLines, "\n"))
+}
+
 func getRowsFromAiSuggestions(ctx context.Context, columnNames []string, shellName, query string) ([]table.Row, []*data.HistoryEntry, error) {
 	suggestions, err := ai.DebouncedGetAiSuggestions(ctx, shellName, strings.TrimPrefix(query, "?"), 5)
 	if err != nil {
@@ -555,6 +1240,37 @@ func getRows(ctx context.Context, columnNames []string, shellName, defaultFilter
 	return rows, filteredData, nil
 }
 
+// getMoreRows fetches the page of search results starting at the given offset, for lazily loading
+// additional rows as the user scrolls (see maybeLoadMoreResults). It also returns the number of
+// raw search results that were consumed, so that the caller can advance its offset past entries
+// that were filtered out as duplicates.
+func getMoreRows(ctx context.Context, columnNames []string, defaultFilter, query string, numEntries, offset int, seenCommands map[string]bool) ([]table.Row, []*data.HistoryEntry, int, error) {
+	db := hctx.GetDb(ctx)
+	config := hctx.GetConf(ctx)
+	searchResults, err := lib.SearchWithOffset(ctx, db, defaultFilter+" "+query, numEntries, offset)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	var rows []table.Row
+	var entries []*data.HistoryEntry
+	for _, entry := range searchResults {
+		if config.FilterDuplicateCommands && entry != nil {
+			cmd := strings.TrimSpace(entry.Command)
+			if seenCommands[cmd] {
+				continue
+			}
+			seenCommands[cmd] = true
+		}
+		row, err := lib.BuildTableRow(ctx, columnNames, *entry, commandEscaper)
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("failed to build row for entry=%#v: %w", entry, err)
+		}
+		rows = append(rows, row)
+		entries = append(entries, entry)
+	}
+	return rows, entries, len(searchResults), nil
+}
+
 func commandEscaper(cmd string) string {
 	if !strings.Contains(cmd, "\n") && !strings.Contains(cmd, "\t") {
 		// No special escaping necessary
@@ -939,10 +1655,40 @@ func allocateQueryId() int {
 }
 
 func TuiQuery(ctx context.Context, shellName string, initialQueryArray []string) error {
+	for {
+		panicked, err := runTuiQuery(ctx, shellName, initialQueryArray)
+		if !panicked {
+			return err
+		}
+		// The TUI panicked (e.g. due to a rendering bug). The terminal has already been restored and
+		// the stack trace logged, so offer to relaunch with the same query rather than losing it.
+		fmt.Printf("hishtory's interactive search crashed (the stack trace was logged to ~/%s/hishtory.log). Relaunch with the same query? [y/N]", data.GetHishtoryPath())
+		reader := bufio.NewReader(os.Stdin)
+		resp, readErr := reader.ReadString('\n')
+		if readErr != nil || strings.TrimSpace(resp) != "y" {
+			return err
+		}
+		initialQueryArray = []string{CURRENT_QUERY_FOR_HIGHLIGHTING}
+	}
+}
+
+func runTuiQuery(ctx context.Context, shellName string, initialQueryArray []string) (panicked bool, err error) {
+	var p *tea.Program
+	defer func() {
+		if r := recover(); r != nil {
+			if p != nil {
+				// Restore the terminal so that the panic doesn't leave it in a broken state
+				_ = p.ReleaseTerminal()
+			}
+			hctx.GetLogger().Errorf("TUI panicked: %v\n%s", r, string(debug.Stack()))
+			panicked = true
+			err = fmt.Errorf("hishtory TUI panicked: %v", r)
+		}
+	}()
 	initialQueryArray = splitQueryArray(initialQueryArray)
 	initialQueryWithEscaping, err := buildInitialQueryWithSearchEscaping(initialQueryArray)
 	if err != nil {
-		return err
+		return false, err
 	}
 	loadedKeyBindings = hctx.GetConf(ctx).KeyBindings.ToKeyMap()
 	configureColorProfile(ctx)
@@ -950,7 +1696,7 @@ func TuiQuery(ctx context.Context, shellName string, initialQueryArray []string)
 	if hctx.GetConf(ctx).FullScreenRendering {
 		additionalOptions = append(additionalOptions, tea.WithAltScreen())
 	}
-	p := tea.NewProgram(initialModel(ctx, shellName, initialQueryWithEscaping), additionalOptions...)
+	p = tea.NewProgram(initialModel(ctx, shellName, initialQueryWithEscaping), additionalOptions...)
 	// Async: Get the initial set of rows
 	go func() {
 		queryId := allocateQueryId()
@@ -1001,14 +1747,14 @@ func TuiQuery(ctx context.Context, shellName string, initialQueryArray []string)
 	// Blocking: Start the TUI
 	_, err = p.Run()
 	if err != nil {
-		return err
+		return false, err
 	}
 	if SELECTED_COMMAND == "" && os.Getenv("HISHTORY_TERM_INTEGRATION") != "" {
 		// Print out the initialQuery instead so that we don't clear the terminal (note that we don't use the escaped one here)
 		SELECTED_COMMAND = strings.Join(initialQueryArray, " ")
 	}
 	fmt.Printf("%s\n", SELECTED_COMMAND)
-	return nil
+	return false, nil
 }
 
 // TODO: support custom key bindings
@@ -15,6 +15,46 @@ func TestCalculateWordBoundaries(t *testing.T) {
 	require.Equal(t, []int{0, 3}, calculateWordBoundaries("foo    "))
 }
 
+func TestParseAtomForCompletion(t *testing.T) {
+	checkParse := func(query string, cursor int, expectedAtom, expectedPartial string, expectedValueStart int) {
+		atom, partial, valueStart, ok := parseAtomForCompletion(query, cursor)
+		require.True(t, ok)
+		require.Equal(t, expectedAtom, atom)
+		require.Equal(t, expectedPartial, partial)
+		require.Equal(t, expectedValueStart, valueStart)
+	}
+	checkParse("hostname:", 9, "hostname", "", 9)
+	checkParse("hostname:lap", 12, "hostname", "lap", 9)
+	checkParse("ls hostname:lap", 15, "hostname", "lap", 12)
+	checkParse("-hostname:lap", 13, "hostname", "lap", 10)
+	checkParse("cwd:foo\\ bar", 12, "cwd", "foo bar", 4)
+	checkParse("hostname:lap cwd:/tmp", 12, "hostname", "lap", 9)
+	checkParse("hostname:lap cwd:/tmp", 21, "cwd", "/tmp", 17)
+	for _, tc := range []struct {
+		query  string
+		cursor int
+	}{
+		{"ls", 2},
+		{"hostname", 8},
+		{":foo", 4},
+		{"hostname:lap", 5},
+		{"hostname:lap ", 13},
+		{"foo\\:bar", 8},
+	} {
+		_, _, _, ok := parseAtomForCompletion(tc.query, tc.cursor)
+		require.False(t, ok, "expected no completion context for %#v at cursor %d", tc.query, tc.cursor)
+	}
+}
+
+func TestEscapeAtomValue(t *testing.T) {
+	require.Equal(t, "foo", escapeAtomValue("foo"))
+	require.Equal(t, "foo\\ bar", escapeAtomValue("foo bar"))
+	require.Equal(t, "foo\\\\bar", escapeAtomValue("foo\\bar"))
+	require.Equal(t, "foo", unescapeAtomValue(escapeAtomValue("foo")))
+	require.Equal(t, "foo bar", unescapeAtomValue(escapeAtomValue("foo bar")))
+	require.Equal(t, "foo\\bar", unescapeAtomValue(escapeAtomValue("foo\\bar")))
+}
+
 func TestSanitizeEscapeCodes(t *testing.T) {
 	require.Equal(t, "foo", sanitizeEscapeCodes("foo"))
 	require.Equal(t, "foo\x1b[31mbar", sanitizeEscapeCodes("foo\x1b[31mbar"))
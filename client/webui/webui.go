@@ -2,13 +2,17 @@ package webui
 
 import (
 	"context"
+	"crypto/sha256"
 	"crypto/subtle"
 	"embed"
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"net"
 	"net/http"
-	"net/url"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/ddworken/hishtory/client/data"
 	"github.com/ddworken/hishtory/client/hctx"
@@ -20,33 +24,151 @@ import (
 //go:embed templates
 var templateFiles embed.FS
 
+// A time-limited read-only share token for the web UI, which grants a guest browsable access to a
+// filtered slice of history without sharing the basic auth credentials
+type shareToken struct {
+	// The secret token value, passed by guests via the `token` query parameter (or the cookie
+	// that gets set from it)
+	Secret string
+	// A filter that is prepended to every search that the guest runs, e.g. "cwd:~/infra"
+	Filter string
+	// When the token stops working
+	ExpiresAt time.Time
+}
+
+type contextKey string
+
+// The context key under which the auth middleware stores the share token's filter for requests
+// authenticated via a share token
+const guestFilterContextKey contextKey = "hishtory-guest-filter"
+
+// The context key under which the scope middleware stores the mandatory `--scope` filter, which is
+// ANDed onto every search regardless of how the request was authenticated
+const scopeFilterContextKey contextKey = "hishtory-scope-filter"
+
+const shareTokenCookieName = "hishtory-share-token"
+
+// The number of entries retrieved per page, with further pages loaded via infinite scroll
+const webUiPageSize = 100
+
 type webUiData struct {
 	SearchQuery   string
 	SearchResults [][]string
 	ColumnNames   []string
+	// Whether there (likely) is another page of results, and the offset to request it at
+	HasMore    bool
+	NextOffset int
+	// The configured TUI color scheme, reused for the web UI's accent colors
+	ColorScheme hctx.ColorScheme
 }
 
-func getTableRowsForDisplay(ctx context.Context, searchQuery string) ([][]string, error) {
-	results, err := lib.Search(ctx, hctx.GetDb(ctx), searchQuery, 100)
+// Applies the guest and scope filters from the request context to the given search query, so that
+// share-token guests and --scope'd servers only ever search their slice of history
+func effectiveSearchQuery(ctx context.Context, searchQuery string) string {
+	if guestFilter, ok := ctx.Value(guestFilterContextKey).(string); ok {
+		// This request was authenticated via a read-only share token, so restrict it to the
+		// token's slice of history
+		searchQuery = guestFilter + " " + searchQuery
+	}
+	if scopeFilter, ok := ctx.Value(scopeFilterContextKey).(string); ok {
+		// The server was started with a mandatory --scope filter, so restrict every search to it
+		searchQuery = scopeFilter + " " + searchQuery
+	}
+	return searchQuery
+}
+
+func getTableRowsForDisplay(ctx context.Context, searchQuery string, offset int) ([][]string, error) {
+	results, err := lib.SearchWithOffset(ctx, hctx.GetDb(ctx), effectiveSearchQuery(ctx, searchQuery), webUiPageSize, offset)
 	if err != nil {
 		return nil, err
 	}
 	return buildTableRows(ctx, results)
 }
 
-func htmx_resultsTable(w http.ResponseWriter, r *http.Request) {
+// Tracks sqlite's data_version change counter so that repeated identical queries (e.g. from
+// auto-refreshing dashboards) can be answered with a 304 instead of re-running the full search
+var dbChangeState struct {
+	mu sync.Mutex
+	// The last observed value of `PRAGMA data_version`, which sqlite increments whenever
+	// another connection (i.e. the recording hishtory client) commits a change
+	dataVersion int64
+	// When dataVersion was last observed to change, used for the Last-Modified header
+	changedAt time.Time
+}
+
+// Returns the current change counter for the local history DB and when it last changed. Returns
+// a zero counter if the counter could not be read, in which case caching is skipped.
+func getDbChangeCounter(ctx context.Context) (int64, time.Time) {
+	var dataVersion int64
+	if err := hctx.GetDb(ctx).Raw("PRAGMA data_version").Scan(&dataVersion).Error; err != nil {
+		return 0, time.Time{}
+	}
+	dbChangeState.mu.Lock()
+	defer dbChangeState.mu.Unlock()
+	if dataVersion != dbChangeState.dataVersion {
+		dbChangeState.dataVersion = dataVersion
+		dbChangeState.changedAt = time.Now()
+	}
+	return dataVersion, dbChangeState.changedAt
+}
+
+// Sets the ETag and Last-Modified caching headers for the given search, and returns true if the
+// client already has a current copy (in which case a 304 was written and the handler should
+// return without re-running the search)
+func handleCachingHeaders(w http.ResponseWriter, r *http.Request, searchQuery string, offset int) bool {
+	dataVersion, changedAt := getDbChangeCounter(r.Context())
+	if dataVersion == 0 {
+		return false
+	}
+	queryHash := sha256.Sum256(fmt.Appendf(nil, "%s\x00%d", effectiveSearchQuery(r.Context(), searchQuery), offset))
+	etag := fmt.Sprintf("\"%d-%x\"", dataVersion, queryHash[:8])
+	// no-cache makes browsers revalidate with If-None-Match on every request, rather than
+	// serving stale results without checking
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", changedAt.UTC().Format(http.TimeFormat))
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	if ims, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !changedAt.Truncate(time.Second).After(ims) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// The response format of the live search endpoint, consumed by the debounced fetch-based
+// search in the web UI
+type searchApiResponse struct {
+	SearchQuery string     `json:"search_query"`
+	ColumnNames []string   `json:"column_names"`
+	Rows        [][]string `json:"rows"`
+	HasMore     bool       `json:"has_more"`
+	NextOffset  int        `json:"next_offset"`
+}
+
+func apiSearchHandler(w http.ResponseWriter, r *http.Request) {
 	searchQuery := r.URL.Query().Get("q")
-	tableRows, err := getTableRowsForDisplay(r.Context(), searchQuery)
+	offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+	if err != nil {
+		offset = 0
+	}
+	if handleCachingHeaders(w, r, searchQuery, offset) {
+		return
+	}
+	tableRows, err := getTableRowsForDisplay(r.Context(), searchQuery, offset)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		panic(err)
 	}
-	w.Header().Add("Content-Type", "text/html")
-	w.Header().Add("HX-Replace-Url", getNewUrl(r, searchQuery))
-	err = getTemplates().ExecuteTemplate(w, "resultsTable.html", webUiData{
-		SearchQuery:   searchQuery,
-		SearchResults: tableRows,
-		ColumnNames:   hctx.GetConf(r.Context()).DisplayedColumns,
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(searchApiResponse{
+		SearchQuery: searchQuery,
+		ColumnNames: hctx.GetConf(r.Context()).DisplayedColumns,
+		Rows:        tableRows,
+		HasMore:     len(tableRows) == webUiPageSize,
+		NextOffset:  offset + len(tableRows),
 	})
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -54,26 +176,12 @@ func htmx_resultsTable(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func getNewUrl(r *http.Request, searchQuery string) string {
-	urlStr := r.Header.Get("Hx-Current-Url")
-	if urlStr == "" {
-		// In this function we purposefully want to silence any errors since updating the URL is non-critical, so
-		// we always return an empty string rather than handling the error.
-		return ""
-	}
-	url, err := url.Parse(urlStr)
-	if err != nil {
-		return ""
-	}
-	q := url.Query()
-	q.Set("q", searchQuery)
-	url.RawQuery = q.Encode()
-	return url.String()
-}
-
 func webuiHandler(w http.ResponseWriter, r *http.Request) {
 	searchQuery := r.URL.Query().Get("q")
-	tableRows, err := getTableRowsForDisplay(r.Context(), searchQuery)
+	if handleCachingHeaders(w, r, searchQuery, 0) {
+		return
+	}
+	tableRows, err := getTableRowsForDisplay(r.Context(), searchQuery, 0)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		panic(err)
@@ -83,6 +191,9 @@ func webuiHandler(w http.ResponseWriter, r *http.Request) {
 		SearchQuery:   searchQuery,
 		SearchResults: tableRows,
 		ColumnNames:   hctx.GetConf(r.Context()).DisplayedColumns,
+		HasMore:       len(tableRows) == webUiPageSize,
+		NextOffset:    len(tableRows),
+		ColorScheme:   hctx.GetConf(r.Context()).ColorScheme,
 	})
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -107,9 +218,28 @@ func buildTableRows(ctx context.Context, entries []*data.HistoryEntry) ([][]stri
 	return ret, nil
 }
 
-func withBasicAuth(expectedUsername, expectedPassword string) func(h http.Handler) http.Handler {
+func withBasicAuth(expectedUsername, expectedPassword string, token *shareToken) func(h http.Handler) http.Handler {
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token != nil && time.Now().Before(token.ExpiresAt) {
+				// Accept the token either as a query parameter (from the share URL) or from the
+				// cookie that gets set below, so that follow-up searches stay authenticated
+				presentedToken := r.URL.Query().Get("token")
+				fromCookie := false
+				if presentedToken == "" {
+					if cookie, err := r.Cookie(shareTokenCookieName); err == nil {
+						presentedToken = cookie.Value
+						fromCookie = true
+					}
+				}
+				if secureStringEquals(presentedToken, token.Secret) {
+					if !fromCookie {
+						http.SetCookie(w, &http.Cookie{Name: shareTokenCookieName, Value: token.Secret, Expires: token.ExpiresAt, HttpOnly: true})
+					}
+					h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), guestFilterContextKey, token.Filter)))
+					return
+				}
+			}
 			username, password, hasCreds := r.BasicAuth()
 			if !hasCreds || !secureStringEquals(username, expectedUsername) || !secureStringEquals(password, expectedPassword) {
 				w.Header().Add("WWW-Authenticate", "Basic realm=\"User Visible Realm\"")
@@ -121,11 +251,24 @@ func withBasicAuth(expectedUsername, expectedPassword string) func(h http.Handle
 	}
 }
 
+// Middleware that stores the mandatory scope filter in the request context, so that every search
+// is restricted to it no matter how the request was authenticated
+func withScopeFilter(scopeFilter string) func(h http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		if scopeFilter == "" {
+			return h
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), scopeFilterContextKey, scopeFilter)))
+		})
+	}
+}
+
 func secureStringEquals(s1, s2 string) bool {
 	return subtle.ConstantTimeCompare([]byte(s1), []byte(s2)) == 1
 }
 
-func StartWebUiServer(ctx context.Context, port int, disableAuth bool, overridenUsername, overridenPassword string) error {
+func StartWebUiServer(ctx context.Context, port int, disableAuth bool, overridenUsername, overridenPassword, shareFilter string, shareTtl time.Duration, scopeFilter string) error {
 	username := "hishtory"
 	// Note that uuid.NewRandom() uses crypto/rand and returns a UUID with 122 bits of security
 	password := uuid.Must(uuid.NewRandom()).String()
@@ -133,19 +276,34 @@ func StartWebUiServer(ctx context.Context, port int, disableAuth bool, overriden
 		username = overridenUsername
 		password = overridenPassword
 	}
-	wba := withBasicAuth(username, password)
+	var token *shareToken
+	if shareFilter != "" {
+		token = &shareToken{
+			Secret:    uuid.Must(uuid.NewRandom()).String(),
+			Filter:    shareFilter,
+			ExpiresAt: time.Now().Add(shareTtl),
+		}
+	}
+	wba := withBasicAuth(username, password, token)
 	if disableAuth {
 		// No-op wrapper that doesn't enforce auth
 		wba = func(h http.Handler) http.Handler { return h }
 	}
-	http.Handle("/", wba(http.HandlerFunc(webuiHandler)))
-	http.Handle("/htmx/results-table", wba(http.HandlerFunc(htmx_resultsTable)))
+	wsf := withScopeFilter(scopeFilter)
+	http.Handle("/", wba(wsf(http.HandlerFunc(webuiHandler))))
+	http.Handle("/api/search", wba(wsf(http.HandlerFunc(apiSearchHandler))))
 
 	server := http.Server{
 		BaseContext: func(l net.Listener) context.Context { return ctx },
 		Addr:        fmt.Sprintf(":%d", port),
 	}
 	fmt.Printf("Starting web server on %s...\n", server.Addr)
+	if scopeFilter != "" {
+		fmt.Printf("Restricting all searches to the scope %#v\n", scopeFilter)
+	}
 	fmt.Printf("Username: %s\nPassword: %s\n", username, password)
+	if token != nil {
+		fmt.Printf("Read-only share URL (filter %#v, expires %s): http://localhost:%d/?token=%s\n", token.Filter, token.ExpiresAt.Format(time.RFC3339), port, token.Secret)
+	}
 	return server.ListenAndServe()
 }
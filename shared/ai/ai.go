@@ -107,6 +107,207 @@ func GetAiSuggestionsViaOpenAiApi(apiEndpoint, query, shellName, osName, overrid
 	return ret, apiResp.Usage, nil
 }
 
+const DefaultOllamaEndpoint = "http://localhost:11434/api/chat"
+
+// The request schema for Ollama (and llama.cpp) style chat endpoints. Note that unlike the OpenAI
+// schema, this doesn't support requesting multiple completions in a single request.
+type ollamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []openAiMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+}
+
+type ollamaResponse struct {
+	Model   string        `json:"model"`
+	Message openAiMessage `json:"message"`
+	Done    bool          `json:"done"`
+}
+
+// Query an Ollama/llama.cpp style chat endpoint for AI suggestions. These endpoints are generally
+// self-hosted, so unlike the OpenAI code path this requires no API key. Since the Ollama schema only
+// supports one completion per request, we issue repeated requests until we have numberCompletions
+// unique suggestions (bounded to avoid hammering slow local models).
+func GetAiSuggestionsViaOllamaApi(apiEndpoint, query, shellName, osName, model string, numberCompletions int) ([]string, error) {
+	if results := TestOnlyOverrideAiSuggestions[query]; len(results) > 0 {
+		return results, nil
+	}
+	hctx.GetLogger().Infof("Running Ollama query for %#v", query)
+	if model == "" {
+		model = os.Getenv("OLLAMA_MODEL")
+	}
+	if model == "" {
+		return nil, fmt.Errorf("no Ollama model specified, please set the OLLAMA_MODEL environment variable")
+	}
+	openAiReq := createOpenAiRequest(query, shellName, osName, model, numberCompletions)
+	apiReqStr, err := json.Marshal(ollamaRequest{
+		Model:    model,
+		Messages: openAiReq.Messages,
+		Stream:   false,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize JSON for Ollama API: %w", err)
+	}
+	ret := make([]string, 0)
+	for i := 0; i < numberCompletions; i++ {
+		req, err := http.NewRequest(http.MethodPost, apiEndpoint, bytes.NewBuffer(apiReqStr))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Ollama API request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := lib.GetHttpClient().Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query Ollama API at %s (is your local LLM server running?): %w", apiEndpoint, err)
+		}
+		bodyText, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Ollama API response: %w", err)
+		}
+		var apiResp ollamaResponse
+		err = json.Unmarshal(bodyText, &apiResp)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse Ollama API response=%#v: %w", string(bodyText), err)
+		}
+		if apiResp.Message.Content == "" {
+			return nil, fmt.Errorf("Ollama API returned an empty completion, resp body=%#v, resp.StatusCode=%d", string(bodyText), resp.StatusCode)
+		}
+		if !slices.Contains(ret, apiResp.Message.Content) {
+			ret = append(ret, apiResp.Message.Content)
+		} else {
+			// The model is repeating itself, so stop early rather than issuing more requests that
+			// are likely to return duplicate suggestions
+			break
+		}
+	}
+	hctx.GetLogger().Infof("For Ollama query=%#v ==> %#v", query, ret)
+	return ret, nil
+}
+
+var TestOnlyOverrideAiExplanations map[string]string = make(map[string]string)
+
+// Ask an OpenAI compatible chat endpoint to explain what the given shell command does. Unlike
+// suggestions, the response is free-form prose rather than an executable shell command.
+func GetAiExplanationViaOpenAiApi(apiEndpoint, command, shellName, osName, overriddenOpenAiModel string) (string, OpenAiUsage, error) {
+	if explanation := TestOnlyOverrideAiExplanations[command]; explanation != "" {
+		return explanation, OpenAiUsage{}, nil
+	}
+	hctx.GetLogger().Infof("Running OpenAI explanation query for %#v", command)
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	if apiKey == "" && apiEndpoint == DefaultOpenAiEndpoint {
+		return "", OpenAiUsage{}, fmt.Errorf("OPENAI_API_KEY environment variable is not set")
+	}
+	apiReqStr, err := json.Marshal(createOpenAiExplanationRequest(command, shellName, osName, overriddenOpenAiModel))
+	if err != nil {
+		return "", OpenAiUsage{}, fmt.Errorf("failed to serialize JSON for OpenAI API: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, apiEndpoint, bytes.NewBuffer(apiReqStr))
+	if err != nil {
+		return "", OpenAiUsage{}, fmt.Errorf("failed to create OpenAI API request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	resp, err := lib.GetHttpClient().Do(req)
+	if err != nil {
+		return "", OpenAiUsage{}, fmt.Errorf("failed to query OpenAI API: %w", err)
+	}
+	defer resp.Body.Close()
+	bodyText, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", OpenAiUsage{}, fmt.Errorf("failed to read OpenAI API response: %w", err)
+	}
+	if resp.StatusCode == 429 {
+		return "", OpenAiUsage{}, fmt.Errorf("received 429 error code from OpenAI (is your API key valid?)")
+	}
+	var apiResp openAiResponse
+	err = json.Unmarshal(bodyText, &apiResp)
+	if err != nil {
+		return "", OpenAiUsage{}, fmt.Errorf("failed to parse OpenAI API response=%#v: %w", string(bodyText), err)
+	}
+	if len(apiResp.Choices) == 0 {
+		return "", OpenAiUsage{}, fmt.Errorf("OpenAI API returned zero choices, parsed resp=%#v, resp body=%#v, resp.StatusCode=%d", apiResp, bodyText, resp.StatusCode)
+	}
+	return apiResp.Choices[0].Message.Content, apiResp.Usage, nil
+}
+
+// Ask an Ollama/llama.cpp style chat endpoint to explain what the given shell command does.
+func GetAiExplanationViaOllamaApi(apiEndpoint, command, shellName, osName, model string) (string, error) {
+	if explanation := TestOnlyOverrideAiExplanations[command]; explanation != "" {
+		return explanation, nil
+	}
+	hctx.GetLogger().Infof("Running Ollama explanation query for %#v", command)
+	if model == "" {
+		model = os.Getenv("OLLAMA_MODEL")
+	}
+	if model == "" {
+		return "", fmt.Errorf("no Ollama model specified, please set the OLLAMA_MODEL environment variable")
+	}
+	openAiReq := createOpenAiExplanationRequest(command, shellName, osName, model)
+	apiReqStr, err := json.Marshal(ollamaRequest{
+		Model:    model,
+		Messages: openAiReq.Messages,
+		Stream:   false,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize JSON for Ollama API: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, apiEndpoint, bytes.NewBuffer(apiReqStr))
+	if err != nil {
+		return "", fmt.Errorf("failed to create Ollama API request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := lib.GetHttpClient().Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to query Ollama API at %s (is your local LLM server running?): %w", apiEndpoint, err)
+	}
+	defer resp.Body.Close()
+	bodyText, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read Ollama API response: %w", err)
+	}
+	var apiResp ollamaResponse
+	err = json.Unmarshal(bodyText, &apiResp)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse Ollama API response=%#v: %w", string(bodyText), err)
+	}
+	if apiResp.Message.Content == "" {
+		return "", fmt.Errorf("Ollama API returned an empty explanation, resp body=%#v, resp.StatusCode=%d", string(bodyText), resp.StatusCode)
+	}
+	return apiResp.Message.Content, nil
+}
+
+func createOpenAiExplanationRequest(command, shellName, osName, overriddenOpenAiModel string) openAiRequest {
+	if osName == "" {
+		osName = "Linux"
+	}
+	if shellName == "" {
+		shellName = "bash"
+	}
+
+	model := "gpt-4o-mini"
+	if envModel := os.Getenv("OPENAI_API_MODEL"); envModel != "" {
+		model = envModel
+	}
+	if overriddenOpenAiModel != "" {
+		model = overriddenOpenAiModel
+	}
+
+	systemPrompt := "You are an expert programmer that loves to help people understand shell commands. " +
+		"You will be given a shell command that was run in " + shellName + " on " + osName +
+		" and you will reply with a concise plain-text explanation of what it does, covering each " +
+		"flag and argument. Do not use markdown formatting in your reply."
+
+	return openAiRequest{
+		Model:             model,
+		NumberCompletions: 1,
+		Messages: []openAiMessage{
+			{Role: "system", Content: systemPrompt},
+			{Role: "user", Content: "Explain this command: " + command},
+		},
+	}
+}
+
 type AiSuggestionRequest struct {
 	DeviceId          string `json:"device_id"`
 	UserId            string `json:"user_id"`
@@ -25,6 +25,17 @@ type EncHistoryEntry struct {
 	IsFromSameDevice bool `json:"is_from_same_device"`
 }
 
+// Represents an encrypted per-user settings document, used for syncing selected config
+// options (e.g. displayed columns and the color scheme) across devices. Like history
+// entries, the contents are encrypted client-side so the backend can't read them.
+type EncSettings struct {
+	UserId        string `json:"user_id" gorm:"uniqueIndex"`
+	EncryptedData []byte `json:"enc_data"`
+	Nonce         []byte `json:"nonce"`
+	// When this settings document was last updated
+	Date time.Time `json:"time"`
+}
+
 // Represents a request to get all history entries from a given device. Used as part of bootstrapping
 // a new device.
 type DumpRequest struct {
@@ -65,6 +76,16 @@ type DeletionRequest struct {
 	ReadCount int `json:"read_count"`
 }
 
+// The status of pending deletion requests for a single destination device. Used by
+// `hishtory redact --verify` to report which devices have applied a deletion.
+type DeletionRequestStatus struct {
+	// The device that the deletion requests are waiting on
+	DeviceId string `json:"device_id"`
+	// How many times that device has downloaded the deletion requests. Zero means the
+	// device has not yet applied the deletion.
+	ReadCount int `json:"read_count"`
+}
+
 // Identifies a list of history entries that should be deleted
 type MessageIdentifiers struct {
 	Ids []MessageIdentifier `json:"message_ids"`
@@ -108,6 +129,63 @@ type Feedback struct {
 	Feedback string    `json:"feedback"`
 }
 
+// Represents a team: a shared read-only pool of history entries that multiple users can link
+// their accounts into. Entries only end up in the pool when a member explicitly shares them, and
+// are encrypted client-side with a team key, so the backend can't read them.
+type Team struct {
+	TeamId      string    `json:"team_id" gorm:"primaryKey"`
+	OwnerUserId string    `json:"owner_user_id" gorm:"not null"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Represents a user's membership in a team
+type TeamMember struct {
+	TeamId   string    `json:"team_id" gorm:"uniqueIndex:team_membership_idx"`
+	UserId   string    `json:"user_id" gorm:"uniqueIndex:team_membership_idx"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// Represents an encrypted history entry that a member explicitly shared into a team's pool
+type TeamHistoryEntry struct {
+	TeamId         string    `json:"team_id" gorm:"index"`
+	SharedByUserId string    `json:"shared_by_user_id"`
+	EncryptedData  []byte    `json:"enc_data"`
+	Nonce          []byte    `json:"nonce"`
+	EncryptedId    string    `json:"encrypted_id"`
+	Date           time.Time `json:"time"`
+}
+
+// Represents a user's published sharing public key, which other users seal entries to for
+// `hishtory share`. Publishing the key is what opts a user in to receiving shared entries.
+type SharingPublicKey struct {
+	UserId    string    `json:"user_id" gorm:"uniqueIndex"`
+	PublicKey []byte    `json:"public_key"`
+	Date      time.Time `json:"date"`
+}
+
+// Represents a history entry that one user shared with another. The entry is sealed to the
+// recipient's sharing public key, so the backend can't read it. SenderUserId is claimed by the
+// sender and is not authenticated; it is only used for tagging the entry on the receiving side.
+type SharedHistoryEntry struct {
+	RecipientUserId string    `json:"recipient_user_id" gorm:"index"`
+	SenderUserId    string    `json:"sender_user_id"`
+	EncryptedData   []byte    `json:"enc_data"`
+	Date            time.Time `json:"date"`
+}
+
+// The request body for the manifest diffing endpoint: a compact list of the entry IDs that the
+// client has locally. Used by `hishtory reupload` so that it only uploads the entries that the
+// backend is actually missing, rather than re-encrypting and re-uploading everything.
+type ManifestDiffRequest struct {
+	EntryIds []string `json:"entry_ids"`
+}
+
+// The response from the manifest diffing endpoint: the subset of the submitted entry IDs that the
+// backend has no record of for this user
+type ManifestDiffResponse struct {
+	MissingEntryIds []string `json:"missing_entry_ids"`
+}
+
 // Response from submitting new history entries. Contains deletion requests and dump requests to avoid
 // extra round-trip requests to the hishtory backend.
 type SubmitResponse struct {
@@ -82,6 +82,7 @@ func BackupAndRestoreWithId(t testing.TB, id string) func() {
 		path.Join(homedir, data.GetHishtoryPath(), DB_WAL_PATH),
 		path.Join(homedir, data.GetHishtoryPath(), DB_SHM_PATH),
 		path.Join(homedir, data.GetHishtoryPath(), data.CONFIG_PATH),
+		path.Join(homedir, data.GetHishtoryPath(), data.CONFIG_TOML_PATH),
 		path.Join(homedir, data.GetHishtoryPath(), "config.sh"),
 		path.Join(homedir, data.GetHishtoryPath(), "config.zsh"),
 		path.Join(homedir, data.GetHishtoryPath(), "config.fish"),
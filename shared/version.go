@@ -6,6 +6,13 @@ import (
 	"strconv"
 )
 
+// ProtocolVersion is the version of the client<->server wire protocol (the JSON object formats
+// exchanged over the API). Bump this whenever an object format changes in a way that old clients
+// cannot decode. Servers advertise their version via the X-Hishtory-Protocol-Version response
+// header, which clients use to turn decode failures against newer servers into a clear "please
+// update hishtory on this device" message instead of an opaque JSON error.
+const ProtocolVersion = 1
+
 type ParsedVersion struct {
 	MajorVersion int
 	MinorVersion int